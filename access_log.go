@@ -0,0 +1,261 @@
+package echox
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	AccessLogJSON = "json"
+	AccessLogText = "text"
+)
+
+type (
+	// AccessLogConfig 请求日志的配置
+	AccessLogConfig struct {
+		// 跳过日志
+		Skipper middleware.Skipper
+
+		// 输出的字段
+		// 非必须 默认和Echo的请求日志相同，配置了区域、租户和构建信息时加上区域、租户和版本
+		// 可以使用的字段：time、id、remote_ip、host、method、uri、path、route、referer、user_agent、
+		// status、error、latency、latency_human、bytes_in、bytes_out、region、tenant、user、version、instance
+		Fields []string
+
+		// 输出格式，json或者text
+		// 非必须 默认值是json
+		Format string
+
+		// 不记录日志的路径，按路径前缀匹配
+		// 非必须 默认跳过Kubernetes探针和指标
+		Exclude []string
+
+		// 只记录耗时超过阈值的请求，5xx的请求总是记录
+		// 非必须 默认全部记录
+		SlowThreshold time.Duration
+
+		// 采样比例
+		// 非必须 默认值是1，全部记录
+		SampleRate float64
+
+		// 按路由配置的采样比例，用于请求量大的接口，比如"/api/users/:id": 0.01
+		Sample map[string]float64
+
+		// 输出
+		// 非必须 默认是标准输出
+		Output io.Writer
+
+		// 用来解析user字段
+		// 非必须 默认使用EchoConfig的JWT
+		JWT *JWTConfig
+	}
+)
+
+var (
+	// DefaultAccessLogConfig 默认配置
+	DefaultAccessLogConfig = AccessLogConfig{
+		Skipper: middleware.DefaultSkipper,
+		Fields: []string{
+			"time", "id", "remote_ip", "host", "method", "uri", "user_agent",
+			"status", "error", "latency", "latency_human", "bytes_in", "bytes_out",
+		},
+		Format:     AccessLogJSON,
+		Exclude:    []string{"/healthz", "/readyz", "/startupz", "/metrics"},
+		SampleRate: 1,
+	}
+)
+
+// AccessLog 请求日志中间件
+func AccessLog() echo.MiddlewareFunc {
+	return AccessLogWithConfig(DefaultAccessLogConfig)
+}
+
+// AccessLogWithConfig 请求日志中间件
+// 可以选择字段和格式，按路径排除，只记录慢请求，以及按比例采样
+func AccessLogWithConfig(config AccessLogConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultAccessLogConfig.Skipper
+	}
+	if 0 == len(config.Fields) {
+		config.Fields = DefaultAccessLogConfig.Fields
+	}
+	if AccessLogText != config.Format {
+		config.Format = AccessLogJSON
+	}
+	if nil == config.Exclude {
+		config.Exclude = DefaultAccessLogConfig.Exclude
+	}
+	if 0 >= config.SampleRate {
+		config.SampleRate = DefaultAccessLogConfig.SampleRate
+	}
+	if nil == config.Output {
+		config.Output = os.Stdout
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) || config.excluded(c.Request().URL.Path) {
+				return next(c)
+			}
+
+			start := time.Now()
+			if err = next(c); nil != err {
+				// 先处理错误，日志中才能拿到最终的状态码
+				c.Error(err)
+			}
+			latency := time.Since(start)
+			if !config.sampled(c, latency) {
+				return
+			}
+
+			var buffer bytes.Buffer
+			config.write(&buffer, c, err, start, latency)
+			_, _ = config.Output.Write(buffer.Bytes())
+
+			return
+		}
+	}
+}
+
+func (alc *AccessLogConfig) excluded(path string) bool {
+	for _, prefix := range alc.Exclude {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sampled 是否记录这个请求
+func (alc *AccessLogConfig) sampled(c echo.Context, latency time.Duration) bool {
+	if http.StatusInternalServerError <= c.Response().Status {
+		return true
+	}
+	if latency < alc.SlowThreshold {
+		return false
+	}
+
+	rate := alc.SampleRate
+	if routeRate, ok := alc.Sample[c.Path()]; ok {
+		rate = routeRate
+	}
+
+	return 1 <= rate || rand.Float64() < rate
+}
+
+func (alc *AccessLogConfig) write(buffer *bytes.Buffer, c echo.Context, err error, start time.Time, latency time.Duration) {
+	if AccessLogJSON == alc.Format {
+		buffer.WriteByte('{')
+	}
+	for i, field := range alc.Fields {
+		value, quoted := alc.field(c, field, err, start, latency)
+		if AccessLogJSON == alc.Format {
+			if 0 != i {
+				buffer.WriteByte(',')
+			}
+			buffer.WriteString(jsonString(field))
+			buffer.WriteByte(':')
+			if quoted {
+				value = jsonString(value)
+			}
+		} else {
+			if 0 != i {
+				buffer.WriteByte(' ')
+			}
+			buffer.WriteString(field)
+			buffer.WriteByte('=')
+			if quoted && ("" == value || strings.ContainsAny(value, " \"=")) {
+				value = strconv.Quote(value)
+			}
+		}
+		buffer.WriteString(value)
+	}
+	if AccessLogJSON == alc.Format {
+		buffer.WriteByte('}')
+	}
+	buffer.WriteByte('\n')
+}
+
+func jsonString(value string) string {
+	quoted, _ := json.Marshal(value)
+
+	return string(quoted)
+}
+
+// field 字段的值，quoted表示是不是字符串
+func (alc *AccessLogConfig) field(c echo.Context, field string, err error, start time.Time, latency time.Duration) (value string, quoted bool) {
+	req := c.Request()
+	rsp := c.Response()
+
+	quoted = true
+	switch field {
+	case "time":
+		value = start.Format(time.RFC3339Nano)
+	case "id":
+		value = req.Header.Get(echo.HeaderXRequestID)
+		if "" == value {
+			value = rsp.Header().Get(echo.HeaderXRequestID)
+		}
+	case "remote_ip":
+		value = c.RealIP()
+	case "host":
+		value = req.Host
+	case "method":
+		value = req.Method
+	case "uri":
+		value = req.RequestURI
+	case "path":
+		value = req.URL.Path
+	case "route":
+		value = c.Path()
+	case "referer":
+		value = req.Referer()
+	case "user_agent":
+		value = req.UserAgent()
+	case "status":
+		value, quoted = strconv.Itoa(rsp.Status), false
+	case "error":
+		if nil != err {
+			value = err.Error()
+		}
+	case "latency":
+		value, quoted = strconv.FormatInt(int64(latency), 10), false
+	case "latency_human":
+		value = latency.String()
+	case "bytes_in":
+		length := req.ContentLength
+		if 0 > length {
+			length = 0
+		}
+		value, quoted = strconv.FormatInt(length, 10), false
+	case "bytes_out":
+		value, quoted = strconv.FormatInt(rsp.Size, 10), false
+	case "region":
+		value = RegionOf(c)
+	case "tenant":
+		value = TenantOf(c)
+	case "version":
+		value = appVersion()
+	case "instance":
+		value = instanceId
+	case "user":
+		if nil != alc.JWT {
+			value = userIdOf(&EchoContext{Context: c, JWT: alc.JWT})
+		}
+	default:
+		value = req.Header.Get(field)
+	}
+
+	return
+}
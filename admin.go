@@ -0,0 +1,266 @@
+package echox
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type (
+	// AdminConfig 管理接口的配置
+	AdminConfig struct {
+		// 管理接口的路径
+		// 非必须 默认值是"/admin"
+		BasePath string
+
+		// 管理接口的中间件，用来做认证和授权
+		// 必须字段 管理接口不允许匿名访问
+		Middlewares []echo.MiddlewareFunc
+
+		// 通过管理接口切换配置后的保护
+		// 非必须 默认值是DefaultSwitchGuard
+		SwitchGuard *SwitchGuard
+	}
+
+	// AdminRoute 注册的路由
+	AdminRoute struct {
+		Method    string   `json:"method"`
+		Path      string   `json:"path"`
+		Handler   string   `json:"handler"`
+		Name      string   `json:"name,omitempty"`
+		Auth      string   `json:"auth,omitempty"`
+		Roles     []string `json:"roles,omitempty"`
+		Scopes    []string `json:"scopes,omitempty"`
+		Public    bool     `json:"public,omitempty"`
+		RateLimit string   `json:"rateLimit,omitempty"`
+		Timeout   string   `json:"timeout,omitempty"`
+		Examples  []string `json:"examples,omitempty"`
+	}
+)
+
+var (
+	logLevels = map[log.Lvl]string{
+		log.DEBUG: "debug",
+		log.INFO:  "info",
+		log.WARN:  "warn",
+		log.ERROR: "error",
+		log.OFF:   "off",
+	}
+
+	// DefaultAdminConfig 默认配置
+	DefaultAdminConfig = AdminConfig{
+		BasePath: "/admin",
+	}
+)
+
+func (ac *AdminConfig) mount(e *echo.Echo) {
+	if "" == ac.BasePath {
+		ac.BasePath = DefaultAdminConfig.BasePath
+	}
+	if 0 == len(ac.Middlewares) {
+		panic("echo: admin requires middlewares for authentication")
+	}
+
+	g := e.Group(ac.BasePath, ac.Middlewares...)
+	g.GET("/routes", ac.routes)
+	g.GET("/openapi.json", ac.openAPI)
+	g.GET("/slo", ac.slo)
+	g.GET("/config", ac.config)
+	g.GET("/build", ac.build)
+	g.GET("/instance", ac.instance)
+	g.GET("/errors", ac.errors)
+	g.DELETE("/errors", ac.clearErrors)
+	g.GET("/scopes", ac.scopes)
+	g.GET("/log/level", ac.logLevel)
+	g.PUT("/log/level", ac.setLogLevel)
+	g.GET("/routes/disabled", ac.disabledRoutes)
+	g.PUT("/routes/disabled", ac.disableRoute)
+	g.DELETE("/routes/disabled", ac.enableRoute)
+	g.GET("/config/staged", ac.staged)
+	g.PUT("/config/staged", ac.stage)
+	g.POST("/config/switch", ac.switchConfig)
+	g.POST("/config/rollback", ac.rollbackConfig)
+	g.GET("/cron", ac.cronJobs)
+	g.POST("/cron/:name", ac.triggerCron)
+}
+
+func (ac *AdminConfig) routes(c echo.Context) error {
+	registered := c.Echo().Routes()
+	routes := make([]AdminRoute, 0, len(registered))
+	for _, r := range registered {
+		route := AdminRoute{Method: r.Method, Path: r.Path, Handler: r.Name}
+		if metadata, ok := RouteOf(r.Method, r.Path); ok {
+			route.Name = metadata.Name
+			route.Auth = metadata.Auth
+			route.Roles = metadata.Roles
+			route.Scopes = metadata.Scopes
+			route.Public = metadata.Public
+			route.RateLimit = metadata.RateLimit
+			if 0 < metadata.Timeout {
+				route.Timeout = metadata.Timeout.String()
+			}
+			route.Examples = sortedExamples(metadata.Examples)
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+
+		return routes[i].Method < routes[j].Method
+	})
+
+	return c.JSON(http.StatusOK, routes)
+}
+
+func (ac *AdminConfig) config(c echo.Context) error {
+	reloadMutex.Lock()
+	dumped := DumpConfig(applied)
+	reloadMutex.Unlock()
+
+	return c.JSON(http.StatusOK, dumped)
+}
+
+// scopes 权限覆盖检查，管理接口使用自己的中间件认证，不参与检查
+func (ac *AdminConfig) scopes(c echo.Context) error {
+	return c.JSON(http.StatusOK, ScopeCoverage(c.Echo(), ScopeCoverageConfig{Ignore: []string{ac.BasePath}}))
+}
+
+func (ac *AdminConfig) openAPI(c echo.Context) error {
+	build := Build()
+
+	return c.JSON(http.StatusOK, OpenAPIOf(build.Module, build.Version))
+}
+
+func (ac *AdminConfig) slo(c echo.Context) error {
+	return c.JSON(http.StatusOK, SLOMonitors())
+}
+
+func (ac *AdminConfig) build(c echo.Context) error {
+	return c.JSON(http.StatusOK, Build())
+}
+
+func (ac *AdminConfig) instance(c echo.Context) error {
+	reloadMutex.Lock()
+	info := instanceInfo(applied)
+	reloadMutex.Unlock()
+
+	return c.JSON(http.StatusOK, info)
+}
+
+func (ac *AdminConfig) errors(c echo.Context) error {
+	return c.JSON(http.StatusOK, RecentErrors())
+}
+
+func (ac *AdminConfig) clearErrors(c echo.Context) error {
+	if nil != recentErrors {
+		recentErrors.clear()
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ac *AdminConfig) logLevel(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"level": logLevels[c.Echo().Logger.Level()]})
+}
+
+func (ac *AdminConfig) setLogLevel(c echo.Context) (err error) {
+	body := struct {
+		Level string `json:"level"`
+	}{}
+	if err = c.Bind(&body); nil != err {
+		return
+	}
+	for lvl, name := range logLevels {
+		if strings.EqualFold(name, body.Level) {
+			c.Echo().Logger.SetLevel(lvl)
+
+			return c.NoContent(http.StatusNoContent)
+		}
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest, "不支持的日志级别")
+}
+
+func (ac *AdminConfig) disabledRoutes(c echo.Context) error {
+	return c.JSON(http.StatusOK, DisabledRoutes())
+}
+
+func (ac *AdminConfig) disableRoute(c echo.Context) (err error) {
+	route := DisabledRoute{}
+	if err = c.Bind(&route); nil != err {
+		return
+	}
+	if "" == route.Method || "" == route.Path {
+		return echo.NewHTTPError(http.StatusBadRequest, "缺少请求方法或者路径")
+	}
+	if strings.HasPrefix(route.Path, ac.BasePath) {
+		return echo.NewHTTPError(http.StatusBadRequest, "不能停用管理接口")
+	}
+	DisableRoute(route.Method, route.Path, route.Message)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ac *AdminConfig) enableRoute(c echo.Context) error {
+	method := c.QueryParam("method")
+	path := c.QueryParam("path")
+	if "" == method || "" == path {
+		return echo.NewHTTPError(http.StatusBadRequest, "缺少请求方法或者路径")
+	}
+	EnableRoute(method, path)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ac *AdminConfig) staged(c echo.Context) error {
+	return c.JSON(http.StatusOK, Staged())
+}
+
+func (ac *AdminConfig) stage(c echo.Context) (err error) {
+	settings := StagedSettings{}
+	if err = c.Bind(&settings); nil != err {
+		return
+	}
+	if err = settings.Stage(); nil != err {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ac *AdminConfig) switchConfig(c echo.Context) error {
+	guard := DefaultSwitchGuard
+	if nil != ac.SwitchGuard {
+		guard = *ac.SwitchGuard
+	}
+	if err := SwitchConfig(guard); nil != err {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ac *AdminConfig) cronJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, CronJobs())
+}
+
+func (ac *AdminConfig) triggerCron(c echo.Context) error {
+	if err := TriggerCron(c.Param("name")); nil != err {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (ac *AdminConfig) rollbackConfig(c echo.Context) error {
+	if err := RollbackConfig(); nil != err {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,291 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/random"
+)
+
+const (
+	JobPending   JobState = "pending"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+type (
+	// JobState 任务状态
+	JobState string
+
+	// Job 异步任务
+	Job struct {
+		Id        string      `json:"id"`
+		State     JobState    `json:"state"`
+		Progress  float64     `json:"progress"`
+		Message   string      `json:"message,omitempty"`
+		Result    interface{} `json:"result,omitempty"`
+		Error     string      `json:"error,omitempty"`
+		CreatedAt time.Time   `json:"createdAt"`
+		UpdatedAt time.Time   `json:"updatedAt"`
+		// 创建任务的用户，只有同一个用户可以查询
+		Owner string `json:"-"`
+	}
+
+	// JobFunc 后台执行的任务，ctx在任务被取消或者服务退出时取消
+	JobFunc func(ctx context.Context, progress Progress) (result interface{}, err error)
+
+	// Progress 更新任务进度，percent是0到100
+	Progress func(percent float64, message string)
+
+	// AsyncHandler 在请求中绑定和验证参数，返回后台执行的任务
+	AsyncHandler func(c echo.Context) (JobFunc, error)
+
+	// JobStore 任务存储，多实例部署时需要换成共享存储
+	JobStore interface {
+		Save(ctx context.Context, job Job, ttl time.Duration) error
+		// Get 读取任务，不存在时返回ErrJobNotFound
+		Get(ctx context.Context, id string) (Job, error)
+	}
+
+	// AsyncConfig 异步任务的配置
+	AsyncConfig struct {
+		// 任务存储
+		// 非必须 默认存储在内存中
+		Store JobStore
+
+		// 任务结果保留的时间
+		// 非必须 默认值是24小时
+		TTL time.Duration
+
+		// 单个任务的超时时间
+		// 非必须 默认不超时
+		Timeout time.Duration
+
+		// 任务状态接口的路径，挂在同一个分组下
+		// 非必须 默认值是"/jobs"
+		JobsPath string
+	}
+
+	memoryJobStore struct {
+		mutex   sync.Mutex
+		entries map[string]*jobEntry
+	}
+
+	jobEntry struct {
+		job     Job
+		expires time.Time
+	}
+)
+
+var (
+	// DefaultAsyncConfig 默认配置
+	DefaultAsyncConfig = AsyncConfig{
+		TTL:      24 * time.Hour,
+		JobsPath: "/jobs",
+	}
+
+	// DefaultJobStore 默认的任务存储
+	DefaultJobStore = NewMemoryJobStore()
+
+	ErrJobNotFound = echo.NewHTTPError(http.StatusNotFound, "任务不存在")
+
+	// jobContext 服务退出时取消所有任务
+	jobContext, cancelJobs = context.WithCancel(context.Background())
+	runningJobs            = &workerGroup{cancel: cancelJobs}
+	jobCancels             sync.Map
+	jobMounts              sync.Map
+)
+
+// NewMemoryJobStore 创建内存任务存储
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{entries: make(map[string]*jobEntry)}
+}
+
+func (mjs *memoryJobStore) Save(_ context.Context, job Job, ttl time.Duration) error {
+	mjs.mutex.Lock()
+	defer mjs.mutex.Unlock()
+
+	now := time.Now()
+	for id, entry := range mjs.entries {
+		if now.After(entry.expires) {
+			delete(mjs.entries, id)
+		}
+	}
+	mjs.entries[job.Id] = &jobEntry{job: job, expires: now.Add(ttl)}
+
+	return nil
+}
+
+func (mjs *memoryJobStore) Get(_ context.Context, id string) (job Job, err error) {
+	mjs.mutex.Lock()
+	defer mjs.mutex.Unlock()
+
+	if entry, ok := mjs.entries[id]; ok && time.Now().Before(entry.expires) {
+		job = entry.job
+	} else {
+		err = ErrJobNotFound
+	}
+
+	return
+}
+
+// Async 注册异步任务接口
+// 请求返回202和任务编号，同时在分组下挂载GET /jobs/:id查询状态和结果，DELETE /jobs/:id取消任务
+func Async(g *echo.Group, path string, handler AsyncHandler) {
+	AsyncWithConfig(g, path, handler, DefaultAsyncConfig)
+}
+
+// AsyncWithConfig 注册异步任务接口
+func AsyncWithConfig(g *echo.Group, path string, handler AsyncHandler, config AsyncConfig) {
+	if nil == config.Store {
+		config.Store = DefaultJobStore
+	}
+	if 0 >= config.TTL {
+		config.TTL = DefaultAsyncConfig.TTL
+	}
+	if "" == config.JobsPath {
+		config.JobsPath = DefaultAsyncConfig.JobsPath
+	}
+
+	// 同一个分组只挂载一次状态接口
+	key := fmt.Sprintf("%p%s", g, config.JobsPath)
+	location, mounted := jobMounts.Load(key)
+	if !mounted {
+		location = g.GET(config.JobsPath+"/:id", config.status).Path
+		g.DELETE(config.JobsPath+"/:id", config.cancel)
+		jobMounts.Store(key, location)
+	}
+	g.POST(path, config.start(handler, location.(string)))
+}
+
+func (ac AsyncConfig) start(handler AsyncHandler, location string) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		var fn JobFunc
+		if fn, err = handler(c); nil != err {
+			return
+		}
+
+		now := time.Now()
+		job := Job{
+			Id:        random.String(32, random.Lowercase+random.Numeric),
+			State:     JobPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Owner:     userIdOf(c),
+		}
+		if err = ac.Store.Save(c.Request().Context(), job, ac.TTL); nil != err {
+			return
+		}
+
+		// 任务不使用请求的上下文，请求结束后继续执行
+		ctx, cancel := context.WithCancel(jobContext)
+		if 0 < ac.Timeout {
+			ctx, cancel = context.WithTimeout(jobContext, ac.Timeout)
+		}
+		jobCancels.Store(job.Id, cancel)
+		runningJobs.wait.Add(1)
+		// 上下文在请求结束后会被复用，协程中不能再使用
+		logger := c.Logger()
+		go func() {
+			defer runningJobs.wait.Done()
+			defer jobCancels.Delete(job.Id)
+			defer cancel()
+
+			ac.run(ctx, logger, job, fn)
+		}()
+
+		c.Response().Header().Set(echo.HeaderLocation, strings.Replace(location, ":id", job.Id, 1))
+
+		return c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func (ac AsyncConfig) run(ctx context.Context, logger echo.Logger, job Job, fn JobFunc) {
+	save := func() {
+		job.UpdatedAt = time.Now()
+		// 存储使用独立的上下文，任务取消后也要能保存状态
+		if err := ac.Store.Save(context.Background(), job, ac.TTL); nil != err {
+			logger.Error(err)
+		}
+	}
+
+	var mutex sync.Mutex
+	progress := func(percent float64, message string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		job.Progress = percent
+		job.Message = message
+		save()
+	}
+	job.State = JobRunning
+	save()
+
+	result, err := safeJob(ctx, fn, progress)
+	mutex.Lock()
+	defer mutex.Unlock()
+	switch {
+	case nil != ctx.Err() && nil != err:
+		job.State = JobCancelled
+		job.Error = ctx.Err().Error()
+	case nil != err:
+		job.State = JobFailed
+		job.Error = err.Error()
+	default:
+		job.State = JobSucceeded
+		job.Progress = 100
+		job.Result = result
+	}
+	save()
+}
+
+func (ac AsyncConfig) status(c echo.Context) error {
+	job, err := ac.owned(c)
+	if nil != err {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+func (ac AsyncConfig) cancel(c echo.Context) error {
+	job, err := ac.owned(c)
+	if nil != err {
+		return err
+	}
+	if cancel, ok := jobCancels.Load(job.Id); ok {
+		cancel.(context.CancelFunc)()
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// owned 读取当前用户的任务，其它用户的任务当作不存在
+func (ac AsyncConfig) owned(c echo.Context) (job Job, err error) {
+	if job, err = ac.Store.Get(c.Request().Context(), c.Param("id")); nil != err {
+		return
+	}
+	if job.Owner != userIdOf(c) {
+		err = ErrJobNotFound
+	}
+
+	return
+}
+
+// safeJob 任务崩溃时当作失败
+func safeJob(ctx context.Context, fn JobFunc, progress Progress) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("job panic: %v", r)
+		}
+	}()
+
+	return fn(ctx, progress)
+}
@@ -0,0 +1,232 @@
+package echox
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	auditStartKey = "echox.audit.start"
+	redactedValue = "******"
+)
+
+type (
+	// AuditConfig 审计日志中间件的配置
+	AuditConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 用于读取当前用户
+		// 非必须 默认使用EchoConfig.JWT
+		JWT *JWTConfig
+
+		// 需要脱敏的字段，不区分大小写
+		// 只记录能够解析的JSON和表单，其它的内容无法脱敏，只记录长度
+		// 非必须 默认值是password、token等常见的敏感字段
+		RedactFields []string
+
+		// 记录的请求体和响应体的最大长度，超出部分截断
+		// 非必须 默认值是4096
+		MaxBodySize int
+
+		// 审计记录的去处
+		// 必须字段
+		Sink AuditSink
+	}
+
+	// AuditRecord 审计记录
+	AuditRecord struct {
+		Time      time.Time     `json:"time"`
+		RequestID string        `json:"requestId,omitempty"`
+		Ip        string        `json:"ip"`
+		Method    string        `json:"method"`
+		Path      string        `json:"path"`
+		Status    int           `json:"status"`
+		Latency   time.Duration `json:"latency"`
+		UserId    string        `json:"userId,omitempty"`
+		// 调用者的类型，user或者service，服务账号的UserId是service:服务名
+		Principal    string `json:"principal,omitempty"`
+		RequestBody  string `json:"requestBody,omitempty"`
+		ResponseBody string `json:"responseBody,omitempty"`
+	}
+
+	// AuditSink 审计记录的去处，比如文件、数据库、Kafka
+	AuditSink interface {
+		Write(record *AuditRecord) error
+	}
+
+	// AuditSinkFunc 使用函数作为审计记录的去处
+	AuditSinkFunc func(record *AuditRecord) error
+
+	writerAuditSink struct {
+		mutex   sync.Mutex
+		encoder *json.Encoder
+	}
+)
+
+var (
+	// DefaultAuditConfig 默认配置
+	DefaultAuditConfig = AuditConfig{
+		Skipper:      middleware.DefaultSkipper,
+		RedactFields: []string{"password", "passwd", "secret", "token", "accessToken", "refreshToken", "authorization"},
+		MaxBodySize:  4096,
+	}
+)
+
+func (asf AuditSinkFunc) Write(record *AuditRecord) error {
+	return asf(record)
+}
+
+// NewWriterAuditSink 把审计记录按行写成JSON，一般用于写文件
+func NewWriterAuditSink(w io.Writer) AuditSink {
+	return &writerAuditSink{encoder: json.NewEncoder(w)}
+}
+
+func (was *writerAuditSink) Write(record *AuditRecord) error {
+	was.mutex.Lock()
+	defer was.mutex.Unlock()
+
+	return was.encoder.Encode(record)
+}
+
+// Audit 审计日志中间件
+func Audit(sink AuditSink) echo.MiddlewareFunc {
+	c := DefaultAuditConfig
+	c.Sink = sink
+
+	return AuditWithConfig(c)
+}
+
+// AuditWithConfig 审计日志中间件
+func AuditWithConfig(config AuditConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultAuditConfig.Skipper
+	}
+	if nil == config.Sink {
+		panic("echo: audit middleware requires sink")
+	}
+	if nil == config.RedactFields {
+		config.RedactFields = DefaultAuditConfig.RedactFields
+	}
+	if 0 >= config.MaxBodySize {
+		config.MaxBodySize = DefaultAuditConfig.MaxBodySize
+	}
+
+	redacts := make(map[string]bool, len(config.RedactFields))
+	for _, field := range config.RedactFields {
+		redacts[strings.ToLower(field)] = true
+	}
+
+	dump := middleware.BodyDumpWithConfig(middleware.BodyDumpConfig{
+		Skipper: config.Skipper,
+		Handler: func(c echo.Context, reqBody []byte, resBody []byte) {
+			record := &AuditRecord{
+				Time:         time.Now(),
+				RequestID:    c.Response().Header().Get(echo.HeaderXRequestID),
+				Ip:           c.RealIP(),
+				Method:       c.Request().Method,
+				Path:         c.Request().URL.Path,
+				Status:       c.Response().Status,
+				RequestBody:  config.body(reqBody, c.Request().Header.Get(echo.HeaderContentType), redacts),
+				ResponseBody: config.body(resBody, c.Response().Header().Get(echo.HeaderContentType), redacts),
+			}
+			if start, ok := c.Get(auditStartKey).(time.Time); ok {
+				record.Latency = record.Time.Sub(start)
+			}
+			if nil != config.JWT {
+				ec := EchoContext{Context: c, JWT: config.JWT}
+				if principal, err := ec.Principal(); nil == err {
+					record.UserId = principal.Subject()
+					record.Principal = principal.Type
+				}
+			}
+
+			if err := config.Sink.Write(record); nil != err {
+				c.Logger().Error(err)
+			}
+		},
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		h := dump(next)
+
+		return func(c echo.Context) error {
+			c.Set(auditStartKey, time.Now())
+
+			return h(c)
+		}
+	}
+}
+
+// body 脱敏并截断请求体或者响应体
+func (ac *AuditConfig) body(body []byte, contentType string, redacts map[string]bool) (result string) {
+	if 0 == len(body) {
+		return
+	}
+
+	// 解析失败的内容不能原样记录，里面可能有密码
+	switch mediaType := mediaTypeOf(contentType); {
+	case echo.MIMEApplicationJSON == mediaType || strings.HasSuffix(mediaType, "+json"):
+		var data interface{}
+		if err := json.Unmarshal(body, &data); nil != err {
+			return omittedBody(body)
+		}
+		redacted, err := json.Marshal(redact(data, redacts))
+		if nil != err {
+			return omittedBody(body)
+		}
+		body = redacted
+	case echo.MIMEApplicationForm == mediaType:
+		values, err := url.ParseQuery(string(body))
+		if nil != err {
+			return omittedBody(body)
+		}
+		for key := range values {
+			if redacts[strings.ToLower(key)] {
+				values.Set(key, redactedValue)
+			}
+		}
+		body = []byte(values.Encode())
+	default:
+		return omittedBody(body)
+	}
+
+	result = string(body)
+	if len(result) > ac.MaxBodySize {
+		result = result[:ac.MaxBodySize]
+	}
+
+	return
+}
+
+// omittedBody 不能脱敏的内容只记录长度
+func omittedBody(body []byte) string {
+	return "[" + strconv.Itoa(len(body)) + " bytes omitted]"
+}
+
+func redact(data interface{}, redacts map[string]bool) interface{} {
+	switch value := data.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if redacts[strings.ToLower(key)] {
+				value[key] = redactedValue
+			} else {
+				value[key] = redact(item, redacts)
+			}
+		}
+	case []interface{}:
+		for index, item := range value {
+			value[index] = redact(item, redacts)
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,93 @@
+package echox
+
+import (
+	"reflect"
+	"sync"
+)
+
+type (
+	// bindField 按标签绑定时字段的信息，按类型缓存，不用每个请求都解析标签
+	bindField struct {
+		index int
+		field reflect.StructField
+		name  string
+		// 没有标签的嵌套结构体
+		nested reflect.Type
+	}
+
+	bindFieldsKey struct {
+		typ reflect.Type
+		tag string
+	}
+)
+
+var (
+	bindFieldCache sync.Map
+	defaultsCache  sync.Map
+	sanitizeCache  sync.Map
+)
+
+// cachedBindFields 结构体中可以按标签绑定的字段
+func cachedBindFields(t reflect.Type, tag string) []bindField {
+	key := bindFieldsKey{typ: t, tag: tag}
+	if cached, ok := bindFieldCache.Load(key); ok {
+		return cached.([]bindField)
+	}
+
+	fields := make([]bindField, 0, t.NumField())
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if "" != field.PkgPath {
+			continue
+		}
+
+		name := tagName(field, tag)
+		if "-" == name {
+			continue
+		}
+		bf := bindField{index: index, field: field, name: name}
+		if "" == name {
+			if nested, ok := nestedStruct(field.Type); ok {
+				bf.nested = nested
+			} else {
+				// 和Echo一样，没有标签时按字段名匹配
+				bf.name = field.Name
+			}
+		}
+		fields = append(fields, bf)
+	}
+	bindFieldCache.Store(key, fields)
+
+	return fields
+}
+
+// hasDefaults 结构体及其嵌套结构体中有没有default标签，没有时跳过设置默认值
+func hasDefaults(t reflect.Type) bool {
+	if cached, ok := defaultsCache.Load(t); ok {
+		return cached.(bool)
+	}
+
+	found := searchDefaults(t, make(map[reflect.Type]bool))
+	defaultsCache.Store(t, found)
+
+	return found
+}
+
+func searchDefaults(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if "" != field.Tag.Get("default") {
+			return true
+		}
+		if nested, ok := nestedStruct(field.Type); ok && searchDefaults(nested, visiting) {
+			return true
+		}
+	}
+
+	return false
+}
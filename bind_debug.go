@@ -0,0 +1,176 @@
+package echox
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// HeaderXDebugBind 请求头为1时，返回绑定和验证的过程
+	HeaderXDebugBind = "X-Debug-Bind"
+	// HeaderXDebugBindTrace 绑定和验证的过程
+	HeaderXDebugBindTrace = "X-Debug-Bind-Trace"
+)
+
+type (
+	// BindTrace 绑定和验证的过程
+	BindTrace struct {
+		Fields      []BindTraceField  `json:"fields"`
+		Validations []ValidationTrace `json:"validations,omitempty"`
+		Error       string            `json:"error,omitempty"`
+
+		mutex sync.Mutex
+	}
+
+	// BindTraceField 字段的绑定过程
+	BindTraceField struct {
+		Field string `json:"field"`
+		// 取值来源：path、query、body
+		Source string `json:"source,omitempty"`
+		// 是否使用了默认值
+		Default bool `json:"default,omitempty"`
+	}
+
+	// ValidationTrace 字段的验证过程
+	ValidationTrace struct {
+		Field  string `json:"field"`
+		Rules  string `json:"rules"`
+		Passed bool   `json:"passed"`
+	}
+)
+
+// bindTraces 绑定对象到过程的映射
+// 验证器拿不到上下文，只能通过绑定的对象找到过程
+var bindTraces sync.Map
+
+func (dvb *DefaultValueBinder) traceable(c echo.Context) bool {
+	if "1" != c.Request().Header.Get(HeaderXDebugBind) {
+		return false
+	}
+	if nil != dvb.DebugBind {
+		return dvb.DebugBind(c)
+	}
+
+	return c.Echo().Debug
+}
+
+func (dvb *DefaultValueBinder) trace(i interface{}, c echo.Context, bind func() error) (err error) {
+	value := reflect.ValueOf(i)
+	if reflect.Ptr != value.Kind() || reflect.Struct != value.Elem().Kind() {
+		return bind()
+	}
+
+	trace := &BindTrace{}
+	bindTraces.Store(i, trace)
+	c.Response().Before(func() {
+		trace.mutex.Lock()
+		defer trace.mutex.Unlock()
+
+		if data, marshalErr := json.Marshal(trace); nil == marshalErr {
+			c.Response().Header().Set(HeaderXDebugBindTrace, string(data))
+		}
+	})
+	c.Response().After(func() {
+		bindTraces.Delete(i)
+	})
+
+	before := snapshot(value.Elem())
+	err = bind()
+	trace.record(value.Elem(), before, c)
+	if nil != err {
+		trace.Error = err.Error()
+	}
+
+	return
+}
+
+func (bt *BindTrace) record(value reflect.Value, before map[string]interface{}, c echo.Context) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	zero := snapshot(reflect.New(value.Type()).Elem())
+	for name, current := range snapshot(value) {
+		field := BindTraceField{Field: name}
+		if !reflect.DeepEqual(zero[name], before[name]) {
+			field.Default = true
+		}
+		if !reflect.DeepEqual(before[name], current) {
+			field.Source = source(value.Type(), name, c)
+		}
+		if field.Default || "" != field.Source {
+			bt.Fields = append(bt.Fields, field)
+		}
+	}
+}
+
+func (bt *BindTrace) validated(i interface{}, err error) {
+	bt.mutex.Lock()
+	defer bt.mutex.Unlock()
+
+	failed := make(map[string]bool)
+	if errs, ok := err.(validator.ValidationErrors); ok {
+		for _, fe := range errs {
+			failed[fe.StructField()] = true
+		}
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(i))
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		if rules := field.Tag.Get("validate"); "" != rules && "-" != rules {
+			bt.Validations = append(bt.Validations, ValidationTrace{
+				Field:  field.Name,
+				Rules:  rules,
+				Passed: !failed[field.Name],
+			})
+		}
+	}
+	if nil != err {
+		bt.Error = err.Error()
+	}
+}
+
+// snapshot 记录结构体各字段当前的值
+func snapshot(value reflect.Value) (values map[string]interface{}) {
+	values = make(map[string]interface{})
+	for index := 0; index < value.NumField(); index++ {
+		if field := value.Type().Field(index); "" == field.PkgPath {
+			values[field.Name] = value.Field(index).Interface()
+		}
+	}
+
+	return
+}
+
+// source 推断字段的取值来源
+func source(t reflect.Type, name string, c echo.Context) string {
+	field, _ := t.FieldByName(name)
+	if param := tagName(field, "param"); "" != param {
+		for _, paramName := range c.ParamNames() {
+			if param == paramName {
+				return "path"
+			}
+		}
+	}
+	if query := tagName(field, "query"); "" != query {
+		if _, ok := c.QueryParams()[query]; ok {
+			return "query"
+		}
+	}
+
+	return "body"
+}
+
+func tagName(field reflect.StructField, key string) string {
+	tag := field.Tag.Get(key)
+	if index := strings.Index(tag, ","); -1 != index {
+		tag = tag[:index]
+	}
+
+	return tag
+}
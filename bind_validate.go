@@ -0,0 +1,197 @@
+package echox
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sanitizeTag 清洗字符串的标签，多个规则用逗号分隔，按顺序执行
+//
+//	Name string `json:"name" sanitize:"trim,collapse" validate:"required"`
+//
+// 支持的规则：
+//   - trim 去掉首尾空白
+//   - lower 转小写
+//   - upper 转大写
+//   - collapse 连续的空白合并成一个空格
+//   - nohtml 去掉HTML标签
+//
+// 不支持的规则是配置错误，Handler注册时panic，BindAndValidate和Sanitize返回错误
+const sanitizeTag = "sanitize"
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+	whitespace = regexp.MustCompile(`\s+`)
+
+	sanitizeRules = map[string]func(string) string{
+		"trim":  strings.TrimSpace,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"collapse": func(value string) string {
+			return whitespace.ReplaceAllString(value, " ")
+		},
+		"nohtml": func(value string) string {
+			return htmlTag.ReplaceAllString(value, "")
+		},
+	}
+)
+
+// BindAndValidate 绑定路径、查询参数和请求体，设置默认值，按标签清洗字符串，最后验证
+// 错误和c.Bind、c.Validate一样由错误处理器返回统一的格式
+//
+//	req, err := echox.BindAndValidate[CreateUserReq](c)
+func BindAndValidate[T any](c echo.Context) (req *T, err error) {
+	req = new(T)
+	if err = c.Bind(req); nil != err {
+		return nil, err
+	}
+	if err = Sanitize(req); nil != err {
+		return nil, err
+	}
+	if nil != c.Echo().Validator {
+		if err = c.Validate(req); nil != err {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// Handler 把处理请求的函数转换成处理器，返回值为nil时响应204，否则按JSON返回
+//
+//	g.POST("/users", echox.Handler(func(c echo.Context, req *CreateUserReq) (interface{}, error) {
+//		return createUser(c.Request().Context(), req)
+//	}))
+func Handler[T any](fn func(c echo.Context, req *T) (rsp interface{}, err error)) echo.HandlerFunc {
+	// 注册时检查清洗规则，不要等到处理请求时才发现
+	if err := checkSanitize(reflect.TypeOf(new(T))); nil != err {
+		panic(err.Error())
+	}
+
+	return func(c echo.Context) (err error) {
+		var req *T
+		if req, err = BindAndValidate[T](c); nil != err {
+			return
+		}
+
+		var rsp interface{}
+		if rsp, err = fn(c, req); nil != err || c.Response().Committed {
+			return
+		}
+		if nil == rsp {
+			return c.NoContent(http.StatusNoContent)
+		}
+
+		return maskedJSON(c, http.StatusOK, rsp)
+	}
+}
+
+// Sanitize 按sanitize标签清洗结构体及其嵌套结构体中的字符串
+// 标签中有不支持的规则时返回错误，不修改任何字段
+func Sanitize(i interface{}) (err error) {
+	if err = checkSanitize(reflect.TypeOf(i)); nil != err {
+		return
+	}
+	sanitizeValue(reflect.ValueOf(i), nil)
+
+	return
+}
+
+func sanitizeValue(value reflect.Value, rules []string) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			sanitizeValue(value.Elem(), rules)
+		}
+	case reflect.String:
+		if 0 != len(rules) && value.CanSet() {
+			value.SetString(sanitizeString(value.String(), rules))
+		}
+	case reflect.Slice, reflect.Array:
+		for index := 0; index < value.Len(); index++ {
+			sanitizeValue(value.Index(index), rules)
+		}
+	case reflect.Struct:
+		if _, ok := nestedStruct(value.Type()); !ok {
+			return
+		}
+		for index := 0; index < value.NumField(); index++ {
+			field := value.Type().Field(index)
+			if "" != field.PkgPath {
+				continue
+			}
+
+			var fieldRules []string
+			if tag := field.Tag.Get(sanitizeTag); "" != tag && "-" != tag {
+				fieldRules = strings.Split(tag, ",")
+			}
+			sanitizeValue(value.Field(index), fieldRules)
+		}
+	}
+}
+
+// sanitizeString 执行清洗规则，规则已经由checkSanitize检查过
+func sanitizeString(value string, rules []string) string {
+	for _, rule := range rules {
+		if sanitize, ok := sanitizeRules[strings.TrimSpace(rule)]; ok {
+			value = sanitize(value)
+		}
+	}
+
+	return value
+}
+
+// checkSanitize 检查类型中所有的清洗规则，结果按类型缓存
+func checkSanitize(t reflect.Type) (err error) {
+	if nil == t {
+		return
+	}
+	if cached, ok := sanitizeCache.Load(t); ok {
+		err, _ = cached.(error)
+
+		return
+	}
+
+	err = searchSanitize(t, make(map[reflect.Type]bool))
+	sanitizeCache.Store(t, err)
+
+	return
+}
+
+func searchSanitize(t reflect.Type, visiting map[reflect.Type]bool) (err error) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return searchSanitize(t.Elem(), visiting)
+	case reflect.Struct:
+	default:
+		return
+	}
+	if _, ok := nestedStruct(t); !ok || visiting[t] {
+		return
+	}
+	visiting[t] = true
+
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if "" != field.PkgPath {
+			continue
+		}
+		if tag := field.Tag.Get(sanitizeTag); "" != tag && "-" != tag {
+			for _, rule := range strings.Split(tag, ",") {
+				if _, ok := sanitizeRules[strings.TrimSpace(rule)]; !ok {
+					return fmt.Errorf("echo: sanitize rule %q of %s.%s is unsupported", rule, t.Name(), field.Name)
+				}
+			}
+		}
+		if err = searchSanitize(field.Type, visiting); nil != err {
+			return
+		}
+	}
+
+	return
+}
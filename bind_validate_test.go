@@ -0,0 +1,80 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	sanitizeProfile struct {
+		Bio string `json:"bio" sanitize:"nohtml,trim"`
+	}
+
+	sanitizeReq struct {
+		Name    string            `json:"name" sanitize:"trim,collapse,lower"`
+		Tags    []string          `json:"tags" sanitize:"upper"`
+		Profile *sanitizeProfile  `json:"profile"`
+		Friends []sanitizeProfile `json:"friends"`
+	}
+
+	unsupportedSanitizeReq struct {
+		Name    string `json:"name" sanitize:"trim"`
+		Profile struct {
+			Bio string `json:"bio" sanitize:"trim,shout"`
+		} `json:"profile"`
+	}
+)
+
+func TestSanitizeRules(t *testing.T) {
+	req := &sanitizeReq{
+		Name:    "  Echo   X ",
+		Tags:    []string{"web"},
+		Profile: &sanitizeProfile{Bio: " <b>hello</b> "},
+		Friends: []sanitizeProfile{{Bio: "<i>hi</i> "}},
+	}
+	if err := Sanitize(req); nil != err {
+		t.Fatal(err)
+	}
+	if "echo x" != req.Name || "WEB" != req.Tags[0] || "hello" != req.Profile.Bio || "hi" != req.Friends[0].Bio {
+		t.Fatalf("清洗的结果是%+v %+v %+v", req, req.Profile, req.Friends)
+	}
+}
+
+func TestSanitizeUnsupportedRuleIsConfigError(t *testing.T) {
+	req := &unsupportedSanitizeReq{Name: " echo "}
+	err := Sanitize(req)
+	if nil == err || !strings.Contains(err.Error(), `"shout"`) {
+		t.Fatalf("不支持的规则应该返回错误：%v", err)
+	}
+	if " echo " != req.Name {
+		t.Fatal("规则有错误时不应该修改字段")
+	}
+
+	func() {
+		defer func() {
+			if nil == recover() {
+				t.Fatal("注册使用了不支持的规则的处理器应该panic")
+			}
+		}()
+		Handler(func(c echo.Context, req *unsupportedSanitizeReq) (interface{}, error) { return nil, nil })
+	}()
+
+	// 直接调用BindAndValidate时处理请求不panic，返回错误
+	e := echo.New()
+	e.POST("/users", func(c echo.Context) (err error) {
+		_, err = BindAndValidate[unsupportedSanitizeReq](c)
+
+		return
+	})
+	httpReq := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"echo"}`))
+	httpReq.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httpReq)
+	if http.StatusInternalServerError != rec.Code {
+		t.Fatalf("返回了%d", rec.Code)
+	}
+}
@@ -0,0 +1,352 @@
+package echox
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mcuadros/go-defaults"
+)
+
+const (
+	// timeFormatTag 时间字段的格式，默认是RFC3339，"unix"和"unixmilli"表示时间戳
+	timeFormatTag = "time_format"
+)
+
+type (
+	// BindErrors 绑定失败的字段和原因，按验证错误的格式返回给客户端
+	BindErrors map[string]string
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	bindUnmarshalerType = reflect.TypeOf((*echo.BindUnmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func (be BindErrors) Error() string {
+	fields := make([]string, 0, len(be))
+	for field, message := range be {
+		fields = append(fields, field+": "+message)
+	}
+	sort.Strings(fields)
+
+	return strings.Join(fields, "; ")
+}
+
+// bindStruct 绑定路径参数、查询参数和请求体到结构体
+// 支持嵌套结构体、指针、time_format标签和逗号分隔的切片参数
+func bindStruct(value reflect.Value, c echo.Context) (err error) {
+	errs := make(BindErrors)
+
+	params := make(map[string][]string)
+	for index, name := range c.ParamNames() {
+		params[name] = []string{c.ParamValues()[index]}
+	}
+	bindValues(value, params, "param", errs)
+	bindValues(value, c.QueryParams(), "query", errs)
+	if 0 != len(errs) {
+		return errs
+	}
+
+	req := c.Request()
+	if 0 == req.ContentLength {
+		return
+	}
+
+	ctype := req.Header.Get(echo.HeaderContentType)
+	switch {
+	case strings.HasPrefix(ctype, echo.MIMEApplicationJSON):
+		err = bindJSON(value, json.NewDecoder(req.Body))
+	case strings.HasPrefix(ctype, echo.MIMEApplicationXML), strings.HasPrefix(ctype, echo.MIMETextXML):
+		if err = xml.NewDecoder(req.Body).Decode(value.Addr().Interface()); nil != err {
+			err = echo.NewHTTPError(400, err.Error()).SetInternal(err)
+		}
+	case strings.HasPrefix(ctype, echo.MIMEApplicationForm), strings.HasPrefix(ctype, echo.MIMEMultipartForm):
+		form, formErr := c.FormParams()
+		if nil != formErr {
+			return echo.NewHTTPError(400, formErr.Error()).SetInternal(formErr)
+		}
+		bindValues(value, form, "form", errs)
+		if 0 != len(errs) {
+			err = errs
+		}
+	default:
+		err = echo.ErrUnsupportedMediaType
+	}
+	if nil == err {
+		// 请求体中的切片元素在绑定后才存在，这时候再设置默认值
+		elementDefaults(value)
+	}
+
+	return
+}
+
+func bindJSON(value reflect.Value, decoder *json.Decoder) (err error) {
+	if err = decoder.Decode(value.Addr().Interface()); nil == err {
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && "" != typeErr.Field {
+		err = BindErrors{typeErr.Field: fmt.Sprintf("类型应该是%s", typeErr.Type)}
+	} else {
+		err = echo.NewHTTPError(400, err.Error()).SetInternal(err)
+	}
+
+	return
+}
+
+// bindValues 按标签绑定键值对
+func bindValues(value reflect.Value, data map[string][]string, tag string, errs BindErrors) (bound bool) {
+	if 0 == len(data) {
+		return
+	}
+
+	for _, bf := range cachedBindFields(value.Type(), tag) {
+		fieldValue := value.Field(bf.index)
+		// 没有标签的嵌套结构体
+		if nil != bf.nested {
+			if reflect.Ptr == bf.field.Type.Kind() {
+				// 指针只在有值绑定时分配
+				target := reflect.New(bf.nested)
+				if !fieldValue.IsNil() {
+					target = fieldValue
+				}
+				if bindValues(target.Elem(), data, tag, errs) && fieldValue.IsNil() {
+					fieldValue.Set(target)
+				}
+			} else if bindValues(fieldValue, data, tag, errs) {
+				bound = true
+			}
+			continue
+		}
+
+		values, ok := lookup(data, bf.name)
+		if !ok || 0 == len(values) {
+			continue
+		}
+		if err := setField(fieldValue, bf.field, values); nil != err {
+			errs[bf.name] = err.Error()
+		}
+		bound = true
+	}
+
+	return
+}
+
+func lookup(data map[string][]string, name string) (values []string, ok bool) {
+	if values, ok = data[name]; ok {
+		return
+	}
+	for key, value := range data {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+
+	return
+}
+
+func nestedStruct(t reflect.Type) (nested reflect.Type, ok bool) {
+	nested = t
+	if reflect.Ptr == nested.Kind() {
+		nested = nested.Elem()
+	}
+	if reflect.Struct != nested.Kind() || timeType == nested || unmarshalable(nested) {
+		return
+	}
+	ok = true
+
+	return
+}
+
+func unmarshalable(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+
+	return pt.Implements(bindUnmarshalerType) || pt.Implements(textUnmarshalerType)
+}
+
+func setField(value reflect.Value, field reflect.StructField, values []string) (err error) {
+	if reflect.Ptr == value.Kind() {
+		target := reflect.New(value.Type().Elem())
+		if err = setField(target.Elem(), field, values); nil == err {
+			value.Set(target)
+		}
+		return
+	}
+
+	// time.Time也实现了TextUnmarshaler，需要先处理
+	if timeType == value.Type() {
+		return setTime(value, field.Tag.Get(timeFormatTag), values[0])
+	}
+	if unmarshaler, ok := value.Addr().Interface().(echo.BindUnmarshaler); ok {
+		return unmarshaler.UnmarshalParam(values[0])
+	}
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(values[0]))
+	}
+
+	if reflect.Slice == value.Kind() && reflect.Uint8 != value.Type().Elem().Kind() {
+		// 同时支持重复的参数和逗号分隔的参数
+		items := make([]string, 0, len(values))
+		for _, item := range values {
+			for _, split := range strings.Split(item, ",") {
+				if split = strings.TrimSpace(split); "" != split {
+					items = append(items, split)
+				}
+			}
+		}
+
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for index, item := range items {
+			if err = setField(slice.Index(index), field, []string{item}); nil != err {
+				return
+			}
+		}
+		value.Set(slice)
+
+		return
+	}
+
+	return setBasic(value, values[0])
+}
+
+func setTime(value reflect.Value, layout string, raw string) (err error) {
+	var parsed time.Time
+	switch layout {
+	case "unix", "unixmilli":
+		var timestamp int64
+		if timestamp, err = strconv.ParseInt(raw, 10, 64); nil != err {
+			return errors.New("应该是时间戳")
+		}
+		if "unix" == layout {
+			parsed = time.Unix(timestamp, 0)
+		} else {
+			parsed = time.Unix(0, timestamp*int64(time.Millisecond))
+		}
+	default:
+		if "" == layout {
+			layout = time.RFC3339
+		}
+		if parsed, err = time.ParseInLocation(layout, raw, time.Local); nil != err {
+			return fmt.Errorf("时间格式应该是%s", layout)
+		}
+	}
+	value.Set(reflect.ValueOf(parsed))
+
+	return
+}
+
+func setBasic(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		if "" == raw {
+			raw = "false"
+		}
+		parsed, err := strconv.ParseBool(raw)
+		if nil != err {
+			return errors.New("应该是布尔值")
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if reflect.TypeOf(time.Duration(0)) == value.Type() {
+			parsed, err := time.ParseDuration(raw)
+			if nil != err {
+				return errors.New("应该是时长")
+			}
+			value.SetInt(int64(parsed))
+			return nil
+		}
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if nil != err {
+			return errors.New("应该是整数")
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if nil != err {
+			return errors.New("应该是非负整数")
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if nil != err {
+			return errors.New("应该是数字")
+		}
+		value.SetFloat(parsed)
+	default:
+		return errors.New("不支持的类型")
+	}
+
+	return nil
+}
+
+// fillDefaults 设置结构体及其嵌套结构体的默认值
+func fillDefaults(value reflect.Value) {
+	value = reflect.Indirect(value)
+	if reflect.Struct != value.Kind() || !value.CanAddr() || !hasDefaults(value.Type()) {
+		return
+	}
+
+	defaults.SetDefaults(value.Addr().Interface())
+	for index := 0; index < value.NumField(); index++ {
+		if "" != value.Type().Field(index).PkgPath {
+			continue
+		}
+
+		field := value.Field(index)
+		switch field.Kind() {
+		case reflect.Ptr:
+			if !field.IsNil() {
+				fillDefaults(field)
+			}
+		case reflect.Struct:
+			if _, ok := nestedStruct(field.Type()); ok {
+				fillDefaults(field)
+			}
+		}
+	}
+}
+
+// elementDefaults 给切片中的结构体元素设置默认值
+func elementDefaults(value reflect.Value) {
+	value = reflect.Indirect(value)
+	if reflect.Struct != value.Kind() {
+		return
+	}
+
+	for index := 0; index < value.NumField(); index++ {
+		if "" != value.Type().Field(index).PkgPath {
+			continue
+		}
+
+		field := value.Field(index)
+		switch field.Kind() {
+		case reflect.Ptr:
+			if !field.IsNil() {
+				elementDefaults(field)
+			}
+		case reflect.Struct:
+			if _, ok := nestedStruct(field.Type()); ok {
+				elementDefaults(field)
+			}
+		case reflect.Slice, reflect.Array:
+			for element := 0; element < field.Len(); element++ {
+				item := field.Index(element)
+				fillDefaults(item)
+				elementDefaults(item)
+			}
+		}
+	}
+}
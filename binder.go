@@ -1,18 +1,40 @@
 package echox
 
 import (
+	"reflect"
+
 	"github.com/labstack/echo/v4"
-	"github.com/mcuadros/go-defaults"
 )
 
-type DefaultValueBinder struct{}
+type DefaultValueBinder struct {
+	// 绑定枚举时忽略大小写
+	EnumCaseInsensitive bool
+
+	// 是否允许通过X-Debug-Bind请求头查看绑定过程
+	// 非必须 默认只在调试模式下允许
+	DebugBind func(echo.Context) bool
+}
 
 func (dvb *DefaultValueBinder) Bind(i interface{}, c echo.Context) (err error) {
-	defaults.SetDefaults(i)
+	if dvb.traceable(c) {
+		return dvb.trace(i, c, func() error {
+			return dvb.bind(i, c)
+		})
+	}
+
+	return dvb.bind(i, c)
+}
+
+func (dvb *DefaultValueBinder) bind(i interface{}, c echo.Context) (err error) {
+	value := reflect.ValueOf(i)
+	// 不是结构体时交给Echo处理
+	if reflect.Ptr != value.Kind() || reflect.Struct != value.Elem().Kind() {
+		return new(echo.DefaultBinder).Bind(i, c)
+	}
 
-	db := new(echo.DefaultBinder)
-	if err = db.Bind(i, c); err != echo.ErrUnsupportedMediaType {
-		return
+	fillDefaults(value)
+	if err = bindStruct(value.Elem(), c); nil == err && dvb.EnumCaseInsensitive {
+		normalizeEnums(value)
 	}
 
 	return
@@ -0,0 +1,57 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	benchmarkQuery struct {
+		Id     int64    `param:"id"`
+		Page   int      `query:"page"`
+		Size   int      `query:"size"`
+		Sort   string   `query:"sort"`
+		Tags   []string `query:"tags"`
+		Filter struct {
+			Name string `query:"name"`
+		}
+	}
+
+	benchmarkDefaults struct {
+		Id   int64  `param:"id"`
+		Page int    `query:"page" default:"1"`
+		Size int    `query:"size" default:"20"`
+		Sort string `query:"sort" default:"id"`
+	}
+)
+
+func BenchmarkDefaultValueBinder(b *testing.B) {
+	b.Run("query", func(b *testing.B) {
+		benchmarkBind(b, func() interface{} { return new(benchmarkQuery) })
+	})
+	b.Run("defaults", func(b *testing.B) {
+		benchmarkBind(b, func() interface{} { return new(benchmarkDefaults) })
+	})
+}
+
+func benchmarkBind(b *testing.B, value func() interface{}) {
+	e := echo.New()
+	binder := new(DefaultValueBinder)
+	req := httptest.NewRequest(http.MethodGet, "/users/1?size=50&sort=name&tags=a,b&name=echo", nil)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 每个请求重新解析查询参数
+		c.Reset(req, c.Response().Writer)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		if err := binder.Bind(value(), c); nil != err {
+			b.Fatal(err)
+		}
+	}
+}
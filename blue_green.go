@@ -0,0 +1,245 @@
+package echox
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+)
+
+type (
+	// SwitchGuard 切换配置后的保护
+	// 在观察期内错误率超过阈值时，自动回滚到切换前的配置
+	SwitchGuard struct {
+		// 观察期
+		Window time.Duration
+		// 5xx响应占比的阈值
+		MaxErrorRate float64
+		// 请求数达到这个值后才开始计算错误率
+		MinRequests int64
+	}
+
+	// StagedSettings 通过管理接口预备的配置，只包含可以热加载的部分
+	// 没有设置的字段保持当前的值
+	StagedSettings struct {
+		LogLevel    *log.Lvl        `json:"logLevel"`
+		Rate        *float64        `json:"rate"`
+		Burst       *int            `json:"burst"`
+		CORSOrigins []string        `json:"corsOrigins"`
+		Features    map[string]bool `json:"features"`
+	}
+
+	// StagedStatus 预备配置的状态
+	StagedStatus struct {
+		Staged   bool `json:"staged"`
+		Guarding bool `json:"guarding"`
+	}
+
+	switchState struct {
+		staged   *EchoConfig
+		previous *EchoConfig
+		total    int64
+		errors   int64
+		guard    SwitchGuard
+		timer    *time.Timer
+	}
+)
+
+var (
+	// DefaultSwitchGuard 默认的保护
+	DefaultSwitchGuard = SwitchGuard{
+		Window:       time.Minute,
+		MaxErrorRate: 0.05,
+		MinRequests:  20,
+	}
+
+	ErrNoStagedConfig    = errors.New("没有预备的配置")
+	ErrNoPreviousConfig  = errors.New("没有可以回滚的配置")
+	ErrServerNotStarted  = errors.New("服务还没有启动")
+	ErrSwitchInProgress  = errors.New("上一次切换还在观察期内")
+	switching            = &switchState{}
+	guardingSwitch       int32
+	rollbackNotification = make(chan struct{}, 1)
+)
+
+// StageConfig 预备新配置，调用SwitchConfig后才生效
+func StageConfig(ec *EchoConfig) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	switching.staged = ec
+}
+
+// SwitchConfig 原子地切换到预备的配置，并在观察期内监控错误率
+func SwitchConfig(guard SwitchGuard) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if nil == running {
+		return ErrServerNotStarted
+	}
+	if nil == switching.staged {
+		return ErrNoStagedConfig
+	}
+	if 1 == atomic.LoadInt32(&guardingSwitch) {
+		return ErrSwitchInProgress
+	}
+
+	switching.previous = applied
+	apply(running, switching.staged)
+	switching.staged = nil
+	switching.guard = guard
+	atomic.StoreInt64(&switching.total, 0)
+	atomic.StoreInt64(&switching.errors, 0)
+	atomic.StoreInt32(&guardingSwitch, 1)
+	switching.timer = time.AfterFunc(guard.Window, func() {
+		// 观察期结束，新配置转正
+		atomic.StoreInt32(&guardingSwitch, 0)
+	})
+
+	return nil
+}
+
+// RollbackConfig 回滚到切换前的配置
+func RollbackConfig() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	return rollback()
+}
+
+func rollback() error {
+	if nil == running {
+		return ErrServerNotStarted
+	}
+	if nil == switching.previous {
+		return ErrNoPreviousConfig
+	}
+
+	if nil != switching.timer {
+		switching.timer.Stop()
+	}
+	apply(running, switching.previous)
+	switching.previous = nil
+	atomic.StoreInt32(&guardingSwitch, 0)
+	running.Logger.Warn("配置已经回滚")
+
+	return nil
+}
+
+// Staged 预备配置的状态
+func Staged() StagedStatus {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	return StagedStatus{
+		Staged:   nil != switching.staged,
+		Guarding: 1 == atomic.LoadInt32(&guardingSwitch),
+	}
+}
+
+// Stage 在当前配置的基础上预备新配置
+func (ss *StagedSettings) Stage() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if nil == applied {
+		return ErrServerNotStarted
+	}
+
+	ec := *applied
+	if nil != ss.LogLevel {
+		ec.LogLevel = *ss.LogLevel
+	}
+	if nil != ss.Rate || nil != ss.Burst {
+		rateLimit := DefaultRateLimitConfig
+		if nil != ec.RateLimit {
+			rateLimit = *ec.RateLimit
+		}
+		if nil != ss.Rate {
+			rateLimit.Rate = *ss.Rate
+		}
+		if nil != ss.Burst {
+			rateLimit.Burst = *ss.Burst
+		}
+		ec.RateLimit = &rateLimit
+	}
+	if nil != ss.CORSOrigins {
+		cors := middleware.DefaultCORSConfig
+		if nil != ec.CORS {
+			cors = *ec.CORS
+		}
+		cors.AllowOrigins = ss.CORSOrigins
+		ec.CORS = &cors
+	}
+	if nil != ss.Features {
+		features := make(map[string]bool, len(ec.Features)+len(ss.Features))
+		for name, enabled := range ec.Features {
+			features[name] = enabled
+		}
+		for name, enabled := range ss.Features {
+			features[name] = enabled
+		}
+		ec.Features = features
+	}
+	switching.staged = &ec
+
+	return nil
+}
+
+// switchGuardMiddleware 观察期内统计错误率
+func switchGuardMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		if 0 == atomic.LoadInt32(&guardingSwitch) {
+			return next(c)
+		}
+
+		err = next(c)
+		total := atomic.AddInt64(&switching.total, 1)
+		errs := atomic.LoadInt64(&switching.errors)
+		if http.StatusInternalServerError <= statusOf(c, err) {
+			errs = atomic.AddInt64(&switching.errors, 1)
+		}
+
+		guard := switching.guard
+		if total >= guard.MinRequests && float64(errs)/float64(total) > guard.MaxErrorRate {
+			select {
+			case rollbackNotification <- struct{}{}:
+				go func() {
+					reloadMutex.Lock()
+					defer reloadMutex.Unlock()
+					<-rollbackNotification
+
+					if 1 == atomic.LoadInt32(&guardingSwitch) {
+						rollback()
+					}
+				}()
+			default:
+			}
+		}
+
+		return
+	}
+}
+
+// statusOf 处理器返回后的状态码，返回错误时按错误处理器的规则推断
+func statusOf(c echo.Context, err error) int {
+	if nil == err {
+		return c.Response().Status
+	}
+	switch re := err.(type) {
+	case *echo.HTTPError:
+		return re.Code
+	case validator.ValidationErrors, BindErrors:
+		return http.StatusBadRequest
+	case statusCoder:
+		return re.StatusCode()
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,227 @@
+package echox
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type (
+	breakerState int
+
+	// BreakerConfig 熔断配置
+	BreakerConfig struct {
+		// 跳过熔断
+		Skipper middleware.Skipper
+
+		// 连续失败多少次后熔断
+		// 非必须 默认值是5
+		FailureThreshold int
+
+		// 熔断后多久进入半开状态
+		// 非必须 默认值是30秒
+		OpenTimeout time.Duration
+
+		// 半开状态下允许同时试探的请求数
+		// 非必须 默认值是1
+		HalfOpenRequests int
+
+		// 判断是否失败
+		// 非必须 默认5xx和网络错误算失败
+		IsFailure func(status int, err error) bool
+
+		// 熔断时的降级处理，为空时返回ErrBreakerOpen
+		Fallback echo.HandlerFunc
+	}
+
+	// circuitBreaker 熔断器，同名的中间件和客户端共享状态
+	circuitBreaker struct {
+		config   BreakerConfig
+		mutex    sync.Mutex
+		state    breakerState
+		failures int
+		openedAt time.Time
+		probes   int
+	}
+
+	breakerTransport struct {
+		breaker   *circuitBreaker
+		transport http.RoundTripper
+	}
+)
+
+var (
+	// DefaultBreakerConfig 默认配置
+	DefaultBreakerConfig = BreakerConfig{
+		Skipper:          middleware.DefaultSkipper,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+		IsFailure: func(status int, err error) bool {
+			return nil != err || http.StatusInternalServerError <= status
+		},
+	}
+
+	// ErrBreakerOpen 已经熔断
+	ErrBreakerOpen = echo.NewHTTPError(http.StatusServiceUnavailable, "服务暂时不可用")
+
+	breakers sync.Map
+)
+
+// Breaker 熔断中间件
+// 同名的熔断器共享状态，以第一次创建时的配置为准
+func Breaker(name string, config BreakerConfig) echo.MiddlewareFunc {
+	cb := breakerOf(name, config)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if cb.config.Skipper(c) {
+				return next(c)
+			}
+			if !cb.allow() {
+				return cb.fallback(c)
+			}
+
+			err = next(c)
+			// 下游客户端已经熔断，不重复计数
+			if errors.Is(err, ErrBreakerOpen) {
+				cb.release()
+				return cb.fallback(c)
+			}
+			// 业务返回的HTTP错误只按状态码判断
+			status := statusOf(c, err)
+			cause := err
+			switch err.(type) {
+			case *echo.HTTPError, statusCoder:
+				cause = nil
+			}
+			cb.record(cb.config.IsFailure(status, cause))
+
+			return
+		}
+	}
+}
+
+// NewBreakerClient 创建和同名熔断中间件共享状态的客户端
+// 熔断时请求直接返回包装了ErrBreakerOpen的错误
+func NewBreakerClient(name string, config BreakerConfig, client *http.Client) *http.Client {
+	if nil == client {
+		client = &http.Client{}
+	}
+	transport := client.Transport
+	if nil == transport {
+		transport = http.DefaultTransport
+	}
+
+	wrapped := *client
+	wrapped.Transport = &breakerTransport{
+		breaker:   breakerOf(name, config),
+		transport: transport,
+	}
+
+	return &wrapped
+}
+
+func (bt *breakerTransport) RoundTrip(req *http.Request) (rsp *http.Response, err error) {
+	if !bt.breaker.allow() {
+		err = ErrBreakerOpen
+		return
+	}
+
+	status := 0
+	if rsp, err = bt.transport.RoundTrip(req); nil == err {
+		status = rsp.StatusCode
+	}
+	bt.breaker.record(bt.breaker.config.IsFailure(status, err))
+
+	return
+}
+
+func breakerOf(name string, config BreakerConfig) *circuitBreaker {
+	if nil == config.Skipper {
+		config.Skipper = DefaultBreakerConfig.Skipper
+	}
+	if 0 >= config.FailureThreshold {
+		config.FailureThreshold = DefaultBreakerConfig.FailureThreshold
+	}
+	if 0 >= config.OpenTimeout {
+		config.OpenTimeout = DefaultBreakerConfig.OpenTimeout
+	}
+	if 0 >= config.HalfOpenRequests {
+		config.HalfOpenRequests = DefaultBreakerConfig.HalfOpenRequests
+	}
+	if nil == config.IsFailure {
+		config.IsFailure = DefaultBreakerConfig.IsFailure
+	}
+
+	cb, _ := breakers.LoadOrStore(name, &circuitBreaker{config: config})
+
+	return cb.(*circuitBreaker)
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if time.Since(cb.openedAt) < cb.config.OpenTimeout {
+			return false
+		}
+		cb.state = breakerHalfOpen
+		cb.probes = 0
+		fallthrough
+	case breakerHalfOpen:
+		if cb.probes >= cb.config.HalfOpenRequests {
+			return false
+		}
+		cb.probes++
+	}
+
+	return true
+}
+
+// release 放弃一次试探
+func (cb *circuitBreaker) release() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if breakerHalfOpen == cb.state && 0 < cb.probes {
+		cb.probes--
+	}
+}
+
+func (cb *circuitBreaker) record(failure bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if !failure {
+		cb.state = breakerClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if breakerHalfOpen == cb.state || cb.failures >= cb.config.FailureThreshold {
+		cb.state = breakerOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+func (cb *circuitBreaker) fallback(c echo.Context) error {
+	if nil != cb.config.Fallback {
+		return cb.config.Fallback(c)
+	}
+
+	return ErrBreakerOpen
+}
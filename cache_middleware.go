@@ -0,0 +1,399 @@
+package echox
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfNoneMatch = "If-None-Match"
+	HeaderXCache      = "X-Cache"
+)
+
+type (
+	// CacheConfig 响应缓存中间件的配置
+	CacheConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 缓存时间
+		// 必须字段
+		TTL time.Duration
+
+		// 缓存的键
+		// 非必须 默认值是请求方法、地址和当前用户
+		KeyFunc CacheKeyFunc
+
+		// 缓存存储
+		// 非必须 默认值是DefaultCacheStore
+		Store CacheStore
+	}
+
+	// MemoryCacheStoreConfig 内存缓存存储的配置
+	MemoryCacheStoreConfig struct {
+		// 最多缓存的响应数量，超出后淘汰最早写入的
+		// 非必须 默认值是10000
+		MaxEntries int
+	}
+
+	// CacheKeyFunc 生成缓存的键
+	CacheKeyFunc func(echo.Context) string
+
+	// CachedResponse 缓存的响应
+	CachedResponse struct {
+		Status       int         `json:"status"`
+		Header       http.Header `json:"header"`
+		Body         []byte      `json:"body"`
+		ETag         string      `json:"etag"`
+		LastModified time.Time   `json:"lastModified"`
+	}
+
+	// CacheStore 缓存存储
+	CacheStore interface {
+		Get(key string) (rsp *CachedResponse, ok bool, err error)
+		Set(key string, rsp *CachedResponse, ttl time.Duration) error
+		Delete(key string) error
+		// DeletePrefix 删除某个前缀的所有缓存，用于批量失效
+		DeletePrefix(prefix string) error
+	}
+
+	memoryCacheStore struct {
+		mutex      sync.RWMutex
+		maxEntries int
+		entries    map[string]*cacheEntry
+		order      *list.List
+		sweeping   sync.Once
+	}
+
+	cacheEntry struct {
+		key      string
+		response *CachedResponse
+		expires  time.Time
+		element  *list.Element
+	}
+
+	bufferedWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+		// 处理器刷新或者接管了连接，比如SSE和WebSocket，之后直接写出，不缓存
+		streaming bool
+		// 开始直接写出时调用
+		onStream func()
+	}
+)
+
+var (
+	// DefaultMemoryCacheStoreConfig 默认配置
+	DefaultMemoryCacheStoreConfig = MemoryCacheStoreConfig{
+		MaxEntries: 10000,
+	}
+
+	// DefaultCacheStore 默认的缓存存储
+	DefaultCacheStore = NewMemoryCacheStore()
+
+	// DefaultCacheConfig 默认配置
+	DefaultCacheConfig = CacheConfig{
+		Skipper: middleware.DefaultSkipper,
+		KeyFunc: DefaultCacheKey,
+	}
+)
+
+// NewMemoryCacheStore 创建内存缓存存储
+func NewMemoryCacheStore() CacheStore {
+	return NewMemoryCacheStoreWithConfig(DefaultMemoryCacheStoreConfig)
+}
+
+// NewMemoryCacheStoreWithConfig 创建内存缓存存储
+func NewMemoryCacheStoreWithConfig(config MemoryCacheStoreConfig) CacheStore {
+	if 0 >= config.MaxEntries {
+		config.MaxEntries = DefaultMemoryCacheStoreConfig.MaxEntries
+	}
+
+	return &memoryCacheStore{
+		maxEntries: config.MaxEntries,
+		entries:    make(map[string]*cacheEntry),
+		order:      list.New(),
+	}
+}
+
+func (mcs *memoryCacheStore) Get(key string) (rsp *CachedResponse, ok bool, err error) {
+	mcs.mutex.RLock()
+	defer mcs.mutex.RUnlock()
+
+	var entry *cacheEntry
+	if entry, ok = mcs.entries[key]; ok && time.Now().Before(entry.expires) {
+		rsp = entry.response
+	} else {
+		ok = false
+	}
+
+	return
+}
+
+func (mcs *memoryCacheStore) Set(key string, rsp *CachedResponse, ttl time.Duration) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	// 默认存储是包级变量，用到时才开始清理
+	mcs.sweeping.Do(func() {
+		sweepEvery(memorySweepInterval, mcs.sweep)
+	})
+	if entry, ok := mcs.entries[key]; ok {
+		entry.response = rsp
+		entry.expires = time.Now().Add(ttl)
+
+		return nil
+	}
+	if mcs.maxEntries <= mcs.order.Len() {
+		mcs.remove(mcs.order.Front().Value.(*cacheEntry))
+	}
+	entry := &cacheEntry{key: key, response: rsp, expires: time.Now().Add(ttl)}
+	entry.element = mcs.order.PushBack(entry)
+	mcs.entries[key] = entry
+
+	return nil
+}
+
+func (mcs *memoryCacheStore) remove(entry *cacheEntry) {
+	mcs.order.Remove(entry.element)
+	delete(mcs.entries, entry.key)
+}
+
+func (mcs *memoryCacheStore) sweep(now time.Time) {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	for _, entry := range mcs.entries {
+		if now.After(entry.expires) {
+			mcs.remove(entry)
+		}
+	}
+}
+
+func (mcs *memoryCacheStore) Delete(key string) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	if entry, ok := mcs.entries[key]; ok {
+		mcs.remove(entry)
+	}
+
+	return nil
+}
+
+func (mcs *memoryCacheStore) DeletePrefix(prefix string) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	for key, entry := range mcs.entries {
+		if strings.HasPrefix(key, prefix) {
+			mcs.remove(entry)
+		}
+	}
+
+	return nil
+}
+
+// DefaultCacheKey 默认的缓存键，格式是"地址|请求方法|用户"
+// 不同用户的缓存互相隔离，地址在最前面，InvalidateCachePrefix可以按路径失效
+func DefaultCacheKey(c echo.Context) string {
+	return strings.Join([]string{c.Request().URL.RequestURI(), c.Request().Method, userIdOf(c)}, "|")
+}
+
+// InvalidateCache 使默认缓存存储中的缓存失效
+func InvalidateCache(key string) error {
+	return DefaultCacheStore.Delete(key)
+}
+
+// InvalidateCachePrefix 使默认缓存存储中某个路径下的缓存全部失效
+func InvalidateCachePrefix(path string) error {
+	return DefaultCacheStore.DeletePrefix(path)
+}
+
+// Cached 响应缓存中间件
+func Cached(ttl time.Duration, keyFunc CacheKeyFunc) echo.MiddlewareFunc {
+	c := DefaultCacheConfig
+	c.TTL = ttl
+	c.KeyFunc = keyFunc
+
+	return CachedWithConfig(c)
+}
+
+// CachedWithConfig 响应缓存中间件
+// 只缓存GET和HEAD请求的200响应，同时处理If-None-Match和If-Modified-Since条件请求
+// 设置了Cookie的响应属于某个客户端，不缓存
+func CachedWithConfig(config CacheConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultCacheConfig.Skipper
+	}
+	if 0 >= config.TTL {
+		panic("echo: cache middleware requires ttl")
+	}
+	if nil == config.KeyFunc {
+		config.KeyFunc = DefaultCacheConfig.KeyFunc
+	}
+	if nil == config.Store {
+		config.Store = DefaultCacheStore
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			method := c.Request().Method
+			if config.Skipper(c) || (http.MethodGet != method && http.MethodHead != method) {
+				return next(c)
+			}
+
+			key := config.KeyFunc(c)
+			if rsp, ok, getErr := config.Store.Get(key); nil == getErr && ok {
+				c.Response().Header().Set(HeaderXCache, "HIT")
+
+				return writeCached(c, rsp)
+			}
+
+			writer := &bufferedWriter{ResponseWriter: c.Response().Writer, status: http.StatusOK}
+			c.Response().Writer = writer
+			err = next(c)
+			c.Response().Writer = writer.ResponseWriter
+			if nil != err || writer.streaming {
+				return
+			}
+
+			rsp := &CachedResponse{
+				Status:       writer.status,
+				Body:         writer.body.Bytes(),
+				ETag:         ETag(writer.body.Bytes()),
+				LastModified: time.Now().UTC().Truncate(time.Second),
+			}
+			header := c.Response().Header()
+			header.Set(HeaderETag, rsp.ETag)
+			header.Set(echo.HeaderLastModified, rsp.LastModified.Format(http.TimeFormat))
+			header.Set(HeaderXCache, "MISS")
+			if http.StatusOK == rsp.Status && 0 == len(header[echo.HeaderSetCookie]) {
+				rsp.Header = header.Clone()
+				if setErr := config.Store.Set(key, rsp, config.TTL); nil != setErr {
+					c.Logger().Error(setErr)
+				}
+			}
+
+			if http.StatusOK == rsp.Status && NotModified(c, rsp.ETag, rsp.LastModified) {
+				c.Response().Status = http.StatusNotModified
+				writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+			writer.ResponseWriter.WriteHeader(rsp.Status)
+			_, err = writer.ResponseWriter.Write(rsp.Body)
+
+			return
+		}
+	}
+}
+
+// ETag 根据内容生成ETag
+func ETag(body []byte) string {
+	sum := sha1.Sum(body)
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// NotModified 判断条件请求是否可以返回304
+func NotModified(c echo.Context, etag string, lastModified time.Time) bool {
+	if match := c.Request().Header.Get(HeaderIfNoneMatch); "" != match {
+		matched := false
+		eachHeaderValue(match, func(candidate string) bool {
+			matched = "*" == candidate || etag == strings.TrimPrefix(candidate, "W/")
+
+			return !matched
+		})
+
+		return matched
+	}
+
+	if since := c.Request().Header.Get(echo.HeaderIfModifiedSince); "" != since && !lastModified.IsZero() {
+		if t, err := http.ParseTime(since); nil == err && !lastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeCached(c echo.Context, rsp *CachedResponse) (err error) {
+	header := c.Response().Header()
+	for key, values := range rsp.Header {
+		// 保存的请求头是规范的写法，请求编号使用这次请求的
+		if requestIdHeader == key || HeaderXCache == key {
+			continue
+		}
+		header[key] = values
+	}
+	if NotModified(c, rsp.ETag, rsp.LastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	c.Response().WriteHeader(rsp.Status)
+	_, err = c.Response().Write(rsp.Body)
+
+	return
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	if bw.streaming {
+		bw.ResponseWriter.WriteHeader(code)
+
+		return
+	}
+	bw.status = code
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if bw.streaming {
+		return bw.ResponseWriter.Write(b)
+	}
+
+	return bw.body.Write(b)
+}
+
+// Flush 流式的响应不缓存，先写出已经缓冲的内容，之后直接写出
+func (bw *bufferedWriter) Flush() {
+	if !bw.streaming {
+		bw.stream()
+		bw.ResponseWriter.WriteHeader(bw.status)
+		if 0 != bw.body.Len() {
+			_, _ = bw.ResponseWriter.Write(bw.body.Bytes())
+			bw.body.Reset()
+		}
+	}
+	if flusher, ok := bw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 接管连接之后不再缓存，比如WebSocket
+func (bw *bufferedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !bw.streaming {
+		bw.stream()
+	}
+
+	return bw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (bw *bufferedWriter) stream() {
+	bw.streaming = true
+	if nil != bw.onStream {
+		bw.onStream()
+	}
+}
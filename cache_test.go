@@ -0,0 +1,89 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestCacheHitKeepsRequestId(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(CachedWithConfig(CacheConfig{TTL: time.Minute, Store: NewMemoryCacheStore()}))
+	e.GET("/items", func(c echo.Context) error {
+		return c.String(http.StatusOK, "items")
+	})
+
+	ids := make([]string, 0, 2)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+		ids = append(ids, rec.Header().Get(echo.HeaderXRequestID))
+		if 1 == i && "HIT" != rec.Header().Get(HeaderXCache) {
+			t.Fatal("第二次请求没有命中缓存")
+		}
+	}
+	if ids[0] == ids[1] {
+		t.Fatalf("缓存的响应使用了第一次请求的编号：%v", ids)
+	}
+}
+
+func TestDefaultCacheKeyIncludesMethod(t *testing.T) {
+	e := echo.New()
+	get := e.NewContext(httptest.NewRequest(http.MethodGet, "/items?page=1", nil), httptest.NewRecorder())
+	head := e.NewContext(httptest.NewRequest(http.MethodHead, "/items?page=1", nil), httptest.NewRecorder())
+	if DefaultCacheKey(get) == DefaultCacheKey(head) {
+		t.Fatalf("GET和HEAD的缓存键相同：%s", DefaultCacheKey(get))
+	}
+}
+
+func TestCacheSkipsResponsesSettingCookies(t *testing.T) {
+	e := echo.New()
+	e.Use(CachedWithConfig(CacheConfig{TTL: time.Minute, Store: NewMemoryCacheStore()}))
+	calls := 0
+	e.GET("/session", func(c echo.Context) error {
+		calls++
+		c.SetCookie(&http.Cookie{Name: "session", Value: "secret"})
+
+		return c.String(http.StatusOK, "ok")
+	})
+
+	for i := 0; i < 2; i++ {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/session", nil))
+	}
+	if 2 != calls {
+		t.Fatalf("设置了Cookie的响应被缓存了，处理器执行了%d次", calls)
+	}
+}
+
+func TestMemoryCacheStoreEvictsOldest(t *testing.T) {
+	store := NewMemoryCacheStoreWithConfig(MemoryCacheStoreConfig{MaxEntries: 2})
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Set(key, &CachedResponse{Status: http.StatusOK}, time.Minute); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok, _ := store.Get("a"); ok {
+		t.Fatal("超出数量后没有淘汰最早写入的")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok, _ := store.Get(key); !ok {
+			t.Fatalf("%s被淘汰了", key)
+		}
+	}
+
+	if err := store.DeletePrefix("b"); nil != err {
+		t.Fatal(err)
+	}
+	if err := store.Set("d", &CachedResponse{Status: http.StatusOK}, time.Minute); nil != err {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get("c"); !ok {
+		t.Fatal("删除后的空位没有被使用")
+	}
+}
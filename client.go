@@ -0,0 +1,247 @@
+package echox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ClientConfig 调用下游服务的客户端配置
+	ClientConfig struct {
+		// 下游服务的名字，作为指标的service标签和熔断器的名字
+		// 必须字段
+		Name string
+
+		// 整个调用的超时时间，包括重试
+		// 非必须 默认值是10秒
+		Timeout time.Duration
+
+		// 失败后重试的次数
+		// 非必须 默认不重试
+		Retries int
+
+		// 第一次重试前等待的时间，之后每次翻倍并加上随机抖动
+		// 非必须 默认值是100毫秒
+		Backoff time.Duration
+
+		// 最长的等待时间
+		// 非必须 默认值是2秒
+		MaxBackoff time.Duration
+
+		// 判断是否需要重试
+		// 非必须 默认幂等的请求在网络错误、502、503和504时重试
+		Retryable func(req *http.Request, rsp *http.Response, err error) bool
+
+		// 服务令牌，请求没有Authorization时带上，ctx中有ForwardToken转发的令牌时优先使用转发的令牌
+		// 非必须
+		Token func(ctx context.Context) (string, error)
+
+		// 熔断
+		// 非必须 默认不熔断
+		Breaker *BreakerConfig
+
+		// 指标记录器
+		// 非必须 默认使用EchoConfig.Metrics的记录器
+		Recorder ClientRecorder
+
+		// 非必须 默认是http.DefaultTransport
+		Transport http.RoundTripper
+	}
+
+	// ClientRecorder 记录调用下游的指标，标签和服务端的请求指标一致
+	ClientRecorder interface {
+		ObserveClient(service string, labels RequestLabels, duration time.Duration)
+	}
+
+	clientTransport struct {
+		config ClientConfig
+		base   http.RoundTripper
+	}
+
+	forwardTokenKey struct{}
+)
+
+var (
+	// DefaultClientConfig 默认配置
+	DefaultClientConfig = ClientConfig{
+		Timeout:    10 * time.Second,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+		Retryable:  retryable,
+	}
+
+	// metricsRecorder 服务端使用的指标记录器
+	metricsRecorder MetricsRecorder
+)
+
+// NewHTTPClient 创建调用下游服务的客户端
+// 带上超时、重试、请求编号和链路追踪、服务令牌和指标，和服务端处理请求的方式一致
+// 请求需要使用c.Request().Context()才能传递请求编号和链路
+func NewHTTPClient(config ClientConfig) *http.Client {
+	if "" == config.Name {
+		panic("echo: http client requires a name")
+	}
+	if 0 >= config.Timeout {
+		config.Timeout = DefaultClientConfig.Timeout
+	}
+	if 0 >= config.Backoff {
+		config.Backoff = DefaultClientConfig.Backoff
+	}
+	if 0 >= config.MaxBackoff {
+		config.MaxBackoff = DefaultClientConfig.MaxBackoff
+	}
+	if nil == config.Retryable {
+		config.Retryable = DefaultClientConfig.Retryable
+	}
+
+	var base http.RoundTripper = &CorrelationTransport{Base: config.Transport}
+	if nil != config.Breaker {
+		base = &breakerTransport{breaker: breakerOf(config.Name, *config.Breaker), transport: base}
+	}
+
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: &clientTransport{config: config, base: base},
+	}
+}
+
+// ForwardToken 把当前请求的令牌放入上下文，客户端用这个上下文调用下游时转发令牌
+func ForwardToken(c echo.Context) context.Context {
+	ctx := c.Request().Context()
+	if auth := c.Request().Header.Get(echo.HeaderAuthorization); "" != auth {
+		ctx = context.WithValue(ctx, forwardTokenKey{}, auth)
+	}
+
+	return ctx
+}
+
+func (ct *clientTransport) RoundTrip(req *http.Request) (rsp *http.Response, err error) {
+	start := time.Now()
+	defer func() {
+		ct.observe(req, rsp, err, time.Since(start))
+	}()
+
+	// RoundTripper不能修改原始请求
+	if req, err = ct.authorize(req); nil != err {
+		return
+	}
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if 0 != attempt {
+			if attemptReq, err = rewind(req); nil != err {
+				return
+			}
+		}
+
+		rsp, err = ct.base.RoundTrip(attemptReq)
+		if attempt >= ct.config.Retries || !ct.config.Retryable(req, rsp, err) || !replayable(req) {
+			return
+		}
+		if nil != rsp {
+			_, _ = io.Copy(ioutil.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(ct.backoff(attempt)):
+		}
+	}
+}
+
+// authorize 请求没有Authorization时带上转发的令牌或者服务令牌
+func (ct *clientTransport) authorize(req *http.Request) (authorized *http.Request, err error) {
+	authorized = req
+	if "" != req.Header.Get(echo.HeaderAuthorization) {
+		return
+	}
+
+	auth, _ := req.Context().Value(forwardTokenKey{}).(string)
+	if "" == auth && nil != ct.config.Token {
+		var token string
+		if token, err = ct.config.Token(req.Context()); nil != err {
+			return
+		}
+		if "" != token {
+			auth = "Bearer " + token
+		}
+	}
+	if "" != auth {
+		authorized = req.Clone(req.Context())
+		authorized.Header.Set(echo.HeaderAuthorization, auth)
+	}
+
+	return
+}
+
+// backoff 指数退避加上随机抖动，避免重试同时到达下游
+func (ct *clientTransport) backoff(attempt int) time.Duration {
+	wait := ct.config.Backoff << uint(attempt)
+	if wait > ct.config.MaxBackoff || 0 >= wait {
+		wait = ct.config.MaxBackoff
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func (ct *clientTransport) observe(req *http.Request, rsp *http.Response, err error, duration time.Duration) {
+	recorder := ct.config.Recorder
+	if nil == recorder {
+		recorder, _ = metricsRecorder.(ClientRecorder)
+	}
+	if nil == recorder {
+		return
+	}
+
+	status := "error"
+	if nil == err && nil != rsp {
+		status = strconv.Itoa(rsp.StatusCode)
+	}
+	recorder.ObserveClient(ct.config.Name, RequestLabels{
+		Method: req.Method,
+		Route:  NormalizePath(req.URL.Path),
+		Status: status,
+	}, duration)
+}
+
+// retryable 幂等的请求在网络错误和网关错误时重试
+func retryable(req *http.Request, rsp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if nil != err {
+		return nil == req.Context().Err() && !errors.Is(err, ErrBreakerOpen)
+	}
+
+	switch rsp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// replayable 请求体可以重新读取时才能重试
+func replayable(req *http.Request) bool {
+	return nil == req.Body || http.NoBody == req.Body || nil != req.GetBody
+}
+
+func rewind(req *http.Request) (rewound *http.Request, err error) {
+	rewound = req.Clone(req.Context())
+	if nil != req.GetBody {
+		rewound.Body, err = req.GetBody()
+	}
+
+	return
+}
@@ -0,0 +1,276 @@
+package echox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// APISnapshot 接口的快照，发布时保存下来和下一个版本比较
+	APISnapshot struct {
+		Routes map[string]*RouteSnapshot `json:"routes"`
+	}
+
+	// RouteSnapshot 路由的快照
+	RouteSnapshot struct {
+		Method   string   `json:"method"`
+		Path     string   `json:"path"`
+		Auth     string   `json:"auth,omitempty"`
+		Scopes   []string `json:"scopes,omitempty"`
+		Request  *Schema  `json:"request,omitempty"`
+		Response *Schema  `json:"response,omitempty"`
+	}
+
+	// APIChange 两个版本之间的变化
+	APIChange struct {
+		Route   string `json:"route"`
+		Field   string `json:"field,omitempty"`
+		Message string `json:"message"`
+		// 是否是不兼容的变化
+		Breaking bool `json:"breaking"`
+	}
+)
+
+// ErrBreakingChanges 有不兼容的变化
+var ErrBreakingChanges = errors.New("接口有不兼容的变化")
+
+// Snapshot 所有带元数据的路由的快照，请求和响应的结构来自Route.Request和Route.Response
+func Snapshot() (snapshot APISnapshot) {
+	snapshot.Routes = make(map[string]*RouteSnapshot)
+	for _, route := range RegisteredRoutes() {
+		rs := &RouteSnapshot{Method: route.Method, Path: route.Path, Auth: route.Auth, Scopes: route.Scopes}
+		if nil != route.Request {
+			rs.Request = SchemaOf(reflect.TypeOf(route.Request))
+		}
+		if nil != route.Response {
+			rs.Response = SchemaOf(reflect.TypeOf(route.Response))
+		}
+		snapshot.Routes[snapshotKey(route.Method, route.Path)] = rs
+	}
+
+	return
+}
+
+// CompareSnapshots 比较两个快照，列出所有变化，不兼容的排在前面
+// 不兼容的变化：
+//   - 删除路由
+//   - 增加认证或者权限
+//   - 请求增加必须字段、字段变成必须、删除枚举值
+//   - 响应删除字段、字段变成可空、增加枚举值
+//   - 请求和响应的字段类型变化
+func CompareSnapshots(from APISnapshot, to APISnapshot) (changes []APIChange) {
+	for key, old := range from.Routes {
+		current, ok := to.Routes[key]
+		if !ok {
+			changes = append(changes, APIChange{Route: key, Message: "删除了路由", Breaking: true})
+			continue
+		}
+
+		if "" == old.Auth && "" != current.Auth {
+			changes = append(changes, APIChange{Route: key, Message: "增加了认证", Breaking: true})
+		}
+		for _, scope := range current.Scopes {
+			if !containsString(old.Scopes, scope) {
+				changes = append(changes, APIChange{Route: key, Message: "增加了权限" + scope, Breaking: true})
+			}
+		}
+		compareSchema(key, "", old.Request, current.Request, true, &changes)
+		compareSchema(key, "", old.Response, current.Response, false, &changes)
+	}
+	for key := range to.Routes {
+		if _, ok := from.Routes[key]; !ok {
+			changes = append(changes, APIChange{Route: key, Message: "增加了路由"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Breaking != changes[j].Breaking {
+			return changes[i].Breaking
+		}
+		if changes[i].Route != changes[j].Route {
+			return changes[i].Route < changes[j].Route
+		}
+
+		return changes[i].Field < changes[j].Field
+	})
+
+	return
+}
+
+// compareSchema 比较字段，request表示是请求还是响应，两者的兼容规则相反
+func compareSchema(route string, field string, from *Schema, to *Schema, request bool, changes *[]APIChange) {
+	change := func(message string, breaking bool) {
+		*changes = append(*changes, APIChange{Route: route, Field: field, Message: message, Breaking: breaking})
+	}
+
+	switch {
+	case nil == from && nil == to:
+		return
+	case nil == from:
+		change("增加了"+direction(request), request && 0 != len(to.Required))
+		return
+	case nil == to:
+		change("删除了"+direction(request), !request)
+		return
+	}
+
+	if from.Type != to.Type || from.Format != to.Format {
+		change(fmt.Sprintf("类型从%s变成了%s", schemaType(from), schemaType(to)), true)
+		return
+	}
+	if !request && !from.Nullable && to.Nullable {
+		change("变成了可空", true)
+	}
+	for _, value := range from.Enum {
+		if request && !containsValue(to.Enum, value) {
+			change(fmt.Sprintf("删除了枚举值%v", value), true)
+		}
+	}
+	for _, value := range to.Enum {
+		if !request && !containsValue(from.Enum, value) {
+			change(fmt.Sprintf("增加了枚举值%v", value), true)
+		}
+	}
+	if nil != from.Items || nil != to.Items {
+		compareSchema(route, field+"[]", from.Items, to.Items, request, changes)
+	}
+
+	for name, property := range from.Properties {
+		path := joinField(field, name)
+		current, ok := to.Properties[name]
+		if !ok {
+			// 请求中多余的字段会被忽略，删除请求字段是兼容的
+			*changes = append(*changes, APIChange{Route: route, Field: path, Message: "删除了字段", Breaking: !request})
+			continue
+		}
+		if request && !containsString(from.Required, name) && containsString(to.Required, name) {
+			*changes = append(*changes, APIChange{Route: route, Field: path, Message: "变成了必须字段", Breaking: true})
+		}
+		compareSchema(route, path, property, current, request, changes)
+	}
+	for name := range to.Properties {
+		if _, ok := from.Properties[name]; ok {
+			continue
+		}
+		breaking := request && containsString(to.Required, name)
+		message := "增加了字段"
+		if breaking {
+			message = "增加了必须字段"
+		}
+		*changes = append(*changes, APIChange{Route: route, Field: joinField(field, name), Message: message, Breaking: breaking})
+	}
+}
+
+// APICommand 处理接口快照命令，不是快照命令时handled为false
+//
+//	api snapshot <file> 保存当前接口的快照
+//	api check <file>    和保存的快照比较，有不兼容的变化时返回ErrBreakingChanges
+//
+// 命令会按配置创建服务来注册路由，但是不启动
+func APICommand(ec *EchoConfig, args []string, out io.Writer) (handled bool, err error) {
+	if 3 != len(args) || "api" != args[0] {
+		return
+	}
+	handled = true
+
+	New(ec)
+	current := Snapshot()
+	switch args[1] {
+	case "snapshot":
+		var data []byte
+		if data, err = json.MarshalIndent(current, "", "  "); nil != err {
+			return
+		}
+		err = ioutil.WriteFile(args[2], append(data, '\n'), 0644)
+	case "check":
+		var data []byte
+		if data, err = ioutil.ReadFile(args[2]); nil != err {
+			return
+		}
+		var previous APISnapshot
+		if err = json.Unmarshal(data, &previous); nil != err {
+			return
+		}
+
+		breaking := false
+		for _, change := range CompareSnapshots(previous, current) {
+			level := "ok"
+			if change.Breaking {
+				level = "BREAKING"
+				breaking = true
+			}
+			if _, err = fmt.Fprintf(out, "%-8s %s %s %s\n", level, change.Route, change.Field, change.Message); nil != err {
+				return
+			}
+		}
+		if breaking {
+			err = ErrBreakingChanges
+		}
+	default:
+		err = fmt.Errorf("不支持的接口命令：%s", args[1])
+	}
+
+	return
+}
+
+// snapshotKey 路径参数改名不影响调用方，参数统一成":"
+func snapshotKey(method string, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		}
+	}
+
+	return routeKey(method, strings.Join(segments, "/"))
+}
+
+func direction(request bool) string {
+	if request {
+		return "请求体"
+	}
+
+	return "响应体"
+}
+
+func schemaType(schema *Schema) string {
+	if "" != schema.Format {
+		return schema.Type + "(" + schema.Format + ")"
+	}
+
+	return schema.Type
+}
+
+func joinField(parent string, name string) string {
+	if "" == parent {
+		return name
+	}
+
+	return parent + "." + name
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,386 @@
+package echox
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	MIMETextEventStream = "text/event-stream"
+
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+type (
+	// CompressionConfig 响应压缩中间件的配置
+	CompressionConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 压缩级别
+		// 非必须 默认值是gzip.DefaultCompression
+		Level int
+
+		// 小于这个大小的响应不压缩
+		// 非必须 默认值是1024
+		MinSize int
+
+		// 按内容类型前缀配置的最小大小，比如"application/json": 256，没有匹配的使用MinSize
+		MinSizes map[string]int
+
+		// 需要压缩的内容类型
+		// 非必须 默认压缩除了图片、音视频和压缩包以外的所有类型
+		Types []string
+
+		// 不压缩的内容类型前缀，配置了Types时也生效
+		Exclude []string
+
+		// 客户端支持时优先使用Brotli
+		// 需要先调用RegisterBrotli注册编码器
+		Brotli bool
+	}
+
+	// BrotliEncoder 创建Brotli编码器
+	BrotliEncoder func(w io.Writer, level int) io.WriteCloser
+
+	// CompressionRecorder 记录压缩前后的大小，用来计算压缩率
+	CompressionRecorder interface {
+		ObserveCompression(encoding string, contentType string, in int64, out int64)
+	}
+
+	// countingWriter 统计压缩后写出的字节数
+	countingWriter struct {
+		io.Writer
+		written int64
+	}
+
+	compressWriter struct {
+		http.ResponseWriter
+		config   *CompressionConfig
+		encoding string
+		status   int
+		buffer   bytes.Buffer
+		// 处理器是否写过状态码
+		wroteHeader bool
+		// 是否已经决定了要不要压缩
+		decided bool
+		encoder io.WriteCloser
+		// 按内容类型确定的最小大小，第一次写入时确定
+		minSize   int
+		mediaType string
+		in        int64
+		out       *countingWriter
+	}
+)
+
+var (
+	// DefaultCompressionConfig 默认配置
+	DefaultCompressionConfig = CompressionConfig{
+		Skipper: middleware.DefaultSkipper,
+		Level:   gzip.DefaultCompression,
+		MinSize: 1024,
+	}
+
+	// 已经压缩过的内容类型，再压缩只会浪费CPU
+	compressedTypes = []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/pdf", "application/octet-stream",
+	}
+
+	brotliEncoder BrotliEncoder
+	gzipPools     sync.Map
+)
+
+// RegisterBrotli 注册Brotli编码器
+// echox不直接依赖Brotli的实现，比如：
+//
+//	echox.RegisterBrotli(func(w io.Writer, level int) io.WriteCloser {
+//		return brotli.NewWriterLevel(w, level)
+//	})
+func RegisterBrotli(encoder BrotliEncoder) {
+	brotliEncoder = encoder
+}
+
+// Compression 响应压缩中间件
+func Compression() echo.MiddlewareFunc {
+	return CompressionWithConfig(DefaultCompressionConfig)
+}
+
+// CompressionWithConfig 响应压缩中间件
+func CompressionWithConfig(config CompressionConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultCompressionConfig.Skipper
+	}
+	if 0 == config.Level {
+		config.Level = DefaultCompressionConfig.Level
+	}
+	if 0 == config.MinSize {
+		config.MinSize = DefaultCompressionConfig.MinSize
+	}
+	if config.Brotli && nil == brotliEncoder {
+		panic("echo: brotli compression requires RegisterBrotli")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			req := c.Request()
+			if config.Skipper(c) || "" != req.Header.Get(echo.HeaderUpgrade) ||
+				strings.Contains(req.Header.Get(echo.HeaderAccept), MIMETextEventStream) {
+				return next(c)
+			}
+
+			encoding := config.negotiate(req.Header.Get(echo.HeaderAcceptEncoding))
+			c.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			if "" == encoding {
+				return next(c)
+			}
+
+			writer := &compressWriter{
+				ResponseWriter: c.Response().Writer,
+				config:         &config,
+				encoding:       encoding,
+				status:         http.StatusOK,
+			}
+			c.Response().Writer = writer
+			defer func() {
+				if closeErr := writer.Close(); nil == err {
+					err = closeErr
+				}
+				c.Response().Writer = writer.ResponseWriter
+			}()
+			err = next(c)
+
+			return
+		}
+	}
+}
+
+// negotiate 选择客户端支持的编码
+func (cc *CompressionConfig) negotiate(acceptEncoding string) (encoding string) {
+	eachHeaderValue(acceptEncoding, func(name string) bool {
+		if index := strings.IndexByte(name, ';'); -1 != index {
+			params := strings.TrimSpace(name[index+1:])
+			name = strings.TrimSpace(name[:index])
+			if strings.HasPrefix(params, "q=") {
+				if q, err := strconv.ParseFloat(params[2:], 64); nil == err && 0 == q {
+					return true
+				}
+			}
+		}
+
+		switch name {
+		case encodingBrotli:
+			if cc.Brotli {
+				encoding = encodingBrotli
+
+				return false
+			}
+		case encodingGzip, "*":
+			encoding = encodingGzip
+		}
+
+		return true
+	})
+
+	return
+}
+
+// compressible 内容类型是否需要压缩
+func (cc *CompressionConfig) compressible(mediaType string) bool {
+	if MIMETextEventStream == mediaType {
+		return false
+	}
+	for _, t := range cc.Exclude {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+
+	if 0 != len(cc.Types) {
+		for _, t := range cc.Types {
+			if strings.HasPrefix(mediaType, t) {
+				return true
+			}
+		}
+
+		return false
+	}
+	for _, t := range compressedTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// minSize 内容类型对应的最小大小，匹配最长的前缀
+func (cc *CompressionConfig) minSize(mediaType string) (size int) {
+	size = cc.MinSize
+	matched := -1
+	for prefix, value := range cc.MinSizes {
+		if strings.HasPrefix(mediaType, prefix) && len(prefix) > matched {
+			size, matched = value, len(prefix)
+		}
+	}
+
+	return
+}
+
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if nil != err {
+		mediaType = contentType
+	}
+
+	return mediaType
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	cw.status = code
+	cw.wroteHeader = true
+	if http.StatusNoContent == code || http.StatusNotModified == code || code < http.StatusOK {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		if nil != cw.encoder {
+			cw.in += int64(len(b))
+			return cw.encoder.Write(b)
+		}
+
+		return cw.ResponseWriter.Write(b)
+	}
+
+	if 0 == cw.buffer.Len() {
+		// 处理器一般在写入前设置内容类型
+		cw.mediaType = mediaTypeOf(cw.ResponseWriter.Header().Get(echo.HeaderContentType))
+		cw.minSize = cw.config.minSize(cw.mediaType)
+	}
+	cw.buffer.Write(b)
+	// 不压缩的类型不用等到最小大小，直接写出
+	if cw.buffer.Len() >= cw.minSize || !cw.config.compressible(cw.mediaType) {
+		if err := cw.decide(true); nil != err {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(0 != cw.buffer.Len() && cw.buffer.Len() >= cw.minSize)
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return cw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Close 写出剩余的数据
+// 处理器什么都没有写时不写出响应头，处理器返回错误时留给错误处理写出错误的状态码
+func (cw *compressWriter) Close() (err error) {
+	if !cw.decided && (cw.wroteHeader || 0 != cw.buffer.Len()) {
+		err = cw.decide(false)
+	}
+	if nil != cw.encoder {
+		if closeErr := cw.encoder.Close(); nil == err {
+			err = closeErr
+		}
+		if gw, ok := cw.encoder.(*gzip.Writer); ok {
+			gzipPool(cw.config.Level).Put(gw)
+		}
+		if recorder, ok := metricsRecorder.(CompressionRecorder); ok {
+			recorder.ObserveCompression(cw.encoding, cw.mediaType, cw.in, cw.out.written)
+		}
+	}
+
+	return
+}
+
+// decide 决定是否压缩，并写出响应头和缓冲的数据
+func (cw *compressWriter) decide(large bool) (err error) {
+	cw.decided = true
+	header := cw.ResponseWriter.Header()
+	if 0 == cw.buffer.Len() && !large {
+		cw.ResponseWriter.WriteHeader(cw.status)
+
+		return
+	}
+
+	if large && "" == header.Get(echo.HeaderContentEncoding) && cw.config.compressible(mediaTypeOf(header.Get(echo.HeaderContentType))) {
+		header.Set(echo.HeaderContentEncoding, cw.encoding)
+		header.Del(echo.HeaderContentLength)
+		cw.encoder = cw.newEncoder()
+	} else if !large && 0 != cw.buffer.Len() && "" == header.Get(echo.HeaderContentLength) {
+		// 只有全部数据都在缓冲里时才知道长度
+		header.Set(echo.HeaderContentLength, strconv.Itoa(cw.buffer.Len()))
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if nil != cw.encoder {
+		cw.in += int64(cw.buffer.Len())
+		_, err = cw.encoder.Write(cw.buffer.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buffer.Bytes())
+	}
+	cw.buffer.Reset()
+
+	return
+}
+
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+	cw.out = &countingWriter{Writer: cw.ResponseWriter}
+	if encodingBrotli == cw.encoding {
+		return brotliEncoder(cw.out, cw.config.Level)
+	}
+
+	gw := gzipPool(cw.config.Level).Get().(*gzip.Writer)
+	gw.Reset(cw.out)
+
+	return gw
+}
+
+func (cw *countingWriter) Write(b []byte) (n int, err error) {
+	n, err = cw.Writer.Write(b)
+	cw.written += int64(n)
+
+	return
+}
+
+func gzipPool(level int) *sync.Pool {
+	pool, _ := gzipPools.LoadOrStore(level, &sync.Pool{
+		New: func() interface{} {
+			gw, err := gzip.NewWriterLevel(nil, level)
+			if nil != err {
+				gw = gzip.NewWriter(nil)
+			}
+
+			return gw
+		},
+	})
+
+	return pool.(*sync.Pool)
+}
@@ -0,0 +1,579 @@
+package echox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// ConsulConfig Consul KV的配置
+	ConsulConfig struct {
+		// 服务地址
+		// 非必须 默认值是http://127.0.0.1:8500
+		Address string
+
+		// 配置的键
+		// 必须字段
+		Key string
+
+		Token      string
+		Datacenter string
+
+		// 阻塞查询的等待时间
+		// 非必须 默认值是5分钟
+		Wait time.Duration
+
+		// 非必须 默认不超时，超时时间要大于Wait
+		Client *http.Client
+	}
+
+	// EtcdConfig etcd v3的配置，通过etcd的HTTP网关访问
+	EtcdConfig struct {
+		// 服务地址
+		// 非必须 默认值是http://127.0.0.1:2379
+		Endpoint string
+
+		// 配置的键
+		// 必须字段
+		Key string
+
+		// 认证令牌，通过/v3/auth/authenticate获取
+		Token string
+
+		// 非必须 默认不超时，监听是长连接
+		Client *http.Client
+	}
+
+	// ApolloConfig Apollo的配置
+	ApolloConfig struct {
+		// 配置服务的地址，比如http://apollo-config:8080
+		// 必须字段
+		Address string
+
+		// 必须字段
+		AppId string
+
+		// 非必须 默认值是default
+		Cluster string
+
+		// 命名空间，properties格式的配置转换成YAML
+		// 非必须 默认值是application
+		Namespace string
+
+		// 访问密钥，开启了访问控制时需要
+		Secret string
+
+		// 非必须 默认不超时，长轮询会等待60秒
+		Client *http.Client
+	}
+
+	// NacosConfig Nacos的配置
+	NacosConfig struct {
+		// 服务地址
+		// 非必须 默认值是http://127.0.0.1:8848
+		Address string
+
+		// 必须字段
+		DataId string
+
+		// 非必须 默认值是DEFAULT_GROUP
+		Group string
+
+		// 命名空间编号
+		Tenant string
+
+		AccessToken string
+
+		// 非必须 默认不超时，长轮询会等待30秒
+		Client *http.Client
+	}
+
+	consulProvider struct {
+		config ConsulConfig
+	}
+
+	etcdProvider struct {
+		config EtcdConfig
+	}
+
+	apolloProvider struct {
+		config ApolloConfig
+	}
+
+	nacosProvider struct {
+		config NacosConfig
+	}
+
+	// etcdKeyValue 值是base64编码的
+	etcdKeyValue struct {
+		Value string `json:"value"`
+	}
+
+	// etcdHeader etcd网关返回的int64是字符串
+	etcdHeader struct {
+		Revision json.Number `json:"revision"`
+	}
+
+	apolloNotification struct {
+		NamespaceName  string `json:"namespaceName"`
+		NotificationId int64  `json:"notificationId"`
+	}
+)
+
+// NewConsulProvider 创建Consul KV配置中心，使用阻塞查询监听变化
+func NewConsulProvider(config ConsulConfig) ConfigProvider {
+	if "" == config.Key {
+		panic("echo: consul provider requires a key")
+	}
+	if "" == config.Address {
+		config.Address = "http://127.0.0.1:8500"
+	}
+	if 0 >= config.Wait {
+		config.Wait = 5 * time.Minute
+	}
+	if nil == config.Client {
+		config.Client = &http.Client{}
+	}
+
+	return &consulProvider{config: config}
+}
+
+func (cp *consulProvider) Get(ctx context.Context) (data []byte, err error) {
+	data, _, err = cp.get(ctx, 0)
+
+	return
+}
+
+func (cp *consulProvider) Watch(ctx context.Context, onChange func(data []byte)) (err error) {
+	var index uint64
+	if _, index, err = cp.get(ctx, 0); nil != err && ErrConfigNotFound != err {
+		return
+	}
+
+	for {
+		var data []byte
+		var next uint64
+		data, next, err = cp.get(ctx, index)
+		if nil != ctx.Err() {
+			return nil
+		}
+		// 配置被删除时继续使用当前配置
+		if nil != err && ErrConfigNotFound != err {
+			return
+		}
+		if nil == err && next != index {
+			onChange(data)
+		}
+		// 索引变小说明Consul重建过，重新开始
+		if next < index {
+			next = 0
+		}
+		index = next
+	}
+}
+
+func (cp *consulProvider) get(ctx context.Context, index uint64) (data []byte, next uint64, err error) {
+	query := url.Values{"raw": {"true"}}
+	if 0 != index {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(cp.config.Wait.Seconds())))
+	}
+	if "" != cp.config.Datacenter {
+		query.Set("dc", cp.config.Datacenter)
+	}
+	header := http.Header{}
+	if "" != cp.config.Token {
+		header.Set("X-Consul-Token", cp.config.Token)
+	}
+
+	var rsp *http.Response
+	address := fmt.Sprintf("%s/v1/kv/%s?%s", strings.TrimSuffix(cp.config.Address, "/"), strings.TrimPrefix(cp.config.Key, "/"), query.Encode())
+	if rsp, data, err = remoteRequest(ctx, cp.config.Client, http.MethodGet, address, nil, header); nil != err {
+		return
+	}
+	next, _ = strconv.ParseUint(rsp.Header.Get("X-Consul-Index"), 10, 64)
+	err = remoteStatus(rsp, data)
+
+	return
+}
+
+// NewEtcdProvider 创建etcd配置中心，使用watch接口监听变化
+func NewEtcdProvider(config EtcdConfig) ConfigProvider {
+	if "" == config.Key {
+		panic("echo: etcd provider requires a key")
+	}
+	if "" == config.Endpoint {
+		config.Endpoint = "http://127.0.0.1:2379"
+	}
+	if nil == config.Client {
+		config.Client = &http.Client{}
+	}
+
+	return &etcdProvider{config: config}
+}
+
+func (ep *etcdProvider) Get(ctx context.Context) (data []byte, err error) {
+	data, _, err = ep.get(ctx)
+
+	return
+}
+
+func (ep *etcdProvider) Watch(ctx context.Context, onChange func(data []byte)) (err error) {
+	var revision int64
+	if _, revision, err = ep.get(ctx); nil != err && ErrConfigNotFound != err {
+		return
+	}
+
+	var body []byte
+	if body, err = json.Marshal(map[string]interface{}{
+		"create_request": map[string]string{
+			"key":            base64.StdEncoding.EncodeToString([]byte(ep.config.Key)),
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	}); nil != err {
+		return
+	}
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, ep.url("/v3/watch"), bytes.NewReader(body)); nil != err {
+		return
+	}
+	ep.header(req.Header)
+	var rsp *http.Response
+	if rsp, err = ep.config.Client.Do(req); nil != err {
+		if nil != ctx.Err() {
+			err = nil
+		}
+
+		return
+	}
+	defer rsp.Body.Close()
+	if http.StatusOK != rsp.StatusCode {
+		return fmt.Errorf("配置中心返回%d", rsp.StatusCode)
+	}
+
+	// 响应是一直不结束的JSON流，每个变化一个对象
+	decoder := json.NewDecoder(rsp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Canceled bool `json:"canceled"`
+				Events   []struct {
+					Type string       `json:"type"`
+					Kv   etcdKeyValue `json:"kv"`
+				} `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err = decoder.Decode(&message); nil != err {
+			if nil != ctx.Err() {
+				err = nil
+			}
+
+			return
+		}
+		if nil != message.Error {
+			return fmt.Errorf("etcd watch: %s", message.Error.Message)
+		}
+		// 历史版本被压缩后监听会被取消，重新读取后再监听
+		if message.Result.Canceled {
+			return fmt.Errorf("etcd watch canceled")
+		}
+		for _, event := range message.Result.Events {
+			if "DELETE" == event.Type {
+				continue
+			}
+
+			var data []byte
+			if data, err = base64.StdEncoding.DecodeString(event.Kv.Value); nil != err {
+				return
+			}
+			onChange(data)
+		}
+	}
+}
+
+func (ep *etcdProvider) get(ctx context.Context) (data []byte, revision int64, err error) {
+	var body []byte
+	if body, err = json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(ep.config.Key))}); nil != err {
+		return
+	}
+	header := http.Header{}
+	ep.header(header)
+
+	var rsp *http.Response
+	var raw []byte
+	if rsp, raw, err = remoteRequest(ctx, ep.config.Client, http.MethodPost, ep.url("/v3/kv/range"), bytes.NewReader(body), header); nil != err {
+		return
+	}
+	if err = remoteStatus(rsp, raw); nil != err {
+		return
+	}
+
+	var result struct {
+		Header etcdHeader     `json:"header"`
+		Kvs    []etcdKeyValue `json:"kvs"`
+	}
+	if err = json.Unmarshal(raw, &result); nil != err {
+		return
+	}
+	revision, _ = result.Header.Revision.Int64()
+	if 0 == len(result.Kvs) {
+		err = ErrConfigNotFound
+
+		return
+	}
+	data, err = base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+
+	return
+}
+
+func (ep *etcdProvider) url(path string) string {
+	return strings.TrimSuffix(ep.config.Endpoint, "/") + path
+}
+
+func (ep *etcdProvider) header(header http.Header) {
+	header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if "" != ep.config.Token {
+		header.Set(echo.HeaderAuthorization, ep.config.Token)
+	}
+}
+
+// NewApolloProvider 创建Apollo配置中心，使用通知接口长轮询监听变化
+func NewApolloProvider(config ApolloConfig) ConfigProvider {
+	if "" == config.Address {
+		panic("echo: apollo provider requires an address")
+	}
+	if "" == config.AppId {
+		panic("echo: apollo provider requires an app id")
+	}
+	if "" == config.Cluster {
+		config.Cluster = "default"
+	}
+	if "" == config.Namespace {
+		config.Namespace = "application"
+	}
+	if nil == config.Client {
+		config.Client = &http.Client{}
+	}
+
+	return &apolloProvider{config: config}
+}
+
+func (ap *apolloProvider) Get(ctx context.Context) (data []byte, err error) {
+	path := fmt.Sprintf("/configs/%s/%s/%s", url.PathEscape(ap.config.AppId), url.PathEscape(ap.config.Cluster), url.PathEscape(ap.config.Namespace))
+
+	var rsp *http.Response
+	var raw []byte
+	if rsp, raw, err = remoteRequest(ctx, ap.config.Client, http.MethodGet, ap.config.Address+path, nil, ap.header(path)); nil != err {
+		return
+	}
+	if err = remoteStatus(rsp, raw); nil != err {
+		return
+	}
+
+	var result struct {
+		Configurations map[string]string `json:"configurations"`
+	}
+	if err = json.Unmarshal(raw, &result); nil != err {
+		return
+	}
+	// yaml、json等格式的命名空间内容在content中
+	if content, ok := result.Configurations["content"]; ok && strings.Contains(ap.config.Namespace, ".") {
+		return []byte(content), nil
+	}
+
+	return yaml.Marshal(result.Configurations)
+}
+
+func (ap *apolloProvider) Watch(ctx context.Context, onChange func(data []byte)) (err error) {
+	id := int64(-1)
+	for {
+		var notifications []byte
+		if notifications, err = json.Marshal([]apolloNotification{{NamespaceName: ap.config.Namespace, NotificationId: id}}); nil != err {
+			return
+		}
+		query := url.Values{
+			"appId":         {ap.config.AppId},
+			"cluster":       {ap.config.Cluster},
+			"notifications": {string(notifications)},
+		}
+		path := "/notifications/v2?" + query.Encode()
+
+		// 服务端最多等待60秒
+		pollCtx, cancel := context.WithTimeout(ctx, 90*time.Second)
+		rsp, raw, pollErr := remoteRequest(pollCtx, ap.config.Client, http.MethodGet, ap.config.Address+path, nil, ap.header(path))
+		cancel()
+		if nil != ctx.Err() {
+			return nil
+		}
+		if nil != pollErr {
+			return pollErr
+		}
+		if http.StatusNotModified == rsp.StatusCode {
+			continue
+		}
+		if err = remoteStatus(rsp, raw); nil != err {
+			return
+		}
+
+		var changed []apolloNotification
+		if err = json.Unmarshal(raw, &changed); nil != err {
+			return
+		}
+		for _, notification := range changed {
+			if notification.NamespaceName == ap.config.Namespace {
+				id = notification.NotificationId
+			}
+		}
+
+		var data []byte
+		if data, err = ap.Get(ctx); nil != err {
+			return
+		}
+		onChange(data)
+	}
+}
+
+// header 开启访问控制时的签名
+func (ap *apolloProvider) header(pathWithQuery string) (header http.Header) {
+	header = http.Header{}
+	if "" == ap.config.Secret {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha1.New, []byte(ap.config.Secret))
+	mac.Write([]byte(timestamp + "\n" + pathWithQuery))
+	header.Set(echo.HeaderAuthorization, fmt.Sprintf("Apollo %s:%s", ap.config.AppId, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	header.Set("Timestamp", timestamp)
+
+	return
+}
+
+// NewNacosProvider 创建Nacos配置中心，使用监听接口长轮询监听变化
+func NewNacosProvider(config NacosConfig) ConfigProvider {
+	if "" == config.DataId {
+		panic("echo: nacos provider requires a data id")
+	}
+	if "" == config.Address {
+		config.Address = "http://127.0.0.1:8848"
+	}
+	if "" == config.Group {
+		config.Group = "DEFAULT_GROUP"
+	}
+	if nil == config.Client {
+		config.Client = &http.Client{}
+	}
+
+	return &nacosProvider{config: config}
+}
+
+func (np *nacosProvider) Get(ctx context.Context) (data []byte, err error) {
+	query := np.query()
+	query.Set("dataId", np.config.DataId)
+	query.Set("group", np.config.Group)
+	if "" != np.config.Tenant {
+		query.Set("tenant", np.config.Tenant)
+	}
+
+	var rsp *http.Response
+	if rsp, data, err = remoteRequest(ctx, np.config.Client, http.MethodGet, np.config.Address+"/nacos/v1/cs/configs?"+query.Encode(), nil, nil); nil != err {
+		return
+	}
+	err = remoteStatus(rsp, data)
+
+	return
+}
+
+func (np *nacosProvider) Watch(ctx context.Context, onChange func(data []byte)) (err error) {
+	var data []byte
+	if data, err = np.Get(ctx); nil != err && ErrConfigNotFound != err {
+		return
+	}
+	hash := ""
+	if nil == err {
+		hash = md5Hex(data)
+	}
+
+	header := http.Header{}
+	header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	header.Set("Long-Pulling-Timeout", "30000")
+	for {
+		// 格式是dataId^2group^2md5^2tenant^1
+		listening := []string{np.config.DataId, np.config.Group, hash}
+		if "" != np.config.Tenant {
+			listening = append(listening, np.config.Tenant)
+		}
+		form := url.Values{"Listening-Configs": {strings.Join(listening, "\x02") + "\x01"}}
+
+		pollCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
+		rsp, raw, pollErr := remoteRequest(pollCtx, np.config.Client, http.MethodPost, np.config.Address+"/nacos/v1/cs/configs/listener?"+np.query().Encode(), strings.NewReader(form.Encode()), header)
+		cancel()
+		if nil != ctx.Err() {
+			return nil
+		}
+		if nil != pollErr {
+			return pollErr
+		}
+		if err = remoteStatus(rsp, raw); nil != err {
+			return
+		}
+		// 没有变化时返回空
+		if 0 == len(bytes.TrimSpace(raw)) {
+			continue
+		}
+
+		if data, err = np.Get(ctx); ErrConfigNotFound == err {
+			hash = ""
+			continue
+		} else if nil != err {
+			return
+		}
+		hash = md5Hex(data)
+		onChange(data)
+	}
+}
+
+func (np *nacosProvider) query() url.Values {
+	query := url.Values{}
+	if "" != np.config.AccessToken {
+		query.Set("accessToken", np.config.AccessToken)
+	}
+
+	return query
+}
+
+// remoteStatus 把配置中心的错误响应转换成错误
+func remoteStatus(rsp *http.Response, data []byte) (err error) {
+	switch {
+	case http.StatusNotFound == rsp.StatusCode:
+		err = ErrConfigNotFound
+	case http.StatusOK != rsp.StatusCode:
+		err = fmt.Errorf("配置中心返回%d：%s", rsp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,221 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// configDriftInterval 检查启动时传入的配置有没有被修改的间隔
+const configDriftInterval = time.Minute
+
+var (
+	// startedConfig 调用方传给StartWith或者Reload的配置，snapshotConfig是它当时的副本
+	startedConfig  *EchoConfig
+	snapshotConfig *EchoConfig
+)
+
+// Clone 深拷贝配置，XxxConfig结构、切片和映射都会复制，JWTConfig通过它自己的Clone复制
+// 存储、客户端和函数这些有状态的对象，以及其它带锁的配置仍然共享
+func (ec *EchoConfig) Clone() *EchoConfig {
+	cloned := new(EchoConfig)
+	reflect.ValueOf(cloned).Elem().Set(cloneValue(reflect.ValueOf(ec).Elem()))
+
+	return cloned
+}
+
+// RunningConfig 正在运行的配置的副本，修改副本不会影响运行的服务，需要修改时使用Reload
+func RunningConfig() *EchoConfig {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if nil == applied {
+		return nil
+	}
+
+	return applied.Clone()
+}
+
+// watchDrift 记录调用方的配置和它当时的副本，用来检测启动后的修改
+func watchDrift(ec *EchoConfig) {
+	startedConfig, snapshotConfig = ec, ec.Clone()
+}
+
+// driftWorker 检测调用方在启动后直接修改了传入的配置，记录警告提示使用Reload
+// 运行的服务使用的是启动时复制的配置，不会读取调用方的配置，这里只是提醒修改没有生效
+// 每个修改过的字段只警告一次
+func driftWorker(e *echo.Echo) Worker {
+	warned := ""
+
+	return Worker{
+		Name:     "config-drift",
+		Interval: configDriftInterval,
+		Run: func(_ context.Context) error {
+			reloadMutex.Lock()
+			field := ""
+			if nil != startedConfig {
+				field = changedField("EchoConfig", reflect.ValueOf(startedConfig).Elem(), reflect.ValueOf(snapshotConfig).Elem())
+			}
+			reloadMutex.Unlock()
+
+			if "" != field && field != warned {
+				e.Logger.Warnf("启动后修改了配置%s，修改不会生效，需要调用Reload", field)
+			}
+			warned = field
+
+			return nil
+		},
+	}
+}
+
+// changedField 按Clone的规则比较配置，返回第一个不同的字段，没有被复制的对象只比较是不是同一个
+func changedField(path string, value reflect.Value, snapshot reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() || snapshot.IsNil() || (!clonable(value.Type().Elem()) && jwtConfigType != value.Type()) {
+			if value.Pointer() != snapshot.Pointer() {
+				return path
+			}
+
+			return ""
+		}
+
+		return changedField(path, value.Elem(), snapshot.Elem())
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if "" != value.Type().Field(i).PkgPath {
+				continue
+			}
+			if field := changedField(path+"."+value.Type().Field(i).Name, value.Field(i), snapshot.Field(i)); "" != field {
+				return field
+			}
+		}
+	case reflect.Slice:
+		if value.IsNil() != snapshot.IsNil() || value.Len() != snapshot.Len() {
+			return path
+		}
+		for i := 0; i < value.Len(); i++ {
+			if field := changedField(fmt.Sprintf("%s[%d]", path, i), value.Index(i), snapshot.Index(i)); "" != field {
+				return field
+			}
+		}
+	case reflect.Map:
+		if value.IsNil() != snapshot.IsNil() || value.Len() != snapshot.Len() {
+			return path
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			snapshotValue := snapshot.MapIndex(iter.Key())
+			if !snapshotValue.IsValid() {
+				return fmt.Sprintf("%s[%v]", path, iter.Key())
+			}
+			if field := changedField(fmt.Sprintf("%s[%v]", path, iter.Key()), iter.Value(), snapshotValue); "" != field {
+				return field
+			}
+		}
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		if value.Pointer() != snapshot.Pointer() {
+			return path
+		}
+	case reflect.Interface:
+		if value.IsNil() || snapshot.IsNil() {
+			if value.IsNil() != snapshot.IsNil() {
+				return path
+			}
+
+			return ""
+		}
+		if value.Elem().Type() != snapshot.Elem().Type() {
+			return path
+		}
+
+		return changedField(path, value.Elem(), snapshot.Elem())
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if field := changedField(fmt.Sprintf("%s[%d]", path, i), value.Index(i), snapshot.Index(i)); "" != field {
+				return field
+			}
+		}
+	default:
+		if value.Interface() != snapshot.Interface() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+func cloneValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Ptr:
+		// JWTConfig带有运行时替换的密钥，New还会填充默认值，不能和调用方共享
+		if jwtConfigType == value.Type() && !value.IsNil() {
+			return reflect.ValueOf(value.Interface().(*JWTConfig).Clone())
+		}
+		if value.IsNil() || !clonable(value.Type().Elem()) {
+			return value
+		}
+		cloned := reflect.New(value.Type().Elem())
+		cloned.Elem().Set(cloneValue(value.Elem()))
+
+		return cloned
+	case reflect.Struct:
+		cloned := reflect.New(value.Type()).Elem()
+		cloned.Set(value)
+		for i := 0; i < cloned.NumField(); i++ {
+			if field := cloned.Field(i); field.CanSet() {
+				field.Set(cloneValue(value.Field(i)))
+			}
+		}
+
+		return cloned
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		cloned := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			cloned.Index(i).Set(cloneValue(value.Index(i)))
+		}
+
+		return cloned
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		cloned := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			cloned.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+
+		return cloned
+	}
+
+	return value
+}
+
+var jwtConfigType = reflect.TypeOf((*JWTConfig)(nil))
+
+// clonable 只复制纯数据的配置结构
+func clonable(typ reflect.Type) bool {
+	return reflect.Struct == typ.Kind() && strings.HasSuffix(typ.Name(), "Config") && !hasLocks(typ)
+}
+
+func hasLocks(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i).Type
+		if path := field.PkgPath(); "sync" == path || "sync/atomic" == path {
+			return true
+		}
+		if reflect.Struct == field.Kind() && hasLocks(field) {
+			return true
+		}
+	}
+
+	return false
+}
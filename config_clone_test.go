@@ -0,0 +1,55 @@
+package echox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloneCopiesJWTConfig(t *testing.T) {
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+
+	cloned := ec.Clone()
+	if cloned.JWT == ec.JWT {
+		t.Fatal("复制的配置和调用方共用了JWTConfig")
+	}
+	New(cloned)
+	cloned.JWT.SetSigningKey("rotated")
+
+	if "" != ec.JWT.SigningMethod || nil != ec.JWT.Extractor {
+		t.Fatal("New修改了调用方的JWTConfig")
+	}
+	if "secret" != ec.JWT.signingKey() {
+		t.Fatal("替换密钥修改了调用方的JWTConfig")
+	}
+	if "rotated" != cloned.JWT.Clone().SigningKey {
+		t.Fatal("复制的应该是当前使用的密钥")
+	}
+	if _, err := ec.JWT.ServiceToken("billing", 0); nil != err {
+		t.Fatalf("没有初始化的配置也应该可以签发Token：%v", err)
+	}
+}
+
+func TestChangedFieldDetectsDrift(t *testing.T) {
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+	ec.RateLimit = &RateLimitConfig{Rate: 10}
+	snapshot := ec.Clone()
+
+	changed := func() string {
+		return changedField("EchoConfig", reflect.ValueOf(ec).Elem(), reflect.ValueOf(snapshot).Elem())
+	}
+	if field := changed(); "" != field {
+		t.Fatalf("没有修改时报告了%s", field)
+	}
+
+	ec.RateLimit.Rate = 20
+	if field := changed(); "EchoConfig.RateLimit.Rate" != field {
+		t.Fatalf("报告了%q", field)
+	}
+	ec.RateLimit.Rate = 10
+	ec.JWT.SigningKey = "changed"
+	if field := changed(); "EchoConfig.JWT.SigningKey" != field {
+		t.Fatalf("报告了%q", field)
+	}
+}
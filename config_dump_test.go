@@ -0,0 +1,50 @@
+package echox
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type dumpedConfig struct {
+	Header   http.Header
+	Metadata map[string]string
+	URL      string
+	Address  string
+	DSN      string
+	Cookie   string
+	Name     string
+}
+
+func TestDumpRedactsCredentials(t *testing.T) {
+	dumped := dump(reflect.ValueOf(&dumpedConfig{
+		Header:   http.Header{"Authorization": {"Bearer abc"}, "Accept": {"application/json"}},
+		Metadata: map[string]string{"Cookie": "session=abc", "Set-Cookie": "session=abc", "region": "cn"},
+		URL:      "redis://user:p@ss@localhost:6379/0",
+		Address:  "app:secret@tcp(localhost:3306)/app",
+		DSN:      "host=localhost password=secret",
+		Cookie:   "session=abc",
+		Name:     "echox",
+	}), "", 0).(map[string]interface{})
+
+	header := dumped["Header"].(map[string]interface{})
+	if maskedValue != header["Authorization"] || "application/json" != header["Accept"].([]interface{})[0] {
+		t.Fatalf("请求头是%v", header)
+	}
+	metadata := dumped["Metadata"].(map[string]interface{})
+	if maskedValue != metadata["Cookie"] || maskedValue != metadata["Set-Cookie"] || "cn" != metadata["region"] {
+		t.Fatalf("映射是%v", metadata)
+	}
+	expected := map[string]interface{}{
+		"URL":     "redis://user:" + maskedValue + "@localhost:6379/0",
+		"Address": "app:" + maskedValue + "@tcp(localhost:3306)/app",
+		"DSN":     maskedValue,
+		"Cookie":  maskedValue,
+		"Name":    "echox",
+	}
+	for name, value := range expected {
+		if value != dumped[name] {
+			t.Errorf("%s是%v，应该是%v", name, dumped[name], value)
+		}
+	}
+}
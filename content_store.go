@@ -0,0 +1,265 @@
+package echox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// BlobIndex 内容的引用计数
+	BlobIndex interface {
+		// Acquire 增加引用，返回增加后的引用数，内容第一次出现时为1
+		Acquire(ctx context.Context, hash string, object StoredObject) (refs int64, err error)
+		// Release 减少引用，返回减少后的引用数
+		Release(ctx context.Context, hash string) (refs int64, err error)
+		// Get 内容的信息，不存在时返回ErrObjectNotFound
+		Get(ctx context.Context, hash string) (object StoredObject, refs int64, err error)
+		// Orphans 引用数为0并且在before之前变成0的内容
+		Orphans(ctx context.Context, before time.Time) (hashes []string, err error)
+		// Forget 删除内容的记录
+		Forget(ctx context.Context, hash string) error
+	}
+
+	// ContentStore 按内容寻址的存储，相同的内容只保存一份
+	// 实现了Storage接口，可以直接作为上传的存储，Put时的key被忽略，返回的Key是内容的SHA-256
+	ContentStore struct {
+		storage Storage
+		index   BlobIndex
+		locks   sync.Map
+	}
+
+	memoryBlob struct {
+		object   StoredObject
+		refs     int64
+		orphaned time.Time
+	}
+
+	// memoryBlobIndex 内存中的引用计数，适合测试和单实例
+	memoryBlobIndex struct {
+		mutex sync.Mutex
+		blobs map[string]*memoryBlob
+	}
+)
+
+// NewContentStore 创建按内容寻址的存储
+func NewContentStore(storage Storage, index BlobIndex) *ContentStore {
+	if nil == storage {
+		panic("echo: content store requires a storage")
+	}
+	if nil == index {
+		index = NewMemoryBlobIndex()
+	}
+
+	return &ContentStore{storage: storage, index: index}
+}
+
+// NewMemoryBlobIndex 创建内存中的引用计数
+func NewMemoryBlobIndex() BlobIndex {
+	return &memoryBlobIndex{blobs: make(map[string]*memoryBlob)}
+}
+
+// Put 保存内容，内容已经存在时只增加引用
+func (cs *ContentStore) Put(ctx context.Context, _ string, reader io.Reader, _ int64, contentType string) (object StoredObject, err error) {
+	// 先写到临时文件，算出哈希后才知道是不是重复的内容
+	file, err := ioutil.TempFile("", "echox-blob-*")
+	if nil != err {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if nil != err {
+		return
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	unlock := cs.lock(key)
+	defer unlock()
+
+	var refs int64
+	if object, refs, err = cs.index.Get(ctx, key); nil == err && 0 < refs {
+		_, err = cs.index.Acquire(ctx, key, object)
+		return
+	}
+	if nil != err && ErrObjectNotFound != err {
+		return
+	}
+
+	// 引用数为0但是还没有被回收的内容可以直接复用
+	if ErrObjectNotFound == err {
+		if _, err = file.Seek(0, io.SeekStart); nil != err {
+			return
+		}
+		if object, err = cs.storage.Put(ctx, cs.path(key), file, size, contentType); nil != err {
+			return
+		}
+		object.Key = key
+	}
+	_, err = cs.index.Acquire(ctx, key, object)
+
+	return
+}
+
+// Open 读取内容
+func (cs *ContentStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return cs.storage.Open(ctx, cs.path(key))
+}
+
+// Delete 减少引用，内容在回收时才真正删除
+func (cs *ContentStore) Delete(ctx context.Context, key string) (err error) {
+	unlock := cs.lock(key)
+	defer unlock()
+
+	_, err = cs.index.Release(ctx, key)
+
+	return
+}
+
+// Stat 内容的信息和引用数
+func (cs *ContentStore) Stat(ctx context.Context, key string) (StoredObject, int64, error) {
+	return cs.index.Get(ctx, key)
+}
+
+// GC 删除引用数变成0超过grace的内容，返回删除的个数
+func (cs *ContentStore) GC(ctx context.Context, grace time.Duration) (deleted int, err error) {
+	hashes, err := cs.index.Orphans(ctx, time.Now().Add(-grace))
+	if nil != err {
+		return
+	}
+
+	for _, hash := range hashes {
+		if err = cs.collect(ctx, hash); nil != err {
+			return
+		}
+		deleted++
+	}
+
+	return
+}
+
+// Worker 定时回收的后台任务
+func (cs *ContentStore) Worker(interval time.Duration, grace time.Duration) Worker {
+	return Worker{
+		Name:     "content-store-gc",
+		Interval: interval,
+		Run: func(ctx context.Context) (err error) {
+			_, err = cs.GC(ctx, grace)
+			return
+		},
+	}
+}
+
+func (cs *ContentStore) collect(ctx context.Context, hash string) (err error) {
+	unlock := cs.lock(hash)
+	defer unlock()
+
+	// 加锁后重新确认，期间可能又被引用了
+	if _, refs, getErr := cs.index.Get(ctx, hash); nil != getErr || 0 < refs {
+		return
+	}
+	if err = cs.storage.Delete(ctx, cs.path(hash)); nil != err {
+		return
+	}
+
+	return cs.index.Forget(ctx, hash)
+}
+
+// path 按哈希的前两位分目录，避免单个目录下文件太多
+func (cs *ContentStore) path(hash string) string {
+	hash = strings.ToLower(hash)
+	if 2 >= len(hash) {
+		return "sha256/" + hash
+	}
+
+	return "sha256/" + hash[:2] + "/" + hash
+}
+
+func (cs *ContentStore) lock(hash string) func() {
+	mutex, _ := cs.locks.LoadOrStore(hash, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+
+	return mutex.(*sync.Mutex).Unlock
+}
+
+func (mbi *memoryBlobIndex) Acquire(_ context.Context, hash string, object StoredObject) (refs int64, err error) {
+	mbi.mutex.Lock()
+	defer mbi.mutex.Unlock()
+
+	blob, ok := mbi.blobs[hash]
+	if !ok {
+		blob = &memoryBlob{object: object}
+		mbi.blobs[hash] = blob
+	}
+	blob.refs++
+	blob.orphaned = time.Time{}
+	refs = blob.refs
+
+	return
+}
+
+func (mbi *memoryBlobIndex) Release(_ context.Context, hash string) (refs int64, err error) {
+	mbi.mutex.Lock()
+	defer mbi.mutex.Unlock()
+
+	blob, ok := mbi.blobs[hash]
+	if !ok {
+		err = ErrObjectNotFound
+		return
+	}
+	if 0 < blob.refs {
+		blob.refs--
+		if 0 == blob.refs {
+			blob.orphaned = time.Now()
+		}
+	}
+	refs = blob.refs
+
+	return
+}
+
+func (mbi *memoryBlobIndex) Get(_ context.Context, hash string) (object StoredObject, refs int64, err error) {
+	mbi.mutex.Lock()
+	defer mbi.mutex.Unlock()
+
+	blob, ok := mbi.blobs[hash]
+	if !ok {
+		err = ErrObjectNotFound
+		return
+	}
+	object, refs = blob.object, blob.refs
+
+	return
+}
+
+func (mbi *memoryBlobIndex) Orphans(_ context.Context, before time.Time) (hashes []string, err error) {
+	mbi.mutex.Lock()
+	defer mbi.mutex.Unlock()
+
+	for hash, blob := range mbi.blobs {
+		if 0 == blob.refs && blob.orphaned.Before(before) {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return
+}
+
+func (mbi *memoryBlobIndex) Forget(_ context.Context, hash string) error {
+	mbi.mutex.Lock()
+	defer mbi.mutex.Unlock()
+
+	delete(mbi.blobs, hash)
+
+	return nil
+}
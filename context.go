@@ -6,16 +6,17 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/labstack/echo/v4"
 	"github.com/storezhang/gox"
 )
 
 const (
 	defaultIndent = "  "
+
+	canonicalJSONKey = "echox.json.canonical"
 )
 
 type (
@@ -28,9 +29,43 @@ type (
 	JWTClaims struct {
 		gox.BaseUser
 		jwt.StandardClaims
+		// 服务账号的名字，用户的Token为空
+		Service string `json:"svc,omitempty"`
 	}
 )
 
+// contextMiddleware 把请求的上下文换成EchoContext，New中第一个Use的中间件
+// 顺序约定：
+//   - Pre阶段的中间件（方法覆盖、去掉末尾的斜杠、重定向和重写）在路由之前执行，看到的是Echo原始的上下文
+//     不能用e.Pre包装，Echo的路由查找会把上下文断言成内部的*echo.context，传入EchoContext会panic
+//   - 之后的日志、异常恢复、认证、限流等中间件和处理器看到的都是EchoContext
+//   - 错误处理拿到的是Echo原始的上下文，通过ContextOf取回EchoContext
+func contextMiddleware(jwtConfig *JWTConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := c.(*EchoContext); ok {
+				return next(c)
+			}
+
+			return next(&EchoContext{Context: c, JWT: jwtConfig})
+		}
+	}
+}
+
+// ContextOf 读取echox的上下文，Pre阶段的中间件和错误处理中拿到的不是EchoContext，这里包装一个
+func ContextOf(c echo.Context) *EchoContext {
+	if ec, ok := c.(*EchoContext); ok {
+		return ec
+	}
+
+	reloadMutex.Lock()
+	jwtConfig := runningJWT
+	reloadMutex.Unlock()
+
+	return &EchoContext{Context: c, JWT: jwtConfig}
+}
+
+// User 当前登录的用户，服务账号的Token返回ErrNotUser
 func (ec *EchoContext) User() (user gox.BaseUser, err error) {
 	var token string
 
@@ -41,20 +76,17 @@ func (ec *EchoContext) User() (user gox.BaseUser, err error) {
 	var claims jwt.Claims
 	if claims, _, err = ec.JWT.Parse(token); nil != err {
 		return
+	} else if jwtClaims := claims.(*JWTClaims); "" != jwtClaims.Service {
+		err = ErrNotUser
 	} else {
-		user = claims.(*JWTClaims).BaseUser
+		user = jwtClaims.BaseUser
 	}
 
 	return
 }
 
 func (ec *EchoContext) Token(code int, user gox.BaseUser) error {
-	if token, err := ec.JWT.Token(&JWTClaims{
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 72).Unix(),
-		},
-		BaseUser: user,
-	}); nil != err {
+	if token, err := ec.JWT.UserToken(user); nil != err {
 		return err
 	} else {
 		return ec.Context.JSON(code, echo.Map{
@@ -94,12 +126,21 @@ func (ec *EchoContext) contentDisposition(file http.File, name, dispositionType
 
 func (ec *EchoContext) JSON(code int, i interface{}) (err error) {
 	indent := ""
-	if _, pretty := ec.QueryParams()["pretty"]; ec.Echo().Debug || pretty {
+	if ec.Echo().Debug || ec.pretty() {
 		indent = defaultIndent
 	}
 	return ec.json(code, i, indent)
 }
 
+// pretty 请求参数中有pretty时格式化JSON，没有查询参数时不解析，QueryParams每次都会分配
+func (ec *EchoContext) pretty() (pretty bool) {
+	if query := ec.Request().URL.RawQuery; strings.Contains(query, "pretty") {
+		_, pretty = ec.QueryParams()["pretty"]
+	}
+
+	return
+}
+
 func (ec *EchoContext) JSONPretty(code int, i interface{}, indent string) (err error) {
 	return ec.json(code, i, indent)
 }
@@ -127,35 +168,37 @@ func (ec *EchoContext) JSONPBlob(code int, callback string, b []byte) (err error
 }
 
 func (ec *EchoContext) jsonPBlob(code int, callback string, i interface{}) (err error) {
-	enc := jsoniter.NewEncoder(ec.Response())
-	_, pretty := ec.QueryParams()["pretty"]
-	if ec.Echo().Debug || pretty {
-		enc.SetIndent("", "  ")
-	}
-	ec.writeContentType(echo.MIMEApplicationJavaScriptCharsetUTF8)
-	ec.Response().WriteHeader(code)
-	if _, err = ec.Response().Write([]byte(callback + "(")); err != nil {
-		return
+	indent := ""
+	if ec.Echo().Debug || ec.pretty() {
+		indent = defaultIndent
 	}
-	if err = enc.Encode(i); err != nil {
+	var data []byte
+	if data, err = marshalJSON(ec.serializer(), i, indent); nil != err {
 		return
 	}
-	if _, err = ec.Response().Write([]byte(");")); err != nil {
+
+	return ec.JSONPBlob(code, callback, append(data, '\n'))
+}
+
+func (ec *EchoContext) json(code int, i interface{}, indent string) (err error) {
+	var data []byte
+	if data, err = marshalJSON(ec.serializer(), i, indent); nil != err {
 		return
 	}
+	ec.writeContentType(echo.MIMEApplicationJSONCharsetUTF8)
+	ec.Response().WriteHeader(code)
+	_, err = ec.Response().Write(append(data, '\n'))
 
 	return
 }
 
-func (ec *EchoContext) json(code int, i interface{}, indent string) error {
-	enc := jsoniter.NewEncoder(ec.Response())
-	if indent != "" {
-		enc.SetIndent("", indent)
+// serializer 路由要求规范的JSON时使用JSONCanonical，否则使用配置的编码
+func (ec *EchoContext) serializer() JSONSerializer {
+	if canonical, _ := ec.Get(canonicalJSONKey).(bool); canonical {
+		return JSONCanonical
 	}
-	ec.writeContentType(echo.MIMEApplicationJSONCharsetUTF8)
-	ec.Response().WriteHeader(code)
 
-	return enc.Encode(i)
+	return jsonSerializer
 }
 
 func (ec *EchoContext) writeContentType(value string) {
@@ -0,0 +1,109 @@
+package echox
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+func TestMiddlewaresObserveEchoContext(t *testing.T) {
+	logs := new(bytes.Buffer)
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+	ec.AccessLog = &AccessLogConfig{Fields: []string{"status", "user"}, Output: logs}
+	ec.Routes = []RouteFunc{Register(Route{
+		Method: echo.GET,
+		Path:   "/me",
+		Auth:   AuthJWT,
+		Handler: func(c echo.Context) error {
+			if _, ok := c.(*EchoContext); !ok {
+				t.Errorf("处理器拿到的是%T", c)
+			}
+
+			return errors.New("failed")
+		},
+	})}
+	e := New(ec)
+
+	authorized, handled := false, false
+	errorHandler := e.HTTPErrorHandler
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		handled = true
+		if !authorized {
+			errorHandler(err, c)
+
+			return
+		}
+		if user, userErr := ContextOf(c).User(); nil != userErr || 1 != user.Id {
+			t.Errorf("错误处理读不到用户：%v", userErr)
+		}
+		errorHandler(err, c)
+	}
+
+	token, err := ec.JWT.UserToken(gox.BaseUser{Id: 1})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 没有Token时认证拒绝请求
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me", nil))
+	if http.StatusUnauthorized != rec.Code {
+		t.Fatalf("没有Token时的状态码是%d", rec.Code)
+	}
+
+	logs.Reset()
+	authorized, handled = true, false
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if http.StatusInternalServerError != rec.Code {
+		t.Fatalf("认证通过后的状态码是%d", rec.Code)
+	}
+	if !handled {
+		t.Fatal("错误处理没有执行")
+	}
+	if !strings.Contains(logs.String(), `"user":"1"`) {
+		t.Fatalf("访问日志没有记录用户：%s", logs.String())
+	}
+}
+
+// contextSink 让基准测试中的上下文逃逸，和真实的处理器一样
+var contextSink echo.Context
+
+func BenchmarkContextMiddleware(b *testing.B) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	h := contextMiddleware(&JWTConfig{SigningKey: "secret"})(func(c echo.Context) error {
+		contextSink = c
+
+		return nil
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = h(c)
+	}
+}
+
+func TestJSONPretty(t *testing.T) {
+	e := echo.New()
+	for target, indented := range map[string]bool{"/": false, "/?pretty": true, "/?prettyish=1": false} {
+		rec := httptest.NewRecorder()
+		c := &EchoContext{Context: e.NewContext(httptest.NewRequest(http.MethodGet, target, nil), rec)}
+		if err := c.JSON(http.StatusOK, struct{ A int }{A: 1}); nil != err {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(rec.Body.String(), "\n  "); got != indented {
+			t.Errorf("%s的JSON格式化是%v：%q", target, got, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package echox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderTraceparent W3C Trace Context的请求头
+const HeaderTraceparent = "traceparent"
+
+type (
+	// Correlation 关联一次调用链上所有请求的信息
+	Correlation struct {
+		RequestId string `json:"requestId"`
+		TraceId   string `json:"traceId"`
+		// 当前服务的SpanId，向下游调用时作为父级
+		SpanId string `json:"spanId"`
+		// 上游的SpanId
+		ParentId string `json:"parentId,omitempty"`
+		Flags    string `json:"flags"`
+	}
+
+	// CorrelationTransport 向下游请求转发关联信息
+	CorrelationTransport struct {
+		Base http.RoundTripper
+	}
+
+	correlationKey struct{}
+)
+
+// Traceparent 向下游传递时的traceparent请求头
+func (c Correlation) Traceparent() string {
+	return "00-" + c.TraceId + "-" + c.SpanId + "-" + c.Flags
+}
+
+// WithCorrelation 把关联信息放入上下文
+func WithCorrelation(ctx context.Context, correlation Correlation) context.Context {
+	return context.WithValue(ctx, correlationKey{}, correlation)
+}
+
+// CorrelationFrom 从上下文中读取关联信息
+func CorrelationFrom(ctx context.Context) (correlation Correlation, ok bool) {
+	correlation, ok = ctx.Value(correlationKey{}).(Correlation)
+
+	return
+}
+
+// CorrelationOf 当前请求的关联信息
+func CorrelationOf(c echo.Context) Correlation {
+	correlation, _ := CorrelationFrom(c.Request().Context())
+
+	return correlation
+}
+
+func (ec *EchoContext) Correlation() Correlation {
+	return CorrelationOf(ec.Context)
+}
+
+func (ct *CorrelationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := ct.Base
+	if nil == base {
+		base = http.DefaultTransport
+	}
+
+	correlation, ok := CorrelationFrom(req.Context())
+	if !ok {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTripper不能修改原始请求
+	forwarded := req.Clone(req.Context())
+	forwarded.Header.Set(echo.HeaderXRequestID, correlation.RequestId)
+	forwarded.Header.Set(HeaderTraceparent, correlation.Traceparent())
+
+	return base.RoundTrip(forwarded)
+}
+
+// correlationMiddleware 生成关联信息，必须在RequestID中间件之后
+func correlationMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		correlation := Correlation{
+			RequestId: c.Response().Header().Get(echo.HeaderXRequestID),
+			SpanId:    randomHex(8),
+			Flags:     "01",
+		}
+		if traceId, parentId, flags, ok := parseTraceparent(req.Header.Get(HeaderTraceparent)); ok {
+			correlation.TraceId = traceId
+			correlation.ParentId = parentId
+			correlation.Flags = flags
+		} else {
+			correlation.TraceId = randomHex(16)
+		}
+		c.SetRequest(req.WithContext(WithCorrelation(req.Context(), correlation)))
+
+		return next(c)
+	}
+}
+
+// parseTraceparent 解析traceparent，格式是version-traceId-parentId-flags
+func parseTraceparent(header string) (traceId string, parentId string, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if 4 > len(parts) || 2 != len(parts[0]) || "ff" == parts[0] {
+		return
+	}
+	if 32 != len(parts[1]) || 16 != len(parts[2]) || 2 != len(parts[3]) {
+		return
+	}
+	if !isHex(parts[1]) || !isHex(parts[2]) || !isHex(parts[3]) ||
+		strings.Repeat("0", 32) == parts[1] || strings.Repeat("0", 16) == parts[2] {
+		return
+	}
+
+	traceId, parentId, flags, ok = strings.ToLower(parts[1]), strings.ToLower(parts[2]), strings.ToLower(parts[3]), true
+
+	return
+}
+
+func isHex(value string) bool {
+	_, err := hex.DecodeString(value)
+
+	return nil == err
+}
+
+func randomHex(size int) string {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+
+	return hex.EncodeToString(data)
+}
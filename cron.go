@@ -0,0 +1,419 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// CronJob 定时任务
+	CronJob struct {
+		// 名称
+		// 必须
+		Name string
+
+		// 执行时间，标准的五段cron表达式（分 时 日 月 周），也支持@hourly、@daily和@every 10m这样的写法
+		// 必须
+		Spec string
+
+		// 执行任务，服务退出时ctx被取消，应该尽快返回
+		// 和Request二选一
+		Func func(ctx context.Context) error
+
+		// 定时调用自己的接口
+		Request *CronRequest
+
+		// 每次执行前随机等待的最长时间，避免多个实例同时执行
+		// 非必须 默认不等待
+		Jitter time.Duration
+
+		// 单次执行的超时时间
+		// 非必须 默认不超时
+		Timeout time.Duration
+	}
+
+	// CronStatus 定时任务的状态
+	CronStatus struct {
+		Name         string    `json:"name"`
+		Spec         string    `json:"spec"`
+		Running      bool      `json:"running"`
+		Runs         int64     `json:"runs"`
+		Failures     int64     `json:"failures"`
+		Skipped      int64     `json:"skipped"`
+		LastRun      time.Time `json:"lastRun,omitempty"`
+		LastDuration string    `json:"lastDuration,omitempty"`
+		LastError    string    `json:"lastError,omitempty"`
+		Next         time.Time `json:"next,omitempty"`
+	}
+
+	// CronRecorder 记录定时任务的指标，status是succeeded、failed或者skipped
+	CronRecorder interface {
+		ObserveCron(job string, status string, duration time.Duration)
+	}
+
+	cronEntry struct {
+		job      CronJob
+		schedule *cronSchedule
+		mutex    sync.Mutex
+		status   CronStatus
+		ctx      context.Context
+		wait     sync.WaitGroup
+	}
+
+	// cronSchedule 解析后的cron表达式，每个字段是允许的取值的位图
+	cronSchedule struct {
+		every  time.Duration
+		minute uint64
+		hour   uint64
+		dom    uint64
+		month  uint64
+		dow    uint64
+		anyDom bool
+		anyDow bool
+	}
+
+	cronField struct {
+		min int
+		max int
+	}
+)
+
+var (
+	// ErrCronNotFound 定时任务不存在
+	ErrCronNotFound = echo.NewHTTPError(http.StatusNotFound, "定时任务不存在")
+	// ErrCronRunning 定时任务正在执行
+	ErrCronRunning = echo.NewHTTPError(http.StatusConflict, "定时任务正在执行")
+
+	cronMutex   sync.RWMutex
+	cronEntries = make(map[string]*cronEntry)
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+
+	cronFields = []cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+)
+
+// CronJobs 所有定时任务的状态
+func CronJobs() (statuses []CronStatus) {
+	cronMutex.RLock()
+	defer cronMutex.RUnlock()
+
+	statuses = make([]CronStatus, 0, len(cronEntries))
+	for _, entry := range cronEntries {
+		entry.mutex.Lock()
+		statuses = append(statuses, entry.status)
+		entry.mutex.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return
+}
+
+// TriggerCron 立即执行一次定时任务，不等待执行完成
+func TriggerCron(name string) error {
+	cronMutex.RLock()
+	entry, ok := cronEntries[name]
+	cronMutex.RUnlock()
+	if !ok {
+		return ErrCronNotFound
+	}
+	if !entry.run(false) {
+		return ErrCronRunning
+	}
+
+	return nil
+}
+
+// cronWorkers 每个定时任务一个后台任务，服务退出时和其它后台任务一起取消
+func cronWorkers(e *echo.Echo, jobs []CronJob) (workers []Worker) {
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		if "" == job.Name {
+			panic("echo: cron job requires a name")
+		}
+		if nil == job.Func && nil != job.Request {
+			job.Func = job.Request.call(e, job.Name)
+		}
+		if nil == job.Func {
+			panic("echo: cron job requires a func")
+		}
+		if names[job.Name] {
+			panic("echo: cron job is duplicated: " + job.Name)
+		}
+		names[job.Name] = true
+
+		schedule, err := parseCron(job.Spec)
+		if nil != err {
+			panic("echo: cron spec is invalid: " + err.Error())
+		}
+		entry := &cronEntry{job: job, schedule: schedule, status: CronStatus{Name: job.Name, Spec: job.Spec}}
+		workers = append(workers, Worker{
+			Name: "cron:" + job.Name,
+			Run: func(ctx context.Context) error {
+				return entry.loop(ctx, e)
+			},
+		})
+	}
+
+	return
+}
+
+func (ce *cronEntry) loop(ctx context.Context, e *echo.Echo) error {
+	ce.ctx = ctx
+	cronMutex.Lock()
+	cronEntries[ce.job.Name] = ce
+	cronMutex.Unlock()
+	// 退出时不再接受手动触发，等待正在执行的任务
+	defer ce.wait.Wait()
+	defer func() {
+		cronMutex.Lock()
+		delete(cronEntries, ce.job.Name)
+		cronMutex.Unlock()
+	}()
+
+	for {
+		next := ce.schedule.next(time.Now())
+		ce.mutex.Lock()
+		ce.status.Next = next
+		ce.mutex.Unlock()
+
+		delay := time.Until(next)
+		if 0 < ce.job.Jitter {
+			delay += time.Duration(rand.Int63n(int64(ce.job.Jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		if !ce.run(true) {
+			e.Logger.Warnf("定时任务%s上一次还没有执行完，跳过本次执行", ce.job.Name)
+		}
+	}
+}
+
+// run 异步执行一次，上一次还没有执行完时跳过并返回false
+func (ce *cronEntry) run(scheduled bool) bool {
+	ce.mutex.Lock()
+	if ce.status.Running {
+		if scheduled {
+			ce.status.Skipped++
+		}
+		ce.mutex.Unlock()
+		if scheduled {
+			ce.observe("skipped", 0)
+		}
+
+		return false
+	}
+	ce.status.Running = true
+	ce.status.LastRun = time.Now()
+	ce.mutex.Unlock()
+
+	ce.wait.Add(1)
+	go func() {
+		defer ce.wait.Done()
+
+		ctx := ce.ctx
+		if 0 < ce.job.Timeout {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ce.job.Timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		err := ce.safeRun(ctx)
+		duration := time.Since(start)
+
+		ce.mutex.Lock()
+		ce.status.Running = false
+		ce.status.Runs++
+		ce.status.LastDuration = duration.String()
+		ce.status.LastError = ""
+		status := "succeeded"
+		if nil != err {
+			ce.status.Failures++
+			ce.status.LastError = err.Error()
+			status = "failed"
+		}
+		ce.mutex.Unlock()
+		ce.observe(status, duration)
+	}()
+
+	return true
+}
+
+// safeRun 任务崩溃时不影响服务
+func (ce *cronEntry) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("崩溃：%v", r)
+		}
+	}()
+
+	return ce.job.Func(ctx)
+}
+
+func (ce *cronEntry) observe(status string, duration time.Duration) {
+	if recorder, ok := metricsRecorder.(CronRecorder); ok {
+		recorder.ObserveCron(ce.job.Name, status, duration)
+	}
+}
+
+// parseCron 解析cron表达式
+func parseCron(spec string) (schedule *cronSchedule, err error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		var every time.Duration
+		if every, err = time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every "))); nil != err {
+			return
+		}
+		if 0 >= every {
+			err = fmt.Errorf("间隔必须大于0：%s", spec)
+			return
+		}
+		schedule = &cronSchedule{every: every}
+
+		return
+	}
+	if descriptor, ok := cronDescriptors[spec]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(cronFields) != len(fields) {
+		err = fmt.Errorf("需要5个字段：%s", spec)
+		return
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		if bits[i], err = cronFields[i].parse(field); nil != err {
+			return
+		}
+	}
+	// 周日可以写成0或者7
+	if 0 != bits[4]&(1<<7) {
+		bits[4] |= 1
+	}
+	schedule = &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDom: strings.HasPrefix(fields[2], "*"),
+		anyDow: strings.HasPrefix(fields[4], "*"),
+	}
+	if schedule.next(time.Now()).IsZero() {
+		err = fmt.Errorf("永远不会执行：%s", spec)
+		schedule = nil
+	}
+
+	return
+}
+
+// parse 解析一个字段，支持*、数字、范围、步长和逗号分隔的列表
+func (cf cronField) parse(field string) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); 0 <= index {
+			if step, err = strconv.Atoi(part[index+1:]); nil != err || 0 >= step {
+				err = fmt.Errorf("步长不正确：%s", field)
+				return
+			}
+			part = part[:index]
+		}
+
+		start, end := cf.min, cf.max
+		switch {
+		case "*" == part:
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			if start, err = strconv.Atoi(bounds[0]); nil != err {
+				return
+			}
+			if end, err = strconv.Atoi(bounds[1]); nil != err {
+				return
+			}
+		default:
+			if start, err = strconv.Atoi(part); nil != err {
+				return
+			}
+			end = start
+			// 5/10表示从5开始每10个
+			if 1 != step {
+				end = cf.max
+			}
+		}
+		if start < cf.min || end > cf.max || start > end {
+			err = fmt.Errorf("超出范围%d-%d：%s", cf.min, cf.max, field)
+			return
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return
+}
+
+// next t之后的下一次执行时间，没有时返回零值
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	if 0 < cs.every {
+		return t.Add(cs.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case 0 == cs.month&(1<<uint(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !cs.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case 0 == cs.hour&(1<<uint(t.Hour())):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case 0 == cs.minute&(1<<uint(t.Minute())):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchDay 日和周都有限制时满足一个就可以，和标准的cron一致
+func (cs *cronSchedule) matchDay(t time.Time) bool {
+	dom := 0 != cs.dom&(1<<uint(t.Day()))
+	dow := 0 != cs.dow&(1<<uint(t.Weekday()))
+	switch {
+	case cs.anyDom && cs.anyDow:
+		return true
+	case cs.anyDom:
+		return dow
+	case cs.anyDow:
+		return dom
+	default:
+		return dom || dow
+	}
+}
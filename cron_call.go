@@ -0,0 +1,100 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// CronRequest 定时调用自己的接口，请求直接交给Echo处理，不经过网络
+	// 配置了JWT时带上服务账号的Token，和外部调用走同样的鉴权
+	//
+	//	Cron: []echox.CronJob{{
+	//		Name:    "recompute",
+	//		Spec:    "@daily",
+	//		Request: &echox.CronRequest{Method: http.MethodPost, Path: "/internal/recompute"},
+	//	}}
+	CronRequest struct {
+		// 请求方法
+		// 非必须 默认值是POST
+		Method string
+
+		// 请求的地址，可以带查询参数
+		// 必须
+		Path   string
+		Header http.Header
+		Body   string
+
+		// 调用者的服务账号
+		// 非必须 默认值是system
+		Service string
+	}
+
+	cronCallKey struct{}
+)
+
+// IsSystemCall 请求是不是定时任务发起的
+func IsSystemCall(c echo.Context) bool {
+	return nil != c.Request().Context().Value(cronCallKey{})
+}
+
+// call 执行请求，状态码大于等于400时返回错误
+func (cr *CronRequest) call(e *echo.Echo, name string) func(ctx context.Context) error {
+	if "" == cr.Path {
+		panic("echo: cron request requires a path: " + name)
+	}
+	method := cr.Method
+	if "" == method {
+		method = http.MethodPost
+	}
+	service := cr.Service
+	if "" == service {
+		service = SystemService
+	}
+
+	return func(ctx context.Context) (err error) {
+		req := httptest.NewRequest(method, cr.Path, strings.NewReader(cr.Body))
+		req = req.WithContext(context.WithValue(ctx, cronCallKey{}, name))
+		req.RemoteAddr = "127.0.0.1:0"
+		for key, values := range cr.Header {
+			req.Header[key] = values
+		}
+		if "" != cr.Body && "" == req.Header.Get(echo.HeaderContentType) {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		if err = authorizeService(req, service); nil != err {
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if http.StatusBadRequest <= rec.Code {
+			err = fmt.Errorf("定时调用%s %s返回%d：%s", method, cr.Path, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+
+		return
+	}
+}
+
+// authorizeService 请求没有Authorization时签发短期的服务账号Token，定时调用和重放请求时使用
+func authorizeService(req *http.Request, service string) (err error) {
+	reloadMutex.Lock()
+	config := runningJWT
+	reloadMutex.Unlock()
+	if nil == config || "" != req.Header.Get(echo.HeaderAuthorization) {
+		return
+	}
+
+	var token string
+	if token, err = config.ServiceToken(service, 5*time.Minute); nil == err {
+		req.Header.Set(echo.HeaderAuthorization, config.AuthScheme+" "+token)
+	}
+
+	return
+}
@@ -0,0 +1,215 @@
+package echox
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	// LayoutUnixMillis 使用毫秒时间戳作为传输格式
+	LayoutUnixMillis = "unix_millis"
+)
+
+var (
+	// DateLayout Date的传输格式
+	// 可以是Go的时间格式，也可以是LayoutUnixMillis
+	DateLayout = "2006-01-02"
+
+	// DateTimeLayout DateTime的传输格式
+	// 可以是Go的时间格式，也可以是LayoutUnixMillis
+	DateTimeLayout = time.RFC3339
+
+	// DurationUnit Duration的传输格式
+	// 为0时使用"1h30m"格式的字符串，否则传输以此为单位的整数，比如time.Millisecond
+	DurationUnit time.Duration = 0
+)
+
+type (
+	// Date 日期，默认传输格式是yyyy-MM-dd
+	Date struct {
+		time.Time
+	}
+
+	// DateTime 时间，默认传输格式是RFC3339
+	DateTime struct {
+		time.Time
+	}
+
+	// Duration 时间段
+	Duration struct {
+		time.Duration
+	}
+)
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return marshalTime(d.Time, DateLayout)
+}
+
+func (d *Date) UnmarshalJSON(data []byte) (err error) {
+	d.Time, err = unmarshalTime(data, DateLayout)
+
+	return
+}
+
+// UnmarshalParam 从路径、查询参数和表单中绑定
+func (d *Date) UnmarshalParam(param string) (err error) {
+	d.Time, err = parseTime(param, DateLayout)
+
+	return
+}
+
+func (d Date) String() string {
+	return formatTime(d.Time, DateLayout)
+}
+
+func (d Date) OpenAPISchema() *Schema {
+	return timeSchema(DateLayout, "date")
+}
+
+func (dt DateTime) MarshalJSON() ([]byte, error) {
+	return marshalTime(dt.Time, DateTimeLayout)
+}
+
+func (dt *DateTime) UnmarshalJSON(data []byte) (err error) {
+	dt.Time, err = unmarshalTime(data, DateTimeLayout)
+
+	return
+}
+
+// UnmarshalParam 从路径、查询参数和表单中绑定
+func (dt *DateTime) UnmarshalParam(param string) (err error) {
+	dt.Time, err = parseTime(param, DateTimeLayout)
+
+	return
+}
+
+func (dt DateTime) String() string {
+	return formatTime(dt.Time, DateTimeLayout)
+}
+
+func (dt DateTime) OpenAPISchema() *Schema {
+	return timeSchema(DateTimeLayout, "date-time")
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if 0 == DurationUnit {
+		return []byte(strconv.Quote(d.Duration.String())), nil
+	}
+
+	return []byte(strconv.FormatInt(int64(d.Duration/DurationUnit), 10)), nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	if bytes.Equal(data, []byte("null")) {
+		return
+	}
+
+	return d.UnmarshalParam(unquote(data))
+}
+
+// UnmarshalParam 从路径、查询参数和表单中绑定
+func (d *Duration) UnmarshalParam(param string) (err error) {
+	if "" == param {
+		d.Duration = 0
+
+		return
+	}
+
+	if 0 == DurationUnit {
+		d.Duration, err = time.ParseDuration(param)
+	} else {
+		var value int64
+		if value, err = strconv.ParseInt(param, 10, 64); nil == err {
+			d.Duration = time.Duration(value) * DurationUnit
+		}
+	}
+
+	return
+}
+
+func (d Duration) OpenAPISchema() *Schema {
+	if 0 == DurationUnit {
+		return &Schema{Type: "string", Format: "duration", Example: "1h30m"}
+	}
+
+	return &Schema{Type: "integer", Format: "int64"}
+}
+
+func marshalTime(t time.Time, layout string) ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	if LayoutUnixMillis == layout {
+		return []byte(formatTime(t, layout)), nil
+	}
+
+	return []byte(strconv.Quote(formatTime(t, layout))), nil
+}
+
+func unmarshalTime(data []byte, layout string) (t time.Time, err error) {
+	if bytes.Equal(data, []byte("null")) {
+		return
+	}
+
+	return parseTime(unquote(data), layout)
+}
+
+func formatTime(t time.Time, layout string) string {
+	if LayoutUnixMillis == layout {
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+
+	return t.Format(layout)
+}
+
+func parseTime(value string, layout string) (t time.Time, err error) {
+	if "" == value {
+		return
+	}
+
+	if LayoutUnixMillis == layout {
+		var millis int64
+		if millis, err = strconv.ParseInt(value, 10, 64); nil == err {
+			t = time.Unix(0, millis*int64(time.Millisecond))
+		}
+	} else {
+		t, err = time.ParseInLocation(layout, value, time.Local)
+	}
+
+	return
+}
+
+func timeSchema(layout string, format string) *Schema {
+	if LayoutUnixMillis == layout {
+		return &Schema{Type: "integer", Format: "int64"}
+	}
+
+	return &Schema{Type: "string", Format: format}
+}
+
+func unquote(data []byte) string {
+	if 2 <= len(data) && '"' == data[0] && '"' == data[len(data)-1] {
+		if value, err := strconv.Unquote(string(data)); nil == err {
+			return value
+		}
+	}
+
+	return string(data)
+}
+
+// timeValue 让验证器把时间类型当成time.Time和time.Duration处理
+// 这样required等规则才能正确判断零值
+func timeValue(field reflect.Value) interface{} {
+	switch value := field.Interface().(type) {
+	case Date:
+		return value.Time
+	case DateTime:
+		return value.Time
+	case Duration:
+		return value.Duration
+	}
+
+	return nil
+}
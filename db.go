@@ -0,0 +1,300 @@
+package echox
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	dbKey       = "echox.db"
+	txKey       = "echox.tx"
+	handleKey   = "echox.db.handle"
+	replicasKey = "echox.db.replicas"
+	replicaKey  = "echox.db.replica"
+)
+
+type (
+	// DBConfig 数据库配置
+	DBConfig struct {
+		// 数据库连接
+		// 必须
+		DB *sql.DB
+
+		// 其它的数据库句柄，比如gorm.DB或者sqlx.DB，通过DBHandle读取
+		Handle interface{}
+
+		// 是否每个请求开启事务，2xx时提交，出错或者崩溃时回滚
+		Transaction bool
+
+		// 不需要事务的请求
+		// 非必须 默认跳过GET、HEAD和OPTIONS
+		Skipper middleware.Skipper
+
+		// 事务选项
+		TxOptions *sql.TxOptions
+
+		// 只读副本，读请求分配到健康的副本上，没有可用的副本时回到主库
+		Replicas []*sql.DB
+
+		// 走副本的请求
+		// 非必须 默认GET、HEAD和OPTIONS走副本
+		ReadOnly func(echo.Context) bool
+
+		// 查询副本的复制延迟，不配置时不检查延迟
+		ReplicaLag func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+		// 允许的最大复制延迟，超过后不再分配读请求
+		// 非必须 默认值是1秒
+		MaxReplicaLag time.Duration
+
+		// 副本健康检查的间隔
+		// 非必须 默认值是5秒
+		HealthInterval time.Duration
+	}
+
+	// Querier *sql.DB和*sql.Tx的公共方法
+	Querier interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	}
+
+	// countingQuerier 统计查询次数，用于开发模式的调试响应头和N+1检测
+	countingQuerier struct {
+		Querier
+		stats *queryStats
+	}
+
+	// txWriter 在写响应头之前提交事务，提交失败时不会返回成功的响应
+	txWriter struct {
+		http.ResponseWriter
+		tx     *sql.Tx
+		once   sync.Once
+		err    error
+		failed bool
+	}
+)
+
+var (
+	// DefaultDBConfig 默认配置
+	DefaultDBConfig = DBConfig{
+		Skipper: func(c echo.Context) bool {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return true
+			}
+
+			return false
+		},
+		ReadOnly: func(c echo.Context) bool {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return true
+			}
+
+			return false
+		},
+		MaxReplicaLag:  time.Second,
+		HealthInterval: 5 * time.Second,
+	}
+)
+
+// DBOf 当前请求使用的数据库，开启了事务时返回事务，读请求返回分配的副本
+func DBOf(c echo.Context) Querier {
+	if tx, ok := c.Get(txKey).(*sql.Tx); ok {
+		return counted(c, tx)
+	}
+	if replica, ok := c.Get(replicaKey).(*sql.DB); ok {
+		return counted(c, replica)
+	}
+
+	return PrimaryOf(c)
+}
+
+// PrimaryOf 主库，读请求中需要读到刚写入的数据时使用
+func PrimaryOf(c echo.Context) Querier {
+	if db, ok := c.Get(dbKey).(*sql.DB); ok {
+		return counted(c, db)
+	}
+
+	return nil
+}
+
+// ReplicaOf 副本，写请求中的只读查询可以单独走副本，没有可用的副本时返回主库
+func ReplicaOf(c echo.Context) Querier {
+	if pool, ok := c.Get(replicasKey).(*replicaPool); ok {
+		if replica := pool.next(); nil != replica {
+			return counted(c, replica)
+		}
+	}
+
+	return PrimaryOf(c)
+}
+
+func counted(c echo.Context, querier Querier) Querier {
+	if stats, ok := c.Get(dbQueriesKey).(*queryStats); ok {
+		querier = &countingQuerier{Querier: querier, stats: stats}
+	}
+
+	return querier
+}
+
+// TxOf 当前请求的事务，没有开启事务时返回空
+func TxOf(c echo.Context) *sql.Tx {
+	tx, _ := c.Get(txKey).(*sql.Tx)
+
+	return tx
+}
+
+// DBHandle 配置的其它数据库句柄
+func DBHandle(c echo.Context) interface{} {
+	return c.Get(handleKey)
+}
+
+func (ec *EchoContext) DB() Querier {
+	return DBOf(ec.Context)
+}
+
+func (ec *EchoContext) Tx() *sql.Tx {
+	return TxOf(ec.Context)
+}
+
+func (ec *EchoContext) Primary() Querier {
+	return PrimaryOf(ec.Context)
+}
+
+func (ec *EchoContext) Replica() Querier {
+	return ReplicaOf(ec.Context)
+}
+
+// DBWithConfig 注入数据库连接，按配置开启事务
+func DBWithConfig(config DBConfig) echo.MiddlewareFunc {
+	if nil == config.DB {
+		panic("echo: db requires a database")
+	}
+	if nil == config.Skipper {
+		config.Skipper = DefaultDBConfig.Skipper
+	}
+	if nil == config.ReadOnly {
+		config.ReadOnly = DefaultDBConfig.ReadOnly
+	}
+	if 0 >= config.MaxReplicaLag {
+		config.MaxReplicaLag = DefaultDBConfig.MaxReplicaLag
+	}
+	if 0 >= config.HealthInterval {
+		config.HealthInterval = DefaultDBConfig.HealthInterval
+	}
+	RegisterHealthCheck("db", config.DB.PingContext)
+	var pool *replicaPool
+	if 0 != len(config.Replicas) {
+		pool = newReplicaPool(config.Replicas)
+		go pool.check(config.HealthInterval, config.ReplicaLag, config.MaxReplicaLag)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			c.Set(dbKey, config.DB)
+			if nil != config.Handle {
+				c.Set(handleKey, config.Handle)
+			}
+			if nil != pool {
+				c.Set(replicasKey, pool)
+				if config.ReadOnly(c) {
+					if replica := pool.next(); nil != replica {
+						c.Set(replicaKey, replica)
+					}
+				}
+			}
+			if !config.Transaction || config.Skipper(c) {
+				return next(c)
+			}
+
+			tx, err := config.DB.BeginTx(c.Request().Context(), config.TxOptions)
+			if nil != err {
+				return
+			}
+			c.Set(txKey, tx)
+
+			writer := &txWriter{ResponseWriter: c.Response().Writer, tx: tx}
+			c.Response().Writer = writer
+			defer func() {
+				c.Response().Writer = writer.ResponseWriter
+				// 崩溃时回滚，交给Recover中间件处理
+				if r := recover(); nil != r {
+					_ = tx.Rollback()
+					panic(r)
+				}
+			}()
+
+			err = next(c)
+			status := statusOf(c, err)
+			if nil != err || http.StatusOK > status || http.StatusMultipleChoices <= status {
+				// 已经提交时回滚会返回ErrTxDone，不影响结果
+				_ = tx.Rollback()
+				return
+			}
+			if commitErr := writer.commit(); nil != commitErr && !c.Response().Committed {
+				err = commitErr
+			}
+
+			return
+		}
+	}
+}
+
+func (cq *countingQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	cq.stats.observe(query)
+
+	return cq.Querier.ExecContext(ctx, query, args...)
+}
+
+func (cq *countingQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	cq.stats.observe(query)
+
+	return cq.Querier.QueryContext(ctx, query, args...)
+}
+
+func (cq *countingQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	cq.stats.observe(query)
+
+	return cq.Querier.QueryRowContext(ctx, query, args...)
+}
+
+func (tw *txWriter) commit() error {
+	tw.once.Do(func() {
+		tw.err = tw.tx.Commit()
+	})
+
+	return tw.err
+}
+
+func (tw *txWriter) WriteHeader(code int) {
+	if http.StatusOK <= code && http.StatusMultipleChoices > code {
+		if err := tw.commit(); nil != err {
+			tw.failed = true
+			code = http.StatusInternalServerError
+		}
+	} else {
+		_ = tw.tx.Rollback()
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *txWriter) Write(b []byte) (int, error) {
+	// 提交失败后丢弃成功的响应体
+	if tw.failed {
+		return len(b), nil
+	}
+
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *txWriter) Flush() {
+	tw.ResponseWriter.(http.Flusher).Flush()
+}
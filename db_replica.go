@@ -0,0 +1,115 @@
+package echox
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// replicaPool 只读副本，按轮询分配，不健康或者延迟太大的副本不再分配
+	replicaPool struct {
+		mutex    sync.RWMutex
+		replicas []*replica
+		index    uint32
+	}
+
+	replica struct {
+		db      *sql.DB
+		healthy bool
+		lag     time.Duration
+	}
+
+	// ReplicaStatus 副本的状态
+	ReplicaStatus struct {
+		Healthy bool          `json:"healthy"`
+		Lag     time.Duration `json:"lag"`
+	}
+)
+
+var (
+	poolsMutex sync.Mutex
+	pools      []*replicaPool
+)
+
+// Replicas 所有副本的状态
+func Replicas() (statuses []ReplicaStatus) {
+	poolsMutex.Lock()
+	defer poolsMutex.Unlock()
+
+	for _, pool := range pools {
+		pool.mutex.RLock()
+		for _, r := range pool.replicas {
+			statuses = append(statuses, ReplicaStatus{Healthy: r.healthy, Lag: r.lag})
+		}
+		pool.mutex.RUnlock()
+	}
+
+	return
+}
+
+func newReplicaPool(dbs []*sql.DB) (pool *replicaPool) {
+	pool = &replicaPool{replicas: make([]*replica, 0, len(dbs))}
+	for _, db := range dbs {
+		pool.replicas = append(pool.replicas, &replica{db: db, healthy: true})
+	}
+
+	poolsMutex.Lock()
+	pools = append(pools, pool)
+	poolsMutex.Unlock()
+
+	return
+}
+
+// next 下一个可用的副本，没有时返回空
+func (rp *replicaPool) next() *sql.DB {
+	rp.mutex.RLock()
+	defer rp.mutex.RUnlock()
+
+	healthy := make([]*sql.DB, 0, len(rp.replicas))
+	for _, r := range rp.replicas {
+		if r.healthy {
+			healthy = append(healthy, r.db)
+		}
+	}
+	if 0 == len(healthy) {
+		return nil
+	}
+
+	return healthy[int(atomic.AddUint32(&rp.index, 1)-1)%len(healthy)]
+}
+
+// check 定时检查副本的连接和复制延迟
+func (rp *replicaPool) check(
+	interval time.Duration,
+	lagOf func(ctx context.Context, db *sql.DB) (time.Duration, error),
+	maxLag time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if LifecycleStopped == State() {
+			return
+		}
+
+		for _, r := range rp.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			healthy := nil == r.db.PingContext(ctx)
+			var lag time.Duration
+			if healthy && nil != lagOf {
+				var err error
+				lag, err = lagOf(ctx, r.db)
+				healthy = nil == err && lag <= maxLag
+			}
+			cancel()
+
+			rp.mutex.Lock()
+			r.healthy = healthy
+			r.lag = lag
+			rp.mutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package echox
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderXDebug          = "X-Debug"
+	HeaderXDebugHandler   = "X-Debug-Handler"
+	HeaderXDebugDuration  = "X-Debug-Duration"
+	HeaderXDebugDBQueries = "X-Debug-DB-Queries"
+	HeaderXDebugCache     = "X-Debug-Cache"
+
+	dbQueriesKey = "echox.db.queries"
+)
+
+type (
+	// DevConfig 开发模式配置
+	// 请求带上调试参数或者请求头时，格式化JSON响应并加上调试响应头
+	DevConfig struct {
+		// 调试的查询参数
+		// 非必须 默认值是"debug"
+		Param string
+
+		// 调试的请求头
+		// 非必须 默认值是"X-Debug"
+		Header string
+	}
+
+	// debugWriter 缓存响应，处理完成后再加上调试响应头
+	debugWriter struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+func (dc DevConfig) middleware() echo.MiddlewareFunc {
+	if "" == dc.Param {
+		dc.Param = "debug"
+	}
+	if "" == dc.Header {
+		dc.Header = HeaderXDebug
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !debugging(c.QueryParam(dc.Param)) && !debugging(c.Request().Header.Get(dc.Header)) {
+				return next(c)
+			}
+
+			queries := newQueryStats()
+			c.Set(dbQueriesKey, queries)
+			writer := &debugWriter{ResponseWriter: c.Response().Writer, status: http.StatusOK}
+			c.Response().Writer = writer
+			start := time.Now()
+
+			// 错误也要在缓存中处理，才能加上调试响应头
+			if err := next(c); nil != err {
+				c.Error(err)
+			}
+			c.Response().Writer = writer.ResponseWriter
+
+			header := c.Response().Header()
+			header.Set(HeaderXDebugHandler, handlerName(c.Handler()))
+			header.Set(HeaderXDebugDuration, time.Since(start).String())
+			header.Set(HeaderXDebugDBQueries, strconv.FormatInt(queries.total(), 10))
+			if cache := header.Get(HeaderXCache); "" != cache {
+				header.Set(HeaderXDebugCache, cache)
+			} else {
+				header.Set(HeaderXDebugCache, "NONE")
+			}
+
+			body := writer.body.Bytes()
+			if strings.HasPrefix(header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+				var indented bytes.Buffer
+				if nil == json.Indent(&indented, body, "", defaultIndent) {
+					body = indented.Bytes()
+				}
+			}
+			header.Del(echo.HeaderContentLength)
+			writer.ResponseWriter.WriteHeader(writer.status)
+			_, err := writer.ResponseWriter.Write(body)
+
+			return err
+		}
+	}
+}
+
+func debugging(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+
+	return false
+}
+
+func handlerName(handler echo.HandlerFunc) string {
+	if nil == handler {
+		return ""
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); nil != fn {
+		return fn.Name()
+	}
+
+	return ""
+}
+
+func (dw *debugWriter) WriteHeader(code int) {
+	dw.status = code
+}
+
+func (dw *debugWriter) Write(b []byte) (int, error) {
+	return dw.body.Write(b)
+}
+
+// Flush 缓存时不能刷新
+func (dw *debugWriter) Flush() {}
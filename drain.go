@@ -0,0 +1,128 @@
+package echox
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+const (
+	HeaderRetryAfter = "Retry-After"
+	HeaderConnection = "Connection"
+)
+
+type (
+	// DrainConfig 优雅退出时按阶段拒绝请求的配置
+	// 比如收到退出信号后立即拒绝写请求，读请求继续服务到Grace结束
+	DrainConfig struct {
+		// 按顺序生效的阶段
+		Stages []DrainStage
+
+		// 收到退出信号后，继续服务未被拒绝的请求的时间，之后关闭监听
+		// 非必须 默认值是所有阶段中最晚的After
+		Grace time.Duration
+
+		// 关闭监听后，等待处理中的请求完成的时间
+		// 非必须 默认值是10秒
+		Timeout time.Duration
+	}
+
+	// DrainStage 退出阶段
+	DrainStage struct {
+		// 收到退出信号后多久开始拒绝
+		After time.Duration
+
+		// 拒绝的请求方法，为空表示所有方法
+		Methods []string
+
+		// 拒绝的路径前缀，为空表示所有路径
+		Prefixes []string
+	}
+)
+
+var (
+	// DefaultDrainConfig 默认配置
+	DefaultDrainConfig = DrainConfig{
+		Timeout: 10 * time.Second,
+	}
+
+	// drainingSince 收到退出信号的时间，为0表示没有退出
+	drainingSince int64
+)
+
+// Draining 是否正在退出
+func Draining() bool {
+	return 0 != atomic.LoadInt64(&drainingSince)
+}
+
+func startDraining() {
+	atomic.CompareAndSwapInt64(&drainingSince, 0, time.Now().UnixNano())
+}
+
+func (dc *DrainConfig) grace() (grace time.Duration) {
+	grace = dc.Grace
+	if 0 == grace {
+		for _, stage := range dc.Stages {
+			if stage.After > grace {
+				grace = stage.After
+			}
+		}
+	}
+
+	return
+}
+
+func (dc *DrainConfig) timeout() time.Duration {
+	if 0 >= dc.Timeout {
+		return DefaultDrainConfig.Timeout
+	}
+
+	return dc.Timeout
+}
+
+func (ds *DrainStage) match(c echo.Context) bool {
+	if 0 != len(ds.Methods) {
+		if exists, _ := gox.IsInArray(c.Request().Method, ds.Methods); !exists {
+			return false
+		}
+	}
+	if 0 == len(ds.Prefixes) {
+		return true
+	}
+	for _, prefix := range ds.Prefixes {
+		if strings.HasPrefix(c.Request().URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// middleware 按阶段拒绝请求
+func (dc *DrainConfig) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	retryAfter := strconv.Itoa(int((dc.grace() + dc.timeout()) / time.Second))
+
+	return func(c echo.Context) error {
+		since := atomic.LoadInt64(&drainingSince)
+		if 0 == since {
+			return next(c)
+		}
+
+		elapsed := time.Since(time.Unix(0, since))
+		for _, stage := range dc.Stages {
+			if elapsed >= stage.After && stage.match(c) {
+				c.Response().Header().Set(HeaderConnection, "close")
+				c.Response().Header().Set(HeaderRetryAfter, retryAfter)
+
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "服务正在停止")
+			}
+		}
+
+		return next(c)
+	}
+}
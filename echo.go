@@ -2,17 +2,20 @@ package echox
 
 import (
 	"context"
-	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 const (
@@ -20,44 +23,154 @@ const (
 )
 
 var (
-	DefaultEchoConfig = &EchoConfig{
-		Ip:                 "",
-		Port:               1323,
-		BasePath:           "",
-		Validate:           true,
-		DefaultValueBinder: true,
-		ErrorHandler:       true,
-		JWT:                nil,
-		Init:               nil,
-		Routes:             nil,
-	}
+	// DefaultEchoConfig 默认配置
+	// Deprecated: 全局的配置会被修改，多个测试之间会互相影响，使用NewDefaultConfig
+	DefaultEchoConfig = NewDefaultConfig()
 )
 
 type (
 	EchoFunc   func(e *echo.Echo)
 	RouteFunc  func(g *echo.Group)
 	EchoConfig struct {
-		Ip                 string
-		Port               int
-		BasePath           string
-		Validate           bool
-		DefaultValueBinder bool
-		ErrorHandler       bool
-		JWT                *JWTConfig
-		Init               EchoFunc
-		Routes             []RouteFunc
+		// 启动时直接使用传入的配置，不复制，启动后对配置的修改会影响运行的服务
+		// Deprecated: 只用来兼容旧的行为，默认启动时复制配置
+		MutableConfig       bool
+		Environments        *EnvironmentConfig
+		Ip                  string
+		Port                int
+		BasePath            string
+		Validate            bool
+		DefaultValueBinder  bool
+		JSONSerializer      JSONSerializer
+		EnumCaseInsensitive bool
+		DebugBind           func(echo.Context) bool
+		ErrorHandler        bool
+		ErrorLog            *ErrorLogConfig
+		LogLevel            log.Lvl
+		CORS                *middleware.CORSConfig
+		IPFilter            *IPFilterConfig
+		RateLimit           *RateLimitConfig
+		Features            map[string]bool
+		JWT                 *JWTConfig
+		Audit               *AuditConfig
+		Admin               *AdminConfig
+		Idempotency         *IdempotencyConfig
+		Embedded            *Embedded
+		Drain               *DrainConfig
+		Journal             *JournalConfig
+		Notifiers           []LifecycleNotifier
+		Kubernetes          *KubernetesConfig
+		Build               *BuildConfig
+		Metrics             *MetricsConfig
+		ErrorBudget         *ErrorBudgetConfig
+		Security            *SecurityConfig
+		Workers             []Worker
+		Cron                []CronJob
+		Region              *RegionConfig
+		Tenant              *TenantConfig
+		Fields              *FieldsConfig
+		OIDC                *OIDCConfig
+		Profiling           *ProfilingConfig
+		DB                  *DBConfig
+		QueryCount          *QueryCountConfig
+		PprofLabels         bool
+		Dev                 *DevConfig
+		Mock                *MockConfig
+		Compression         *CompressionConfig
+		Recover             *RecoverConfig
+		AccessLog           *AccessLogConfig
+		RouteCheck          *RouteCheckConfig
+		GRPC                *GRPCConfig
+		H2C                 bool
+		HTTP3               *HTTP3Config
+		Remote              *RemoteConfig
+		Streams             *StreamConfig
+		PubSub              *PubSubConfig
+		Restart             *RestartConfig
+		Init                EchoFunc
+		Routes              []RouteFunc
+		Versions            map[string][]RouteFunc
+		Versioning          *VersionConfig
+		Static              []StaticMount
+		Responses           []StaticResponse
+		Sitemap             *SitemapConfig
+		Proxies             []ProxyConfig
+		Redirects           []RedirectRule
+		Rewrites            []RewriteRule
 	}
 )
 
-func (ec *EchoConfig) Address() string {
-	var address string
-	if "" != strings.TrimSpace(ec.Ip) {
-		address = fmt.Sprintf("%s:%d", ec.Ip, ec.Port)
-	} else {
-		address = fmt.Sprintf(":%d", ec.Port)
+// NewDefaultConfig 创建默认配置，每次返回新的对象
+func NewDefaultConfig() *EchoConfig {
+	return &EchoConfig{
+		Ip:                  "",
+		MutableConfig:       false,
+		Environments:        nil,
+		Port:                1323,
+		BasePath:            "",
+		Validate:            true,
+		DefaultValueBinder:  true,
+		JSONSerializer:      nil,
+		EnumCaseInsensitive: false,
+		DebugBind:           nil,
+		ErrorHandler:        true,
+		ErrorLog:            nil,
+		LogLevel:            0,
+		CORS:                nil,
+		IPFilter:            nil,
+		RateLimit:           nil,
+		Features:            nil,
+		JWT:                 nil,
+		Audit:               nil,
+		Admin:               nil,
+		Idempotency:         nil,
+		Embedded:            nil,
+		Drain:               nil,
+		Journal:             nil,
+		Notifiers:           nil,
+		Kubernetes:          nil,
+		Build:               nil,
+		Metrics:             nil,
+		ErrorBudget:         nil,
+		Security:            nil,
+		Workers:             nil,
+		Cron:                nil,
+		Region:              nil,
+		Tenant:              nil,
+		Fields:              nil,
+		OIDC:                nil,
+		Profiling:           nil,
+		DB:                  nil,
+		QueryCount:          nil,
+		PprofLabels:         false,
+		Dev:                 nil,
+		Mock:                nil,
+		Compression:         nil,
+		Recover:             nil,
+		AccessLog:           nil,
+		RouteCheck:          &RouteCheckConfig{},
+		GRPC:                nil,
+		H2C:                 false,
+		HTTP3:               nil,
+		Remote:              nil,
+		Streams:             nil,
+		PubSub:              nil,
+		Restart:             nil,
+		Init:                nil,
+		Routes:              nil,
+		Versions:            nil,
+		Versioning:          nil,
+		Static:              nil,
+		Responses:           nil,
+		Sitemap:             nil,
+		Proxies:             nil,
+		Redirects:           nil,
+		Rewrites:            nil,
 	}
+}
 
-	return address
+func (ec *EchoConfig) Address() string {
+	return net.JoinHostPort(strings.TrimSpace(ec.Ip), strconv.Itoa(ec.Port))
 }
 
 func Start() {
@@ -65,17 +178,212 @@ func Start() {
 }
 
 func StartWith(ec *EchoConfig) {
+	// 复制配置，启动后调用方再修改配置不会影响运行的服务
+	if !ec.MutableConfig {
+		reloadMutex.Lock()
+		watchDrift(ec)
+		reloadMutex.Unlock()
+		ec = ec.Clone()
+	}
+
+	// 容器健康门禁和CI冒烟测试
+	if isSelfTest(os.Args[1:]) {
+		selfTest(ec)
+	}
+
+	e := New(ec)
+	notify(e, ec, LifecycleStarting)
+
+	// 重放崩溃前没有处理完的请求
+	if nil != ec.Journal && ec.Journal.Replay {
+		if err := ReplayJournal(e, ec.Journal.Journal); nil != err {
+			e.Logger.Fatal(err)
+		}
+	}
+
+	// 启动Server
+	// 先监听再启动，监听成功就算准备好了
+	// 重启时使用旧进程交过来的监听
+	listener, err := listen(ec)
+	if nil != err {
+		e.Logger.Fatal(err)
+	}
+	e.Listener = listener
+	if nil != ec.GRPC {
+		if nil != ec.HTTP3 && ec.HTTP3.TLS && 0 == ec.GRPC.Port {
+			panic("echo: grpc on the http port does not support tls")
+		}
+		ec.GRPC.serve(e, listener)
+	}
+	if nil == ec.GRPC || 0 != ec.GRPC.Port {
+		go serve(e, ec, listener)
+	}
+	if nil != ec.HTTP3 {
+		ec.HTTP3.serve(e, ec)
+	}
+	notify(e, ec, LifecycleReady)
+	takeOver(e)
+	if nil != ec.Restart {
+		ec.Restart.watch(e, listener)
+	}
+
+	// 后台任务
+	// 配置中心的监听、跨实例广播的订阅和定时任务也是后台任务
+	background := append(append([]Worker{}, ec.Workers...), cronWorkers(e, ec.Cron)...)
+	if nil != ec.Remote {
+		background = append(background, ec.Remote.worker(e))
+	}
+	if nil != ec.PubSub {
+		background = append(background, ec.PubSub.worker(e))
+	}
+	if nil != ec.Embedded && nil != ec.Embedded.config.Backup {
+		background = append(background, embeddedWorker(ec.Embedded))
+	}
+	if !ec.MutableConfig {
+		background = append(background, driftWorker(e))
+	}
+	workers := startWorkers(e, background)
+
+	// 等待系统退出中断并响应
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	notify(e, ec, LifecycleDraining)
+	shutdown(e, ec, workers)
+	notify(e, ec, LifecycleStopped)
+}
+
+// serve 按配置的协议启动HTTP服务
+func serve(e *echo.Echo, ec *EchoConfig, listener net.Listener) {
+	var err error
+	switch {
+	case nil != ec.HTTP3 && ec.HTTP3.TLS:
+		if e.TLSListener, err = ec.HTTP3.tlsListener(listener); nil == err {
+			err = e.StartTLS(ec.Address(), ec.HTTP3.CertFile, ec.HTTP3.KeyFile)
+		}
+	case ec.H2C:
+		// 不能用e.Start，它会替换Server的Handler
+		e.Server.Handler = h2c.NewHandler(e, &http2.Server{})
+		e.Server.ErrorLog = e.StdLogger
+		err = e.Server.Serve(listener)
+	default:
+		err = e.Start(ec.Address())
+	}
+	if nil != err && http.ErrServerClosed != err {
+		e.Logger.Fatal(err)
+	}
+}
+
+// shutdown 优雅退出
+// 配置了Drain时，先按阶段拒绝请求，再停止后台任务和关闭监听
+func shutdown(e *echo.Echo, ec *EchoConfig, workers *workerGroup) {
+	timeout := DefaultDrainConfig.Timeout
+	if nil != ec.Drain {
+		startDraining()
+		time.Sleep(ec.Drain.grace())
+		timeout = ec.Drain.timeout()
+	}
+	// 通知WebSocket和SSE客户端，等待断开
+	streamConfig := DefaultStreamConfig
+	if nil != ec.Streams {
+		streamConfig = ec.Streams.defaults()
+	}
+	streams.shutdown(streamConfig)
+	workers.stop(timeout)
+	// 取消还在执行的异步任务，等待任务保存状态
+	runningJobs.stop(timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if nil != ec.GRPC {
+		if err := ec.GRPC.shutdown(ctx); nil != err {
+			e.Logger.Error(err)
+		}
+	}
+	if nil != ec.HTTP3 {
+		if err := ec.HTTP3.shutdown(); nil != err {
+			e.Logger.Error(err)
+		}
+	}
+	err := e.Shutdown(ctx)
+	// 请求都结束以后再同步和关闭嵌入式存储
+	if nil != ec.Embedded {
+		if closeErr := ec.Embedded.Close(); nil != closeErr {
+			e.Logger.Error(closeErr)
+		}
+	}
+	if nil != err {
+		e.Logger.Fatal(err)
+	}
+}
+
+// New 按配置创建Echo对象，但是不启动
+// 测试时可以直接把返回值交给httptest使用
+func New(ec *EchoConfig) *echo.Echo {
+	// 按运行环境开关功能，后面的配置都以开关之后的为准
+	if nil != ec.Environments {
+		ec.Environments.apply(ec)
+	}
+
 	// 创建Echo对象
 	e := echo.New()
+	// 路由的元数据和注册时发现的问题属于新的服务，同一个进程中多次New不会互相影响
+	resetRoutes()
+	// 请求日志只用在声明了Journaled的路由上，在路由的认证之后执行
+	routeJournal = nil
+	if nil != ec.Journal {
+		routeJournal = JournaledWithConfig(*ec.Journal)
+	}
+	// 客户端IP，日志、限流和过滤都依赖它
+	if nil != ec.IPFilter {
+		e.IPExtractor = ec.IPFilter.IPExtractor()
+	}
+
+	if nil != ec.JWT {
+		ec.JWT.init()
+	}
 
 	if nil != ec.Init {
 		ec.Init(e)
 	}
 	if nil != ec.Routes {
-		g := e.Group(ec.BasePath)
-		for _, route := range ec.Routes {
-			route(g)
-		}
+		mountRoutes(e, e.Group(ec.BasePath), ec.Routes)
+	}
+	// 多版本接口
+	if 0 != len(ec.Versions) {
+		mountVersions(e, ec)
+	}
+	// 静态文件
+	for _, static := range ec.Static {
+		static.mount(e)
+	}
+	// 固定响应
+	for _, response := range ec.Responses {
+		response.mount(e)
+	}
+	// 站点地图和robots.txt
+	if nil != ec.Sitemap {
+		ec.Sitemap.mount(e)
+	}
+	// 网关转发
+	for _, proxy := range ec.Proxies {
+		proxy.mount(e)
+	}
+	// Kubernetes探针
+	if nil != ec.Kubernetes {
+		ec.Kubernetes.mount(e)
+	}
+	// 构建信息
+	if nil != ec.Build {
+		ec.Build.mount(e)
+	}
+	// OpenID Connect登录
+	if nil != ec.OIDC {
+		ec.OIDC.mount(e, ec.JWT)
+	}
+	// 管理接口
+	if nil != ec.Admin {
+		ec.Admin.mount(e)
 	}
 
 	// 初始化Validator
@@ -87,81 +395,207 @@ func StartWith(ec *EchoConfig) {
 
 	// 初始化绑定
 	if ec.DefaultValueBinder {
-		e.Binder = &DefaultValueBinder{}
+		e.Binder = &DefaultValueBinder{
+			EnumCaseInsensitive: ec.EnumCaseInsensitive,
+			DebugBind:           ec.DebugBind,
+		}
+	}
+
+	// 响应的JSON编码
+	jsonSerializer = JSONIter
+	if nil != ec.JSONSerializer {
+		jsonSerializer = ec.JSONSerializer
 	}
 
 	// 处理错误
 	if ec.ErrorHandler {
-		e.HTTPErrorHandler = func(err error, c echo.Context) {
-			type response struct {
-				ErrorCode int         `json:"errorCode"`
-				Message   string      `json:"message"`
-				Data      interface{} `json:"data"`
-			}
-			rsp := response{}
-
-			statusCode := http.StatusInternalServerError
-			switch re := err.(type) {
-			case *echo.HTTPError:
-				statusCode = re.Code
-				rsp.Message = re.Error()
-			case validator.ValidationErrors:
-				statusCode = http.StatusBadRequest
-				lang := c.Request().Header.Get(HeaderAcceptLanguage)
-				rsp.ErrorCode = 9901
-				rsp.Message = "数据验证错误"
-				rsp.Data = i18n(lang, re)
-			case Error:
-				rsp.ErrorCode = re.ErrorCode()
-				rsp.Message = re.Message()
-				rsp.Data = re.Data()
-			default:
-				rsp.Message = re.Error()
-			}
-
-			c.JSON(statusCode, rsp)
-			c.Logger().Error(err)
-		}
+		e.HTTPErrorHandler = errorHandler
+	}
+	// 最近的错误
+	recentErrors = nil
+	if nil != ec.ErrorLog {
+		recentErrors = newErrorRing(*ec.ErrorLog)
 	}
 
 	// 初始化中间件
 	e.Pre(middleware.MethodOverride())
 	e.Pre(middleware.RemoveTrailingSlash())
+	// 重定向和重写在路由之前，重写后的路径参与路由
+	if 0 != len(ec.Redirects) || 0 != len(ec.Rewrites) {
+		e.Pre(redirectMiddleware(ec.Redirects, ec.Rewrites))
+	}
 
-	// e.Use(middleware.CSRF())
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
+	// echox的上下文必须是第一个中间件，顺序见contextMiddleware
+	e.Use(contextMiddleware(ec.JWT))
+	if nil != ec.AccessLog {
+		e.Use(AccessLogWithConfig(accessLogConfig(ec)))
+	} else {
+		e.Use(middleware.LoggerWithConfig(loggerConfig(ec)))
+	}
+	e.Use(recoverMiddleware(ec))
 	e.Use(middleware.RequestID())
+	e.Use(correlationMiddleware)
+	if nil != ec.IPFilter {
+		e.Use(IPFilter(*ec.IPFilter))
+	}
+	// 开发模式的调试信息
+	if nil != ec.Dev {
+		e.Use(ec.Dev.middleware())
+	}
+	// 多区域路由
+	if nil != ec.Region {
+		e.Use(RegionWithConfig(*ec.Region))
+	}
+	// 多租户
+	if nil != ec.Tenant {
+		e.Use(TenantWithConfig(*ec.Tenant))
+	}
+	// 按查询参数裁剪响应字段
+	if nil != ec.Fields {
+		e.Use(FieldsWithConfig(*ec.Fields))
+	}
+	// pprof标签，在租户之后才能读取租户
+	if ec.PprofLabels {
+		e.Use(pprofLabelsMiddleware)
+	}
+	// 安全响应头和CSRF
+	if nil != ec.Security {
+		ec.Security.mount(e)
+	}
+	var recorder MetricsRecorder
+	if nil != ec.Metrics {
+		recorder = ec.Metrics.mount(e)
+	}
+	// 调用下游的客户端共用指标
+	metricsRecorder = recorder
+	// gRPC和HTTP共用指标
+	if nil != ec.GRPC {
+		ec.GRPC.mount(e, ec, recorder)
+	}
+	// 按请求统计资源消耗
+	if nil != ec.Profiling {
+		e.Use(ProfilingWithConfig(*ec.Profiling, recorder))
+	}
+	if nil != ec.HTTP3 {
+		e.Use(ec.HTTP3.altSvc(ec))
+	}
+	if nil != ec.Compression {
+		e.Use(CompressionWithConfig(*ec.Compression))
+	}
+	if nil != ec.Drain {
+		e.Use(ec.Drain.middleware)
+	}
 
-	// 符合JWT和Casbin的上下文
-	if nil != ec.JWT {
-		e.Use(func(h echo.HandlerFunc) echo.HandlerFunc {
-			return func(c echo.Context) error {
-				cc := &EchoContext{
-					Context: c,
-					JWT:     ec.JWT,
-				}
-				return h(cc)
-			}
-		})
+	// 可以热加载的配置
+	reloadMutex.Lock()
+	running = e
+	runningJWT = ec.JWT
+	rateLimitStore = nil
+	apply(e, ec)
+	reloadMutex.Unlock()
+	e.Use(reloadableMiddleware)
+	e.Use(switchGuardMiddleware)
+	e.Use(routeSwitchMiddleware)
+	if nil != ec.ErrorBudget {
+		e.Use(ErrorBudgetWithConfig(*ec.ErrorBudget))
+	}
+	// 模拟响应在停用的路由之后，停用的路由不返回示例
+	if nil != ec.Mock {
+		e.Use(MockWithConfig(*ec.Mock))
 	}
 
-	// 启动Server
-	go func() {
-		if err := e.Start(ec.Address()); nil != err {
-			e.Logger.Fatal(err)
+	// 数据库和事务
+	if nil != ec.DB {
+		e.Use(DBWithConfig(*ec.DB))
+		// 查询次数和N+1检测
+		if nil != ec.QueryCount {
+			e.Use(QueryCountWithConfig(*ec.QueryCount, recorder))
 		}
-	}()
+	}
 
-	// 等待系统退出中断并响应
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := e.Shutdown(ctx); nil != err {
-		e.Logger.Fatal(err)
+	// 审计日志
+	if nil != ec.Audit {
+		audit := *ec.Audit
+		if nil == audit.JWT {
+			audit.JWT = ec.JWT
+		}
+		e.Use(AuditWithConfig(audit))
+	}
+
+	// 幂等
+	if nil != ec.Idempotency {
+		idempotency := *ec.Idempotency
+		if nil == idempotency.Store {
+			// 关闭服务时停止默认存储的后台清理
+			store := NewMemoryIdempotencyStore().(*memoryIdempotencyStore)
+			e.Server.RegisterOnShutdown(func() {
+				_ = store.Close()
+			})
+			idempotency.Store = store
+		}
+		e.Use(IdempotencyWithConfig(idempotency))
 	}
+
+	// 路由冲突
+	if nil != ec.RouteCheck {
+		ec.RouteCheck.check(e)
+	}
+
+	return e
+}
+
+// recoverMiddleware 异常恢复，没有配置时使用默认配置
+func recoverMiddleware(ec *EchoConfig) echo.MiddlewareFunc {
+	config := DefaultRecoverConfig
+	if nil != ec.Recover {
+		config = *ec.Recover
+	}
+	if nil == config.JWT {
+		config.JWT = ec.JWT
+	}
+
+	return RecoverWithConfig(config)
+}
+
+// loggerConfig 请求日志的配置，总是带上实例编号，配置了区域、租户和构建信息时加到日志中
+func loggerConfig(ec *EchoConfig) (config middleware.LoggerConfig) {
+	config = middleware.DefaultLoggerConfig
+
+	fields := `"instance":` + jsonString(instanceId) + `,`
+	if nil != ec.Region {
+		fields += `"region":"${header:` + HeaderXRegion + `}",`
+	}
+	if nil != ec.Tenant {
+		fields += `"tenant":"${header:` + HeaderXTenantID + `}",`
+	}
+	if nil != ec.Build {
+		fields += `"version":` + jsonString(appVersion()) + `,`
+	}
+	config.Format = strings.Replace(config.Format, `"id":"${id}",`, `"id":"${id}",`+fields, 1)
+
+	return
+}
+
+// accessLogConfig 没有选择字段时加上实例编号，配置了区域、租户和构建信息也加到日志中
+func accessLogConfig(ec *EchoConfig) (config AccessLogConfig) {
+	config = *ec.AccessLog
+	if 0 == len(config.Fields) {
+		config.Fields = append(append([]string(nil), DefaultAccessLogConfig.Fields...), "instance")
+		if nil != ec.Region {
+			config.Fields = append(config.Fields, "region")
+		}
+		if nil != ec.Tenant {
+			config.Fields = append(config.Fields, "tenant")
+		}
+		if nil != ec.Build {
+			config.Fields = append(config.Fields, "version")
+		}
+	}
+	if nil == config.JWT {
+		config.JWT = ec.JWT
+	}
+
+	return
 }
 
 func Int64Param(c echo.Context, name string) (int64, error) {
@@ -0,0 +1,14 @@
+package echox
+
+import (
+	"testing"
+)
+
+func BenchmarkAddress(b *testing.B) {
+	ec := &EchoConfig{Ip: "127.0.0.1", Port: 9000}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = ec.Address()
+	}
+}
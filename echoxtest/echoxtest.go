@@ -0,0 +1,171 @@
+// Package echoxtest 测试echox服务的工具
+package echoxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/echox"
+	"github.com/storezhang/gox"
+)
+
+type (
+	// Request 请求描述
+	Request struct {
+		// 请求方法
+		// 非必须 默认值是GET
+		Method string
+
+		// 请求路径，可以带查询参数
+		Path string
+
+		// 请求头
+		Header http.Header
+
+		// 请求体
+		// string、[]byte和io.Reader原样发送，其它类型序列化成JSON
+		Body interface{}
+
+		// 路径参数
+		// 直接创建上下文时没有经过路由，需要手动指定
+		Params map[string]string
+
+		// 当前用户
+		// 不为空时自动签发Token
+		User *gox.BaseUser
+	}
+)
+
+// NewTestServer 创建测试服务器
+// 和StartWith使用同样的配置，监听在随机端口上，用完需要调用Close
+func NewTestServer(ec *echox.EchoConfig) *httptest.Server {
+	return httptest.NewServer(echox.New(ec))
+}
+
+// Token 使用配置的JWT为用户签发Token
+func Token(t testing.TB, jwt *echox.JWTConfig, user gox.BaseUser) string {
+	t.Helper()
+
+	token, err := jwt.UserToken(user)
+	if nil != err {
+		t.Fatalf("签发Token出错：%v", err)
+	}
+
+	return token
+}
+
+// Authorization 生成带Token的认证请求头
+func Authorization(t testing.TB, jwt *echox.JWTConfig, user gox.BaseUser) string {
+	t.Helper()
+
+	// 配置还没有交给New时没有填充默认值
+	scheme := jwt.AuthScheme
+	if "" == scheme {
+		scheme = echox.DefaultJWTConfig.AuthScheme
+	}
+
+	return scheme + " " + Token(t, jwt, user)
+}
+
+// NewRequest 按描述创建请求
+func NewRequest(t testing.TB, ec *echox.EchoConfig, req Request) *http.Request {
+	t.Helper()
+
+	method := req.Method
+	if "" == method {
+		method = http.MethodGet
+	}
+
+	r := httptest.NewRequest(method, req.Path, body(t, req.Body))
+	for key, values := range req.Header {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	if nil != req.Body && "" == r.Header.Get(echo.HeaderContentType) {
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if nil != req.User && nil != ec.JWT {
+		r.Header.Set(echo.HeaderAuthorization, Authorization(t, ec.JWT, *req.User))
+	}
+
+	return r
+}
+
+// NewContext 按描述创建上下文，用于直接调用处理器
+func NewContext(t testing.TB, ec *echox.EchoConfig, req Request) (*echox.EchoContext, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	e := echox.New(ec)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(NewRequest(t, ec, req), rec)
+
+	names := make([]string, 0, len(req.Params))
+	values := make([]string, 0, len(req.Params))
+	for name, value := range req.Params {
+		names = append(names, name)
+		values = append(values, value)
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+
+	return &echox.EchoContext{Context: c, JWT: ec.JWT}, rec
+}
+
+// Handle 用描述创建上下文并调用处理器
+// 处理器返回错误时，和正式服务一样交给错误处理器处理
+func Handle(t testing.TB, ec *echox.EchoConfig, req Request, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+
+	c, rec := NewContext(t, ec, req)
+	if err := handler(c); nil != err {
+		c.Echo().HTTPErrorHandler(err, c)
+	}
+
+	return rec
+}
+
+// AssertError 检查返回的错误格式
+func AssertError(t testing.TB, rec *httptest.ResponseRecorder, statusCode int, errorCode int) (rsp echox.ErrorResponse) {
+	t.Helper()
+
+	if statusCode != rec.Code {
+		t.Errorf("状态码应该是%d，实际是%d：%s", statusCode, rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); nil != err {
+		t.Fatalf("错误格式不正确：%v，%s", err, rec.Body.String())
+	}
+	if errorCode != rsp.ErrorCode {
+		t.Errorf("错误码应该是%d，实际是%d：%s", errorCode, rsp.ErrorCode, rsp.Message)
+	}
+
+	return
+}
+
+func body(t testing.TB, b interface{}) io.Reader {
+	t.Helper()
+
+	switch value := b.(type) {
+	case nil:
+		return nil
+	case string:
+		return strings.NewReader(value)
+	case []byte:
+		return bytes.NewReader(value)
+	case io.Reader:
+		return value
+	default:
+		data, err := json.Marshal(value)
+		if nil != err {
+			t.Fatalf("序列化请求体出错：%v", err)
+		}
+
+		return bytes.NewReader(data)
+	}
+}
@@ -0,0 +1,98 @@
+package echoxtest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/echox"
+	"github.com/storezhang/gox"
+)
+
+type order struct {
+	Amount int `json:"amount"`
+}
+
+func testConfig() *echox.EchoConfig {
+	ec := echox.NewDefaultConfig()
+	ec.JWT = &echox.JWTConfig{SigningKey: "secret"}
+	ec.Routes = []echox.RouteFunc{echox.Register(echox.Route{
+		Method: echo.GET,
+		Path:   "/me",
+		Auth:   echox.AuthJWT,
+		Handler: func(c echo.Context) error {
+			user, err := c.(*echox.EchoContext).User()
+			if nil != err {
+				return err
+			}
+
+			return c.String(http.StatusOK, user.Username)
+		},
+	})}
+
+	return ec
+}
+
+func TestNewRequest(t *testing.T) {
+	ec := testConfig()
+	req := NewRequest(t, ec, Request{
+		Method: http.MethodPost,
+		Path:   "/orders?draft=true",
+		Header: http.Header{"X-Tenant": {"acme"}},
+		Body:   order{Amount: 10},
+		User:   &gox.BaseUser{Id: 7, Username: "alice"},
+	})
+
+	if http.MethodPost != req.Method || "true" != req.URL.Query().Get("draft") || "acme" != req.Header.Get("X-Tenant") {
+		t.Fatalf("请求是%s %s %v", req.Method, req.URL, req.Header)
+	}
+	if echo.MIMEApplicationJSON != req.Header.Get(echo.HeaderContentType) {
+		t.Fatalf("结构体的请求体应该是JSON：%s", req.Header.Get(echo.HeaderContentType))
+	}
+	if body, _ := ioutil.ReadAll(req.Body); `{"amount":10}` != string(body) {
+		t.Fatalf("请求体是%s", body)
+	}
+	if !strings.HasPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer ") {
+		t.Fatalf("没有初始化的JWT配置也应该使用默认的认证方式：%s", req.Header.Get(echo.HeaderAuthorization))
+	}
+}
+
+func TestHandle(t *testing.T) {
+	ec := testConfig()
+	rec := Handle(t, ec, Request{Path: "/orders/1", Params: map[string]string{"id": "1"}}, func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("id"))
+	})
+	if http.StatusOK != rec.Code || "1" != rec.Body.String() {
+		t.Fatalf("响应是%d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = Handle(t, ec, Request{Path: "/orders/2"}, func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "订单不存在")
+	})
+	if rsp := AssertError(t, rec, http.StatusNotFound, 0); !strings.Contains(rsp.Message, "订单不存在") {
+		t.Fatalf("错误消息是%q", rsp.Message)
+	}
+}
+
+func TestNewTestServer(t *testing.T) {
+	ec := testConfig()
+	server := NewTestServer(ec)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/me", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	req.Header.Set(echo.HeaderAuthorization, Authorization(t, ec.JWT, gox.BaseUser{Id: 7, Username: "alice"}))
+	rsp, err := http.DefaultClient.Do(req)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if body, _ := ioutil.ReadAll(rsp.Body); http.StatusOK != rsp.StatusCode || "alice" != string(body) {
+		t.Fatalf("响应是%d %s", rsp.StatusCode, body)
+	}
+}
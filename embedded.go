@@ -0,0 +1,561 @@
+package echox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	embeddedCachePrefix       = "cache:"
+	embeddedIdempotencyPrefix = "idempotency:"
+	embeddedRateLimitPrefix   = "ratelimit:"
+)
+
+type (
+	// EmbeddedConfig 嵌入式存储的配置
+	EmbeddedConfig struct {
+		// 数据文件
+		// 必须
+		Path string
+
+		// 每次写入后都同步到磁盘，关闭时掉电最多丢失最后几次写入
+		Sync bool
+
+		// 无效的记录超过这个数量并且多于有效的记录时整理文件，过期的记录每分钟清理一次，也算作无效的记录
+		// 非必须 默认值是1000
+		CompactThreshold int
+
+		// 令牌桶保存在内存中，按这个间隔把变化的令牌桶写入文件，崩溃时最多丢失这段时间的限流状态
+		// 非必须 默认值是1秒
+		RateLimitSnapshot time.Duration
+
+		// 定时备份，为空时不备份
+		Backup *EmbeddedBackupConfig
+	}
+
+	// Embedded 嵌入式的键值存储，单实例部署时代替Redis
+	// 数据追加写入一个文件，启动时读回内存，所以只适合数据量不大的场景
+	// 会话等没有专门接口的数据可以直接使用Get和Set
+	Embedded struct {
+		mutex   sync.Mutex
+		config  EmbeddedConfig
+		file    *os.File
+		entries map[string]embeddedEntry
+		garbage int
+		done    chan struct{}
+		closing sync.Once
+		tasks   sync.WaitGroup
+	}
+
+	embeddedEntry struct {
+		value   []byte
+		expires time.Time
+	}
+
+	embeddedRecord struct {
+		Key     string `json:"k"`
+		Value   []byte `json:"v,omitempty"`
+		Expires int64  `json:"e,omitempty"`
+		Deleted bool   `json:"d,omitempty"`
+	}
+
+	embeddedCacheStore struct {
+		db *Embedded
+	}
+
+	embeddedIdempotencyStore struct {
+		db *Embedded
+	}
+
+	embeddedRateLimitStore struct {
+		db      *Embedded
+		mutex   sync.Mutex
+		buckets map[string]*embeddedBucket
+	}
+
+	embeddedBucket struct {
+		tokenBucket
+		rate  float64
+		burst int
+		dirty bool
+	}
+)
+
+var (
+	// DefaultEmbeddedConfig 默认配置
+	DefaultEmbeddedConfig = EmbeddedConfig{
+		CompactThreshold:  1000,
+		RateLimitSnapshot: time.Second,
+	}
+)
+
+// OpenEmbedded 打开嵌入式存储，文件不存在时创建
+func OpenEmbedded(config EmbeddedConfig) (db *Embedded, err error) {
+	if "" == config.Path {
+		panic("echo: embedded store requires a path")
+	}
+	if 0 >= config.CompactThreshold {
+		config.CompactThreshold = DefaultEmbeddedConfig.CompactThreshold
+	}
+	if 0 >= config.RateLimitSnapshot {
+		config.RateLimitSnapshot = DefaultEmbeddedConfig.RateLimitSnapshot
+	}
+
+	db = &Embedded{config: config, entries: make(map[string]embeddedEntry), done: make(chan struct{})}
+	if nil != config.Backup && config.Backup.Restore {
+		if err = config.Backup.restore(config.Path); nil != err {
+			return
+		}
+	}
+	if err = db.load(); nil != err {
+		return
+	}
+	if db.file, err = os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); nil != err {
+		return
+	}
+	db.every(memorySweepInterval, db.sweep)
+
+	return
+}
+
+// Get 读取值，不存在或者过期时ok为false
+func (e *Embedded) Get(key string) (value []byte, ok bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.get(key, time.Now())
+}
+
+// Set 写入值，ttl为0时不过期
+func (e *Embedded) Set(key string, value []byte, ttl time.Duration) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.set(key, value, ttl)
+}
+
+// Delete 删除值
+func (e *Embedded) Delete(key string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.delete(key)
+}
+
+// DeletePrefix 删除某个前缀的所有值
+func (e *Embedded) DeletePrefix(prefix string) (err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for key := range e.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if err = e.delete(key); nil != err {
+			return
+		}
+	}
+
+	return
+}
+
+// Update 原子地读取和修改值，fn返回nil时不修改
+func (e *Embedded) Update(key string, fn func(value []byte, ok bool) (next []byte, ttl time.Duration, err error)) (err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	value, ok := e.get(key, time.Now())
+	next, ttl, err := fn(value, ok)
+	if nil == err && nil != next {
+		err = e.set(key, next, ttl)
+	}
+
+	return
+}
+
+// Flush 把数据同步到磁盘
+func (e *Embedded) Flush() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.file.Sync()
+}
+
+// Close 停止后台任务，同步数据后关闭数据文件
+func (e *Embedded) Close() (err error) {
+	e.closing.Do(func() {
+		close(e.done)
+	})
+	e.tasks.Wait()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if err = e.file.Sync(); nil != err {
+		return
+	}
+
+	return e.file.Close()
+}
+
+// Snapshot 写出所有有效的记录，格式和数据文件相同，可以直接作为数据文件恢复
+func (e *Embedded) Snapshot(writer io.Writer) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.snapshot(writer)
+}
+
+// every 按间隔执行后台任务，关闭时最后执行一次，任务不能持有e.mutex调用Close
+func (e *Embedded) every(interval time.Duration, task func(now time.Time)) {
+	e.tasks.Add(1)
+	go func() {
+		defer e.tasks.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				task(now)
+			case <-e.done:
+				task(time.Now())
+
+				return
+			}
+		}
+	}()
+}
+
+// sweep 删除过期的记录，没有被读取的过期记录也会计入无效的记录，让文件能够被整理
+func (e *Embedded) sweep(now time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for key, entry := range e.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(e.entries, key)
+			e.garbage++
+		}
+	}
+	// 整理失败时文件只是大一些，下次写入或者清理时再试
+	_ = e.compact()
+}
+
+func (e *Embedded) get(key string, now time.Time) (value []byte, ok bool) {
+	var entry embeddedEntry
+	if entry, ok = e.entries[key]; !ok {
+		return
+	}
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		// 过期的记录在整理文件时才真正删除
+		delete(e.entries, key)
+		e.garbage++
+
+		return nil, false
+	}
+	value = entry.value
+
+	return
+}
+
+func (e *Embedded) set(key string, value []byte, ttl time.Duration) (err error) {
+	record := embeddedRecord{Key: key, Value: value}
+	entry := embeddedEntry{value: value}
+	if 0 < ttl {
+		entry.expires = time.Now().Add(ttl)
+		record.Expires = entry.expires.UnixNano()
+	}
+	if err = e.append(record); nil != err {
+		return
+	}
+	if _, ok := e.entries[key]; ok {
+		e.garbage++
+	}
+	e.entries[key] = entry
+
+	return e.compact()
+}
+
+func (e *Embedded) delete(key string) (err error) {
+	if _, ok := e.entries[key]; !ok {
+		return
+	}
+	if err = e.append(embeddedRecord{Key: key, Deleted: true}); nil != err {
+		return
+	}
+	delete(e.entries, key)
+	// 原来的记录和删除的记录都是无效的
+	e.garbage += 2
+
+	return e.compact()
+}
+
+func (e *Embedded) append(record embeddedRecord) (err error) {
+	var data []byte
+	if data, err = json.Marshal(record); nil != err {
+		return
+	}
+	if _, err = e.file.Write(append(data, '\n')); nil != err {
+		return
+	}
+	if e.config.Sync {
+		err = e.file.Sync()
+	}
+
+	return
+}
+
+// load 按顺序重放数据文件，崩溃时写了一半的最后一行被忽略
+func (e *Embedded) load() (err error) {
+	var file *os.File
+	if file, err = os.Open(e.config.Path); nil != err {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+	defer file.Close()
+
+	now := time.Now()
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if io.EOF == readErr {
+			break
+		}
+		if nil != readErr {
+			return readErr
+		}
+
+		record := embeddedRecord{}
+		if nil != json.Unmarshal(line, &record) {
+			e.garbage++
+
+			continue
+		}
+		if _, ok := e.entries[record.Key]; ok || record.Deleted {
+			e.garbage++
+		}
+		if record.Deleted {
+			delete(e.entries, record.Key)
+
+			continue
+		}
+		entry := embeddedEntry{value: record.Value}
+		if 0 != record.Expires {
+			entry.expires = time.Unix(0, record.Expires)
+		}
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(e.entries, record.Key)
+			e.garbage++
+
+			continue
+		}
+		e.entries[record.Key] = entry
+	}
+
+	return
+}
+
+// compact 无效的记录太多时，把有效的记录写到新文件再替换
+func (e *Embedded) compact() (err error) {
+	if e.garbage < e.config.CompactThreshold || e.garbage < len(e.entries) {
+		return
+	}
+
+	temp := e.config.Path + ".tmp"
+	if err = e.writeTo(temp); nil != err {
+		return
+	}
+	if err = e.file.Close(); nil != err {
+		return
+	}
+	if err = os.Rename(temp, e.config.Path); nil != err {
+		return
+	}
+	if e.file, err = os.OpenFile(e.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); nil == err {
+		e.garbage = 0
+	}
+
+	return
+}
+
+// writeTo 把有效的记录写到文件并同步到磁盘
+func (e *Embedded) writeTo(path string) (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); nil != err {
+		return
+	}
+	defer func() {
+		if closeErr := file.Close(); nil == err {
+			err = closeErr
+		}
+	}()
+
+	writer := bufio.NewWriter(file)
+	if err = e.snapshot(writer); nil != err {
+		return
+	}
+	if err = writer.Flush(); nil != err {
+		return
+	}
+	err = file.Sync()
+
+	return
+}
+
+func (e *Embedded) snapshot(writer io.Writer) (err error) {
+	now := time.Now()
+	encoder := json.NewEncoder(writer)
+	for key, entry := range e.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			continue
+		}
+		record := embeddedRecord{Key: key, Value: entry.value}
+		if !entry.expires.IsZero() {
+			record.Expires = entry.expires.UnixNano()
+		}
+		if err = encoder.Encode(record); nil != err {
+			return
+		}
+	}
+
+	return
+}
+
+// NewEmbeddedCacheStore 创建嵌入式的响应缓存存储
+func NewEmbeddedCacheStore(db *Embedded) CacheStore {
+	return &embeddedCacheStore{db: db}
+}
+
+func (ecs *embeddedCacheStore) Get(key string) (rsp *CachedResponse, ok bool, err error) {
+	var data []byte
+	if data, ok = ecs.db.Get(embeddedCachePrefix + key); !ok {
+		return
+	}
+	rsp = new(CachedResponse)
+	err = json.Unmarshal(data, rsp)
+
+	return
+}
+
+func (ecs *embeddedCacheStore) Set(key string, rsp *CachedResponse, ttl time.Duration) (err error) {
+	var data []byte
+	if data, err = json.Marshal(rsp); nil != err {
+		return
+	}
+
+	return ecs.db.Set(embeddedCachePrefix+key, data, ttl)
+}
+
+func (ecs *embeddedCacheStore) Delete(key string) error {
+	return ecs.db.Delete(embeddedCachePrefix + key)
+}
+
+func (ecs *embeddedCacheStore) DeletePrefix(prefix string) error {
+	return ecs.db.DeletePrefix(embeddedCachePrefix + prefix)
+}
+
+// NewEmbeddedIdempotencyStore 创建嵌入式的幂等结果存储，重启后重复的请求仍然返回第一次的结果
+func NewEmbeddedIdempotencyStore(db *Embedded) IdempotencyStore {
+	return &embeddedIdempotencyStore{db: db}
+}
+
+func (eis *embeddedIdempotencyStore) Begin(key string, ttl time.Duration) (rsp *IdempotentResponse, err error) {
+	err = eis.db.Update(embeddedIdempotencyPrefix+key, func(value []byte, ok bool) ([]byte, time.Duration, error) {
+		// 正在处理的标记带上进程的启动时间，崩溃重启后之前没有处理完的请求可以重试
+		inFlight := []byte("!" + strconv.FormatInt(startedAt.UnixNano(), 10))
+		if !ok || 0 == len(value) || ('!' == value[0] && !bytes.Equal(inFlight, value)) {
+			return inFlight, ttl, nil
+		}
+		if '!' == value[0] {
+			return nil, 0, ErrIdempotencyInFlight
+		}
+		rsp = new(IdempotentResponse)
+
+		return nil, 0, json.Unmarshal(value, rsp)
+	})
+
+	return
+}
+
+func (eis *embeddedIdempotencyStore) Save(key string, rsp *IdempotentResponse, ttl time.Duration) (err error) {
+	var data []byte
+	if data, err = json.Marshal(rsp); nil != err {
+		return
+	}
+
+	return eis.db.Set(embeddedIdempotencyPrefix+key, data, ttl)
+}
+
+func (eis *embeddedIdempotencyStore) Release(key string) error {
+	return eis.db.Delete(embeddedIdempotencyPrefix + key)
+}
+
+// NewEmbeddedRateLimitStore 创建嵌入式的令牌桶存储，重启后限流不会被重置
+// 令牌桶在内存中计算，按EmbeddedConfig.RateLimitSnapshot定时写入文件，每个请求不会写一次磁盘
+func NewEmbeddedRateLimitStore(db *Embedded) RateLimitStore {
+	store := &embeddedRateLimitStore{db: db, buckets: make(map[string]*embeddedBucket)}
+	db.every(db.config.RateLimitSnapshot, store.snapshot)
+
+	return store
+}
+
+func (erls *embeddedRateLimitStore) Allow(key string, rate float64, burst int) (allowed bool, err error) {
+	erls.mutex.Lock()
+	defer erls.mutex.Unlock()
+
+	now := time.Now()
+	bucket, ok := erls.buckets[key]
+	if !ok {
+		bucket = &embeddedBucket{tokenBucket: tokenBucket{tokens: float64(burst), last: now}}
+		// 内存中没有时从文件中读回重启前的状态
+		if value, found := erls.db.Get(embeddedRateLimitPrefix + key); found && 16 == len(value) {
+			bucket.tokens = math.Float64frombits(binary.BigEndian.Uint64(value[:8]))
+			bucket.last = time.Unix(0, int64(binary.BigEndian.Uint64(value[8:])))
+		}
+		erls.buckets[key] = bucket
+	}
+	bucket.rate, bucket.burst, bucket.dirty = rate, burst, true
+	allowed = bucket.take(now, rate, burst)
+
+	return
+}
+
+// snapshot 把变化的令牌桶写入文件，已经装满的令牌桶和新的一样，从内存中删除
+func (erls *embeddedRateLimitStore) snapshot(now time.Time) {
+	erls.mutex.Lock()
+	defer erls.mutex.Unlock()
+
+	for key, bucket := range erls.buckets {
+		if !bucket.dirty {
+			if bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate >= float64(bucket.burst) {
+				delete(erls.buckets, key)
+			}
+
+			continue
+		}
+
+		value := make([]byte, 16)
+		binary.BigEndian.PutUint64(value[:8], math.Float64bits(bucket.tokens))
+		binary.BigEndian.PutUint64(value[8:], uint64(bucket.last.UnixNano()))
+		// 装满以后和新的令牌桶一样，不需要再保存
+		ttl := time.Duration((float64(bucket.burst) - bucket.tokens) / bucket.rate * float64(time.Second))
+		// 写入失败时保留标记，下次再写
+		if nil == erls.db.Set(embeddedRateLimitPrefix+key, value, ttl+time.Second) {
+			bucket.dirty = false
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package echox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const embeddedBackupIndex = "index.json"
+
+type (
+	// EmbeddedBackupConfig 嵌入式存储的定时备份
+	EmbeddedBackupConfig struct {
+		// 备份保存的位置，可以是本地目录或者S3
+		// 必须
+		Storage Storage
+
+		// 备份文件的前缀
+		// 非必须 默认值是"embedded/"
+		Prefix string
+
+		// 备份的间隔
+		// 非必须 默认值是1小时
+		Interval time.Duration
+
+		// 保留的备份数，超出后删除最旧的
+		// 非必须 默认值是24
+		Keep int
+
+		// 启动时数据文件不存在，从最新的备份恢复
+		Restore bool
+	}
+)
+
+var (
+	// DefaultEmbeddedBackupConfig 默认配置
+	DefaultEmbeddedBackupConfig = EmbeddedBackupConfig{
+		Prefix:   "embedded/",
+		Interval: time.Hour,
+		Keep:     24,
+	}
+)
+
+// Backup 把快照保存到配置的存储，备份的列表记在前缀下的index.json中
+func (e *Embedded) Backup(ctx context.Context) (err error) {
+	config := e.config.Backup
+	if nil == config {
+		panic("echo: embedded backup requires a backup config")
+	}
+	config.defaults()
+
+	buffer := new(bytes.Buffer)
+	if err = e.Snapshot(buffer); nil != err {
+		return
+	}
+	key := config.Prefix + time.Now().UTC().Format("20060102T150405Z") + ".jsonl"
+	if _, err = config.Storage.Put(ctx, key, buffer, int64(buffer.Len()), "application/x-ndjson"); nil != err {
+		return
+	}
+
+	var backups []string
+	if backups, err = config.backups(ctx); nil != err {
+		return
+	}
+	backups = append(backups, key)
+	for config.Keep < len(backups) {
+		if err = config.Storage.Delete(ctx, backups[0]); nil != err && ErrObjectNotFound != err {
+			return
+		}
+		backups = backups[1:]
+	}
+
+	var index []byte
+	if index, err = json.Marshal(backups); nil != err {
+		return
+	}
+	_, err = config.Storage.Put(ctx, config.Prefix+embeddedBackupIndex, bytes.NewReader(index), int64(len(index)), "application/json")
+
+	return
+}
+
+func (ebc *EmbeddedBackupConfig) defaults() {
+	if nil == ebc.Storage {
+		panic("echo: embedded backup requires a storage")
+	}
+	if "" == ebc.Prefix {
+		ebc.Prefix = DefaultEmbeddedBackupConfig.Prefix
+	}
+	if 0 >= ebc.Interval {
+		ebc.Interval = DefaultEmbeddedBackupConfig.Interval
+	}
+	if 0 >= ebc.Keep {
+		ebc.Keep = DefaultEmbeddedBackupConfig.Keep
+	}
+}
+
+// backups 已有的备份，旧的在前面
+func (ebc *EmbeddedBackupConfig) backups(ctx context.Context) (backups []string, err error) {
+	var reader io.ReadCloser
+	if reader, err = ebc.Storage.Open(ctx, ebc.Prefix+embeddedBackupIndex); ErrObjectNotFound == err {
+		return []string{}, nil
+	} else if nil != err {
+		return
+	}
+	defer reader.Close()
+
+	var data []byte
+	if data, err = ioutil.ReadAll(reader); nil != err {
+		return
+	}
+	err = json.Unmarshal(data, &backups)
+
+	return
+}
+
+// restore 数据文件不存在时下载最新的备份，先写临时文件，下载完整后再改名
+func (ebc *EmbeddedBackupConfig) restore(path string) (err error) {
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		return
+	}
+	ebc.defaults()
+
+	ctx := context.Background()
+	var backups []string
+	if backups, err = ebc.backups(ctx); nil != err || 0 == len(backups) {
+		return
+	}
+	var reader io.ReadCloser
+	if reader, err = ebc.Storage.Open(ctx, backups[len(backups)-1]); nil != err {
+		return
+	}
+	defer reader.Close()
+
+	temp := path + ".tmp"
+	var file *os.File
+	if file, err = os.OpenFile(temp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); nil != err {
+		return
+	}
+	if _, err = io.Copy(file, reader); nil == err {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); nil == err {
+		err = closeErr
+	}
+	if nil != err {
+		return
+	}
+
+	return os.Rename(temp, path)
+}
+
+// embeddedWorker 定时备份的后台任务
+func embeddedWorker(db *Embedded) Worker {
+	db.config.Backup.defaults()
+
+	return Worker{
+		Name:     "embedded-backup",
+		Run:      db.Backup,
+		Interval: db.config.Backup.Interval,
+	}
+}
@@ -0,0 +1,105 @@
+package echox
+
+import (
+	"reflect"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	enumTag = "enum"
+)
+
+type (
+	// Enum 字符串枚举
+	// 定义方法：
+	//  type Gender string
+	//  func (g Gender) Values() []string { return []string{"male", "female"} }
+	// 字段加上validate:"enum"标签后，验证器会检查值是不是合法
+	Enum interface {
+		// Values 返回所有合法的值
+		Values() []string
+	}
+)
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// NormalizeEnum 忽略大小写，把值转换成枚举中定义的写法
+// 值不合法时，原样返回，交给验证器处理
+func NormalizeEnum(e Enum, value string) string {
+	for _, allowed := range e.Values() {
+		if strings.EqualFold(allowed, value) {
+			return allowed
+		}
+	}
+
+	return value
+}
+
+func validateEnum(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	e, ok := field.Interface().(Enum)
+	if !ok || reflect.String != field.Kind() {
+		return false
+	}
+
+	value := field.String()
+	for _, allowed := range e.Values() {
+		if allowed == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func registerEnumTranslation(t ut.Translator, text string) error {
+	return v.RegisterTranslation(enumTag, t, func(t ut.Translator) error {
+		return t.Add(enumTag, text, true)
+	}, func(t ut.Translator, fe validator.FieldError) string {
+		values := ""
+		if e, ok := fe.Value().(Enum); ok {
+			values = strings.Join(e.Values(), ", ")
+		}
+		message, _ := t.T(enumTag, fe.Field(), values)
+
+		return message
+	})
+}
+
+// normalizeEnums 把结构体中所有枚举字段转换成枚举中定义的写法
+func normalizeEnums(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			normalizeEnums(value.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if field := value.Field(i); field.CanSet() {
+				normalizeEnums(field)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			normalizeEnums(value.Index(i))
+		}
+	case reflect.String:
+		if e, ok := value.Interface().(Enum); ok && value.CanSet() {
+			value.SetString(NormalizeEnum(e, value.String()))
+		}
+	}
+}
+
+func enumSchema(t reflect.Type) *Schema {
+	e := reflect.Zero(t).Interface().(Enum)
+
+	schema := &Schema{Type: "string"}
+	for _, value := range e.Values() {
+		schema.Enum = append(schema.Enum, value)
+	}
+
+	return schema
+}
@@ -0,0 +1,88 @@
+package echox
+
+import (
+	"fmt"
+	"reflect"
+)
+
+type (
+	// EnvironmentConfig 按运行环境开关功能，功能的名字是EchoConfig的字段名，比如Dev和Mock
+	// 运行环境来自Environment()
+	//
+	//	Environments: &echox.EnvironmentConfig{
+	//		Only:   map[string][]string{"DebugBind": {"staging"}},
+	//		Except: map[string][]string{"Mock": {"prod"}},
+	//	}
+	EnvironmentConfig struct {
+		// 功能只在这些环境启用，其它环境当作没有配置
+		Only map[string][]string
+
+		// 功能在这些环境停用
+		Except map[string][]string
+
+		// 生产环境的名字
+		// 非必须 默认值是prod和production
+		Production []string
+
+		// 生产环境禁止的功能，开关之后仍然启用时启动失败
+		// 非必须 默认值是Dev、Mock和DebugBind
+		Forbidden []string
+	}
+)
+
+var (
+	// DefaultEnvironmentConfig 默认配置
+	DefaultEnvironmentConfig = EnvironmentConfig{
+		Production: []string{"prod", "production"},
+		Forbidden:  []string{"Dev", "Mock", "DebugBind"},
+	}
+)
+
+// apply 停用当前环境不需要的功能，再检查生产环境的危险配置
+// 直接修改配置，后面启动服务时看到的是同一份配置
+func (enc *EnvironmentConfig) apply(ec *EchoConfig) {
+	production := enc.Production
+	if 0 == len(production) {
+		production = DefaultEnvironmentConfig.Production
+	}
+	forbidden := enc.Forbidden
+	if nil == forbidden {
+		forbidden = DefaultEnvironmentConfig.Forbidden
+	}
+
+	env := Environment()
+	value := reflect.ValueOf(ec).Elem()
+	for name, envs := range enc.Only {
+		if field := toggleField(value, name); !containsString(envs, env) {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	for name, envs := range enc.Except {
+		if field := toggleField(value, name); containsString(envs, env) {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	for _, name := range forbidden {
+		toggleField(value, name)
+	}
+	if !containsString(production, env) {
+		return
+	}
+	enabled := Modules(ec)
+	for _, name := range forbidden {
+		if containsString(enabled, name) {
+			panic(fmt.Sprintf("echo: %s must not be enabled in %s", name, env))
+		}
+	}
+}
+
+// toggleField 按名字找配置的字段，写错名字时启动失败，避免开关悄悄不生效
+func toggleField(value reflect.Value, name string) reflect.Value {
+	field := value.FieldByName(name)
+	if !field.IsValid() || "Environments" == name {
+		panic("echo: unknown environment toggle: " + name)
+	}
+
+	return field
+}
@@ -1,13 +1,83 @@
 package echox
 
-// Error 接口，符合条件的错误统一处理
-type Error interface {
-	// ErrorCode 返回错误码
-	ErrorCode() int
-	// Message 返回错误消息
-	Message() string
-	// Data 返回错误实体
-	// 在某些错误下，可能需要返回额外的信息给前端处理
-	// 比如，认证错误，需要返回哪些字段有错误
-	Data() interface{}
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// Error 接口，符合条件的错误统一处理
+	Error interface {
+		// ErrorCode 返回错误码
+		ErrorCode() int
+		// Message 返回错误消息
+		Message() string
+		// Data 返回错误实体
+		// 在某些错误下，可能需要返回额外的信息给前端处理
+		// 比如，认证错误，需要返回哪些字段有错误
+		Data() interface{}
+	}
+
+	// ErrorResponse 统一的错误返回格式
+	ErrorResponse struct {
+		XMLName   xml.Name    `json:"-" xml:"error"`
+		ErrorCode int         `json:"errorCode" xml:"errorCode"`
+		Message   string      `json:"message" xml:"message"`
+		Data      interface{} `json:"data" xml:"data,omitempty"`
+		RequestId string      `json:"requestId,omitempty" xml:"requestId,omitempty"`
+	}
+)
+
+var (
+	// requestIdHeader Echo的X-Request-ID不是规范的写法，Header.Get每次都要转换
+	requestIdHeader = http.CanonicalHeaderKey(echo.HeaderXRequestID)
+)
+
+func errorHandler(err error, c echo.Context) {
+	// 响应和处理器一样使用配置的JSON编码
+	c = ContextOf(c)
+	rsp := &ErrorResponse{RequestId: CorrelationOf(c).RequestId}
+	if values := c.Response().Header()[requestIdHeader]; "" == rsp.RequestId && 0 != len(values) {
+		rsp.RequestId = values[0]
+	}
+
+	statusCode := http.StatusInternalServerError
+	switch re := err.(type) {
+	case *echo.HTTPError:
+		statusCode = re.Code
+		rsp.Message = re.Error()
+	case validator.ValidationErrors:
+		statusCode = http.StatusBadRequest
+		lang := c.Request().Header.Get(HeaderAcceptLanguage)
+		rsp.ErrorCode = CodeValidation
+		rsp.Message = "数据验证错误"
+		rsp.Data = fieldErrors(lang, re)
+	case BindErrors:
+		statusCode = http.StatusBadRequest
+		rsp.ErrorCode = CodeValidation
+		rsp.Message = "数据验证错误"
+		rsp.Data = bindFieldErrors(re)
+	case Error:
+		if sc, ok := re.(statusCoder); ok {
+			statusCode = sc.StatusCode()
+		}
+		rsp.ErrorCode = re.ErrorCode()
+		rsp.Message = re.Message()
+		rsp.Data = re.Data()
+	default:
+		rsp.Message = re.Error()
+	}
+
+	if nil != recentErrors {
+		recentErrors.record(c, statusCode, rsp)
+	}
+
+	// 有些数据不能编码成客户端要求的格式，比如map不能编码成XML，这时候退回到JSON
+	if renderErr := renderError(c, statusCode, rsp); nil != renderErr && !c.Response().Committed {
+		c.JSON(statusCode, rsp)
+	}
+	c.Logger().Error(err)
 }
@@ -0,0 +1,165 @@
+package echox
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// ErrorBudgetConfig 按路由的错误预算
+	// 路由的5xx占比超过阈值时自动停用一段时间，保护共享的资源
+	ErrorBudgetConfig struct {
+		// 跳过统计
+		Skipper middleware.Skipper
+
+		// 统计的时间窗口
+		// 非必须 默认值是1分钟
+		Window time.Duration
+
+		// 5xx响应占比的阈值
+		// 非必须 默认值是0.5
+		MaxErrorRate float64
+
+		// 路由声明了SLA的可用性时，错误率超过错误预算的这个倍数时停用，不再使用MaxErrorRate
+		// 非必须 默认值是14.4
+		BurnRate float64
+
+		// 窗口内请求数达到这个值后才开始计算错误率
+		// 非必须 默认值是20
+		MinRequests int64
+
+		// 停用的时长，到期后自动恢复
+		// 非必须 默认值是30秒
+		CoolDown time.Duration
+
+		// 路由被停用时的告警
+		// 非必须 默认写日志
+		Alert func(trip RouteTrip)
+	}
+
+	// RouteTrip 路由被自动停用的信息
+	RouteTrip struct {
+		Method    string        `json:"method"`
+		Path      string        `json:"path"`
+		Total     int64         `json:"total"`
+		Errors    int64         `json:"errors"`
+		ErrorRate float64       `json:"errorRate"`
+		CoolDown  time.Duration `json:"coolDown"`
+	}
+
+	routeBudget struct {
+		mutex  sync.Mutex
+		start  time.Time
+		total  int64
+		errors int64
+	}
+)
+
+var (
+	// DefaultErrorBudgetConfig 默认配置
+	DefaultErrorBudgetConfig = ErrorBudgetConfig{
+		Skipper:      middleware.DefaultSkipper,
+		Window:       time.Minute,
+		MaxErrorRate: 0.5,
+		BurnRate:     sloBurnRate,
+		MinRequests:  20,
+		CoolDown:     30 * time.Second,
+	}
+)
+
+// ErrorBudget 错误预算中间件
+func ErrorBudget() echo.MiddlewareFunc {
+	return ErrorBudgetWithConfig(DefaultErrorBudgetConfig)
+}
+
+// ErrorBudgetWithConfig 错误预算中间件
+// 停用通过DisableRoute完成，可以在管理接口中查看和提前恢复
+func ErrorBudgetWithConfig(config ErrorBudgetConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultErrorBudgetConfig.Skipper
+	}
+	if 0 >= config.Window {
+		config.Window = DefaultErrorBudgetConfig.Window
+	}
+	if 0 >= config.MaxErrorRate {
+		config.MaxErrorRate = DefaultErrorBudgetConfig.MaxErrorRate
+	}
+	if 0 >= config.BurnRate {
+		config.BurnRate = DefaultErrorBudgetConfig.BurnRate
+	}
+	if 0 >= config.MinRequests {
+		config.MinRequests = DefaultErrorBudgetConfig.MinRequests
+	}
+	if 0 >= config.CoolDown {
+		config.CoolDown = DefaultErrorBudgetConfig.CoolDown
+	}
+
+	var budgets sync.Map
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) || "" == c.Path() {
+				return next(c)
+			}
+
+			err = next(c)
+
+			method := c.Request().Method
+			value, _ := budgets.LoadOrStore(routeKey(method, c.Path()), &routeBudget{start: time.Now()})
+			budget := value.(*routeBudget)
+			maxErrorRate := config.MaxErrorRate
+			if route, ok := RouteOf(method, c.Path()); ok && nil != route.SLA && 0 < route.SLA.Availability {
+				maxErrorRate = route.SLA.maxErrorRate(config.BurnRate)
+			}
+			if trip, tripped := budget.record(config, maxErrorRate, http.StatusInternalServerError <= statusOf(c, err)); tripped {
+				trip.Method = method
+				trip.Path = c.Path()
+				DisableRoute(method, trip.Path, defaultDisabledMessage)
+				time.AfterFunc(config.CoolDown, func() {
+					EnableRoute(method, trip.Path)
+				})
+
+				if nil != config.Alert {
+					config.Alert(trip)
+				} else {
+					c.Logger().Warnf("路由%s %s错误率%.2f，停用%s", method, trip.Path, trip.ErrorRate, config.CoolDown)
+				}
+			}
+
+			return
+		}
+	}
+}
+
+func (rb *routeBudget) record(config ErrorBudgetConfig, maxErrorRate float64, failed bool) (trip RouteTrip, tripped bool) {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	if time.Since(rb.start) > config.Window {
+		rb.start = time.Now()
+		rb.total = 0
+		rb.errors = 0
+	}
+	rb.total++
+	if failed {
+		rb.errors++
+	}
+
+	rate := float64(rb.errors) / float64(rb.total)
+	if rb.total < config.MinRequests || rate <= maxErrorRate {
+		return
+	}
+
+	trip = RouteTrip{Total: rb.total, Errors: rb.errors, ErrorRate: rate, CoolDown: config.CoolDown}
+	tripped = true
+	// 恢复后重新统计
+	rb.start = time.Now()
+	rb.total = 0
+	rb.errors = 0
+
+	return
+}
@@ -0,0 +1,72 @@
+package echox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// ErrorCode 注册的错误码，用来生成前端的错误码枚举和文档
+	ErrorCode struct {
+		// 枚举中的名字，比如UserNotFound
+		Name    string `json:"name"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+var (
+	errorCodeMutex sync.RWMutex
+	errorCodes     = make(map[int]ErrorCode)
+)
+
+func init() {
+	RegisterErrorCode("Validation", CodeValidation, "数据验证错误")
+	for rule, code := range ValidationCodes {
+		RegisterErrorCode("Validation"+pascalCase(rule), code, "数据验证错误："+rule)
+	}
+}
+
+// RegisterErrorCode 注册错误码，同一个错误码重复注册时panic
+//
+//	var ErrUserNotFound = echox.NewError(http.StatusNotFound, 10001, "用户不存在")
+//	func init() { echox.RegisterErrorCode("UserNotFound", 10001, "用户不存在") }
+func RegisterErrorCode(name string, code int, message string) {
+	errorCodeMutex.Lock()
+	defer errorCodeMutex.Unlock()
+
+	if registered, ok := errorCodes[code]; ok && registered.Name != name {
+		panic(fmt.Sprintf("echo: error code %d is already registered as %s", code, registered.Name))
+	}
+	errorCodes[code] = ErrorCode{Name: name, Code: code, Message: message}
+}
+
+// ErrorCodes 所有注册的错误码，按错误码排序
+func ErrorCodes() (codes []ErrorCode) {
+	errorCodeMutex.RLock()
+	codes = make([]ErrorCode, 0, len(errorCodes))
+	for _, code := range errorCodes {
+		codes = append(codes, code)
+	}
+	errorCodeMutex.RUnlock()
+
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+
+	return
+}
+
+// pascalCase 把下划线、中划线和点分隔的名字转换成首字母大写的驼峰
+func pascalCase(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return '_' == r || '-' == r || '.' == r || ' ' == r || '/' == r
+	})
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return strings.Join(parts, "")
+}
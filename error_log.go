@@ -0,0 +1,155 @@
+package echox
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ErrorLogConfig 最近错误的配置，错误按状态码、路由和消息合并计数，通过管理接口查询
+	// 需要使用echox的错误处理，也就是EchoConfig.ErrorHandler为true
+	ErrorLogConfig struct {
+		// 最多保留的错误种类，超出后淘汰最久没有出现的
+		// 非必须 默认值是100
+		Size int
+
+		// 记录的最小状态码
+		// 非必须 默认值是500，只记录服务端错误
+		MinStatus int
+	}
+
+	// RecentError 合并后的错误
+	RecentError struct {
+		Status    int       `json:"status"`
+		ErrorCode int       `json:"errorCode,omitempty"`
+		Method    string    `json:"method"`
+		Route     string    `json:"route"`
+		Message   string    `json:"message"`
+		Count     int64     `json:"count"`
+		FirstSeen time.Time `json:"firstSeen"`
+		LastSeen  time.Time `json:"lastSeen"`
+		// 最后一次出现的请求编号，用来查日志
+		RequestId string `json:"requestId,omitempty"`
+	}
+
+	// errorRing 固定大小的缓冲，满了以后新的错误替换最久没有出现的
+	errorRing struct {
+		mutex     sync.Mutex
+		minStatus int
+		size      int
+		entries   []*RecentError
+		index     map[string]*RecentError
+	}
+)
+
+var (
+	// DefaultErrorLogConfig 默认配置
+	DefaultErrorLogConfig = ErrorLogConfig{
+		Size:      100,
+		MinStatus: http.StatusInternalServerError,
+	}
+
+	recentErrors *errorRing
+)
+
+// RecentErrors 最近的错误，最近出现的在前面，没有配置EchoConfig.ErrorLog时为空
+func RecentErrors() []RecentError {
+	if nil == recentErrors {
+		return []RecentError{}
+	}
+
+	return recentErrors.list()
+}
+
+func newErrorRing(config ErrorLogConfig) *errorRing {
+	if 0 >= config.Size {
+		config.Size = DefaultErrorLogConfig.Size
+	}
+	if 0 == config.MinStatus {
+		config.MinStatus = DefaultErrorLogConfig.MinStatus
+	}
+
+	return &errorRing{
+		minStatus: config.MinStatus,
+		size:      config.Size,
+		entries:   make([]*RecentError, 0, config.Size),
+		index:     make(map[string]*RecentError, config.Size),
+	}
+}
+
+// record 相同的错误只增加次数
+func (er *errorRing) record(c echo.Context, status int, rsp *ErrorResponse) {
+	if status < er.minStatus {
+		return
+	}
+
+	now := time.Now()
+	entry := &RecentError{
+		Status:    status,
+		ErrorCode: rsp.ErrorCode,
+		Method:    c.Request().Method,
+		Route:     c.Path(),
+		Message:   rsp.Message,
+		Count:     1,
+		FirstSeen: now,
+		LastSeen:  now,
+		RequestId: rsp.RequestId,
+	}
+	key := recentErrorKey(entry)
+
+	er.mutex.Lock()
+	defer er.mutex.Unlock()
+
+	if existing, ok := er.index[key]; ok {
+		existing.Count++
+		existing.LastSeen = now
+		existing.RequestId = rsp.RequestId
+
+		return
+	}
+	if len(er.entries) < er.size {
+		er.entries = append(er.entries, entry)
+	} else {
+		oldest := 0
+		for i, old := range er.entries {
+			if old.LastSeen.Before(er.entries[oldest].LastSeen) {
+				oldest = i
+			}
+		}
+		delete(er.index, recentErrorKey(er.entries[oldest]))
+		er.entries[oldest] = entry
+	}
+	er.index[key] = entry
+}
+
+func (er *errorRing) list() (errors []RecentError) {
+	er.mutex.Lock()
+	defer er.mutex.Unlock()
+
+	errors = make([]RecentError, 0, len(er.entries))
+	for _, entry := range er.entries {
+		errors = append(errors, *entry)
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].LastSeen.After(errors[j].LastSeen)
+	})
+
+	return
+}
+
+func (er *errorRing) clear() {
+	er.mutex.Lock()
+	defer er.mutex.Unlock()
+
+	er.entries = make([]*RecentError, 0, er.size)
+	er.index = make(map[string]*RecentError, er.size)
+}
+
+func recentErrorKey(entry *RecentError) string {
+	return strconv.Itoa(entry.Status) + " " + entry.Method + " " + entry.Route + " " + entry.Message
+}
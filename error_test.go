@@ -0,0 +1,28 @@
+package echox
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func BenchmarkErrorHandler(b *testing.B) {
+	e := echo.New()
+	e.Logger.SetOutput(ioutil.Discard)
+	err := errors.New("boom")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Reset(req, rec)
+		rec.Body.Reset()
+		errorHandler(err, c)
+	}
+}
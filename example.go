@@ -0,0 +1,285 @@
+package echox
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// Example 响应的示例，用来生成OpenAPI文档和模拟响应
+	Example struct {
+		// 名称，模拟响应时按名称选择
+		// 必须
+		Name string
+
+		// 状态码
+		// 非必须 默认值是200
+		Status int
+
+		// 说明
+		Summary string
+
+		// 示例的值，成功的示例要和Route.Response是同一个类型
+		Value interface{}
+	}
+
+	// MockConfig 模拟响应的配置，请求带上请求头时直接返回路由的示例，不执行处理器
+	MockConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 请求头，值是示例的名称，为true时返回第一个示例
+		// 非必须 默认值是"X-Mock"
+		Header string
+	}
+
+	// OpenAPIDocument OpenAPI文档，只包含带元数据的路由
+	OpenAPIDocument struct {
+		OpenAPI string                                  `json:"openapi"`
+		Info    OpenAPIInfo                             `json:"info"`
+		Paths   map[string]map[string]*OpenAPIOperation `json:"paths"`
+	}
+
+	// OpenAPIInfo 文档的信息
+	OpenAPIInfo struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	// OpenAPIOperation 一个接口
+	OpenAPIOperation struct {
+		OperationId string                      `json:"operationId,omitempty"`
+		Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+		RequestBody *OpenAPIBody                `json:"requestBody,omitempty"`
+		Responses   map[string]*OpenAPIResponse `json:"responses"`
+		Security    []map[string][]string       `json:"security,omitempty"`
+		SLA         *OpenAPISLA                 `json:"x-sla,omitempty"`
+	}
+
+	// OpenAPIParameter 路径参数
+	OpenAPIParameter struct {
+		Name     string  `json:"name"`
+		In       string  `json:"in"`
+		Required bool    `json:"required"`
+		Schema   *Schema `json:"schema"`
+	}
+
+	// OpenAPIBody 请求体
+	OpenAPIBody struct {
+		Content map[string]*OpenAPIMedia `json:"content"`
+	}
+
+	// OpenAPIResponse 响应
+	OpenAPIResponse struct {
+		Description string                   `json:"description"`
+		Content     map[string]*OpenAPIMedia `json:"content,omitempty"`
+	}
+
+	// OpenAPIMedia 某种格式的内容
+	OpenAPIMedia struct {
+		Schema   *Schema                    `json:"schema,omitempty"`
+		Examples map[string]*OpenAPIExample `json:"examples,omitempty"`
+	}
+
+	// OpenAPIExample 示例
+	OpenAPIExample struct {
+		Summary string      `json:"summary,omitempty"`
+		Value   interface{} `json:"value"`
+	}
+)
+
+// HeaderXMock 选择模拟响应的示例
+const HeaderXMock = "X-Mock"
+
+// DefaultMockConfig 默认配置
+var DefaultMockConfig = MockConfig{
+	Skipper: middleware.DefaultSkipper,
+	Header:  HeaderXMock,
+}
+
+// ExampleOf 创建成功的示例，类型参数和Route.Response一致时编译期就能检查示例的字段
+//
+//	Response: UserRsp{},
+//	Examples: []echox.Example{echox.ExampleOf[UserRsp]("admin", UserRsp{Id: 1, Name: "admin"})},
+func ExampleOf[T any](name string, value T) Example {
+	return Example{Name: name, Status: http.StatusOK, Value: value}
+}
+
+// Mock 模拟响应的中间件
+func Mock() echo.MiddlewareFunc {
+	return MockWithConfig(DefaultMockConfig)
+}
+
+// MockWithConfig 模拟响应的中间件，前后端并行开发时不需要实现处理器
+func MockWithConfig(config MockConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultMockConfig.Skipper
+	}
+	if "" == config.Header {
+		config.Header = DefaultMockConfig.Header
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			name := c.Request().Header.Get(config.Header)
+			if "" == name || config.Skipper(c) {
+				return next(c)
+			}
+			route, ok := RouteOf(c.Request().Method, c.Path())
+			if !ok || 0 == len(route.Examples) {
+				return next(c)
+			}
+
+			example := route.Examples[0]
+			if "true" != name {
+				if example, ok = route.example(name); !ok {
+					return echo.NewHTTPError(http.StatusNotFound, "示例不存在："+name)
+				}
+			}
+
+			return c.JSON(example.status(), example.Value)
+		}
+	}
+}
+
+// OpenAPIOf 生成OpenAPI文档，请求和响应的结构来自Route.Request和Route.Response，示例来自Route.Examples
+func OpenAPIOf(title string, version string) (doc OpenAPIDocument) {
+	doc = OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: title, Version: version},
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+	for _, route := range RegisteredRoutes() {
+		path, parameters := openAPIPath(route.Path)
+		operation := &OpenAPIOperation{
+			OperationId: route.Name,
+			Parameters:  parameters,
+			Responses:   make(map[string]*OpenAPIResponse),
+		}
+		if nil != route.SLA {
+			operation.SLA = route.SLA.openAPI()
+		}
+		if AuthJWT == route.Auth {
+			operation.Security = []map[string][]string{{AuthJWT: route.Scopes}}
+		}
+		if nil != route.Request {
+			operation.RequestBody = &OpenAPIBody{Content: map[string]*OpenAPIMedia{
+				echo.MIMEApplicationJSON: {Schema: SchemaOf(reflect.TypeOf(route.Request))},
+			}}
+		}
+		if nil != route.Response {
+			operation.response(http.StatusOK).Content = map[string]*OpenAPIMedia{
+				echo.MIMEApplicationJSON: {Schema: SchemaOf(reflect.TypeOf(route.Response))},
+			}
+		}
+		for _, example := range route.Examples {
+			response := operation.response(example.status())
+			if nil == response.Content {
+				response.Content = map[string]*OpenAPIMedia{echo.MIMEApplicationJSON: {}}
+			}
+			media := response.Content[echo.MIMEApplicationJSON]
+			if nil == media.Examples {
+				media.Examples = make(map[string]*OpenAPIExample)
+			}
+			media.Examples[example.Name] = &OpenAPIExample{Summary: example.Summary, Value: example.Value}
+		}
+		if 0 == len(operation.Responses) {
+			operation.response(http.StatusOK)
+		}
+
+		if nil == doc.Paths[path] {
+			doc.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return
+}
+
+func (oo *OpenAPIOperation) response(status int) *OpenAPIResponse {
+	key := strconv.Itoa(status)
+	response, ok := oo.Responses[key]
+	if !ok {
+		response = &OpenAPIResponse{Description: http.StatusText(status)}
+		oo.Responses[key] = response
+	}
+
+	return response
+}
+
+// openAPIPath 把:id转换成{id}，通配符转换成{path}
+func openAPIPath(path string) (converted string, parameters []OpenAPIParameter) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name := ""
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name = segment[1:]
+		case "*" == segment:
+			name = "path"
+		default:
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		parameters = append(parameters, OpenAPIParameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	converted = strings.Join(segments, "/")
+
+	return
+}
+
+func (r Route) example(name string) (example Example, ok bool) {
+	for _, example = range r.Examples {
+		if name == example.Name {
+			return example, true
+		}
+	}
+
+	return Example{}, false
+}
+
+// checkExamples 注册时检查示例，成功的示例和响应的类型不一致时启动失败
+func (r Route) checkExamples() {
+	names := make(map[string]bool, len(r.Examples))
+	for _, example := range r.Examples {
+		if "" == example.Name {
+			panic("echo: route example requires a name: " + r.Path)
+		}
+		if names[example.Name] {
+			panic("echo: route example is duplicated: " + example.Name)
+		}
+		names[example.Name] = true
+
+		status := example.status()
+		if nil == r.Response || http.StatusOK > status || http.StatusMultipleChoices <= status || nil == example.Value {
+			continue
+		}
+		if expected, actual := indirectType(reflect.TypeOf(r.Response)), indirectType(reflect.TypeOf(example.Value)); expected != actual {
+			panic("echo: route example " + example.Name + " is " + actual.String() + ", response is " + expected.String())
+		}
+	}
+}
+
+func (e Example) status() int {
+	if 0 == e.Status {
+		return http.StatusOK
+	}
+
+	return e.Status
+}
+
+// sortedExamples 示例的名称，按名称排序
+func sortedExamples(examples []Example) (names []string) {
+	for _, example := range examples {
+		names = append(names, example.Name)
+	}
+	sort.Strings(names)
+
+	return
+}
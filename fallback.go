@@ -0,0 +1,121 @@
+package echox
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// HeaderXDegraded 降级后的响应带有这个头
+	HeaderXDegraded = "X-Degraded"
+
+	fallbackErrorKey = "echox.fallback.error"
+)
+
+type (
+	// Fallback 路由的降级处理，主处理器按指定的方式失败或者熔断时调用
+	//
+	//	Fallback: &echox.Fallback{Breaker: "recommend", Handler: func(c echo.Context) error {
+	//		return echox.Degraded(c, cachedRecommendations())
+	//	}}
+	Fallback struct {
+		// 降级的处理器，可以返回缓存的或者部分的数据
+		// 必须
+		Handler echo.HandlerFunc
+
+		// 触发降级的状态码
+		// 非必须 默认值是500、502、503和504
+		Status []int
+
+		// 触发降级的错误码，也就是Error.ErrorCode()
+		Codes []int
+
+		// 熔断器的名字，不为空时路由使用熔断，熔断期间直接降级
+		Breaker string
+	}
+
+	// DegradedResponse 降级的响应，客户端根据degraded提示数据可能不完整
+	DegradedResponse struct {
+		Degraded bool        `json:"degraded" xml:"degraded"`
+		Data     interface{} `json:"data" xml:"data"`
+	}
+)
+
+var (
+	// DefaultFallbackStatus 默认触发降级的状态码
+	DefaultFallbackStatus = []int{
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// Degraded 返回降级的数据
+func Degraded(c echo.Context, data interface{}) error {
+	return Render(c, http.StatusOK, &DegradedResponse{Degraded: true, Data: data})
+}
+
+// FallbackCause 触发降级的错误，不在降级处理器中时为空
+func FallbackCause(c echo.Context) error {
+	err, _ := c.Get(fallbackErrorKey).(error)
+
+	return err
+}
+
+// middlewares 降级在熔断之外，熔断返回的错误也会降级
+func (f *Fallback) middlewares() []echo.MiddlewareFunc {
+	if nil == f.Handler {
+		panic("echo: route fallback requires a handler")
+	}
+
+	middlewares := []echo.MiddlewareFunc{f.middleware}
+	if "" != f.Breaker {
+		middlewares = append(middlewares, Breaker(f.Breaker, DefaultBreakerConfig))
+	}
+
+	return middlewares
+}
+
+func (f *Fallback) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		// 已经写出了响应就不能再降级
+		if err = next(c); nil == err || c.Response().Committed || !f.matches(c, err) {
+			return
+		}
+
+		c.Set(fallbackErrorKey, err)
+		c.Response().Header().Set(HeaderXDegraded, "true")
+		c.Logger().Warnf("接口%s %s降级：%v", c.Request().Method, c.Path(), err)
+
+		return f.Handler(c)
+	}
+}
+
+func (f *Fallback) matches(c echo.Context, err error) bool {
+	if errors.Is(err, ErrBreakerOpen) {
+		return true
+	}
+	if coded, ok := err.(Error); ok {
+		for _, code := range f.Codes {
+			if code == coded.ErrorCode() {
+				return true
+			}
+		}
+	}
+
+	statuses := f.Status
+	if 0 == len(statuses) {
+		statuses = DefaultFallbackStatus
+	}
+	status := statusOf(c, err)
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+
+	return false
+}
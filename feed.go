@@ -0,0 +1,361 @@
+package echox
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// MIMEApplicationRSS RSS 2.0的类型
+	MIMEApplicationRSS = "application/rss+xml; charset=UTF-8"
+	// MIMEApplicationAtom Atom的类型
+	MIMEApplicationAtom = "application/atom+xml; charset=UTF-8"
+
+	atomNamespace = "http://www.w3.org/2005/Atom"
+)
+
+type (
+	// Feed 订阅源，同一个结构可以输出成RSS 2.0或者Atom
+	//
+	//	return echox.Atom(c, &echox.Feed{Title: "动态", Link: "https://www.example.com", Items: items})
+	Feed struct {
+		// 唯一标识，Atom需要，为空时使用Link
+		Id          string
+		Title       string
+		Description string
+		// 站点的地址
+		Link string
+		// 默认的语言，比如zh-CN
+		Language string
+		Author   string
+		// 最后更新的时间，为空时使用最新的条目的时间
+		Updated time.Time
+		// 客户端缓存的时间，同时输出到RSS的ttl
+		TTL time.Duration
+		// 其它语言的标题和描述，键是语言，按Accept-Language选择
+		Translations map[string]FeedText
+		Items        []FeedItem
+	}
+
+	// FeedText 可以翻译的频道信息
+	FeedText struct {
+		Title       string
+		Description string
+	}
+
+	// FeedItem 订阅源的条目
+	FeedItem struct {
+		// 唯一标识，为空时使用Link
+		Id    string
+		Title string
+		Link  string
+		// 摘要，纯文本
+		Summary string
+		// 正文，HTML
+		Content    string
+		Author     string
+		Published  time.Time
+		Updated    time.Time
+		Categories []string
+	}
+
+	rssDocument struct {
+		XMLName xml.Name   `xml:"rss"`
+		Version string     `xml:"version,attr"`
+		Channel rssChannel `xml:"channel"`
+	}
+
+	rssChannel struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		Language      string    `xml:"language,omitempty"`
+		LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+		TTL           int       `xml:"ttl,omitempty"`
+		Items         []rssItem `xml:"item"`
+	}
+
+	rssItem struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link,omitempty"`
+		Description string   `xml:"description,omitempty"`
+		Author      string   `xml:"author,omitempty"`
+		Categories  []string `xml:"category"`
+		Guid        rssGuid  `xml:"guid"`
+		PubDate     string   `xml:"pubDate,omitempty"`
+	}
+
+	rssGuid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+
+	atomDocument struct {
+		XMLName  xml.Name    `xml:"feed"`
+		Xmlns    string      `xml:"xmlns,attr"`
+		Lang     string      `xml:"xml:lang,attr,omitempty"`
+		Id       string      `xml:"id"`
+		Title    string      `xml:"title"`
+		Subtitle string      `xml:"subtitle,omitempty"`
+		Updated  string      `xml:"updated"`
+		Link     *atomLink   `xml:"link,omitempty"`
+		Author   *atomAuthor `xml:"author,omitempty"`
+		Entries  []atomEntry `xml:"entry"`
+	}
+
+	atomEntry struct {
+		Id         string         `xml:"id"`
+		Title      string         `xml:"title"`
+		Updated    string         `xml:"updated"`
+		Published  string         `xml:"published,omitempty"`
+		Link       *atomLink      `xml:"link,omitempty"`
+		Author     *atomAuthor    `xml:"author,omitempty"`
+		Summary    string         `xml:"summary,omitempty"`
+		Content    *atomContent   `xml:"content,omitempty"`
+		Categories []atomCategory `xml:"category"`
+	}
+
+	atomLink struct {
+		Href string `xml:"href,attr"`
+	}
+
+	atomAuthor struct {
+		Name string `xml:"name"`
+	}
+
+	atomContent struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+
+	atomCategory struct {
+		Term string `xml:"term,attr"`
+	}
+)
+
+// RSS 输出RSS 2.0，带ETag和Last-Modified，条件请求命中时返回304
+func RSS(c echo.Context, feed *Feed) error {
+	text, language := feed.localize(c)
+	updated := feed.lastModified()
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         text.Title,
+			Link:          feed.Link,
+			Description:   text.Description,
+			Language:      language,
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+			TTL:           int(feed.TTL.Minutes()),
+			Items:         make([]rssItem, 0, len(feed.Items)),
+		},
+	}
+	for _, item := range feed.Items {
+		description := item.Content
+		if "" == description {
+			description = item.Summary
+		}
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: description,
+			Author:      item.Author,
+			Categories:  item.Categories,
+			Guid:        rssGuid{IsPermaLink: "" == item.Id, Value: item.id()},
+		}
+		if published := item.published(); !published.IsZero() {
+			entry.PubDate = published.UTC().Format(time.RFC1123Z)
+		}
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+
+	return feed.write(c, MIMEApplicationRSS, doc, updated)
+}
+
+// Atom 输出Atom，带ETag和Last-Modified，条件请求命中时返回304
+func Atom(c echo.Context, feed *Feed) error {
+	text, language := feed.localize(c)
+	updated := feed.lastModified()
+	doc := atomDocument{
+		Xmlns:    atomNamespace,
+		Lang:     language,
+		Id:       feed.Id,
+		Title:    text.Title,
+		Subtitle: text.Description,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Entries:  make([]atomEntry, 0, len(feed.Items)),
+	}
+	if "" == doc.Id {
+		doc.Id = feed.Link
+	}
+	if "" != feed.Link {
+		doc.Link = &atomLink{Href: feed.Link}
+	}
+	if "" != feed.Author {
+		doc.Author = &atomAuthor{Name: feed.Author}
+	}
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			Id:         item.id(),
+			Title:      item.Title,
+			Summary:    item.Summary,
+			Categories: make([]atomCategory, 0, len(item.Categories)),
+		}
+		if modified := item.modified(); !modified.IsZero() {
+			entry.Updated = modified.UTC().Format(time.RFC3339)
+		} else {
+			entry.Updated = doc.Updated
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if "" != item.Link {
+			entry.Link = &atomLink{Href: item.Link}
+		}
+		if "" != item.Author {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		if "" != item.Content {
+			entry.Content = &atomContent{Type: "html", Value: item.Content}
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return feed.write(c, MIMEApplicationAtom, doc, updated)
+}
+
+func (f *Feed) write(c echo.Context, contentType string, doc interface{}, updated time.Time) (err error) {
+	var data []byte
+	if data, err = xml.Marshal(doc); nil != err {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+
+	etag := ETag(data)
+	header := c.Response().Header()
+	header.Set(HeaderETag, etag)
+	header.Set(echo.HeaderLastModified, updated.UTC().Format(http.TimeFormat))
+	if 0 < f.TTL {
+		header.Set(HeaderCacheControl, "public, max-age="+strconv.Itoa(int(f.TTL.Seconds())))
+	}
+	if 0 != len(f.Translations) {
+		header.Add(echo.HeaderVary, HeaderAcceptLanguage)
+	}
+	if NotModified(c, etag, updated) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, contentType, data)
+}
+
+// localize 按Accept-Language选择频道信息，先完整匹配，再匹配主语言，比如en-US匹配en
+func (f *Feed) localize(c echo.Context) (text FeedText, language string) {
+	text = FeedText{Title: f.Title, Description: f.Description}
+	language = f.Language
+	if 0 == len(f.Translations) {
+		return
+	}
+
+	for _, lang := range acceptLanguages(c.Request().Header.Get(HeaderAcceptLanguage)) {
+		for _, candidate := range []string{lang, strings.SplitN(lang, "-", 2)[0]} {
+			if translated, ok := f.Translations[candidate]; ok {
+				if "" != translated.Title {
+					text.Title = translated.Title
+				}
+				if "" != translated.Description {
+					text.Description = translated.Description
+				}
+				language = candidate
+
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// lastModified 频道的更新时间，都没有时使用启动时间，保证ETag稳定
+func (f *Feed) lastModified() (updated time.Time) {
+	updated = f.Updated
+	for _, item := range f.Items {
+		if modified := item.modified(); modified.After(updated) {
+			updated = modified
+		}
+	}
+	if updated.IsZero() {
+		updated = startedAt
+	}
+
+	return
+}
+
+func (fi *FeedItem) id() string {
+	if "" != fi.Id {
+		return fi.Id
+	}
+
+	return fi.Link
+}
+
+func (fi *FeedItem) published() time.Time {
+	if !fi.Published.IsZero() {
+		return fi.Published
+	}
+
+	return fi.Updated
+}
+
+func (fi *FeedItem) modified() time.Time {
+	if !fi.Updated.IsZero() {
+		return fi.Updated
+	}
+
+	return fi.Published
+}
+
+// acceptLanguages 按权重从高到低排列的语言
+func acceptLanguages(header string) (languages []string) {
+	type weighted struct {
+		lang   string
+		weight float64
+	}
+
+	values := make([]weighted, 0)
+	eachHeaderValue(header, func(part string) bool {
+		fields := strings.Split(part, ";")
+		lang := strings.TrimSpace(fields[0])
+		if "" == lang || "*" == lang {
+			return true
+		}
+		weight := 1.0
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if parsed, err := strconv.ParseFloat(q[2:], 64); nil == err {
+					weight = parsed
+				}
+			}
+		}
+		values = append(values, weighted{lang: strings.ReplaceAll(lang, "_", "-"), weight: weight})
+
+		return true
+	})
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].weight > values[j].weight
+	})
+
+	languages = make([]string, 0, len(values))
+	for _, value := range values {
+		languages = append(languages, value.lang)
+	}
+
+	return
+}
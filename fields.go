@@ -0,0 +1,263 @@
+package echox
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const fieldsKey = "echox.fields"
+
+type (
+	// FieldsConfig 按查询参数裁剪响应字段的配置，比如?fields=id,name,owner.name
+	// 结构体字段可以用fields标签控制：fields:"always"总是返回，fields:"-"不允许选择
+	FieldsConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 查询参数名
+		// 非必须 默认值是"fields"
+		Param string
+	}
+
+	// fieldSet 选择的字段，值是下一层选择的字段，为空表示返回整个字段
+	fieldSet map[string]fieldSet
+
+	maskField struct {
+		value  reflect.Value
+		always bool
+		denied bool
+		empty  bool
+	}
+)
+
+var (
+	// DefaultFieldsConfig 默认配置
+	DefaultFieldsConfig = FieldsConfig{
+		Skipper: middleware.DefaultSkipper,
+		Param:   "fields",
+	}
+
+	// ErrInvalidFields 选择了不存在或者不允许的字段
+	ErrInvalidFields = echo.NewHTTPError(http.StatusBadRequest, "不支持的字段")
+)
+
+// Fields 裁剪响应字段的中间件
+func Fields() echo.MiddlewareFunc {
+	return FieldsWithConfig(DefaultFieldsConfig)
+}
+
+// FieldsWithConfig 裁剪响应字段的中间件
+// 中间件只解析选择的字段，Render、Handler和MaskFields返回数据时裁剪
+func FieldsWithConfig(config FieldsConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultFieldsConfig.Skipper
+	}
+	if "" == config.Param {
+		config.Param = DefaultFieldsConfig.Param
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			if value := c.QueryParam(config.Param); "" != value {
+				c.Set(fieldsKey, parseFields(strings.Split(value, ",")))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// SelectedFields 客户端选择的字段，没有选择时返回空
+func SelectedFields(c echo.Context) (fields []string) {
+	set, _ := c.Get(fieldsKey).(fieldSet)
+	set.flatten("", &fields)
+	sort.Strings(fields)
+
+	return
+}
+
+// MaskFields 按客户端选择的字段裁剪数据，没有选择时原样返回
+func MaskFields(c echo.Context, data interface{}) (interface{}, error) {
+	set, ok := c.Get(fieldsKey).(fieldSet)
+	if !ok || 0 == len(set) {
+		return data, nil
+	}
+
+	return mask(reflect.ValueOf(data), set, "")
+}
+
+// Mask 只保留指定的字段，嵌套字段用"."分隔，比如"owner.name"
+// 结构体按json标签命名，切片和数组对每个元素裁剪
+func Mask(data interface{}, fields []string) (interface{}, error) {
+	return mask(reflect.ValueOf(data), parseFields(fields), "")
+}
+
+func parseFields(fields []string) fieldSet {
+	set := make(fieldSet)
+	for _, field := range fields {
+		current := set
+		for _, name := range strings.Split(strings.TrimSpace(field), ".") {
+			if "" == name {
+				break
+			}
+			if nil == current[name] {
+				current[name] = make(fieldSet)
+			}
+			current = current[name]
+		}
+	}
+
+	return set
+}
+
+func (fs fieldSet) flatten(prefix string, fields *[]string) {
+	for name, children := range fs {
+		if 0 == len(children) {
+			*fields = append(*fields, prefix+name)
+		} else {
+			children.flatten(prefix+name+".", fields)
+		}
+	}
+}
+
+func mask(value reflect.Value, set fieldSet, path string) (masked interface{}, err error) {
+	if !value.IsValid() {
+		return
+	}
+	if 0 == len(set) {
+		return value.Interface(), nil
+	}
+	if value.Type().Implements(jsonMarshalerType) || value.Type().Implements(textMarshalerType) {
+		return nil, invalidFields(path, "不能选择子字段")
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return
+		}
+
+		return mask(value.Elem(), set, path)
+	case reflect.Struct:
+		return maskStruct(value, set, path)
+	case reflect.Map:
+		if reflect.String != value.Type().Key().Kind() {
+			return nil, invalidFields(path, "不能选择子字段")
+		}
+		if value.IsNil() {
+			return
+		}
+		// 映射的键是动态的，不存在的键不算错误
+		result := make(map[string]interface{}, len(set))
+		for name, children := range set {
+			item := value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+			if !item.IsValid() {
+				continue
+			}
+			if result[name], err = mask(item, children, joinField(path, name)); nil != err {
+				return
+			}
+		}
+		masked = result
+	case reflect.Slice, reflect.Array:
+		if reflect.Slice == value.Kind() && value.IsNil() {
+			return
+		}
+		if reflect.Uint8 == value.Type().Elem().Kind() {
+			return nil, invalidFields(path, "不能选择子字段")
+		}
+		result := make([]interface{}, value.Len())
+		for i := range result {
+			if result[i], err = mask(value.Index(i), set, path); nil != err {
+				return
+			}
+		}
+		masked = result
+	default:
+		return nil, invalidFields(path, "不能选择子字段")
+	}
+
+	return
+}
+
+func maskStruct(value reflect.Value, set fieldSet, path string) (masked interface{}, err error) {
+	fields := make(map[string]maskField)
+	collectMaskFields(value, fields)
+	for name := range set {
+		if field, ok := fields[name]; !ok || field.denied {
+			return nil, invalidFields(joinField(path, name), "不存在")
+		}
+	}
+
+	result := make(map[string]interface{}, len(set))
+	for name, field := range fields {
+		children, selected := set[name]
+		if field.empty || (!selected && !field.always) {
+			continue
+		}
+		if result[name], err = mask(field.value, children, joinField(path, name)); nil != err {
+			return
+		}
+	}
+	masked = result
+
+	return
+}
+
+// collectMaskFields 和JSON一样展开匿名结构体，omitempty的零值可以选择但是不返回
+func collectMaskFields(value reflect.Value, fields map[string]maskField) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, omit := jsonName(field)
+		if omit {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if field.Anonymous && "" == field.Tag.Get("json") && reflect.Struct == fieldValue.Kind() {
+			collectMaskFields(fieldValue, fields)
+			continue
+		}
+		if "" != field.PkgPath || !fieldValue.CanInterface() {
+			continue
+		}
+
+		tag := field.Tag.Get("fields")
+		fields[name] = maskField{
+			value:  fieldValue,
+			always: "always" == tag,
+			denied: "-" == tag,
+			empty:  hasRule(field.Tag.Get("json"), "omitempty") && fieldValue.IsZero(),
+		}
+	}
+}
+
+func invalidFields(path string, reason string) error {
+	return echo.NewHTTPError(ErrInvalidFields.Code, ErrInvalidFields.Message.(string)+"："+path+reason)
+}
+
+// maskResponse 只裁剪成功的响应，错误的统一格式不受影响
+func maskResponse(c echo.Context, code int, data interface{}) (interface{}, error) {
+	if http.StatusOK > code || http.StatusMultipleChoices <= code {
+		return data, nil
+	}
+
+	return MaskFields(c, data)
+}
+
+// maskedJSON 裁剪后按JSON返回
+func maskedJSON(c echo.Context, code int, data interface{}) (err error) {
+	if data, err = maskResponse(c, code, data); nil != err {
+		return
+	}
+
+	return c.JSON(code, data)
+}
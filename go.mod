@@ -1,6 +1,6 @@
 module github.com/storezhang/echox
 
-go 1.14
+go 1.19
 
 require (
 	github.com/casbin/casbin/v2 v2.7.2
@@ -10,7 +10,10 @@ require (
 	github.com/go-playground/validator/v10 v10.3.0
 	github.com/json-iterator/go v1.1.10
 	github.com/labstack/echo/v4 v4.1.16
+	github.com/labstack/gommon v0.3.0
 	github.com/mcuadros/go-defaults v1.2.0
 	github.com/storezhang/gox v1.0.11
 	github.com/stretchr/testify v1.5.1 // indirect
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,156 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	HeaderGRPCStatus  = "Grpc-Status"
+	HeaderGRPCMessage = "Grpc-Message"
+
+	// grpcUnauthenticated gRPC的未认证状态码
+	grpcUnauthenticated = "16"
+)
+
+type (
+	// GRPCConfig 和HTTP一起提供gRPC服务的配置
+	// gRPC请求通过*grpc.Server的ServeHTTP处理，和HTTP共用日志、指标、认证和优雅退出
+	GRPCConfig struct {
+		// gRPC服务，一般是*grpc.Server
+		// 必须字段
+		Server http.Handler
+
+		// 单独的端口
+		// 非必须 默认和HTTP共用端口，按HTTP/2和application/grpc区分请求
+		Port int
+
+		// 是否使用EchoConfig.JWT校验authorization元数据
+		Auth bool
+
+		// 不需要认证的方法，比如"/grpc.health.v1.Health/Check"
+		Public []string
+
+		handler http.Handler
+		server  *http.Server
+	}
+)
+
+// mount 包装gRPC服务，加上日志、指标和认证
+func (gc *GRPCConfig) mount(e *echo.Echo, ec *EchoConfig, recorder MetricsRecorder) {
+	if nil == gc.Server {
+		panic("echo: grpc requires a server")
+	}
+	if gc.Auth && nil == ec.JWT {
+		panic("echo: grpc auth requires EchoConfig.JWT")
+	}
+
+	gc.handler = http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		if gc.Auth && !gc.public(req.URL.Path) {
+			if err := gc.authenticate(ec.JWT, req); nil != err {
+				rsp.Header().Set(echo.HeaderContentType, "application/grpc")
+				rsp.Header().Set(HeaderGRPCStatus, grpcUnauthenticated)
+				rsp.Header().Set(HeaderGRPCMessage, "unauthenticated")
+				rsp.WriteHeader(http.StatusOK)
+				e.Logger.Warnf("grpc %s unauthenticated: %v", req.URL.Path, err)
+
+				return
+			}
+		}
+
+		gc.Server.ServeHTTP(rsp, req)
+		// gRPC的状态在Trailer中，处理完成后写入了响应头
+		status := rsp.Header().Get(HeaderGRPCStatus)
+		if "" == status {
+			status = rsp.Header().Get(http.TrailerPrefix + HeaderGRPCStatus)
+		}
+		if "" == status {
+			status = "0"
+		}
+		if nil != recorder {
+			recorder.ObserveRequest(RequestLabels{Method: "GRPC", Route: req.URL.Path, Status: status}, time.Since(start))
+		}
+		if "0" != status {
+			e.Logger.Warnf("grpc %s status=%s latency=%s", req.URL.Path, status, time.Since(start))
+		} else {
+			e.Logger.Debugf("grpc %s status=0 latency=%s", req.URL.Path, time.Since(start))
+		}
+	})
+}
+
+// serve 启动服务，共用端口时HTTP也由这里启动
+func (gc *GRPCConfig) serve(e *echo.Echo, listener net.Listener) {
+	if 0 != gc.Port {
+		address := fmt.Sprintf(":%d", gc.Port)
+		grpcListener, err := net.Listen("tcp", address)
+		if nil != err {
+			e.Logger.Fatal(err)
+		}
+		gc.server = &http.Server{Handler: h2c.NewHandler(gc.handler, &http2.Server{}), ErrorLog: e.StdLogger}
+		go func() {
+			if err := gc.server.Serve(grpcListener); nil != err && http.ErrServerClosed != err {
+				e.Logger.Fatal(err)
+			}
+		}()
+
+		return
+	}
+
+	// 共用端口时不能用e.Start，它会替换Server的Handler
+	e.Server.Handler = h2c.NewHandler(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if 2 == req.ProtoMajor && strings.HasPrefix(req.Header.Get(echo.HeaderContentType), "application/grpc") {
+			gc.handler.ServeHTTP(rsp, req)
+		} else {
+			e.ServeHTTP(rsp, req)
+		}
+	}), &http2.Server{})
+	e.Server.ErrorLog = e.StdLogger
+	go func() {
+		if err := e.Server.Serve(listener); nil != err && http.ErrServerClosed != err {
+			e.Logger.Fatal(err)
+		}
+	}()
+}
+
+// shutdown 单独端口的gRPC服务随HTTP一起退出
+func (gc *GRPCConfig) shutdown(ctx context.Context) error {
+	if nil == gc.server {
+		return nil
+	}
+
+	return gc.server.Shutdown(ctx)
+}
+
+func (gc *GRPCConfig) public(method string) bool {
+	for _, public := range gc.Public {
+		if public == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (gc *GRPCConfig) authenticate(jc *JWTConfig, req *http.Request) (err error) {
+	auth := req.Header.Get(echo.HeaderAuthorization)
+	scheme := jc.AuthScheme + " "
+	if !strings.HasPrefix(auth, scheme) {
+		return ErrJWTMissing
+	}
+	var claims jwt.Claims
+	if claims, _, err = jc.Parse(auth[len(scheme):]); nil == err && nil == claims {
+		err = ErrJWTMissing
+	}
+
+	return
+}
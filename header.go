@@ -0,0 +1,24 @@
+package echox
+
+import (
+	"strings"
+)
+
+// eachHeaderValue 依次处理逗号分隔的请求头的值，去掉两边的空白，fn返回false时停止
+// 每个请求都会解析Accept之类的请求头，不使用strings.Split分配切片
+func eachHeaderValue(header string, fn func(value string) bool) {
+	for "" != header {
+		value := header
+		if index := strings.IndexByte(header, ','); -1 != index {
+			value, header = header[:index], header[index+1:]
+		} else {
+			header = ""
+		}
+		if value = strings.TrimSpace(value); "" == value {
+			continue
+		}
+		if !fn(value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package echox
+
+import (
+	"testing"
+)
+
+func BenchmarkEachHeaderValue(b *testing.B) {
+	header := "text/html, application/xhtml+xml, application/xml;q=0.9, image/webp, */*;q=0.8"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		eachHeaderValue(header, func(value string) bool {
+			count++
+
+			return true
+		})
+	}
+}
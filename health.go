@@ -0,0 +1,122 @@
+package echox
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// HealthCheck 健康检查，返回错误表示不健康
+	HealthCheck func(ctx context.Context) error
+
+	// HealthStatus 健康检查的结果
+	HealthStatus struct {
+		Status  string            `json:"status"`
+		State   LifecycleState    `json:"state"`
+		Checks  map[string]string `json:"checks,omitempty"`
+		Workers []WorkerStatus    `json:"workers,omitempty"`
+	}
+)
+
+const (
+	healthStatusUp   = "UP"
+	healthStatusDown = "DOWN"
+)
+
+var (
+	healthMutex  sync.RWMutex
+	healthChecks = make(map[string]HealthCheck)
+
+	// lifecycleState 当前的服务状态
+	lifecycleState atomic.Value
+)
+
+// RegisterHealthCheck 注册健康检查，就绪检查时会执行所有的健康检查
+func RegisterHealthCheck(name string, check HealthCheck) {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	healthChecks[name] = check
+}
+
+// State 当前的服务状态
+func State() LifecycleState {
+	if state, ok := lifecycleState.Load().(LifecycleState); ok {
+		return state
+	}
+
+	return LifecycleStarting
+}
+
+// Health 执行所有的健康检查
+func Health(ctx context.Context) (status HealthStatus) {
+	status = HealthStatus{Status: healthStatusUp, State: State()}
+	if LifecycleReady != status.State {
+		status.Status = healthStatusDown
+	}
+
+	healthMutex.RLock()
+	names := make([]string, 0, len(healthChecks))
+	for name := range healthChecks {
+		names = append(names, name)
+	}
+	healthMutex.RUnlock()
+	sort.Strings(names)
+
+	status.Workers = Workers()
+	sort.Slice(status.Workers, func(i, j int) bool {
+		return status.Workers[i].Name < status.Workers[j].Name
+	})
+	if 0 != len(names) {
+		status.Checks = make(map[string]string, len(names))
+	}
+	for _, name := range names {
+		healthMutex.RLock()
+		check := healthChecks[name]
+		healthMutex.RUnlock()
+
+		if err := check(ctx); nil != err {
+			status.Status = healthStatusDown
+			status.Checks[name] = err.Error()
+		} else {
+			status.Checks[name] = healthStatusUp
+		}
+	}
+
+	return
+}
+
+// liveness 进程活着就返回成功
+func liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthStatus{Status: healthStatusUp, State: State()})
+}
+
+// readiness 服务就绪并且所有健康检查通过才返回成功
+func readiness(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 5*time.Second)
+	defer cancel()
+
+	status := Health(ctx)
+	code := http.StatusOK
+	if healthStatusUp != status.Status {
+		code = http.StatusServiceUnavailable
+	}
+
+	return c.JSON(code, status)
+}
+
+// startup 服务开始监听后返回成功
+func startup(c echo.Context) error {
+	state := State()
+	if LifecycleStarting == state {
+		return c.JSON(http.StatusServiceUnavailable, HealthStatus{Status: healthStatusDown, State: state})
+	}
+
+	return c.JSON(http.StatusOK, HealthStatus{Status: healthStatusUp, State: state})
+}
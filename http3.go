@@ -0,0 +1,120 @@
+package echox
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderAltSvc = "Alt-Svc"
+
+type (
+	// HTTP3Server QUIC服务，一般是quic-go的*http3.Server
+	HTTP3Server interface {
+		ListenAndServeTLS(certFile string, keyFile string) error
+		Close() error
+	}
+
+	// HTTP3Config HTTP/3的配置（实验性）
+	// HTTP/3需要TLS，浏览器通过TCP端口响应中的Alt-Svc发现HTTP/3
+	HTTP3Config struct {
+		// 创建QUIC服务，比如：
+		//
+		//	func(address string, handler http.Handler) echox.HTTP3Server {
+		//		return &http3.Server{Addr: address, Handler: handler}
+		//	}
+		//
+		// 必须字段
+		NewServer func(address string, handler http.Handler) HTTP3Server
+
+		// 证书文件
+		// 必须字段
+		CertFile string
+		KeyFile  string
+
+		// UDP端口
+		// 非必须 默认和HTTP使用相同的端口号
+		Port int
+
+		// TCP端口也使用证书提供HTTPS，直接对外暴露时需要
+		// 默认TCP端口是HTTP，由负载均衡终结TLS
+		TLS bool
+
+		// Alt-Svc的有效期
+		// 非必须 默认值是24小时
+		MaxAge time.Duration
+
+		server HTTP3Server
+	}
+)
+
+func (hc *HTTP3Config) port(ec *EchoConfig) int {
+	if 0 != hc.Port {
+		return hc.Port
+	}
+
+	return ec.Port
+}
+
+// altSvc 在TCP的响应中告诉客户端可以使用HTTP/3
+func (hc *HTTP3Config) altSvc(ec *EchoConfig) echo.MiddlewareFunc {
+	maxAge := hc.MaxAge
+	if 0 >= maxAge {
+		maxAge = 24 * time.Hour
+	}
+	value := fmt.Sprintf(`h3=":%d"; ma=%d`, hc.port(ec), int(maxAge.Seconds()))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if 3 > c.Request().ProtoMajor {
+				c.Response().Header().Set(HeaderAltSvc, value)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// serve 启动QUIC服务
+func (hc *HTTP3Config) serve(e *echo.Echo, ec *EchoConfig) {
+	if nil == hc.NewServer {
+		panic("echo: http3 requires a server constructor")
+	}
+	if "" == hc.CertFile || "" == hc.KeyFile {
+		panic("echo: http3 requires a certificate")
+	}
+
+	hc.server = hc.NewServer(fmt.Sprintf("%s:%d", ec.Ip, hc.port(ec)), e)
+	go func() {
+		if err := hc.server.ListenAndServeTLS(hc.CertFile, hc.KeyFile); nil != err && http.ErrServerClosed != err {
+			e.Logger.Error(err)
+		}
+	}()
+}
+
+// tlsListener TCP端口使用和HTTP/3相同的证书
+func (hc *HTTP3Config) tlsListener(listener net.Listener) (tlsListener net.Listener, err error) {
+	var cert tls.Certificate
+	if cert, err = tls.LoadX509KeyPair(hc.CertFile, hc.KeyFile); nil != err {
+		return
+	}
+	tlsListener = tls.NewListener(listener, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+
+	return
+}
+
+// shutdown QUIC没有优雅退出，HTTP退出后直接关闭
+func (hc *HTTP3Config) shutdown() error {
+	if nil == hc.server {
+		return nil
+	}
+
+	return hc.server.Close()
+}
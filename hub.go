@@ -0,0 +1,494 @@
+package echox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// PresenceJoin 加入房间
+	PresenceJoin = "join"
+	// PresenceLeave 离开房间
+	PresenceLeave = "leave"
+)
+
+type (
+	// HubConfig WebSocket房间和在线状态的配置
+	HubConfig struct {
+		// 名称，配置了跨实例广播时用来区分不同的Hub
+		// 非必须 默认值是"default"
+		Name string
+
+		// 在线状态存储
+		// 非必须 默认存储在内存中，多实例部署时使用NewRedisPresenceStore
+		Store PresenceStore
+
+		// 在线状态的有效期，实例崩溃时过期后自动清理，Worker按TTL的三分之一续期
+		// 非必须 默认值是30秒
+		TTL time.Duration
+
+		// 把加入和离开的事件发给房间里的连接
+		Announce bool
+
+		// 收到加入和离开的事件
+		OnPresence func(event PresenceEvent)
+	}
+
+	// Presence 房间里的一个连接
+	Presence struct {
+		// 连接的编号，同一个用户可以有多个连接
+		Session  string                 `json:"session"`
+		Id       string                 `json:"id"`
+		Instance string                 `json:"instance"`
+		JoinedAt time.Time              `json:"joinedAt"`
+		Meta     map[string]interface{} `json:"meta,omitempty"`
+	}
+
+	// PresenceEvent 加入和离开的事件
+	PresenceEvent struct {
+		Type     string   `json:"type"`
+		Event    string   `json:"event"`
+		Room     string   `json:"room"`
+		Presence Presence `json:"presence"`
+	}
+
+	// PresenceStore 在线状态存储
+	PresenceStore interface {
+		// Join 加入房间或者续期
+		Join(ctx context.Context, room string, presence Presence, ttl time.Duration) error
+		// Leave 离开房间
+		Leave(ctx context.Context, room string, session string) error
+		// Members 房间里没有过期的连接
+		Members(ctx context.Context, room string) ([]Presence, error)
+		// Rooms 有连接的房间
+		Rooms(ctx context.Context) ([]string, error)
+	}
+
+	// Hub 管理WebSocket连接加入的房间和在线状态
+	Hub struct {
+		config HubConfig
+		mutex  sync.RWMutex
+		rooms  map[string]map[*WSConn]Presence
+	}
+
+	memoryPresenceStore struct {
+		mutex sync.Mutex
+		rooms map[string]map[string]memoryPresence
+	}
+
+	memoryPresence struct {
+		presence Presence
+		expires  time.Time
+	}
+
+	redisPresenceStore struct {
+		redis  *Redis
+		prefix string
+	}
+)
+
+var (
+	// DefaultHubConfig 默认配置
+	DefaultHubConfig = HubConfig{
+		Name: "default",
+		TTL:  30 * time.Second,
+	}
+)
+
+// NewHub 创建Hub，同一个名称只能创建一个
+func NewHub(config HubConfig) *Hub {
+	if "" == config.Name {
+		config.Name = DefaultHubConfig.Name
+	}
+	if nil == config.Store {
+		config.Store = NewMemoryPresenceStore()
+	}
+	if 0 >= config.TTL {
+		config.TTL = DefaultHubConfig.TTL
+	}
+
+	hub := &Hub{config: config, rooms: make(map[string]map[*WSConn]Presence)}
+	broadcasts.handle("hub:"+config.Name, hub.deliver)
+
+	return hub
+}
+
+// Join 连接加入房间，id是用户编号，meta是给其它成员看的信息
+func (h *Hub) Join(ctx context.Context, room string, conn *WSConn, id string, meta map[string]interface{}) (err error) {
+	presence := Presence{Session: conn.id, Id: id, Instance: instanceId, JoinedAt: time.Now(), Meta: meta}
+	if err = h.config.Store.Join(ctx, room, presence, h.config.TTL); nil != err {
+		return
+	}
+
+	h.mutex.Lock()
+	conns, ok := h.rooms[room]
+	if !ok {
+		conns = make(map[*WSConn]Presence)
+		h.rooms[room] = conns
+	}
+	conns[conn] = presence
+	h.mutex.Unlock()
+	h.publish(ctx, PresenceJoin, room, presence)
+
+	return
+}
+
+// Leave 连接离开房间
+func (h *Hub) Leave(ctx context.Context, room string, conn *WSConn) (err error) {
+	h.mutex.Lock()
+	presence, ok := h.rooms[room][conn]
+	if ok {
+		delete(h.rooms[room], conn)
+		if 0 == len(h.rooms[room]) {
+			delete(h.rooms, room)
+		}
+	}
+	h.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	if err = h.config.Store.Leave(ctx, room, presence.Session); nil == err {
+		h.publish(ctx, PresenceLeave, room, presence)
+	}
+
+	return
+}
+
+// LeaveAll 连接断开时离开所有房间
+func (h *Hub) LeaveAll(ctx context.Context, conn *WSConn) (err error) {
+	h.mutex.RLock()
+	rooms := make([]string, 0)
+	for room, conns := range h.rooms {
+		if _, ok := conns[conn]; ok {
+			rooms = append(rooms, room)
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, room := range rooms {
+		if leaveErr := h.Leave(ctx, room, conn); nil != leaveErr {
+			err = leaveErr
+		}
+	}
+
+	return
+}
+
+// Handler 连接断开时自动离开所有房间
+func (h *Hub) Handler(handler WebSocketHandler) WebSocketHandler {
+	return func(c echo.Context, conn *WSConn) error {
+		defer func() {
+			if err := h.LeaveAll(context.Background(), conn); nil != err {
+				c.Logger().Error(err)
+			}
+		}()
+
+		return handler(c, conn)
+	}
+}
+
+// Broadcast 发送消息给房间里的所有连接
+// 配置了EchoConfig.PubSub时发给所有实例上的连接，否则只发给本实例上的连接
+func (h *Hub) Broadcast(ctx context.Context, room string, v interface{}) error {
+	return broadcasts.publish(ctx, "hub:"+h.config.Name, room, v)
+}
+
+// deliver 发送消息给本实例上房间里的所有连接，JSON消息按文本发送
+func (h *Hub) deliver(room string, binary bool, data []byte) {
+	h.mutex.RLock()
+	conns := make([]*WSConn, 0, len(h.rooms[room]))
+	for conn := range h.rooms[room] {
+		conns = append(conns, conn)
+	}
+	h.mutex.RUnlock()
+
+	var message interface{} = string(data)
+	if binary {
+		message = data
+	}
+	for _, conn := range conns {
+		// 发送失败的连接会在读取出错后离开房间
+		_ = conn.Send(message)
+	}
+}
+
+// Members 房间里的所有连接，包括其它实例上的
+func (h *Hub) Members(ctx context.Context, room string) ([]Presence, error) {
+	return h.config.Store.Members(ctx, room)
+}
+
+// Rooms 有连接的房间，包括其它实例上的
+func (h *Hub) Rooms(ctx context.Context) ([]string, error) {
+	return h.config.Store.Rooms(ctx)
+}
+
+// Mount 挂载查询在线状态的接口
+//
+//	GET /rooms        有连接的房间
+//	GET /rooms/:room  房间里的连接
+func (h *Hub) Mount(g *echo.Group) {
+	g.GET("/rooms", func(c echo.Context) error {
+		rooms, err := h.Rooms(c.Request().Context())
+		if nil != err {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, rooms)
+	})
+	g.GET("/rooms/:room", func(c echo.Context) error {
+		members, err := h.Members(c.Request().Context(), c.Param("room"))
+		if nil != err {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, members)
+	})
+}
+
+// Worker 定时续期本实例上的在线状态
+func (h *Hub) Worker() Worker {
+	return Worker{
+		Name:     "hub-presence",
+		Interval: h.config.TTL / 3,
+		Run: func(ctx context.Context) (err error) {
+			h.mutex.RLock()
+			presences := make(map[string][]Presence, len(h.rooms))
+			for room, conns := range h.rooms {
+				for _, presence := range conns {
+					presences[room] = append(presences[room], presence)
+				}
+			}
+			h.mutex.RUnlock()
+
+			for room, list := range presences {
+				for _, presence := range list {
+					if joinErr := h.config.Store.Join(ctx, room, presence, h.config.TTL); nil != joinErr {
+						err = joinErr
+					}
+				}
+			}
+
+			return
+		},
+	}
+}
+
+func (h *Hub) publish(ctx context.Context, event string, room string, presence Presence) {
+	pe := PresenceEvent{Type: "presence", Event: event, Room: room, Presence: presence}
+	if h.config.Announce {
+		_ = h.Broadcast(ctx, room, pe)
+	}
+	if nil != h.config.OnPresence {
+		h.config.OnPresence(pe)
+	}
+}
+
+// NewMemoryPresenceStore 创建内存在线状态存储
+func NewMemoryPresenceStore() PresenceStore {
+	return &memoryPresenceStore{rooms: make(map[string]map[string]memoryPresence)}
+}
+
+func (mps *memoryPresenceStore) Join(_ context.Context, room string, presence Presence, ttl time.Duration) error {
+	mps.mutex.Lock()
+	defer mps.mutex.Unlock()
+
+	sessions, ok := mps.rooms[room]
+	if !ok {
+		sessions = make(map[string]memoryPresence)
+		mps.rooms[room] = sessions
+	}
+	sessions[presence.Session] = memoryPresence{presence: presence, expires: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (mps *memoryPresenceStore) Leave(_ context.Context, room string, session string) error {
+	mps.mutex.Lock()
+	defer mps.mutex.Unlock()
+
+	delete(mps.rooms[room], session)
+	if 0 == len(mps.rooms[room]) {
+		delete(mps.rooms, room)
+	}
+
+	return nil
+}
+
+func (mps *memoryPresenceStore) Members(_ context.Context, room string) (members []Presence, err error) {
+	mps.mutex.Lock()
+	defer mps.mutex.Unlock()
+
+	mps.sweep(room)
+	members = make([]Presence, 0, len(mps.rooms[room]))
+	for _, mp := range mps.rooms[room] {
+		members = append(members, mp.presence)
+	}
+	sortPresences(members)
+
+	return
+}
+
+func (mps *memoryPresenceStore) Rooms(_ context.Context) (rooms []string, err error) {
+	mps.mutex.Lock()
+	defer mps.mutex.Unlock()
+
+	rooms = make([]string, 0, len(mps.rooms))
+	for room := range mps.rooms {
+		if mps.sweep(room) {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Strings(rooms)
+
+	return
+}
+
+// sweep 清理过期的连接，返回房间是否还有连接
+func (mps *memoryPresenceStore) sweep(room string) bool {
+	now := time.Now()
+	for session, mp := range mps.rooms[room] {
+		if now.After(mp.expires) {
+			delete(mps.rooms[room], session)
+		}
+	}
+	if 0 == len(mps.rooms[room]) {
+		delete(mps.rooms, room)
+
+		return false
+	}
+
+	return true
+}
+
+// NewRedisPresenceStore 创建Redis在线状态存储，多个实例共享房间的成员
+// 每个房间是一个有序集合，分数是过期时间，连接的信息放在同名的哈希中
+func NewRedisPresenceStore(redis *Redis, prefix string) PresenceStore {
+	if "" == prefix {
+		prefix = "echox:presence:"
+	}
+
+	return &redisPresenceStore{redis: redis, prefix: prefix}
+}
+
+func (rps *redisPresenceStore) Join(ctx context.Context, room string, presence Presence, ttl time.Duration) (err error) {
+	var data []byte
+	if data, err = json.Marshal(presence); nil != err {
+		return
+	}
+
+	expires := time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+	if _, err = rps.redis.Do(ctx, "ZADD", rps.roomKey(room), expires, presence.Session); nil != err {
+		return
+	}
+	if _, err = rps.redis.Do(ctx, "HSET", rps.sessionsKey(room), presence.Session, data); nil != err {
+		return
+	}
+	_, err = rps.redis.Do(ctx, "ZADD", rps.prefix+"rooms", expires, room)
+
+	return
+}
+
+func (rps *redisPresenceStore) Leave(ctx context.Context, room string, session string) (err error) {
+	if _, err = rps.redis.Do(ctx, "ZREM", rps.roomKey(room), session); nil != err {
+		return
+	}
+	if _, err = rps.redis.Do(ctx, "HDEL", rps.sessionsKey(room), session); nil != err {
+		return
+	}
+
+	// 最后一个连接离开时房间也不再列出
+	var reply interface{}
+	if reply, err = rps.redis.Do(ctx, "ZCARD", rps.roomKey(room)); nil == err && int64(0) == reply {
+		_, err = rps.redis.Do(ctx, "ZREM", rps.prefix+"rooms", room)
+	}
+
+	return
+}
+
+func (rps *redisPresenceStore) Members(ctx context.Context, room string) (members []Presence, err error) {
+	if err = rps.sweep(ctx, room); nil != err {
+		return
+	}
+
+	var reply interface{}
+	if reply, err = rps.redis.Do(ctx, "HGETALL", rps.sessionsKey(room)); nil != err {
+		return
+	}
+	values := redisStrings(reply)
+	members = make([]Presence, 0, len(values)/2)
+	for i := 1; i < len(values); i += 2 {
+		var presence Presence
+		if err = json.Unmarshal([]byte(values[i]), &presence); nil != err {
+			return
+		}
+		members = append(members, presence)
+	}
+	sortPresences(members)
+
+	return
+}
+
+func (rps *redisPresenceStore) Rooms(ctx context.Context) (rooms []string, err error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if _, err = rps.redis.Do(ctx, "ZREMRANGEBYSCORE", rps.prefix+"rooms", "-inf", now); nil != err {
+		return
+	}
+
+	var reply interface{}
+	if reply, err = rps.redis.Do(ctx, "ZRANGE", rps.prefix+"rooms", 0, -1); nil != err {
+		return
+	}
+	rooms = redisStrings(reply)
+	sort.Strings(rooms)
+
+	return
+}
+
+// sweep 清理崩溃的实例留下的过期连接
+func (rps *redisPresenceStore) sweep(ctx context.Context, room string) (err error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	var reply interface{}
+	if reply, err = rps.redis.Do(ctx, "ZRANGEBYSCORE", rps.roomKey(room), "-inf", now); nil != err {
+		return
+	}
+	expired := redisStrings(reply)
+	if 0 == len(expired) {
+		return
+	}
+
+	args := []interface{}{"HDEL", rps.sessionsKey(room)}
+	for _, session := range expired {
+		args = append(args, session)
+	}
+	if _, err = rps.redis.Do(ctx, args...); nil != err {
+		return
+	}
+	_, err = rps.redis.Do(ctx, "ZREMRANGEBYSCORE", rps.roomKey(room), "-inf", now)
+
+	return
+}
+
+func (rps *redisPresenceStore) roomKey(room string) string {
+	return rps.prefix + "room:" + room
+}
+
+func (rps *redisPresenceStore) sessionsKey(room string) string {
+	return rps.prefix + "sessions:" + room
+}
+
+func sortPresences(presences []Presence) {
+	sort.Slice(presences, func(i, j int) bool {
+		if !presences[i].JoinedAt.Equal(presences[j].JoinedAt) {
+			return presences[i].JoinedAt.Before(presences[j].JoinedAt)
+		}
+
+		return presences[i].Session < presences[j].Session
+	})
+}
@@ -0,0 +1,340 @@
+package echox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotencyReplayed = "Idempotency-Replayed"
+
+	// memorySweepInterval 内存存储清理过期记录的间隔
+	memorySweepInterval = time.Minute
+)
+
+type (
+	// IdempotencyConfig 幂等中间件的配置
+	IdempotencyConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 需要幂等的请求方法
+		// 非必须 默认值是POST和PATCH
+		Methods []string
+
+		// 结果保留的时间
+		// 非必须 默认值是24小时
+		TTL time.Duration
+
+		// 结果存储
+		// 非必须 默认存储在内存中，多实例部署时需要换成Redis等共享存储
+		// 默认的存储在服务关闭时停止后台清理，自己创建的内存存储用完后调用Close
+		Store IdempotencyStore
+	}
+
+	// IdempotentResponse 保存的响应
+	IdempotentResponse struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header"`
+		Body   []byte      `json:"body"`
+		// 请求体的摘要，相同的Idempotency-Key只能重放相同的请求
+		Fingerprint string `json:"fingerprint,omitempty"`
+	}
+
+	// IdempotencyStore 幂等结果存储
+	IdempotencyStore interface {
+		// Begin 开始处理请求
+		// 已经有结果时返回结果；其它请求正在处理时返回ErrIdempotencyInFlight
+		Begin(key string, ttl time.Duration) (*IdempotentResponse, error)
+		// Save 保存结果
+		Save(key string, rsp *IdempotentResponse, ttl time.Duration) error
+		// Release 处理失败，允许客户端重试
+		Release(key string) error
+	}
+
+	memoryIdempotencyStore struct {
+		mutex   sync.Mutex
+		entries map[string]*idempotencyEntry
+		// 停止后台清理，第一次使用时才开始清理
+		stop   func()
+		closed bool
+	}
+
+	idempotencyEntry struct {
+		response *IdempotentResponse
+		expires  time.Time
+	}
+
+	responseRecorder struct {
+		http.ResponseWriter
+		status int
+		body   bytes.Buffer
+	}
+)
+
+var (
+	// DefaultIdempotencyConfig 默认配置
+	DefaultIdempotencyConfig = IdempotencyConfig{
+		Skipper: middleware.DefaultSkipper,
+		Methods: []string{http.MethodPost, http.MethodPatch},
+		TTL:     24 * time.Hour,
+	}
+
+	ErrIdempotencyInFlight = errors.New("相同的请求正在处理中")
+	ErrIdempotencyConflict = echo.NewHTTPError(http.StatusConflict, "相同的请求正在处理中")
+	ErrIdempotencyMismatch = echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key已经用于其它的请求")
+)
+
+// NewMemoryIdempotencyStore 创建内存幂等结果存储，过期的记录在后台定时清理
+// 不再使用时调用Close停止清理
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{entries: make(map[string]*idempotencyEntry)}
+}
+
+func (mis *memoryIdempotencyStore) Begin(key string, ttl time.Duration) (rsp *IdempotentResponse, err error) {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	if nil == mis.stop && !mis.closed {
+		mis.stop = sweepEvery(memorySweepInterval, mis.sweep)
+	}
+	now := time.Now()
+	if entry, ok := mis.entries[key]; ok && now.Before(entry.expires) {
+		if nil == entry.response {
+			err = ErrIdempotencyInFlight
+		} else {
+			rsp = entry.response
+		}
+
+		return
+	}
+	mis.entries[key] = &idempotencyEntry{expires: now.Add(ttl)}
+
+	return
+}
+
+func (mis *memoryIdempotencyStore) Save(key string, rsp *IdempotentResponse, ttl time.Duration) error {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	mis.entries[key] = &idempotencyEntry{response: rsp, expires: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (mis *memoryIdempotencyStore) sweep(now time.Time) {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	for key, entry := range mis.entries {
+		if now.After(entry.expires) {
+			delete(mis.entries, key)
+		}
+	}
+}
+
+func (mis *memoryIdempotencyStore) Release(key string) error {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	delete(mis.entries, key)
+
+	return nil
+}
+
+// Close 停止后台清理，之后仍然可以使用，过期的记录不再清理
+func (mis *memoryIdempotencyStore) Close() error {
+	mis.mutex.Lock()
+	defer mis.mutex.Unlock()
+
+	mis.closed = true
+	if nil != mis.stop {
+		mis.stop()
+		mis.stop = nil
+	}
+
+	return nil
+}
+
+// sweepEvery 在后台定时清理内存存储，返回停止清理的函数
+func sweepEvery(interval time.Duration, sweep func(now time.Time)) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				sweep(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var stopping sync.Once
+	stop = func() {
+		stopping.Do(func() { close(done) })
+	}
+
+	return
+}
+
+// Idempotency 幂等中间件
+func Idempotency() echo.MiddlewareFunc {
+	return IdempotencyWithConfig(DefaultIdempotencyConfig)
+}
+
+// IdempotencyWithConfig 幂等中间件
+// 带有Idempotency-Key请求头的请求，在有效期内重复提交时直接返回第一次的结果
+// 相同的Idempotency-Key带了不同的请求体时返回422
+func IdempotencyWithConfig(config IdempotencyConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultIdempotencyConfig.Skipper
+	}
+	if 0 == len(config.Methods) {
+		config.Methods = DefaultIdempotencyConfig.Methods
+	}
+	if 0 >= config.TTL {
+		config.TTL = DefaultIdempotencyConfig.TTL
+	}
+	if nil == config.Store {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			idempotencyKey := c.Request().Header.Get(HeaderIdempotencyKey)
+			if config.Skipper(c) || "" == idempotencyKey || !config.idempotent(c.Request().Method) {
+				return next(c)
+			}
+
+			var fingerprint string
+			if fingerprint, err = bodyFingerprint(c.Request()); nil != err {
+				return
+			}
+			key := strings.Join([]string{idempotencyKey, c.Request().Method, c.Path(), userIdOf(c)}, ":")
+			var rsp *IdempotentResponse
+			if rsp, err = config.Store.Begin(key, config.TTL); ErrIdempotencyInFlight == err {
+				return ErrIdempotencyConflict
+			} else if nil != err {
+				return
+			} else if nil != rsp {
+				// 没有摘要的是升级前保存的结果，直接重放
+				if "" != rsp.Fingerprint && fingerprint != rsp.Fingerprint {
+					return ErrIdempotencyMismatch
+				}
+
+				return replay(c, rsp)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer, status: http.StatusOK}
+			c.Response().Writer = recorder
+			defer func() {
+				c.Response().Writer = recorder.ResponseWriter
+				if nil != err || http.StatusInternalServerError <= recorder.status {
+					config.Store.Release(key)
+
+					return
+				}
+				config.Store.Save(key, &IdempotentResponse{
+					Status:      recorder.status,
+					Header:      c.Response().Header().Clone(),
+					Body:        recorder.body.Bytes(),
+					Fingerprint: fingerprint,
+				}, config.TTL)
+			}()
+			err = next(c)
+
+			return
+		}
+	}
+}
+
+func (ic *IdempotencyConfig) idempotent(method string) bool {
+	for _, m := range ic.Methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bodyFingerprint 请求体的摘要，读取后放回请求体给处理器使用
+func bodyFingerprint(req *http.Request) (fingerprint string, err error) {
+	if nil == req.Body || http.NoBody == req.Body {
+		return
+	}
+
+	var body []byte
+	if body, err = ioutil.ReadAll(req.Body); nil != err {
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	fingerprint = hex.EncodeToString(sum[:])
+
+	return
+}
+
+func replay(c echo.Context, rsp *IdempotentResponse) error {
+	header := c.Response().Header()
+	for key, values := range rsp.Header {
+		// 保存的请求头是规范的写法，请求编号使用这次请求的
+		if requestIdHeader == key {
+			continue
+		}
+		header[key] = values
+	}
+	header.Set(HeaderIdempotencyReplayed, "true")
+	c.Response().WriteHeader(rsp.Status)
+	_, err := c.Response().Write(rsp.Body)
+
+	return err
+}
+
+// userIdOf 当前调用者，用户是用户编号，服务账号是service:服务名，没有登录时为空
+// 服务账号没有用户编号，不能和其它服务账号共用"0"
+func userIdOf(c echo.Context) (id string) {
+	if ec, ok := c.(*EchoContext); ok && nil != ec.JWT {
+		if principal, err := ec.Principal(); nil == err {
+			id = principal.Subject()
+		}
+	}
+
+	return
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	rr.status = code
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Flush() {
+	rr.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return rr.ResponseWriter.(http.Hijacker).Hijack()
+}
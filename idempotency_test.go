@@ -0,0 +1,120 @@
+package echox
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestIdempotencyReplayKeepsRequestId(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(IdempotencyWithConfig(IdempotencyConfig{Store: NewMemoryIdempotencyStore()}))
+	calls := 0
+	e.POST("/orders", func(c echo.Context) error {
+		calls++
+
+		return c.String(http.StatusCreated, "created")
+	})
+
+	ids := make([]string, 0, 2)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("{}"))
+		req.Header.Set(HeaderIdempotencyKey, "key")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if http.StatusCreated != rec.Code || "created" != rec.Body.String() {
+			t.Fatalf("第%d次请求的响应是%d %q", i+1, rec.Code, rec.Body.String())
+		}
+		ids = append(ids, rec.Header().Get(echo.HeaderXRequestID))
+	}
+
+	if 1 != calls {
+		t.Fatalf("处理器执行了%d次", calls)
+	}
+	if "" == ids[1] || ids[0] == ids[1] {
+		t.Fatalf("重放的响应使用了第一次请求的编号：%v", ids)
+	}
+}
+
+func TestIdempotencyRejectsDifferentBody(t *testing.T) {
+	e := echo.New()
+	e.Use(IdempotencyWithConfig(IdempotencyConfig{Store: NewMemoryIdempotencyStore()}))
+	calls := 0
+	e.POST("/orders", func(c echo.Context) error {
+		calls++
+		body, _ := ioutil.ReadAll(c.Request().Body)
+
+		return c.Blob(http.StatusCreated, echo.MIMEApplicationJSON, body)
+	})
+
+	codes := make([]int, 0, 3)
+	for _, body := range []string{`{"amount":1}`, `{"amount":1}`, `{"amount":100}`} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.Header.Set(HeaderIdempotencyKey, "key")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+		if http.StatusCreated == rec.Code && `{"amount":1}` != rec.Body.String() {
+			t.Fatalf("处理器读到的请求体是%q", rec.Body.String())
+		}
+	}
+
+	if 1 != calls || http.StatusCreated != codes[1] || http.StatusUnprocessableEntity != codes[2] {
+		t.Fatalf("处理器执行了%d次，响应是%v", calls, codes)
+	}
+}
+
+func TestIdempotencySeparatesServiceAccounts(t *testing.T) {
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+	ec.Idempotency = &IdempotencyConfig{}
+	callers := make([]string, 0, 2)
+	ec.Routes = []RouteFunc{Register(Route{Method: echo.POST, Path: "/orders", Handler: func(c echo.Context) error {
+		callers = append(callers, userIdOf(c))
+
+		return c.NoContent(http.StatusCreated)
+	}})}
+	e := New(ec)
+
+	for _, service := range []string{"billing", "shipping"} {
+		token, err := ec.JWT.ServiceToken(service, time.Minute)
+		if nil != err {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set(HeaderIdempotencyKey, "key")
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if 2 != len(callers) || "service:billing" != callers[0] || "service:shipping" != callers[1] {
+		t.Fatalf("不同的服务账号共用了幂等的结果：%v", callers)
+	}
+}
+
+func TestMemoryIdempotencyStoreClose(t *testing.T) {
+	store := NewMemoryIdempotencyStore().(*memoryIdempotencyStore)
+	if nil != store.stop {
+		t.Fatal("创建后没有使用就开始了清理")
+	}
+	if _, err := store.Begin("key", time.Minute); nil != err {
+		t.Fatal(err)
+	}
+	if nil == store.stop {
+		t.Fatal("使用后没有开始清理")
+	}
+
+	if err := store.Close(); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := store.Begin("other", time.Minute); nil != err || nil != store.stop {
+		t.Fatal("关闭后又开始了清理")
+	}
+}
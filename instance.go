@@ -0,0 +1,92 @@
+package echox
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+type (
+	// InstanceInfo 实例的信息，排查多副本的问题时确认请求落在了哪个实例
+	InstanceInfo struct {
+		Id          string    `json:"id"`
+		Hostname    string    `json:"hostname"`
+		Pid         int       `json:"pid"`
+		Environment string    `json:"environment,omitempty"`
+		StartedAt   time.Time `json:"startedAt"`
+		Uptime      string    `json:"uptime"`
+		Version     string    `json:"version,omitempty"`
+		// 启用的功能，是EchoConfig中配置了的字段
+		Modules []string `json:"modules"`
+	}
+)
+
+var instanceId = func() string {
+	if id := os.Getenv("ECHOX_INSTANCE_ID"); "" != id {
+		return id
+	}
+	if pod := os.Getenv("POD_NAME"); "" != pod {
+		return pod
+	}
+	host, _ := os.Hostname()
+
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// InstanceId 实例编号，依次读取环境变量ECHOX_INSTANCE_ID和POD_NAME，都没有时是主机名加进程号
+func InstanceId() string {
+	return instanceId
+}
+
+// Environment 运行环境，读取环境变量ECHOX_ENV，没有时使用配置文件的ECHOX_PROFILE
+func Environment() string {
+	if env := os.Getenv("ECHOX_ENV"); "" != env {
+		return env
+	}
+
+	return os.Getenv("ECHOX_PROFILE")
+}
+
+// Modules 配置了的功能，空的字段和false不算
+func Modules(ec *EchoConfig) (modules []string) {
+	modules = make([]string, 0)
+	if nil == ec {
+		return
+	}
+
+	value := reflect.ValueOf(ec).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		enabled := false
+		switch field.Kind() {
+		case reflect.Bool:
+			enabled = field.Bool()
+		case reflect.Ptr, reflect.Interface, reflect.Func:
+			enabled = !field.IsNil()
+		case reflect.Slice, reflect.Map:
+			enabled = 0 != field.Len()
+		}
+		if enabled {
+			modules = append(modules, value.Type().Field(i).Name)
+		}
+	}
+
+	return
+}
+
+// instanceInfo 当前实例的运行信息
+func instanceInfo(ec *EchoConfig) InstanceInfo {
+	hostname, _ := os.Hostname()
+
+	return InstanceInfo{
+		Id:          instanceId,
+		Hostname:    hostname,
+		Pid:         os.Getpid(),
+		Environment: Environment(),
+		StartedAt:   startedAt,
+		Uptime:      time.Since(startedAt).Truncate(time.Second).String(),
+		Version:     appVersion(),
+		Modules:     Modules(ec),
+	}
+}
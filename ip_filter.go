@@ -0,0 +1,120 @@
+package echox
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// IPFilterConfig 按IP和网段过滤请求，以及信任的代理
+	IPFilterConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 允许的IP或者网段，比如"10.0.0.0/8"、"192.168.1.10"，为空表示允许所有
+		Allow []string
+
+		// 拒绝的IP或者网段，优先于Allow
+		Deny []string
+
+		// 信任的代理网段，只有来自这些地址的请求才使用代理头中的客户端IP
+		// 非必须 默认不信任任何代理，直接使用连接的地址
+		TrustedProxies []string
+
+		// 代理传递客户端IP的请求头，支持X-Forwarded-For和X-Real-IP
+		// 非必须 默认值是X-Forwarded-For
+		Header string
+	}
+)
+
+var (
+	// ErrIPForbidden IP被禁止访问
+	ErrIPForbidden = echo.NewHTTPError(http.StatusForbidden, "禁止访问的IP")
+)
+
+// IPExtractor 按信任的代理读取客户端IP，日志、限流和过滤使用的c.RealIP()都来自这里
+func (ifc *IPFilterConfig) IPExtractor() echo.IPExtractor {
+	if 0 == len(ifc.TrustedProxies) {
+		return echo.ExtractIPDirect()
+	}
+
+	// 只信任配置的网段，不默认信任回环和内网地址
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, network := range parseNetworks(ifc.TrustedProxies) {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	if strings.EqualFold(echo.HeaderXRealIP, ifc.Header) {
+		return echo.ExtractIPFromRealIPHeader(options...)
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// IPFilter 按IP和网段过滤请求的中间件
+func IPFilter(config IPFilterConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if "" != config.Header && !strings.EqualFold(echo.HeaderXForwardedFor, config.Header) && !strings.EqualFold(echo.HeaderXRealIP, config.Header) {
+		panic("echo: ip filter header is unsupported: " + config.Header)
+	}
+	allow := parseNetworks(config.Allow)
+	deny := parseNetworks(config.Deny)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			ip := net.ParseIP(c.RealIP())
+			if nil == ip || containsIP(deny, ip) || (0 != len(allow) && !containsIP(allow, ip)) {
+				return ErrIPForbidden
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// parseNetworks 解析网段，单个IP当作只有一个地址的网段
+func parseNetworks(values []string) (networks []*net.IPNet) {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if nil == ip {
+				panic("echo: ip is invalid: " + value)
+			}
+			bits := 128
+			if nil != ip.To4() {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if nil != err {
+			panic("echo: cidr is invalid: " + value)
+		}
+		networks = append(networks, network)
+	}
+
+	return
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
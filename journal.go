@@ -0,0 +1,365 @@
+package echox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/random"
+)
+
+type (
+	// JournalConfig 请求日志的配置
+	// 请求在处理前先持久化，进程崩溃后重启时重放没有处理完的请求
+	// 只记录声明了Route.Journaled的路由，在路由的认证之后执行，未认证的请求和404不会记录
+	JournalConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 日志存储
+		// 必须字段
+		Journal Journal
+
+		// 启动时是否重放没有处理完的请求
+		Replay bool
+
+		// 持久化前去掉的请求头，凭证不能明文写到磁盘上
+		// 日志中记录认证后的调用者，重放时为同一个调用者重新签发短期的Token，原来的凭证可能已经过期
+		// 非必须 默认值是Authorization、Proxy-Authorization、Cookie和X-Api-Key
+		StripHeaders []string
+	}
+
+	// JournalEntry 请求日志
+	JournalEntry struct {
+		Id     string      `json:"id"`
+		Time   time.Time   `json:"time"`
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+		Body   []byte      `json:"body"`
+		// 认证后的调用者，匿名的请求为空
+		Principal *Principal `json:"principal,omitempty"`
+	}
+
+	// Journal 请求日志存储
+	Journal interface {
+		// Append 记录请求，返回时必须已经持久化
+		Append(entry *JournalEntry) error
+		// Complete 请求处理完成
+		Complete(id string) error
+		// Pending 没有处理完成的请求，按记录顺序返回
+		Pending() ([]*JournalEntry, error)
+	}
+
+	fileJournal struct {
+		mutex sync.Mutex
+		path  string
+		file  *os.File
+	}
+
+	journalRecord struct {
+		Op    string        `json:"op"`
+		Id    string        `json:"id,omitempty"`
+		Entry *JournalEntry `json:"entry,omitempty"`
+	}
+
+	journalReplayKey struct{}
+
+	// replayWriter 重放时丢弃响应，只记录状态码
+	replayWriter struct {
+		header http.Header
+		status int
+	}
+)
+
+const (
+	journalOpAppend   = "append"
+	journalOpComplete = "complete"
+)
+
+var (
+	// DefaultJournalConfig 默认配置
+	// 默认只记录写请求
+	DefaultJournalConfig = JournalConfig{
+		Skipper: func(c echo.Context) bool {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return true
+			default:
+				return false
+			}
+		},
+		StripHeaders: []string{
+			echo.HeaderAuthorization,
+			"Proxy-Authorization",
+			echo.HeaderCookie,
+			"X-Api-Key",
+		},
+	}
+)
+
+// NewFileJournal 创建基于文件的请求日志
+// 打开时会压缩文件，只保留没有处理完的请求
+func NewFileJournal(path string) (journal Journal, err error) {
+	fj := &fileJournal{path: path}
+
+	var pending []*JournalEntry
+	if pending, err = fj.read(); nil != err {
+		return
+	}
+	if err = fj.rewrite(pending); nil != err {
+		return
+	}
+	if fj.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); nil != err {
+		return
+	}
+	journal = fj
+
+	return
+}
+
+func (fj *fileJournal) Append(entry *JournalEntry) error {
+	return fj.write(&journalRecord{Op: journalOpAppend, Entry: entry})
+}
+
+func (fj *fileJournal) Complete(id string) error {
+	return fj.write(&journalRecord{Op: journalOpComplete, Id: id})
+}
+
+func (fj *fileJournal) Pending() ([]*JournalEntry, error) {
+	fj.mutex.Lock()
+	defer fj.mutex.Unlock()
+
+	return fj.read()
+}
+
+func (fj *fileJournal) write(record *journalRecord) (err error) {
+	var data []byte
+	if data, err = json.Marshal(record); nil != err {
+		return
+	}
+
+	fj.mutex.Lock()
+	defer fj.mutex.Unlock()
+
+	if _, err = fj.file.Write(append(data, '\n')); nil != err {
+		return
+	}
+	err = fj.file.Sync()
+
+	return
+}
+
+func (fj *fileJournal) read() (pending []*JournalEntry, err error) {
+	var file *os.File
+	if file, err = os.Open(fj.path); os.IsNotExist(err) {
+		return nil, nil
+	} else if nil != err {
+		return
+	}
+	defer file.Close()
+
+	entries := make(map[string]*JournalEntry)
+	order := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := journalRecord{}
+		// 崩溃时最后一行可能没有写完整，直接忽略
+		if json.Unmarshal(scanner.Bytes(), &record) != nil {
+			continue
+		}
+
+		switch record.Op {
+		case journalOpAppend:
+			// 手工修改或者截断的记录没有请求
+			if nil == record.Entry {
+				continue
+			}
+			entries[record.Entry.Id] = record.Entry
+			order = append(order, record.Entry.Id)
+		case journalOpComplete:
+			delete(entries, record.Id)
+		}
+	}
+	if err = scanner.Err(); nil != err {
+		return
+	}
+
+	for _, id := range order {
+		if entry, ok := entries[id]; ok {
+			pending = append(pending, entry)
+		}
+	}
+
+	return
+}
+
+func (fj *fileJournal) rewrite(pending []*JournalEntry) (err error) {
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	for _, entry := range pending {
+		if err = encoder.Encode(&journalRecord{Op: journalOpAppend, Entry: entry}); nil != err {
+			return
+		}
+	}
+
+	tmp := fj.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, buffer.Bytes(), 0600); nil != err {
+		return
+	}
+	err = os.Rename(tmp, fj.path)
+
+	return
+}
+
+// Journaled 请求日志中间件，一般只用在需要保证不丢失的写接口上
+func Journaled(journal Journal) echo.MiddlewareFunc {
+	c := DefaultJournalConfig
+	c.Journal = journal
+
+	return JournaledWithConfig(c)
+}
+
+// JournaledWithConfig 请求日志中间件
+// 请求持久化以后才会交给处理器，持久化失败时直接返回错误
+func JournaledWithConfig(config JournalConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultJournalConfig.Skipper
+	}
+	if nil == config.Journal {
+		panic("echo: journal middleware requires journal")
+	}
+	if nil == config.StripHeaders {
+		config.StripHeaders = DefaultJournalConfig.StripHeaders
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			id, replay := req.Context().Value(journalReplayKey{}).(string)
+			if !replay {
+				var body []byte
+				if body, err = ioutil.ReadAll(req.Body); nil != err {
+					return
+				}
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+				id = c.Response().Header().Get(echo.HeaderXRequestID)
+				if "" == id {
+					id = random.String(32)
+				}
+				if key := req.Header.Get(HeaderIdempotencyKey); "" == key {
+					req.Header.Set(HeaderIdempotencyKey, id)
+				}
+				header := req.Header.Clone()
+				for _, name := range config.StripHeaders {
+					header.Del(name)
+				}
+				entry := &JournalEntry{
+					Id:     id,
+					Time:   time.Now(),
+					Method: req.Method,
+					URL:    req.URL.RequestURI(),
+					Header: header,
+					Body:   body,
+				}
+				if ec, ok := c.(*EchoContext); ok && nil != ec.JWT {
+					if principal, principalErr := ec.Principal(); nil == principalErr {
+						entry.Principal = &principal
+					}
+				}
+				if err = config.Journal.Append(entry); nil != err {
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "请求无法持久化").SetInternal(err)
+				}
+			}
+			defer func() {
+				if completeErr := config.Journal.Complete(id); nil != completeErr {
+					c.Logger().Error(completeErr)
+				}
+			}()
+			err = next(c)
+
+			return
+		}
+	}
+}
+
+// ReplayJournal 重放没有处理完成的请求
+// 请求带着第一次的Idempotency-Key，配合持久化的幂等存储可以避免重复处理
+// 日志中没有凭证，重放的请求使用为原来的调用者重新签发的Token，匿名的请求仍然匿名
+func ReplayJournal(e *echo.Echo, journal Journal) (err error) {
+	var pending []*JournalEntry
+	if pending, err = journal.Pending(); nil != err {
+		return
+	}
+
+	for _, entry := range pending {
+		ctx := context.WithValue(context.Background(), journalReplayKey{}, entry.Id)
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, entry.Method, entry.URL, bytes.NewReader(entry.Body)); nil != err {
+			return
+		}
+		req.Header = entry.Header
+		if nil == req.Header {
+			req.Header = make(http.Header)
+		}
+		req.RemoteAddr = "127.0.0.1:0"
+		if nil != entry.Principal {
+			if err = authorizePrincipal(req, *entry.Principal); nil != err {
+				return
+			}
+		}
+
+		rw := &replayWriter{header: make(http.Header), status: http.StatusOK}
+		e.ServeHTTP(rw, req)
+		e.Logger.Infof("重放请求：%s %s，结果：%d", entry.Method, entry.URL, rw.status)
+		// 路由可能已经不再记录日志，重放一次后不再重放
+		if err = journal.Complete(entry.Id); nil != err {
+			return
+		}
+	}
+
+	return
+}
+
+// authorizePrincipal 为调用者签发短期的Token，权限和第一次请求时相同
+func authorizePrincipal(req *http.Request, principal Principal) (err error) {
+	reloadMutex.Lock()
+	config := runningJWT
+	reloadMutex.Unlock()
+	if nil == config {
+		return
+	}
+
+	var token string
+	if token, err = principal.token(config, 5*time.Minute); nil == err {
+		req.Header.Set(echo.HeaderAuthorization, config.AuthScheme+" "+token)
+	}
+
+	return
+}
+
+func (rw *replayWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *replayWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (rw *replayWriter) WriteHeader(code int) {
+	rw.status = code
+}
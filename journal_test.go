@@ -0,0 +1,143 @@
+package echox
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+func TestFileJournalSkipsRecordsWithoutEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	data := `{"op":"append"}
+{"op":"append","entry":{"id":"1","method":"POST","url":"/orders"}}
+{"op":"complete"}
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); nil != err {
+		t.Fatal(err)
+	}
+
+	journal, err := NewFileJournal(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	pending, err := journal.Pending()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(pending) || "1" != pending[0].Id {
+		t.Fatalf("没有处理完的请求是%+v", pending)
+	}
+}
+
+func TestJournalRecordsAfterAuthAndReplaysAsCaller(t *testing.T) {
+	journal, err := NewFileJournal(filepath.Join(t.TempDir(), "journal"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var principals []Principal
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+	ec.Journal = &JournalConfig{Journal: journal}
+	ec.Routes = []RouteFunc{Register(Route{
+		Method:    echo.POST,
+		Path:      "/orders",
+		Auth:      AuthJWT,
+		Journaled: true,
+		Handler: func(c echo.Context) (err error) {
+			principal, err := c.(*EchoContext).Principal()
+			if nil != err {
+				return
+			}
+			principals = append(principals, principal)
+
+			return c.NoContent(http.StatusNoContent)
+		},
+	})}
+	e := New(ec)
+
+	// 没有认证和不存在的路由不记录
+	for _, target := range []string{"/orders", "/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+	}
+	if pending, _ := journal.Pending(); 0 != len(pending) {
+		t.Fatalf("记录了没有认证的请求：%+v", pending)
+	}
+
+	// 模拟处理前崩溃：日志中留下了认证过的用户的请求
+	user := gox.BaseUser{Id: 7, Username: "alice"}
+	if err = journal.Append(&JournalEntry{
+		Id:        "crashed",
+		Method:    http.MethodPost,
+		URL:       "/orders",
+		Header:    make(http.Header),
+		Principal: &Principal{Type: PrincipalUser, Id: "7", User: user},
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if err = journal.Append(&JournalEntry{Id: "anonymous", Method: http.MethodPost, URL: "/orders"}); nil != err {
+		t.Fatal(err)
+	}
+	if err = ReplayJournal(e, journal); nil != err {
+		t.Fatal(err)
+	}
+
+	// 匿名的请求重放时仍然没有认证，不会变成系统服务账号
+	if 1 != len(principals) {
+		t.Fatalf("重放的调用者是%+v", principals)
+	}
+	if principals[0].IsService() || 7 != principals[0].User.Id {
+		t.Fatalf("重放时调用者变成了%+v", principals[0])
+	}
+	if pending, _ := journal.Pending(); 0 != len(pending) {
+		t.Fatalf("重放后还有没有处理完的请求：%+v", pending)
+	}
+}
+
+func TestJournalPersistsPrincipal(t *testing.T) {
+	journal, err := NewFileJournal(filepath.Join(t.TempDir(), "journal"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var recorded []*JournalEntry
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+	ec.Journal = &JournalConfig{Journal: journal}
+	ec.Routes = []RouteFunc{Register(Route{
+		Method:    echo.POST,
+		Path:      "/orders",
+		Auth:      AuthJWT,
+		Journaled: true,
+		Handler: func(c echo.Context) (err error) {
+			recorded, err = journal.Pending()
+
+			return
+		},
+	})}
+	e := New(ec)
+
+	token, err := ec.JWT.ServiceToken("billing", time.Minute)
+	if nil != err {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	if 1 != len(recorded) || nil == recorded[0].Principal {
+		t.Fatalf("日志中没有调用者：%+v", recorded)
+	}
+	if principal := recorded[0].Principal; !principal.IsService() || "billing" != principal.Id {
+		t.Fatalf("日志中的调用者是%+v", principal)
+	}
+	if "" != recorded[0].Header.Get(echo.HeaderAuthorization) {
+		t.Fatal("日志中保存了凭证")
+	}
+}
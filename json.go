@@ -0,0 +1,174 @@
+package echox
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+type (
+	// JSONSerializer 响应使用的JSON编码，jsoniter.API和sonic.API都可以直接使用
+	JSONSerializer interface {
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+
+	stdJSON struct{}
+
+	canonicalJSON struct{}
+)
+
+var (
+	// JSONStd 标准库
+	JSONStd JSONSerializer = stdJSON{}
+	// JSONIter jsoniter的默认配置
+	JSONIter JSONSerializer = jsoniter.ConfigDefault
+	// JSONIterFastest jsoniter最快的配置，不转义HTML，浮点数只保留6位小数
+	JSONIterFastest JSONSerializer = jsoniter.ConfigFastest
+	// JSONCanonical 规范的JSON，键按字典序排列，数字的格式固定，不转义HTML
+	// 相同的数据总是得到相同的字节，适合签名和按内容计算ETag
+	JSONCanonical JSONSerializer = canonicalJSON{}
+
+	jsonSerializer = JSONIter
+)
+
+func (sj stdJSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (sj stdJSON) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (cj canonicalJSON) Marshal(v interface{}) ([]byte, error) {
+	return CanonicalJSON(v)
+}
+
+func (cj canonicalJSON) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// CanonicalJSON 编码成规范的JSON
+// 先按标准库编码，再按字典序重新输出对象的键，整数原样保留，小数使用最短的表示
+func CanonicalJSON(v interface{}) (data []byte, err error) {
+	if data, err = json.Marshal(v); nil != err {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err = decoder.Decode(&value); nil != err {
+		return
+	}
+	buffer := new(bytes.Buffer)
+	if err = writeCanonical(buffer, value); nil != err {
+		return
+	}
+	data = buffer.Bytes()
+
+	return
+}
+
+func writeCanonical(buffer *bytes.Buffer, value interface{}) (err error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buffer.WriteByte('{')
+		for i, key := range keys {
+			if 0 != i {
+				buffer.WriteByte(',')
+			}
+			if err = writeCanonicalString(buffer, key); nil != err {
+				return
+			}
+			buffer.WriteByte(':')
+			if err = writeCanonical(buffer, v[key]); nil != err {
+				return
+			}
+		}
+		buffer.WriteByte('}')
+	case []interface{}:
+		buffer.WriteByte('[')
+		for i, item := range v {
+			if 0 != i {
+				buffer.WriteByte(',')
+			}
+			if err = writeCanonical(buffer, item); nil != err {
+				return
+			}
+		}
+		buffer.WriteByte(']')
+	case string:
+		err = writeCanonicalString(buffer, v)
+	case json.Number:
+		err = writeCanonicalNumber(buffer, v)
+	case bool:
+		buffer.WriteString(strconv.FormatBool(v))
+	case nil:
+		buffer.WriteString("null")
+	}
+
+	return
+}
+
+func writeCanonicalString(buffer *bytes.Buffer, value string) error {
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); nil != err {
+		return err
+	}
+	// Encode会在最后加上换行
+	buffer.Truncate(buffer.Len() - 1)
+
+	return nil
+}
+
+// writeCanonicalNumber 整数原样输出，避免大整数丢失精度；小数和ECMAScript一样使用最短的表示
+func writeCanonicalNumber(buffer *bytes.Buffer, number json.Number) (err error) {
+	text := number.String()
+	if !strings.ContainsAny(text, ".eE") {
+		buffer.WriteString(text)
+
+		return
+	}
+
+	var value float64
+	if value, err = number.Float64(); nil != err {
+		return
+	}
+	if abs := math.Abs(value); 0 == abs || (1e-6 <= abs && abs < 1e21) {
+		buffer.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	} else {
+		// 指数不补零，1e-07写成1e-7
+		text = strconv.FormatFloat(value, 'e', -1, 64)
+		buffer.WriteString(strings.NewReplacer("e-0", "e-", "e+0", "e+").Replace(text))
+	}
+
+	return
+}
+
+// marshalJSON 按编码器编码，先编码再写入，编码失败时不会写出半个响应
+func marshalJSON(serializer JSONSerializer, i interface{}, indent string) (data []byte, err error) {
+	if data, err = serializer.Marshal(i); nil != err || "" == indent {
+		return
+	}
+
+	buffer := new(bytes.Buffer)
+	if err = json.Indent(buffer, data, "", indent); nil != err {
+		return
+	}
+	data = buffer.Bytes()
+
+	return
+}
@@ -64,9 +64,10 @@ func (jcc *JWTCasbinConfig) CheckPermission(c echo.Context) (bool, error) {
 		Context: c,
 		JWT:     jcc.JWT,
 	}
-	if user, err := ec.User(); nil != err {
+	// 服务账号的主体带有service:前缀，策略中和用户分开配置
+	if principal, err := ec.Principal(); nil != err {
 		return false, err
 	} else {
-		return jcc.Enforcer.Enforce(user.IdString(), c.Request().URL.Path, MethodMapping[c.Request().Method])
+		return jcc.Enforcer.Enforce(principal.Subject(), c.Request().URL.Path, MethodMapping[c.Request().Method])
 	}
 }
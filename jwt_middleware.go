@@ -1,14 +1,18 @@
 package echox
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/storezhang/gox"
 )
 
 type (
@@ -31,6 +35,10 @@ type (
 		// 必须字段
 		SigningKey interface{}
 
+		// 替换签名密钥后，旧密钥签发的Token还可以继续使用的时间
+		// 非必须 默认值是5分钟，小于0时替换后马上失效
+		SigningKeyGrace time.Duration
+
 		// 签名方法
 		// 非必须 默认是HS256.
 		SigningMethod string
@@ -57,6 +65,9 @@ type (
 
 		keyFunc jwt.Keyfunc
 
+		// 运行时替换的签名密钥
+		key atomic.Value
+
 		Extractor jwtExtractor
 	}
 
@@ -67,17 +78,17 @@ type (
 	JWTErrorHandler func(error) error
 
 	jwtExtractor func(echo.Context) (string, error)
+
+	// signingKeys 运行时的签名密钥，替换后在宽限期内保留旧密钥用来验证
+	signingKeys struct {
+		current  interface{}
+		previous interface{}
+		expires  time.Time
+	}
 )
 
 func (j *JWTConfig) Parse(t string) (claims jwt.Claims, header map[string]interface{}, err error) {
-	token := new(jwt.Token)
-	if _, ok := j.Claims.(jwt.MapClaims); ok {
-		token, err = jwt.Parse(t, j.keyFunc)
-	} else {
-		elem := reflect.ValueOf(j.Claims).Type().Elem()
-		claims := reflect.New(elem).Interface().(jwt.Claims)
-		token, err = jwt.ParseWithClaims(t, claims, j.keyFunc)
-	}
+	token, err := j.parse(t, j.newClaims())
 	if err == nil && token.Valid {
 		claims = token.Claims
 		header = token.Header
@@ -87,9 +98,143 @@ func (j *JWTConfig) Parse(t string) (claims jwt.Claims, header map[string]interf
 }
 
 func (j *JWTConfig) Token(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.GetSigningMethod(j.SigningMethod), claims)
+	// 启动时复制了配置，调用方自己的配置没有经过init
+	method := j.SigningMethod
+	if "" == method {
+		method = DefaultJWTConfig.SigningMethod
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(method), claims)
+
+	return token.SignedString([]byte(j.signingKey().(string)))
+}
+
+// Clone 复制配置，复制的签名密钥是当前使用的密钥，默认值由使用复制的一方填充
+// 启动和重新加载时复制调用方的配置，运行的服务替换密钥和填充默认值不会修改调用方的配置
+func (j *JWTConfig) Clone() *JWTConfig {
+	return &JWTConfig{
+		Skipper:         j.Skipper,
+		BeforeFunc:      j.BeforeFunc,
+		SuccessHandler:  j.SuccessHandler,
+		ErrorHandler:    j.ErrorHandler,
+		SigningKey:      j.signingKey(),
+		SigningKeyGrace: j.SigningKeyGrace,
+		SigningMethod:   j.SigningMethod,
+		ContextKey:      j.ContextKey,
+		Claims:          j.Claims,
+		TokenLookup:     j.TokenLookup,
+		AuthScheme:      j.AuthScheme,
+	}
+}
+
+// SetSigningKey 在运行时替换签名密钥
+// 新签发的Token使用新密钥，旧密钥签发的Token在SigningKeyGrace内仍然有效
+// 密钥没有变化时不做任何事情，重新加载不会提前结束宽限期
+func (j *JWTConfig) SetSigningKey(key interface{}) {
+	previous := j.signingKey()
+	if reflect.DeepEqual(previous, key) {
+		return
+	}
+	j.key.Store(&signingKeys{current: key, previous: previous, expires: time.Now().Add(j.SigningKeyGrace)})
+}
+
+func (j *JWTConfig) signingKey() interface{} {
+	if keys, ok := j.key.Load().(*signingKeys); ok {
+		return keys.current
+	}
+
+	return j.SigningKey
+}
+
+// previousKey 宽限期内的旧密钥
+func (j *JWTConfig) previousKey() (key interface{}, ok bool) {
+	if keys, loaded := j.key.Load().(*signingKeys); loaded && time.Now().Before(keys.expires) {
+		key, ok = keys.previous, true
+	}
+
+	return
+}
+
+// newClaims 按配置的Claims类型创建解析的目标
+func (j *JWTConfig) newClaims() jwt.Claims {
+	if _, ok := j.Claims.(jwt.MapClaims); ok {
+		return jwt.MapClaims{}
+	}
+
+	return reflect.New(reflect.ValueOf(j.Claims).Type().Elem()).Interface().(jwt.Claims)
+}
+
+// parse 解析Token，签名不对时再用宽限期内的旧密钥试一次
+func (j *JWTConfig) parse(t string, claims jwt.Claims) (token *jwt.Token, err error) {
+	token, err = jwt.ParseWithClaims(t, claims, j.keyFunc)
+
+	var validationErr *jwt.ValidationError
+	if nil == err || !errors.As(err, &validationErr) || 0 == validationErr.Errors&jwt.ValidationErrorSignatureInvalid {
+		return
+	}
+	if previous, ok := j.previousKey(); ok {
+		token, err = jwt.ParseWithClaims(t, claims, j.verifyWith(func() interface{} { return previous }))
+	}
+
+	return
+}
+
+// verifyWith 校验签名方法并返回验证用的密钥
+func (j *JWTConfig) verifyWith(key func() interface{}) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != j.SigningMethod {
+			return nil, fmt.Errorf("unexpected jwt signing method=%v", t.Header["alg"])
+		}
+		return []byte(key().(string)), nil
+	}
+}
 
-	return token.SignedString([]byte(j.SigningKey.(string)))
+// init 填充默认值
+// 可以重复调用
+func (j *JWTConfig) init() {
+	if j.Skipper == nil {
+		j.Skipper = DefaultJWTConfig.Skipper
+	}
+	if j.SigningKey == nil {
+		panic("echo: jwt middleware requires signing key")
+	}
+	if j.SigningKeyGrace == 0 {
+		j.SigningKeyGrace = DefaultJWTConfig.SigningKeyGrace
+	}
+	if j.SigningMethod == "" {
+		j.SigningMethod = DefaultJWTConfig.SigningMethod
+	}
+	if j.ContextKey == "" {
+		j.ContextKey = DefaultJWTConfig.ContextKey
+	}
+	if j.Claims == nil {
+		j.Claims = DefaultJWTConfig.Claims
+	}
+	if j.TokenLookup == "" {
+		j.TokenLookup = DefaultJWTConfig.TokenLookup
+	}
+	if j.AuthScheme == "" {
+		j.AuthScheme = DefaultJWTConfig.AuthScheme
+	}
+	j.keyFunc = j.verifyWith(j.signingKey)
+
+	parts := strings.Split(j.TokenLookup, ":")
+	j.Extractor = jwtFromHeader(parts[1], j.AuthScheme)
+	switch parts[0] {
+	case "query":
+		j.Extractor = jwtFromQuery(parts[1])
+	case "cookie":
+		j.Extractor = jwtFromCookie(parts[1])
+	}
+}
+
+// UserToken 为用户签发Token
+func (j *JWTConfig) UserToken(user gox.BaseUser) (string, error) {
+	return j.Token(&JWTClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour * 72).Unix(),
+		},
+		BaseUser: user,
+	})
 }
 
 const (
@@ -103,12 +248,13 @@ var (
 var (
 	// DefaultJWTConfig 默认配置
 	DefaultJWTConfig = &JWTConfig{
-		Skipper:       middleware.DefaultSkipper,
-		SigningMethod: AlgorithmHS256,
-		ContextKey:    "user",
-		TokenLookup:   "header:" + echo.HeaderAuthorization,
-		AuthScheme:    "Bearer",
-		Claims:        &JWTClaims{},
+		Skipper:         middleware.DefaultSkipper,
+		SigningKeyGrace: 5 * time.Minute,
+		SigningMethod:   AlgorithmHS256,
+		ContextKey:      "user",
+		TokenLookup:     "header:" + echo.HeaderAuthorization,
+		AuthScheme:      "Bearer",
+		Claims:          &JWTClaims{},
 	}
 )
 
@@ -122,42 +268,7 @@ func JWT(key interface{}) echo.MiddlewareFunc {
 
 // JWTWithConfig JWT中间件
 func JWTWithConfig(config *JWTConfig) echo.MiddlewareFunc {
-	if config.Skipper == nil {
-		config.Skipper = DefaultJWTConfig.Skipper
-	}
-	if config.SigningKey == nil {
-		panic("echo: jwt middleware requires signing key")
-	}
-	if config.SigningMethod == "" {
-		config.SigningMethod = DefaultJWTConfig.SigningMethod
-	}
-	if config.ContextKey == "" {
-		config.ContextKey = DefaultJWTConfig.ContextKey
-	}
-	if config.Claims == nil {
-		config.Claims = DefaultJWTConfig.Claims
-	}
-	if config.TokenLookup == "" {
-		config.TokenLookup = DefaultJWTConfig.TokenLookup
-	}
-	if config.AuthScheme == "" {
-		config.AuthScheme = DefaultJWTConfig.AuthScheme
-	}
-	config.keyFunc = func(t *jwt.Token) (interface{}, error) {
-		if t.Method.Alg() != config.SigningMethod {
-			return nil, fmt.Errorf("unexpected jwt signing method=%v", t.Header["alg"])
-		}
-		return []byte(config.SigningKey.(string)), nil
-	}
-
-	parts := strings.Split(config.TokenLookup, ":")
-	config.Extractor = jwtFromHeader(parts[1], config.AuthScheme)
-	switch parts[0] {
-	case "query":
-		config.Extractor = jwtFromQuery(parts[1])
-	case "cookie":
-		config.Extractor = jwtFromCookie(parts[1])
-	}
+	config.init()
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -176,15 +287,8 @@ func JWTWithConfig(config *JWTConfig) echo.MiddlewareFunc {
 				}
 				return err
 			}
-			token := new(jwt.Token)
 			// Issue #647, #656
-			if _, ok := config.Claims.(jwt.MapClaims); ok {
-				token, err = jwt.Parse(auth, config.keyFunc)
-			} else {
-				t := reflect.ValueOf(config.Claims).Type().Elem()
-				claims := reflect.New(t).Interface().(jwt.Claims)
-				token, err = jwt.ParseWithClaims(auth, claims, config.keyFunc)
-			}
+			token, err := config.parse(auth, config.newClaims())
 			if err == nil && token.Valid {
 				c.Set(config.ContextKey, token)
 				if config.SuccessHandler != nil {
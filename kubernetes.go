@@ -0,0 +1,205 @@
+package echox
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// KubernetesConfig 运行在Kubernetes中的配置
+	KubernetesConfig struct {
+		// 存活检查的路径
+		// 非必须 默认值是"/healthz"
+		LivenessPath string
+
+		// 就绪检查的路径
+		// 非必须 默认值是"/readyz"
+		ReadinessPath string
+
+		// 启动检查的路径
+		// 非必须 默认值是"/startupz"
+		StartupPath string
+
+		// preStop钩子的路径
+		// 非必须 默认值是"/prestop"
+		// 调用后就绪检查立即失败，等待PreStopDelay后返回，让流量在收到SIGTERM前摘除
+		PreStopPath string
+
+		// preStop钩子的等待时间
+		// 非必须 默认值是5秒
+		PreStopDelay time.Duration
+
+		// 根据cgroup的CPU限制设置GOMAXPROCS
+		AutoMaxProcs bool
+
+		// 根据cgroup的内存限制设置GC的内存上限
+		AutoMemoryLimit bool
+
+		// 内存上限占cgroup内存限制的比例
+		// 非必须 默认值是0.9
+		MemoryLimitRatio float64
+	}
+
+	// InstanceLabels 通过Downward API注入的实例信息
+	// 需要在部署文件中把对应的字段设置为环境变量POD_NAME、POD_NAMESPACE、POD_IP和NODE_NAME
+	InstanceLabels struct {
+		Pod       string `json:"pod,omitempty"`
+		Namespace string `json:"namespace,omitempty"`
+		PodIp     string `json:"podIp,omitempty"`
+		Node      string `json:"node,omitempty"`
+	}
+)
+
+var (
+	// DefaultKubernetesConfig 默认配置
+	DefaultKubernetesConfig = KubernetesConfig{
+		LivenessPath:     "/healthz",
+		ReadinessPath:    "/readyz",
+		StartupPath:      "/startupz",
+		PreStopPath:      "/prestop",
+		PreStopDelay:     5 * time.Second,
+		AutoMaxProcs:     true,
+		AutoMemoryLimit:  true,
+		MemoryLimitRatio: 0.9,
+	}
+)
+
+// Instance 当前实例的信息
+func Instance() InstanceLabels {
+	return InstanceLabels{
+		Pod:       os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		PodIp:     os.Getenv("POD_IP"),
+		Node:      os.Getenv("NODE_NAME"),
+	}
+}
+
+// Labels 实例信息转换成标签，用于日志和指标，总是带上实例编号
+func (il InstanceLabels) Labels() map[string]string {
+	labels := map[string]string{"instance": instanceId}
+	if "" != il.Pod {
+		labels["pod"] = il.Pod
+	}
+	if "" != il.Namespace {
+		labels["namespace"] = il.Namespace
+	}
+	if "" != il.Node {
+		labels["node"] = il.Node
+	}
+
+	return labels
+}
+
+func (kc *KubernetesConfig) init() {
+	if "" == kc.LivenessPath {
+		kc.LivenessPath = DefaultKubernetesConfig.LivenessPath
+	}
+	if "" == kc.ReadinessPath {
+		kc.ReadinessPath = DefaultKubernetesConfig.ReadinessPath
+	}
+	if "" == kc.StartupPath {
+		kc.StartupPath = DefaultKubernetesConfig.StartupPath
+	}
+	if "" == kc.PreStopPath {
+		kc.PreStopPath = DefaultKubernetesConfig.PreStopPath
+	}
+	if 0 >= kc.PreStopDelay {
+		kc.PreStopDelay = DefaultKubernetesConfig.PreStopDelay
+	}
+	if 0 >= kc.MemoryLimitRatio || 1 < kc.MemoryLimitRatio {
+		kc.MemoryLimitRatio = DefaultKubernetesConfig.MemoryLimitRatio
+	}
+}
+
+func (kc *KubernetesConfig) mount(e *echo.Echo) {
+	kc.init()
+
+	if kc.AutoMaxProcs {
+		if procs := cgroupCPU(); 0 < procs {
+			runtime.GOMAXPROCS(procs)
+		}
+	}
+	if kc.AutoMemoryLimit {
+		if limit := cgroupMemory(); 0 < limit {
+			debug.SetMemoryLimit(int64(float64(limit) * kc.MemoryLimitRatio))
+		}
+	}
+
+	e.GET(kc.LivenessPath, liveness)
+	e.GET(kc.ReadinessPath, readiness)
+	e.GET(kc.StartupPath, startup)
+	e.GET(kc.PreStopPath, kc.preStop)
+
+	// 实例信息加到日志中
+	instance := Instance()
+	if "" != instance.Pod {
+		e.Logger.SetHeader(`{"time":"${time_rfc3339_nano}","level":"${level}","prefix":"${prefix}",` +
+			`"file":"${short_file}","line":"${line}","pod":"` + instance.Pod + `","namespace":"` + instance.Namespace + `"}`)
+	}
+}
+
+// preStop 摘除流量后再退出
+func (kc *KubernetesConfig) preStop(c echo.Context) error {
+	lifecycleState.Store(LifecycleDraining)
+	time.Sleep(kc.PreStopDelay)
+
+	return c.NoContent(http.StatusOK)
+}
+
+// cgroupCPU 从cgroup中读取CPU限制，没有限制时返回0
+func cgroupCPU() int {
+	quota, period := -1.0, 0.0
+	// cgroup v2
+	if data, err := ioutil.ReadFile("/sys/fs/cgroup/cpu.max"); nil == err {
+		if fields := strings.Fields(string(data)); 2 == len(fields) && "max" != fields[0] {
+			quota, _ = strconv.ParseFloat(fields[0], 64)
+			period, _ = strconv.ParseFloat(fields[1], 64)
+		}
+	} else {
+		// cgroup v1
+		quota = readCgroupNumber("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+		period = readCgroupNumber("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	}
+	if 0 >= quota || 0 >= period {
+		return 0
+	}
+
+	return int(math.Max(1, math.Ceil(quota/period)))
+}
+
+// cgroupMemory 从cgroup中读取内存限制，没有限制时返回0
+func cgroupMemory() int64 {
+	limit := readCgroupNumber("/sys/fs/cgroup/memory.max")
+	if 0 >= limit {
+		limit = readCgroupNumber("/sys/fs/cgroup/memory/memory.limit_in_bytes")
+	}
+	// cgroup v1没有限制时是一个非常大的数
+	if 0 >= limit || limit >= math.MaxInt64/2 {
+		return 0
+	}
+
+	return int64(limit)
+}
+
+func readCgroupNumber(path string) float64 {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return -1
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if nil != err {
+		return -1
+	}
+
+	return value
+}
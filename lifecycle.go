@@ -0,0 +1,146 @@
+package echox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// LifecycleStarting 开始启动
+	LifecycleStarting LifecycleState = "starting"
+	// LifecycleReady 已经开始监听，可以接收请求
+	LifecycleReady LifecycleState = "ready"
+	// LifecycleDraining 收到退出信号，开始优雅退出
+	LifecycleDraining LifecycleState = "draining"
+	// LifecycleStopped 已经停止
+	LifecycleStopped LifecycleState = "stopped"
+)
+
+type (
+	// LifecycleState 服务状态
+	LifecycleState string
+
+	// LifecycleEvent 服务状态变化的事件
+	LifecycleEvent struct {
+		State   LifecycleState `json:"state"`
+		Time    time.Time      `json:"time"`
+		Address string         `json:"address"`
+		Pid     int            `json:"pid"`
+	}
+
+	// LifecycleNotifier 接收服务状态变化的事件
+	LifecycleNotifier interface {
+		Notify(event *LifecycleEvent) error
+	}
+
+	// LifecycleNotifierFunc 使用函数接收服务状态变化的事件
+	LifecycleNotifierFunc func(event *LifecycleEvent) error
+
+	logNotifier struct {
+		logger echo.Logger
+	}
+
+	httpNotifier struct {
+		url    string
+		client *http.Client
+	}
+
+	systemdNotifier struct{}
+)
+
+func (lnf LifecycleNotifierFunc) Notify(event *LifecycleEvent) error {
+	return lnf(event)
+}
+
+// NewLogNotifier 把服务状态写到日志中
+func NewLogNotifier(logger echo.Logger) LifecycleNotifier {
+	return &logNotifier{logger: logger}
+}
+
+func (ln *logNotifier) Notify(event *LifecycleEvent) error {
+	ln.logger.Infof("服务状态：%s，地址：%s，进程：%d", event.State, event.Address, event.Pid)
+
+	return nil
+}
+
+// NewHTTPNotifier 把服务状态以JSON格式POST到指定地址
+func NewHTTPNotifier(url string, timeout time.Duration) LifecycleNotifier {
+	return &httpNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (hn *httpNotifier) Notify(event *LifecycleEvent) (err error) {
+	var body []byte
+	if body, err = json.Marshal(event); nil != err {
+		return
+	}
+
+	var rsp *http.Response
+	if rsp, err = hn.client.Post(hn.url, echo.MIMEApplicationJSON, bytes.NewReader(body)); nil != err {
+		return
+	}
+	defer rsp.Body.Close()
+	if http.StatusBadRequest <= rsp.StatusCode {
+		err = fmt.Errorf("lifecycle notify %s: %s", hn.url, rsp.Status)
+	}
+
+	return
+}
+
+// NewSystemdNotifier 通过sd_notify通知systemd
+// 只有在systemd设置了NOTIFY_SOCKET时才会发送
+func NewSystemdNotifier() LifecycleNotifier {
+	return &systemdNotifier{}
+}
+
+func (sn *systemdNotifier) Notify(event *LifecycleEvent) error {
+	switch event.State {
+	case LifecycleReady:
+		return SdNotify("READY=1\nSTATUS=ready")
+	case LifecycleDraining:
+		return SdNotify("STOPPING=1\nSTATUS=draining")
+	default:
+		return SdNotify("STATUS=" + string(event.State))
+	}
+}
+
+// SdNotify 向systemd发送状态
+// 没有设置NOTIFY_SOCKET时什么也不做
+func SdNotify(state string) (err error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if "" == socket {
+		return
+	}
+
+	var conn *net.UnixConn
+	if conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"}); nil != err {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+
+	return
+}
+
+// notify 通知所有的接收者，接收失败只记录日志
+func notify(e *echo.Echo, ec *EchoConfig, state LifecycleState) {
+	lifecycleState.Store(state)
+
+	event := &LifecycleEvent{
+		State:   state,
+		Time:    time.Now(),
+		Address: ec.Address(),
+		Pid:     os.Getpid(),
+	}
+	for _, notifier := range ec.Notifiers {
+		if err := notifier.Notify(event); nil != err {
+			e.Logger.Error(err)
+		}
+	}
+}
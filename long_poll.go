@@ -0,0 +1,151 @@
+package echox
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// LongPoller 长轮询的等待登记表
+	// 等待在请求自己的协程中进行，不额外创建协程；登记表限制同时等待的请求数
+	LongPoller struct {
+		mutex   sync.Mutex
+		max     int
+		count   int
+		waiters map[string]map[chan interface{}]struct{}
+	}
+
+	// Condition 检查是否已经有数据，返回true时立即响应
+	Condition func() (data interface{}, ready bool, err error)
+)
+
+const (
+	defaultLongPollWaiters = 10000
+	defaultLongPollWait    = 30 * time.Second
+)
+
+var (
+	// ErrTooManyWaiters 等待的请求太多
+	ErrTooManyWaiters = echo.NewHTTPError(http.StatusServiceUnavailable, "等待的请求太多")
+)
+
+// NewLongPoller 创建长轮询登记表，maxWaiters是同时等待的最大请求数
+func NewLongPoller(maxWaiters int) *LongPoller {
+	if 0 >= maxWaiters {
+		maxWaiters = defaultLongPollWaiters
+	}
+
+	return &LongPoller{
+		max:     maxWaiters,
+		waiters: make(map[string]map[chan interface{}]struct{}),
+	}
+}
+
+// Publish 唤醒主题上所有等待的请求，返回唤醒的请求数
+func (lp *LongPoller) Publish(topic string, data interface{}) (count int) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	for waiter := range lp.waiters[topic] {
+		// 每个等待者只接收一次，缓冲为1不会阻塞
+		select {
+		case waiter <- data:
+			count++
+		default:
+		}
+	}
+
+	return
+}
+
+// Wait 等待主题上的数据
+// 有数据时ok为true；超时或者客户端断开时ok为false
+func (lp *LongPoller) Wait(c echo.Context, topic string, maxWait time.Duration, condition Condition) (data interface{}, ok bool, err error) {
+	if 0 >= maxWait {
+		maxWait = defaultLongPollWait
+	}
+
+	// 先登记再检查条件，避免检查和登记之间发布的数据丢失
+	waiter := make(chan interface{}, 1)
+	if err = lp.register(topic, waiter); nil != err {
+		return
+	}
+	defer lp.unregister(topic, waiter)
+
+	if nil != condition {
+		if data, ok, err = condition(); ok || nil != err {
+			return
+		}
+	}
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	select {
+	case data = <-waiter:
+		ok = true
+	case <-timer.C:
+	case <-c.Request().Context().Done():
+	}
+
+	return
+}
+
+// Handle 长轮询处理，有数据时按200返回数据，超时返回204
+func (lp *LongPoller) Handle(c echo.Context, topic string, maxWait time.Duration, condition Condition) error {
+	data, ok, err := lp.Wait(c, topic, maxWait, condition)
+	if ErrTooManyWaiters == err {
+		c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(1))
+	}
+	if nil != err {
+		return err
+	}
+	// 客户端已经断开，不需要响应
+	if nil != c.Request().Context().Err() {
+		return nil
+	}
+	if !ok {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	return Render(c, http.StatusOK, data)
+}
+
+// Waiting 正在等待的请求数
+func (lp *LongPoller) Waiting() int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	return lp.count
+}
+
+func (lp *LongPoller) register(topic string, waiter chan interface{}) error {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	if lp.count >= lp.max {
+		return ErrTooManyWaiters
+	}
+	if _, ok := lp.waiters[topic]; !ok {
+		lp.waiters[topic] = make(map[chan interface{}]struct{})
+	}
+	lp.waiters[topic][waiter] = struct{}{}
+	lp.count++
+
+	return nil
+}
+
+func (lp *LongPoller) unregister(topic string, waiter chan interface{}) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	delete(lp.waiters[topic], waiter)
+	if 0 == len(lp.waiters[topic]) {
+		delete(lp.waiters, topic)
+	}
+	lp.count--
+}
@@ -0,0 +1,64 @@
+package echox
+
+import (
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const memoKey = "echox.memo"
+
+type (
+	// requestMemo 请求内缓存的计算结果
+	requestMemo struct {
+		mutex   sync.Mutex
+		entries map[string]*memoEntry
+	}
+
+	memoEntry struct {
+		once  sync.Once
+		value interface{}
+		err   error
+	}
+)
+
+// Memo 在请求内缓存fn的结果，同一个请求里相同的key只计算一次，错误也会缓存
+// 适合中间件和处理器重复的查询，比如权限和配置
+func (ec *EchoContext) Memo(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return memo(ec.Context, key, fn)
+}
+
+// MemoOf 类型安全的Memo，同一个key要使用同一个类型
+func MemoOf[T any](c echo.Context, key string, fn func() (T, error)) (value T, err error) {
+	var cached interface{}
+	if cached, err = memo(c, key, func() (interface{}, error) {
+		return fn()
+	}); nil == err {
+		value, _ = cached.(T)
+	}
+
+	return
+}
+
+func memo(c echo.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	// 缓存在第一次调用时创建，之后并发调用也是安全的
+	rm, ok := c.Get(memoKey).(*requestMemo)
+	if !ok {
+		rm = &requestMemo{entries: make(map[string]*memoEntry)}
+		c.Set(memoKey, rm)
+	}
+
+	rm.mutex.Lock()
+	entry, ok := rm.entries[key]
+	if !ok {
+		entry = &memoEntry{}
+		rm.entries[key] = entry
+	}
+	rm.mutex.Unlock()
+	// 并发调用时等待同一次计算
+	entry.once.Do(func() {
+		entry.value, entry.err = fn()
+	})
+
+	return entry.value, entry.err
+}
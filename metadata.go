@@ -0,0 +1,211 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// Metadata 资源的元数据
+	Metadata struct {
+		Size         int64     `json:"size"`
+		ContentType  string    `json:"contentType,omitempty"`
+		ETag         string    `json:"etag,omitempty"`
+		LastModified time.Time `json:"lastModified,omitempty"`
+
+		// 元数据来自响应缓存，直接响应时加上X-Cache: HIT
+		cached bool
+	}
+
+	// MetadataFunc 读取请求对应资源的元数据，ok为false时交给处理器
+	MetadataFunc func(c echo.Context) (metadata Metadata, ok bool, err error)
+
+	// MetadataStorage 可以直接读取元数据的存储，不需要读取内容
+	MetadataStorage interface {
+		Metadata(ctx context.Context, key string) (Metadata, error)
+	}
+)
+
+// Head 用元数据直接响应HEAD请求和没有变化的条件GET请求，不执行处理器
+// 用于经常轮询变化的客户端
+// Echo不会把HEAD请求交给GET路由，路由需要同时注册HEAD，可以使用GetWithHead
+func Head(source MetadataFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			if http.MethodHead != method && http.MethodGet != method {
+				return next(c)
+			}
+
+			metadata, ok, err := source(c)
+			if nil != err {
+				return err
+			} else if !ok {
+				return next(c)
+			}
+
+			modified := !NotModified(c, metadata.ETag, metadata.LastModified)
+			if http.MethodGet == method && modified {
+				return next(c)
+			}
+			metadata.header(c.Response().Header())
+			if metadata.cached {
+				c.Response().Header().Set(HeaderXCache, "HIT")
+			}
+			if !modified {
+				return c.NoContent(http.StatusNotModified)
+			}
+
+			return c.NoContent(http.StatusOK)
+		}
+	}
+}
+
+// GetWithHead 用同一个处理器注册GET和HEAD，HEAD请求和没有变化的条件GET请求由元数据直接响应
+// 元数据在传入的中间件之后检查，认证之类的中间件仍然生效
+//
+//	echox.GetWithHead(g, "/files/:id", download, echox.StorageMetadata(storage, key))
+func GetWithHead(g *echo.Group, path string, handler echo.HandlerFunc, source MetadataFunc, m ...echo.MiddlewareFunc) []*echo.Route {
+	middlewares := make([]echo.MiddlewareFunc, 0, len(m)+1)
+	middlewares = append(append(middlewares, m...), Head(source))
+
+	return g.Match([]string{http.MethodGet, http.MethodHead}, path, handler, middlewares...)
+}
+
+// MetadataHandler 以JSON返回资源的元数据
+func MetadataHandler(source MetadataFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		metadata, ok, err := source(c)
+		if nil != err {
+			return err
+		} else if !ok {
+			return echo.ErrNotFound
+		}
+		if NotModified(c, metadata.ETag, metadata.LastModified) {
+			return c.NoContent(http.StatusNotModified)
+		}
+
+		return c.JSON(http.StatusOK, metadata)
+	}
+}
+
+// CacheMetadata 从响应缓存中读取元数据
+func CacheMetadata(store CacheStore, keyFunc CacheKeyFunc) MetadataFunc {
+	if nil == store {
+		store = DefaultCacheStore
+	}
+	if nil == keyFunc {
+		keyFunc = DefaultCacheConfig.KeyFunc
+	}
+
+	return func(c echo.Context) (metadata Metadata, ok bool, err error) {
+		var rsp *CachedResponse
+		if rsp, ok, err = store.Get(keyFunc(c)); nil != err || !ok || http.StatusOK != rsp.Status {
+			ok = false
+			return
+		}
+
+		metadata = Metadata{
+			Size:         int64(len(rsp.Body)),
+			ContentType:  rsp.Header.Get(echo.HeaderContentType),
+			ETag:         rsp.ETag,
+			LastModified: rsp.LastModified,
+			cached:       true,
+		}
+
+		return
+	}
+}
+
+// StorageMetadata 从文件存储中读取元数据，key返回请求对应的文件
+func StorageMetadata(storage MetadataStorage, key func(c echo.Context) string) MetadataFunc {
+	return func(c echo.Context) (metadata Metadata, ok bool, err error) {
+		if metadata, err = storage.Metadata(c.Request().Context(), key(c)); ErrObjectNotFound == err || ErrInvalidKey == err {
+			err = nil
+		} else if nil == err {
+			ok = true
+		}
+
+		return
+	}
+}
+
+func (m Metadata) header(header http.Header) {
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(m.Size, 10))
+	if "" != m.ContentType {
+		header.Set(echo.HeaderContentType, m.ContentType)
+	}
+	if "" != m.ETag {
+		header.Set(HeaderETag, m.ETag)
+	}
+	if !m.LastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, m.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+func (ls *localStorage) Metadata(_ context.Context, key string) (metadata Metadata, err error) {
+	var path string
+	if path, err = ls.path(key); nil != err {
+		return
+	}
+
+	var info os.FileInfo
+	if info, err = os.Stat(path); os.IsNotExist(err) {
+		err = ErrObjectNotFound
+		return
+	} else if nil != err {
+		return
+	}
+	metadata = Metadata{
+		Size:         info.Size(),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+
+	return
+}
+
+func (ss *s3Storage) Metadata(ctx context.Context, key string) (metadata Metadata, err error) {
+	var req *http.Request
+	if req, err = ss.request(ctx, http.MethodHead, key, nil); nil != err {
+		return
+	}
+
+	var rsp *http.Response
+	if rsp, err = ss.do(req); nil != err {
+		return
+	}
+	_ = rsp.Body.Close()
+
+	metadata = Metadata{
+		Size:        rsp.ContentLength,
+		ContentType: rsp.Header.Get(echo.HeaderContentType),
+		ETag:        rsp.Header.Get(HeaderETag),
+	}
+	if lastModified, parseErr := http.ParseTime(rsp.Header.Get(echo.HeaderLastModified)); nil == parseErr {
+		metadata.LastModified = lastModified
+	}
+
+	return
+}
+
+// Metadata 内容地址的内容不会变化，用哈希作为ETag
+func (cs *ContentStore) Metadata(ctx context.Context, key string) (metadata Metadata, err error) {
+	var object StoredObject
+	if object, _, err = cs.Stat(ctx, key); nil != err {
+		return
+	}
+	metadata = Metadata{
+		Size:        object.Size,
+		ContentType: object.ContentType,
+		ETag:        `"` + key + `"`,
+	}
+
+	return
+}
@@ -0,0 +1,610 @@
+package echox
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/storezhang/gox"
+)
+
+// MetricsOther 超出基数限制或者未知的标签值
+const MetricsOther = "other"
+
+type (
+	// MetricsConfig 指标配置
+	MetricsConfig struct {
+		// 跳过统计
+		Skipper middleware.Skipper
+
+		// 暴露Prometheus指标的路径，Recorder不是默认实现时不暴露
+		// 非必须 默认值是"/metrics"
+		Path string
+
+		// 每个标签最多的取值个数，超出后归为"other"
+		// 非必须 默认值是200
+		MaxLabelValues int
+
+		// 耗时分布的桶，单位是秒
+		// 非必须
+		Buckets []float64
+
+		// 指标记录器
+		// 非必须 默认是内存中的Prometheus实现
+		Recorder MetricsRecorder
+	}
+
+	// RequestLabels 请求指标的标签
+	RequestLabels struct {
+		Method string
+		Route  string
+		Status string
+		Region string
+		Tenant string
+	}
+
+	// MetricsRecorder 指标记录器，可以对接其它的指标系统
+	MetricsRecorder interface {
+		ObserveRequest(labels RequestLabels, duration time.Duration)
+	}
+
+	// PrometheusRecorder 内存中的Prometheus指标
+	PrometheusRecorder struct {
+		mutex     sync.Mutex
+		buckets   []float64
+		constant  string
+		histogram map[RequestLabels]*histogram
+		resources map[string]*resourceUsage
+		queries   map[string]*queryUsage
+		clients   map[clientLabels]*histogram
+		sockets   map[socketLabels]uint64
+		cronRuns  map[cronLabels]uint64
+		cronTimes map[string]*histogram
+		compress  map[compressionLabels]*compressionUsage
+	}
+
+	// compressionLabels 响应压缩的指标标签
+	compressionLabels struct {
+		Encoding string
+		Type     string
+	}
+
+	compressionUsage struct {
+		count uint64
+		in    int64
+		out   int64
+	}
+
+	// cronLabels 定时任务的指标标签
+	cronLabels struct {
+		Job    string
+		Status string
+	}
+
+	// socketLabels WebSocket的指标标签
+	socketLabels struct {
+		Route string
+		Event string
+	}
+
+	// clientLabels 调用下游的指标标签
+	clientLabels struct {
+		Service string
+		RequestLabels
+	}
+
+	queryUsage struct {
+		count uint64
+		sum   int64
+	}
+
+	resourceUsage struct {
+		cpu   float64
+		alloc uint64
+	}
+
+	histogram struct {
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+
+	// cardinalityGuard 限制标签的取值个数
+	cardinalityGuard struct {
+		mutex  sync.RWMutex
+		max    int
+		values map[string]struct{}
+	}
+)
+
+var (
+	// DefaultMetricsConfig 默认配置
+	DefaultMetricsConfig = MetricsConfig{
+		Skipper:        middleware.DefaultSkipper,
+		Path:           "/metrics",
+		MaxLabelValues: 200,
+		Buckets:        []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}
+
+	// idSegment 路径中的ID，比如数字、UUID和长的十六进制串
+	idSegment = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+	knownMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+	}
+)
+
+// NormalizePath 把路径中的ID替换成":id"
+func NormalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// NewPrometheusRecorder 创建Prometheus指标，constant是每个指标都带上的标签
+func NewPrometheusRecorder(buckets []float64, constant map[string]string) *PrometheusRecorder {
+	if 0 == len(buckets) {
+		buckets = DefaultMetricsConfig.Buckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	names := make([]string, 0, len(constant))
+	for name := range constant {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(constant[name])))
+	}
+
+	return &PrometheusRecorder{
+		buckets:   sorted,
+		constant:  strings.Join(pairs, ","),
+		histogram: make(map[RequestLabels]*histogram),
+		resources: make(map[string]*resourceUsage),
+		queries:   make(map[string]*queryUsage),
+		clients:   make(map[clientLabels]*histogram),
+		sockets:   make(map[socketLabels]uint64),
+		cronRuns:  make(map[cronLabels]uint64),
+		cronTimes: make(map[string]*histogram),
+		compress:  make(map[compressionLabels]*compressionUsage),
+	}
+}
+
+func (pr *PrometheusRecorder) ObserveRequest(labels RequestLabels, duration time.Duration) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	h, ok := pr.histogram[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(pr.buckets))}
+		pr.histogram[labels] = h
+	}
+	h.observe(pr.buckets, duration)
+}
+
+func (pr *PrometheusRecorder) ObserveClient(service string, labels RequestLabels, duration time.Duration) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	key := clientLabels{Service: service, RequestLabels: labels}
+	h, ok := pr.clients[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(pr.buckets))}
+		pr.clients[key] = h
+	}
+	h.observe(pr.buckets, duration)
+}
+
+func (pr *PrometheusRecorder) ObserveWebSocket(route string, event string) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.sockets[socketLabels{Route: route, Event: event}]++
+}
+
+func (pr *PrometheusRecorder) ObserveCron(job string, status string, duration time.Duration) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.cronRuns[cronLabels{Job: job, Status: status}]++
+	// 跳过的执行没有耗时
+	if "skipped" == status {
+		return
+	}
+	h, ok := pr.cronTimes[job]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(pr.buckets))}
+		pr.cronTimes[job] = h
+	}
+	h.observe(pr.buckets, duration)
+}
+
+func (pr *PrometheusRecorder) ObserveCompression(encoding string, contentType string, in int64, out int64) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	key := compressionLabels{Encoding: encoding, Type: contentType}
+	usage, ok := pr.compress[key]
+	if !ok {
+		usage = &compressionUsage{}
+		pr.compress[key] = usage
+	}
+	usage.count++
+	usage.in += in
+	usage.out += out
+}
+
+func (pr *PrometheusRecorder) ObserveResources(route string, cpu time.Duration, allocBytes uint64) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	usage, ok := pr.resources[route]
+	if !ok {
+		usage = &resourceUsage{}
+		pr.resources[route] = usage
+	}
+	usage.cpu += cpu.Seconds()
+	usage.alloc += allocBytes
+}
+
+func (pr *PrometheusRecorder) ObserveQueries(route string, count int64) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	usage, ok := pr.queries[route]
+	if !ok {
+		usage = &queryUsage{}
+		pr.queries[route] = usage
+	}
+	usage.count++
+	usage.sum += count
+}
+
+// ServeHTTP 按Prometheus文本格式输出
+func (pr *PrometheusRecorder) ServeHTTP(rsp http.ResponseWriter, _ *http.Request) {
+	pr.mutex.Lock()
+	keys := make([]RequestLabels, 0, len(pr.histogram))
+	for key := range pr.histogram {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Route+keys[i].Method+keys[i].Status < keys[j].Route+keys[j].Method+keys[j].Status
+	})
+
+	var sb strings.Builder
+	sb.WriteString("# TYPE http_requests_total counter\n")
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("http_requests_total{%s} %d\n", pr.labels(key), pr.histogram[key].count))
+	}
+	sb.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		h := pr.histogram[key]
+		labels := pr.labels(key)
+		for i, bucket := range pr.buckets {
+			le := strconv.FormatFloat(bucket, 'g', -1, 64)
+			sb.WriteString(fmt.Sprintf("http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, le, h.counts[i]))
+		}
+		sb.WriteString(fmt.Sprintf("http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count))
+		sb.WriteString(fmt.Sprintf("http_request_duration_seconds_sum{%s} %g\n", labels, h.sum))
+		sb.WriteString(fmt.Sprintf("http_request_duration_seconds_count{%s} %d\n", labels, h.count))
+	}
+	if 0 != len(pr.clients) {
+		clients := make([]clientLabels, 0, len(pr.clients))
+		for key := range pr.clients {
+			clients = append(clients, key)
+		}
+		sort.Slice(clients, func(i, j int) bool {
+			return clients[i].Service+clients[i].Route+clients[i].Method+clients[i].Status <
+				clients[j].Service+clients[j].Route+clients[j].Method+clients[j].Status
+		})
+
+		sb.WriteString("# TYPE http_client_requests_total counter\n")
+		for _, key := range clients {
+			sb.WriteString(fmt.Sprintf("http_client_requests_total{%s} %d\n", pr.clientLabels(key), pr.clients[key].count))
+		}
+		sb.WriteString("# TYPE http_client_request_duration_seconds histogram\n")
+		for _, key := range clients {
+			h := pr.clients[key]
+			labels := pr.clientLabels(key)
+			for i, bucket := range pr.buckets {
+				le := strconv.FormatFloat(bucket, 'g', -1, 64)
+				sb.WriteString(fmt.Sprintf("http_client_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, le, h.counts[i]))
+			}
+			sb.WriteString(fmt.Sprintf("http_client_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count))
+			sb.WriteString(fmt.Sprintf("http_client_request_duration_seconds_sum{%s} %g\n", labels, h.sum))
+			sb.WriteString(fmt.Sprintf("http_client_request_duration_seconds_count{%s} %d\n", labels, h.count))
+		}
+	}
+	if 0 != len(pr.sockets) {
+		sockets := make([]socketLabels, 0, len(pr.sockets))
+		active := make(map[string]int64)
+		for key, count := range pr.sockets {
+			sockets = append(sockets, key)
+			switch key.Event {
+			case WSEventConnected:
+				active[key.Route] += int64(count)
+			case WSEventClosed:
+				active[key.Route] -= int64(count)
+			}
+		}
+		sort.Slice(sockets, func(i, j int) bool {
+			return sockets[i].Route+sockets[i].Event < sockets[j].Route+sockets[j].Event
+		})
+		routes := make([]string, 0, len(active))
+		for route := range active {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+
+		sb.WriteString("# TYPE websocket_connections gauge\n")
+		for _, route := range routes {
+			sb.WriteString(fmt.Sprintf("websocket_connections{%s} %d\n", pr.routeLabels(route), active[route]))
+		}
+		sb.WriteString("# TYPE websocket_events_total counter\n")
+		for _, key := range sockets {
+			labels := pr.routeLabels(key.Route) + fmt.Sprintf(`,event="%s"`, escapeLabel(key.Event))
+			sb.WriteString(fmt.Sprintf("websocket_events_total{%s} %d\n", labels, pr.sockets[key]))
+		}
+	}
+	if 0 != len(pr.cronRuns) {
+		runs := make([]cronLabels, 0, len(pr.cronRuns))
+		for key := range pr.cronRuns {
+			runs = append(runs, key)
+		}
+		sort.Slice(runs, func(i, j int) bool {
+			return runs[i].Job+runs[i].Status < runs[j].Job+runs[j].Status
+		})
+		jobs := make([]string, 0, len(pr.cronTimes))
+		for job := range pr.cronTimes {
+			jobs = append(jobs, job)
+		}
+		sort.Strings(jobs)
+
+		sb.WriteString("# TYPE cron_job_runs_total counter\n")
+		for _, key := range runs {
+			sb.WriteString(fmt.Sprintf("cron_job_runs_total{%s,status=\"%s\"} %d\n", pr.jobLabels(key.Job), escapeLabel(key.Status), pr.cronRuns[key]))
+		}
+		sb.WriteString("# TYPE cron_job_duration_seconds histogram\n")
+		for _, job := range jobs {
+			h := pr.cronTimes[job]
+			labels := pr.jobLabels(job)
+			for i, bucket := range pr.buckets {
+				le := strconv.FormatFloat(bucket, 'g', -1, 64)
+				sb.WriteString(fmt.Sprintf("cron_job_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, le, h.counts[i]))
+			}
+			sb.WriteString(fmt.Sprintf("cron_job_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count))
+			sb.WriteString(fmt.Sprintf("cron_job_duration_seconds_sum{%s} %g\n", labels, h.sum))
+			sb.WriteString(fmt.Sprintf("cron_job_duration_seconds_count{%s} %d\n", labels, h.count))
+		}
+	}
+	if 0 != len(pr.compress) {
+		keys := make([]compressionLabels, 0, len(pr.compress))
+		for key := range pr.compress {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Encoding+keys[i].Type < keys[j].Encoding+keys[j].Type
+		})
+
+		sb.WriteString("# TYPE http_response_compressed_total counter\n")
+		for _, key := range keys {
+			sb.WriteString(fmt.Sprintf("http_response_compressed_total{%s} %d\n", pr.compressionLabels(key), pr.compress[key].count))
+		}
+		// 压缩率是压缩后的大小除以压缩前的大小
+		sb.WriteString("# TYPE http_response_compression_in_bytes_total counter\n")
+		for _, key := range keys {
+			sb.WriteString(fmt.Sprintf("http_response_compression_in_bytes_total{%s} %d\n", pr.compressionLabels(key), pr.compress[key].in))
+		}
+		sb.WriteString("# TYPE http_response_compression_out_bytes_total counter\n")
+		for _, key := range keys {
+			sb.WriteString(fmt.Sprintf("http_response_compression_out_bytes_total{%s} %d\n", pr.compressionLabels(key), pr.compress[key].out))
+		}
+	}
+	if 0 != len(pr.resources) {
+		routes := make([]string, 0, len(pr.resources))
+		for route := range pr.resources {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+
+		sb.WriteString("# TYPE http_request_sampled_cpu_seconds_total counter\n")
+		for _, route := range routes {
+			sb.WriteString(fmt.Sprintf("http_request_sampled_cpu_seconds_total{%s} %g\n", pr.routeLabels(route), pr.resources[route].cpu))
+		}
+		sb.WriteString("# TYPE http_request_sampled_alloc_bytes_total counter\n")
+		for _, route := range routes {
+			sb.WriteString(fmt.Sprintf("http_request_sampled_alloc_bytes_total{%s} %d\n", pr.routeLabels(route), pr.resources[route].alloc))
+		}
+	}
+	if 0 != len(pr.queries) {
+		routes := make([]string, 0, len(pr.queries))
+		for route := range pr.queries {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+
+		sb.WriteString("# TYPE http_request_db_queries summary\n")
+		for _, route := range routes {
+			labels := pr.routeLabels(route)
+			sb.WriteString(fmt.Sprintf("http_request_db_queries_sum{%s} %d\n", labels, pr.queries[route].sum))
+			sb.WriteString(fmt.Sprintf("http_request_db_queries_count{%s} %d\n", labels, pr.queries[route].count))
+		}
+	}
+	pr.mutex.Unlock()
+
+	rsp.Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	rsp.WriteHeader(http.StatusOK)
+	_, _ = rsp.Write([]byte(sb.String()))
+}
+
+func (pr *PrometheusRecorder) labels(key RequestLabels) string {
+	labels := fmt.Sprintf(`method="%s",route="%s",status="%s"`,
+		escapeLabel(key.Method), escapeLabel(key.Route), escapeLabel(key.Status))
+	if "" != key.Region {
+		labels += fmt.Sprintf(`,region="%s"`, escapeLabel(key.Region))
+	}
+	if "" != key.Tenant {
+		labels += fmt.Sprintf(`,tenant="%s"`, escapeLabel(key.Tenant))
+	}
+	if "" != pr.constant {
+		labels = pr.constant + "," + labels
+	}
+
+	return labels
+}
+
+func (pr *PrometheusRecorder) clientLabels(key clientLabels) string {
+	return fmt.Sprintf(`service="%s",`, escapeLabel(key.Service)) + pr.labels(key.RequestLabels)
+}
+
+func (pr *PrometheusRecorder) routeLabels(route string) string {
+	labels := fmt.Sprintf(`route="%s"`, escapeLabel(route))
+	if "" != pr.constant {
+		labels = pr.constant + "," + labels
+	}
+
+	return labels
+}
+
+func (pr *PrometheusRecorder) compressionLabels(key compressionLabels) string {
+	labels := fmt.Sprintf(`encoding="%s",type="%s"`, escapeLabel(key.Encoding), escapeLabel(key.Type))
+	if "" != pr.constant {
+		labels = pr.constant + "," + labels
+	}
+
+	return labels
+}
+
+// jobLabels 不用job作为标签名，避免和Prometheus抓取时的job冲突
+func (pr *PrometheusRecorder) jobLabels(job string) string {
+	labels := fmt.Sprintf(`name="%s"`, escapeLabel(job))
+	if "" != pr.constant {
+		labels = pr.constant + "," + labels
+	}
+
+	return labels
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func (cg *cardinalityGuard) guard(value string) string {
+	cg.mutex.RLock()
+	_, ok := cg.values[value]
+	cg.mutex.RUnlock()
+	if ok {
+		return value
+	}
+
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+	if _, ok = cg.values[value]; ok {
+		return value
+	}
+	if len(cg.values) >= cg.max {
+		return MetricsOther
+	}
+	cg.values[value] = struct{}{}
+
+	return value
+}
+
+// mount 注册指标接口和中间件，返回使用的指标记录器
+func (mc MetricsConfig) mount(e *echo.Echo) MetricsRecorder {
+	if nil == mc.Skipper {
+		mc.Skipper = DefaultMetricsConfig.Skipper
+	}
+	if "" == mc.Path {
+		mc.Path = DefaultMetricsConfig.Path
+	}
+	if 0 >= mc.MaxLabelValues {
+		mc.MaxLabelValues = DefaultMetricsConfig.MaxLabelValues
+	}
+	if nil == mc.Recorder {
+		mc.Recorder = NewPrometheusRecorder(mc.Buckets, Instance().Labels())
+	}
+	if handler, ok := mc.Recorder.(http.Handler); ok {
+		e.GET(mc.Path, echo.WrapHandler(handler))
+	}
+
+	routes := &cardinalityGuard{max: mc.MaxLabelValues, values: make(map[string]struct{})}
+	tenants := &cardinalityGuard{max: mc.MaxLabelValues, values: make(map[string]struct{})}
+	// 区域来自客户端的请求头，和租户一样限制取值个数
+	regions := &cardinalityGuard{max: mc.MaxLabelValues, values: make(map[string]struct{})}
+	var once sync.Once
+	registered := make(map[string]struct{})
+
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if mc.Skipper(c) || mc.Path == c.Path() {
+				return next(c)
+			}
+
+			start := time.Now()
+			err = next(c)
+
+			// 路由在启动后不再变化，第一次请求时收集
+			once.Do(func() {
+				for _, route := range e.Routes() {
+					registered[route.Path] = struct{}{}
+				}
+			})
+
+			method := c.Request().Method
+			if found, _ := gox.IsInArray(method, knownMethods); !found {
+				method = MetricsOther
+			}
+			route := MetricsOther
+			if _, ok := registered[c.Path()]; ok {
+				route = routes.guard(NormalizePath(c.Path()))
+			}
+			tenant := TenantOf(c)
+			if "" != tenant {
+				tenant = tenants.guard(tenant)
+			}
+			region := RegionOf(c)
+			if "" != region {
+				region = regions.guard(region)
+			}
+			mc.Recorder.ObserveRequest(RequestLabels{
+				Method: method,
+				Route:  route,
+				Status: strconv.Itoa(statusOf(c, err)),
+				Region: region,
+				Tenant: tenant,
+			}, time.Since(start))
+
+			return
+		}
+	})
+
+	return mc.Recorder
+}
+
+func (h *histogram) observe(buckets []float64, duration time.Duration) {
+	seconds := duration.Seconds()
+	for i, bucket := range buckets {
+		if seconds <= bucket {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
@@ -0,0 +1,399 @@
+package echox
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// MarshalMsgpack 把数据编码成MessagePack
+// 字段名和JSON一致，实现了json.Marshaler的类型先转换成JSON再编码
+func MarshalMsgpack(data interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if err := encodeMsgpackValue(buffer, reflect.ValueOf(data)); nil != err {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func encodeMsgpackValue(buffer *bytes.Buffer, value reflect.Value) (err error) {
+	if !value.IsValid() {
+		buffer.WriteByte(0xc0)
+
+		return
+	}
+	if reflect.Ptr == value.Kind() || reflect.Interface == value.Kind() {
+		if value.IsNil() {
+			buffer.WriteByte(0xc0)
+
+			return
+		}
+	}
+
+	switch {
+	case value.Type().Implements(jsonMarshalerType):
+		return encodeMsgpackJSON(buffer, value.Interface().(json.Marshaler))
+	case value.Type().Implements(textMarshalerType):
+		var text []byte
+		if text, err = value.Interface().(encoding.TextMarshaler).MarshalText(); nil != err {
+			return
+		}
+		encodeMsgpackString(buffer, string(text))
+
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		err = encodeMsgpackValue(buffer, value.Elem())
+	case reflect.Bool:
+		if value.Bool() {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgpackInt(buffer, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		buffer.WriteByte(0xcf)
+		binary.Write(buffer, binary.BigEndian, value.Uint())
+	case reflect.Float32:
+		buffer.WriteByte(0xca)
+		binary.Write(buffer, binary.BigEndian, math.Float32bits(float32(value.Float())))
+	case reflect.Float64:
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(value.Float()))
+	case reflect.String:
+		encodeMsgpackString(buffer, value.String())
+	case reflect.Slice, reflect.Array:
+		if reflect.Slice == value.Kind() && value.IsNil() {
+			buffer.WriteByte(0xc0)
+		} else if reflect.Uint8 == value.Type().Elem().Kind() {
+			encodeMsgpackBytes(buffer, value)
+		} else {
+			encodeMsgpackLength(buffer, value.Len(), 0x90, 0xdc, 0xdd)
+			for i := 0; i < value.Len() && nil == err; i++ {
+				err = encodeMsgpackValue(buffer, value.Index(i))
+			}
+		}
+	case reflect.Map:
+		err = encodeMsgpackMap(buffer, value)
+	case reflect.Struct:
+		err = encodeMsgpackStruct(buffer, value)
+	default:
+		err = fmt.Errorf("msgpack: unsupported type %s", value.Type())
+	}
+
+	return
+}
+
+func encodeMsgpackJSON(buffer *bytes.Buffer, marshaler json.Marshaler) (err error) {
+	var data []byte
+	if data, err = marshaler.MarshalJSON(); nil != err {
+		return
+	}
+
+	var value interface{}
+	if err = json.Unmarshal(data, &value); nil != err {
+		return
+	}
+
+	return encodeMsgpackValue(buffer, reflect.ValueOf(value))
+}
+
+func encodeMsgpackInt(buffer *bytes.Buffer, value int64) {
+	switch {
+	case 0 <= value && value <= 0x7f:
+		buffer.WriteByte(byte(value))
+	case -32 <= value && value < 0:
+		buffer.WriteByte(byte(int8(value)))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, value)
+	}
+}
+
+func encodeMsgpackString(buffer *bytes.Buffer, value string) {
+	if len(value) < 32 {
+		buffer.WriteByte(0xa0 | byte(len(value)))
+	} else {
+		encodeMsgpackLength(buffer, len(value), 0, 0xda, 0xdb)
+	}
+	buffer.WriteString(value)
+}
+
+func encodeMsgpackBytes(buffer *bytes.Buffer, value reflect.Value) {
+	length := value.Len()
+	switch {
+	case length <= math.MaxUint8:
+		buffer.WriteByte(0xc4)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(0xc5)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(0xc6)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+	for i := 0; i < length; i++ {
+		buffer.WriteByte(byte(value.Index(i).Uint()))
+	}
+}
+
+// encodeMsgpackLength 写数组、映射或者字符串的长度
+// fix为0表示没有短格式
+func encodeMsgpackLength(buffer *bytes.Buffer, length int, fix byte, code16 byte, code32 byte) {
+	switch {
+	case 0 != fix && length < 16:
+		buffer.WriteByte(fix | byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(code16)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(code32)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+func encodeMsgpackMap(buffer *bytes.Buffer, value reflect.Value) (err error) {
+	if value.IsNil() {
+		buffer.WriteByte(0xc0)
+
+		return
+	}
+
+	keys := value.MapKeys()
+	// 按键排序，保证输出稳定
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	encodeMsgpackLength(buffer, len(keys), 0x80, 0xde, 0xdf)
+	for _, key := range keys {
+		if err = encodeMsgpackValue(buffer, key); nil != err {
+			return
+		}
+		if err = encodeMsgpackValue(buffer, value.MapIndex(key)); nil != err {
+			return
+		}
+	}
+
+	return
+}
+
+func encodeMsgpackStruct(buffer *bytes.Buffer, value reflect.Value) (err error) {
+	names := make([]string, 0, value.NumField())
+	fields := make([]reflect.Value, 0, value.NumField())
+	collectMsgpackFields(value, &names, &fields)
+
+	encodeMsgpackLength(buffer, len(names), 0x80, 0xde, 0xdf)
+	for i, name := range names {
+		encodeMsgpackString(buffer, name)
+		if err = encodeMsgpackValue(buffer, fields[i]); nil != err {
+			return
+		}
+	}
+
+	return
+}
+
+func collectMsgpackFields(value reflect.Value, names *[]string, fields *[]reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if "" != field.PkgPath && !field.Anonymous {
+			continue
+		}
+
+		name, omit := jsonName(field)
+		if omit {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if field.Anonymous && "" == field.Tag.Get("json") && reflect.Struct == fieldValue.Kind() {
+			collectMsgpackFields(fieldValue, names, fields)
+			continue
+		}
+		if "" != field.PkgPath {
+			continue
+		}
+		if hasRule(field.Tag.Get("json"), "omitempty") && fieldValue.IsZero() {
+			continue
+		}
+
+		*names = append(*names, name)
+		*fields = append(*fields, fieldValue)
+	}
+}
+
+// UnmarshalMsgpack 把MessagePack解码到v
+// 先解码成通用的值再按JSON转换，字段名和MarshalMsgpack一致
+func UnmarshalMsgpack(data []byte, v interface{}) (err error) {
+	reader := bytes.NewReader(data)
+	var value interface{}
+	if value, err = decodeMsgpackValue(reader); nil != err {
+		return
+	}
+	if 0 != reader.Len() {
+		return errors.New("msgpack: 数据后面有多余的字节")
+	}
+
+	var encoded []byte
+	if encoded, err = json.Marshal(value); nil != err {
+		return
+	}
+
+	return json.Unmarshal(encoded, v)
+}
+
+func decodeMsgpackValue(reader *bytes.Reader) (value interface{}, err error) {
+	var code byte
+	if code, err = reader.ReadByte(); nil != err {
+		return
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return decodeMsgpackString(reader, int(code&0x1f))
+	case code&0xf0 == 0x90:
+		return decodeMsgpackArray(reader, int(code&0x0f))
+	case code&0xf0 == 0x80:
+		return decodeMsgpackMap(reader, int(code&0x0f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		var number uint64
+		number, err = readMsgpackUint(reader, 1<<(code-0xcc))
+		return number, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		var number uint64
+		if number, err = readMsgpackUint(reader, size); nil != err {
+			return
+		}
+		// 按位数做符号扩展
+		shift := 64 - 8*uint(size)
+		return int64(number<<shift) >> shift, nil
+	case 0xca:
+		var bits uint64
+		bits, err = readMsgpackUint(reader, 4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		var bits uint64
+		bits, err = readMsgpackUint(reader, 8)
+		return math.Float64frombits(bits), err
+	case 0xd9, 0xda, 0xdb:
+		var length uint64
+		if length, err = readMsgpackUint(reader, 1<<(code-0xd9)); nil != err {
+			return
+		}
+		return decodeMsgpackString(reader, int(length))
+	case 0xc4, 0xc5, 0xc6:
+		var length uint64
+		if length, err = readMsgpackUint(reader, 1<<(code-0xc4)); nil != err {
+			return
+		}
+		return readMsgpackBytes(reader, int(length))
+	case 0xdc, 0xdd:
+		var length uint64
+		if length, err = readMsgpackUint(reader, 2<<(code-0xdc)); nil != err {
+			return
+		}
+		return decodeMsgpackArray(reader, int(length))
+	case 0xde, 0xdf:
+		var length uint64
+		if length, err = readMsgpackUint(reader, 2<<(code-0xde)); nil != err {
+			return
+		}
+		return decodeMsgpackMap(reader, int(length))
+	default:
+		return nil, fmt.Errorf("msgpack: 不支持的类型0x%x", code)
+	}
+}
+
+func readMsgpackUint(reader *bytes.Reader, size int) (number uint64, err error) {
+	var data []byte
+	if data, err = readMsgpackBytes(reader, size); nil != err {
+		return
+	}
+	for _, b := range data {
+		number = number<<8 | uint64(b)
+	}
+
+	return
+}
+
+// readMsgpackBytes 长度来自数据本身，先检查剩余的字节数，避免恶意的长度导致分配大量内存
+func readMsgpackBytes(reader *bytes.Reader, length int) (data []byte, err error) {
+	if length > reader.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data = make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+
+	return
+}
+
+func decodeMsgpackString(reader *bytes.Reader, length int) (value interface{}, err error) {
+	var data []byte
+	if data, err = readMsgpackBytes(reader, length); nil != err {
+		return
+	}
+
+	return string(data), nil
+}
+
+func decodeMsgpackArray(reader *bytes.Reader, length int) (value interface{}, err error) {
+	if length > reader.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	values := make([]interface{}, length)
+	for i := range values {
+		if values[i], err = decodeMsgpackValue(reader); nil != err {
+			return
+		}
+	}
+
+	return values, nil
+}
+
+func decodeMsgpackMap(reader *bytes.Reader, length int) (value interface{}, err error) {
+	if length > reader.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	values := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		var key, item interface{}
+		if key, err = decodeMsgpackValue(reader); nil != err {
+			return
+		}
+		if item, err = decodeMsgpackValue(reader); nil != err {
+			return
+		}
+		values[fmt.Sprint(key)] = item
+	}
+
+	return values, nil
+}
@@ -0,0 +1,116 @@
+package echox
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// MultipartMixed 多个不同类型的内容，比如JSON清单加上附件
+	MultipartMixed = "mixed"
+	// MultipartByteRanges 多个范围请求的内容
+	MultipartByteRanges = "byteranges"
+)
+
+type (
+	// MultipartWriter 流式写出multipart响应，每写完一个部分就发给客户端
+	//
+	//	mw, err := echox.NewMultipartWriter(c, http.StatusOK, echox.MultipartMixed)
+	//	mw.JSON(manifest)
+	//	mw.Attachment("application/pdf", "report.pdf", file)
+	//	return mw.Close()
+	MultipartWriter struct {
+		c      echo.Context
+		writer *multipart.Writer
+	}
+)
+
+// NewMultipartWriter 写出响应头，subtype是mixed或者byteranges，分隔符随机生成
+func NewMultipartWriter(c echo.Context, code int, subtype string) (mw *MultipartWriter, err error) {
+	if MultipartMixed != subtype && MultipartByteRanges != subtype {
+		return nil, fmt.Errorf("不支持的multipart类型：%s", subtype)
+	}
+
+	rsp := c.Response()
+	writer := multipart.NewWriter(rsp)
+	rsp.Header().Set(echo.HeaderContentType, "multipart/"+subtype+"; boundary="+writer.Boundary())
+	rsp.Header().Del(echo.HeaderContentLength)
+	rsp.WriteHeader(code)
+	mw = &MultipartWriter{c: c, writer: writer}
+
+	return
+}
+
+// Part 开始一个部分，返回这个部分的写入器，下一次调用Part时结束
+func (mw *MultipartWriter) Part(header textproto.MIMEHeader) (io.Writer, error) {
+	// 先把上一个部分发给客户端
+	mw.c.Response().Flush()
+
+	return mw.writer.CreatePart(header)
+}
+
+// JSON 写出一个JSON部分
+func (mw *MultipartWriter) JSON(v interface{}) (err error) {
+	var data []byte
+	if data, err = marshalJSON(jsonSerializer, v, ""); nil != err {
+		return
+	}
+
+	var part io.Writer
+	if part, err = mw.Part(textproto.MIMEHeader{echo.HeaderContentType: {echo.MIMEApplicationJSONCharsetUTF8}}); nil != err {
+		return
+	}
+	_, err = part.Write(data)
+
+	return
+}
+
+// Attachment 写出一个附件，name是客户端保存时的文件名
+func (mw *MultipartWriter) Attachment(contentType string, name string, reader io.Reader) (err error) {
+	header := textproto.MIMEHeader{echo.HeaderContentType: {contentType}}
+	if "" != name {
+		header.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename=%q`, name))
+	}
+
+	var part io.Writer
+	if part, err = mw.Part(header); nil != err {
+		return
+	}
+	_, err = io.Copy(part, reader)
+
+	return
+}
+
+// Range 写出一个范围，start和end都包含在内，total是完整内容的大小，未知时传-1
+func (mw *MultipartWriter) Range(contentType string, start int64, end int64, total int64, reader io.Reader) (err error) {
+	size := "*"
+	if 0 <= total {
+		size = strconv.FormatInt(total, 10)
+	}
+	header := textproto.MIMEHeader{
+		echo.HeaderContentType: {contentType},
+		"Content-Range":        {fmt.Sprintf("bytes %d-%d/%s", start, end, size)},
+	}
+
+	var part io.Writer
+	if part, err = mw.Part(header); nil != err {
+		return
+	}
+	_, err = io.CopyN(part, reader, end-start+1)
+
+	return
+}
+
+// Close 写出结束的分隔符
+func (mw *MultipartWriter) Close() (err error) {
+	if err = mw.writer.Close(); nil == err {
+		mw.c.Response().Flush()
+	}
+
+	return
+}
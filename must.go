@@ -0,0 +1,95 @@
+package echox
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// statusCoder 可以指定状态码的错误
+	statusCoder interface {
+		StatusCode() int
+	}
+
+	// codeError 带状态码和错误码的错误
+	codeError struct {
+		status  int
+		code    int
+		message string
+		data    interface{}
+		cause   error
+	}
+)
+
+// NewError 创建统一处理的错误，status是HTTP状态码，code是错误码
+func NewError(status int, code int, message string, data ...interface{}) Error {
+	ce := &codeError{status: status, code: code, message: message}
+	if 0 != len(data) {
+		ce.data = data[0]
+	}
+
+	return ce
+}
+
+// Must err不为空时转换成统一的错误，code同时作为状态码和错误码
+// 原始错误只写日志，不返回给客户端
+//
+//	if err := echox.Must(c, service.Do(), http.StatusBadGateway); nil != err {
+//		return err
+//	}
+func Must(c echo.Context, err error, code int) error {
+	if nil == err {
+		return nil
+	}
+	// 已经是统一处理的错误时保持原样
+	switch err.(type) {
+	case *echo.HTTPError, Error:
+		return err
+	}
+
+	c.Logger().Error(err)
+
+	return &codeError{status: code, code: code, message: http.StatusText(code), cause: err}
+}
+
+// Require 条件不满足时返回统一的错误
+//
+//	if err := echox.Require(0 < id, http.StatusBadRequest, "编号不合法"); nil != err {
+//		return err
+//	}
+func Require(cond bool, code int, message string) error {
+	if cond {
+		return nil
+	}
+
+	return &codeError{status: code, code: code, message: message}
+}
+
+func (ce *codeError) Error() string {
+	if nil != ce.cause {
+		return ce.message + ": " + ce.cause.Error()
+	}
+
+	return ce.message
+}
+
+func (ce *codeError) ErrorCode() int {
+	return ce.code
+}
+
+func (ce *codeError) Message() string {
+	return ce.message
+}
+
+func (ce *codeError) Data() interface{} {
+	return ce.data
+}
+
+func (ce *codeError) StatusCode() int {
+	return ce.status
+}
+
+func (ce *codeError) Unwrap() error {
+	return ce.cause
+}
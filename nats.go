@@ -0,0 +1,249 @@
+package echox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// NATSConfig NATS连接的配置
+	NATSConfig struct {
+		// 地址
+		// 非必须 默认值是"localhost:4222"
+		Address string
+
+		// 用户名和密码
+		User     string
+		Password string
+
+		// 令牌
+		Token string
+
+		// TLS的配置，为空时不加密，ServerName为空时使用地址中的主机名
+		TLS *tls.Config
+
+		// 连接的超时时间
+		// 非必须 默认值是5秒
+		Timeout time.Duration
+	}
+
+	// NATS 精简的NATS客户端，只支持发布和订阅
+	// 断线后由调用方重新连接，订阅的后台任务会重试
+	NATS struct {
+		config NATSConfig
+		mutex  sync.Mutex
+		conn   *natsConn
+	}
+
+	natsConn struct {
+		conn   net.Conn
+		reader *bufio.Reader
+	}
+)
+
+// DefaultNATSConfig 默认配置
+var DefaultNATSConfig = NATSConfig{
+	Address: "localhost:4222",
+	Timeout: 5 * time.Second,
+}
+
+// NewNATS 创建NATS客户端，连接在第一次使用时建立
+func NewNATS(config NATSConfig) *NATS {
+	if "" == config.Address {
+		config.Address = DefaultNATSConfig.Address
+	}
+	if 0 >= config.Timeout {
+		config.Timeout = DefaultNATSConfig.Timeout
+	}
+
+	return &NATS{config: config}
+}
+
+// Publish 发布消息，发布共用一个连接，出错时下一次重新连接
+func (n *NATS) Publish(ctx context.Context, subject string, data []byte) (err error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if nil == n.conn {
+		if n.conn, err = n.dial(ctx); nil != err {
+			return
+		}
+	}
+	if err = n.conn.conn.SetWriteDeadline(time.Now().Add(n.config.Timeout)); nil == err {
+		_, err = fmt.Fprintf(n.conn.conn, "PUB %s %d\r\n%s\r\n", subject, len(data), data)
+	}
+	if nil != err {
+		_ = n.conn.conn.Close()
+		n.conn = nil
+	}
+
+	return
+}
+
+// Subscribe 订阅主题，使用单独的连接，阻塞到ctx取消或者连接出错
+func (n *NATS) Subscribe(ctx context.Context, subject string, handler func(data []byte)) (err error) {
+	var nc *natsConn
+	if nc, err = n.dial(ctx); nil != err {
+		return
+	}
+	defer nc.conn.Close()
+
+	if _, err = fmt.Fprintf(nc.conn, "SUB %s 1\r\n", subject); nil != err {
+		return
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = nc.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		var line string
+		if line, err = nc.readLine(); nil != err {
+			if nil != ctx.Err() {
+				err = nil
+			}
+
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <size>
+			fields := strings.Fields(line)
+			var size int
+			if size, err = strconv.Atoi(fields[len(fields)-1]); nil != err {
+				return
+			}
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(nc.reader, data); nil != err {
+				return
+			}
+			handler(data[:size])
+		case "PING" == line:
+			// 服务器的心跳，不回复会被断开
+			if _, err = nc.conn.Write([]byte("PONG\r\n")); nil != err {
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// Close 关闭发布的连接
+func (n *NATS) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if nil == n.conn {
+		return nil
+	}
+	err := n.conn.conn.Close()
+	n.conn = nil
+
+	return err
+}
+
+// dial 建立连接，读取服务器的INFO后发送CONNECT，用PING确认认证通过
+func (n *NATS) dial(ctx context.Context) (nc *natsConn, err error) {
+	dialer := net.Dialer{Timeout: n.config.Timeout}
+	var conn net.Conn
+	if conn, err = dialer.DialContext(ctx, "tcp", n.config.Address); nil != err {
+		return
+	}
+	nc = &natsConn{conn: conn, reader: bufio.NewReader(conn)}
+	defer func() {
+		if nil != err {
+			_ = conn.Close()
+			nc = nil
+		}
+	}()
+
+	if err = conn.SetDeadline(time.Now().Add(n.config.Timeout)); nil != err {
+		return
+	}
+	var line string
+	if line, err = nc.readLine(); nil != err {
+		return
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return nil, fmt.Errorf("nats: 不是NATS服务：%s", line)
+	}
+	// NATS先明文发送INFO，之后再升级成TLS
+	if nil != n.config.TLS {
+		var upgraded net.Conn
+		if upgraded, err = n.upgrade(conn); nil != err {
+			return
+		}
+		conn = upgraded
+		nc.conn, nc.reader = conn, bufio.NewReader(conn)
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "echox", "lang": "go"}
+	if nil != n.config.TLS {
+		options["tls_required"] = true
+	}
+	if "" != n.config.User {
+		options["user"] = n.config.User
+		options["pass"] = n.config.Password
+	}
+	if "" != n.config.Token {
+		options["auth_token"] = n.config.Token
+	}
+	var data []byte
+	if data, err = json.Marshal(options); nil != err {
+		return
+	}
+	if _, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", data); nil != err {
+		return
+	}
+	if line, err = nc.readLine(); nil != err {
+		return
+	}
+	if "PONG" != line {
+		return nil, errors.New("nats: " + line)
+	}
+	err = conn.SetDeadline(time.Time{})
+
+	return
+}
+
+// upgrade 把连接升级成TLS
+func (n *NATS) upgrade(conn net.Conn) (upgraded net.Conn, err error) {
+	config := n.config.TLS.Clone()
+	if "" == config.ServerName {
+		if config.ServerName, _, err = net.SplitHostPort(n.config.Address); nil != err {
+			return
+		}
+	}
+	client := tls.Client(conn, config)
+	if err = client.Handshake(); nil != err {
+		return
+	}
+	upgraded = client
+
+	return
+}
+
+func (nc *natsConn) readLine() (line string, err error) {
+	if line, err = nc.reader.ReadString('\n'); nil == err {
+		line = strings.TrimRight(line, "\r\n")
+	}
+
+	return
+}
@@ -0,0 +1,101 @@
+package echox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNATS 模拟NATS服务器，需要TLS时在INFO之后升级连接，收到的PUB转发给所有的SUB
+func fakeNATS(t *testing.T, serverTLS *tls.Config) (address string, connects chan string) {
+	listener := localListener(t)
+	t.Cleanup(func() { _ = listener.Close() })
+	connects = make(chan string, 10)
+	subscribers := make(chan net.Conn, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				fmt.Fprintf(conn, "INFO {\"tls_required\":%t}\r\n", nil != serverTLS)
+				if nil != serverTLS {
+					conn = tls.Server(conn, serverTLS)
+				}
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if nil != err {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					switch {
+					case strings.HasPrefix(line, "CONNECT "):
+						connects <- strings.TrimPrefix(line, "CONNECT ")
+					case "PING" == line:
+						fmt.Fprint(conn, "PONG\r\n")
+					case strings.HasPrefix(line, "SUB "):
+						subscribers <- conn
+					case strings.HasPrefix(line, "PUB "):
+						fields := strings.Fields(line)
+						data, _ := reader.ReadString('\n')
+						sub := <-subscribers
+						fmt.Fprintf(sub, "MSG %s 1 %d\r\n%s", fields[1], len(data)-2, data)
+						subscribers <- sub
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), connects
+}
+
+func TestNATSPublishSubscribe(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	for name, tlsConfig := range map[string][2]*tls.Config{"明文": {}, "TLS": {serverTLS, clientTLS}} {
+		t.Run(name, func(t *testing.T) {
+			address, connects := fakeNATS(t, tlsConfig[0])
+			nats := NewNATS(NATSConfig{Address: address, Token: "token", TLS: tlsConfig[1]})
+			defer nats.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			received := make(chan string, 1)
+			done := make(chan error, 1)
+			go func() {
+				done <- nats.Subscribe(ctx, "events", func(data []byte) { received <- string(data) })
+			}()
+			// 等订阅的连接发出CONNECT后再发布
+			if connect := <-connects; !strings.Contains(connect, `"auth_token":"token"`) {
+				t.Fatalf("CONNECT中没有令牌：%s", connect)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if err := nats.Publish(ctx, "events", []byte("hello")); nil != err {
+				t.Fatal(err)
+			}
+
+			select {
+			case data := <-received:
+				if "hello" != data {
+					t.Fatalf("收到了%q", data)
+				}
+			case err := <-done:
+				t.Fatalf("订阅提前结束：%v", err)
+			case <-ctx.Done():
+				t.Fatal("没有收到消息")
+			}
+			cancel()
+			if err := <-done; nil != err {
+				t.Fatalf("取消订阅不应该返回错误：%v", err)
+			}
+		})
+	}
+}
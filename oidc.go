@@ -0,0 +1,422 @@
+package echox
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/random"
+	"github.com/storezhang/gox"
+)
+
+const (
+	oidcStateCookie = "echox_oidc"
+	// JWKS刷新的最小间隔，防止伪造的kid导致频繁请求
+	oidcJWKSMinRefresh = time.Minute
+)
+
+type (
+	// OIDCConfig OpenID Connect登录配置
+	OIDCConfig struct {
+		// 签发者地址，比如https://keycloak.example.com/realms/demo
+		// 必须
+		Issuer string
+
+		// 客户端编号和密钥
+		// 必须
+		ClientId     string
+		ClientSecret string
+
+		// 请求的范围
+		// 非必须 默认值是openid、profile和email
+		Scopes []string
+
+		// 回调地址，可以是完整的地址或者路径
+		// 非必须 默认值是"/auth/callback"
+		RedirectPath string
+
+		// 登录地址
+		// 非必须 默认值是"/auth/login"
+		LoginPath string
+
+		// 把身份映射成本地用户，比如按Subject查找或者创建用户
+		// 必须
+		User func(c echo.Context, identity OIDCIdentity) (gox.BaseUser, error)
+
+		// 登录成功后的处理
+		// 非必须 默认按EchoContext.Token的格式返回Token和用户
+		Success func(c echo.Context, token string, user gox.BaseUser) error
+
+		// 状态Cookie是否只通过HTTPS发送
+		CookieSecure bool
+
+		// 请求身份提供方的客户端
+		// 非必须 默认超时10秒
+		Client *http.Client
+
+		mutex     sync.Mutex
+		discovery *oidcDiscovery
+		keys      map[string]*rsa.PublicKey
+		refreshed time.Time
+	}
+
+	// OIDCIdentity ID Token中的身份信息
+	OIDCIdentity struct {
+		Subject           string        `json:"sub"`
+		Email             string        `json:"email"`
+		EmailVerified     bool          `json:"emailVerified"`
+		Name              string        `json:"name"`
+		PreferredUsername string        `json:"preferredUsername"`
+		Claims            jwt.MapClaims `json:"claims"`
+	}
+
+	oidcDiscovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	oidcJWK struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+)
+
+var (
+	ErrOIDCState   = echo.NewHTTPError(http.StatusBadRequest, "登录状态不正确，请重新登录")
+	ErrOIDCIDToken = echo.NewHTTPError(http.StatusUnauthorized, "身份令牌验证失败")
+)
+
+func (oc *OIDCConfig) mount(e *echo.Echo, jc *JWTConfig) {
+	if nil == jc {
+		panic("echo: oidc requires jwt config")
+	}
+	if "" == oc.Issuer || "" == oc.ClientId {
+		panic("echo: oidc requires issuer and client id")
+	}
+	if nil == oc.User {
+		panic("echo: oidc requires a user mapping")
+	}
+	if 0 == len(oc.Scopes) {
+		oc.Scopes = []string{"openid", "profile", "email"}
+	}
+	if "" == oc.RedirectPath {
+		oc.RedirectPath = "/auth/callback"
+	}
+	if "" == oc.LoginPath {
+		oc.LoginPath = "/auth/login"
+	}
+	if nil == oc.Client {
+		oc.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if nil == oc.Success {
+		oc.Success = func(c echo.Context, token string, user gox.BaseUser) error {
+			return c.JSON(http.StatusOK, echo.Map{
+				"token": token,
+				"user":  user,
+			})
+		}
+	}
+
+	callback := oc.RedirectPath
+	if parsed, err := url.Parse(oc.RedirectPath); nil == err && parsed.IsAbs() {
+		callback = parsed.Path
+	}
+	e.GET(oc.LoginPath, oc.login)
+	e.GET(callback, func(c echo.Context) error {
+		return oc.callback(c, jc)
+	})
+}
+
+func (oc *OIDCConfig) login(c echo.Context) (err error) {
+	discovery, err := oc.discover(c.Request().Context())
+	if nil != err {
+		return
+	}
+
+	state := random.String(32)
+	nonce := random.String(32)
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state + "." + nonce,
+		Path:     "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   oc.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", oc.ClientId)
+	query.Set("redirect_uri", oc.redirectURI(c))
+	query.Set("scope", strings.Join(oc.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+
+	return c.Redirect(http.StatusFound, discovery.AuthorizationEndpoint+"?"+query.Encode())
+}
+
+func (oc *OIDCConfig) callback(c echo.Context, jc *JWTConfig) (err error) {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if nil != err {
+		return ErrOIDCState
+	}
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if 2 != len(parts) || "" == c.QueryParam("state") || parts[0] != c.QueryParam("state") {
+		return ErrOIDCState
+	}
+	c.SetCookie(&http.Cookie{Name: oidcStateCookie, Path: "/", MaxAge: -1})
+
+	if reason := c.QueryParam("error"); "" != reason {
+		return echo.NewHTTPError(http.StatusUnauthorized, reason+": "+c.QueryParam("error_description"))
+	}
+
+	idToken, err := oc.exchange(c, c.QueryParam("code"))
+	if nil != err {
+		return
+	}
+	identity, err := oc.verify(c.Request().Context(), idToken, parts[1])
+	if nil != err {
+		return
+	}
+
+	user, err := oc.User(c, identity)
+	if nil != err {
+		return
+	}
+	token, err := jc.UserToken(user)
+	if nil != err {
+		return
+	}
+
+	return oc.Success(c, token, user)
+}
+
+func (oc *OIDCConfig) redirectURI(c echo.Context) string {
+	if parsed, err := url.Parse(oc.RedirectPath); nil == err && parsed.IsAbs() {
+		return oc.RedirectPath
+	}
+
+	return c.Scheme() + "://" + c.Request().Host + oc.RedirectPath
+}
+
+// exchange 用授权码换取ID Token
+func (oc *OIDCConfig) exchange(c echo.Context, code string) (idToken string, err error) {
+	discovery, err := oc.discover(c.Request().Context())
+	if nil != err {
+		return
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", oc.redirectURI(c))
+	form.Set("client_id", oc.ClientId)
+	form.Set("client_secret", oc.ClientSecret)
+
+	req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if nil != err {
+		return
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+
+	rsp, err := oc.Client.Do(req)
+	if nil != err {
+		return
+	}
+	defer rsp.Body.Close()
+
+	result := struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err = json.NewDecoder(rsp.Body).Decode(&result); nil != err {
+		return
+	}
+	if http.StatusOK != rsp.StatusCode || "" == result.IdToken {
+		err = echo.NewHTTPError(http.StatusUnauthorized, strings.TrimSpace(result.Error+" "+result.ErrorDescription))
+		return
+	}
+	idToken = result.IdToken
+
+	return
+}
+
+// verify 验证ID Token的签名、签发者、受众、有效期和nonce
+func (oc *OIDCConfig) verify(ctx context.Context, idToken string, nonce string) (identity OIDCIdentity, err error) {
+	discovery, err := oc.discover(ctx)
+	if nil != err {
+		return
+	}
+
+	token, parseErr := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected id token signing method=%v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+
+		return oc.key(ctx, discovery, kid)
+	})
+	if nil != parseErr || !token.Valid {
+		err = ErrOIDCIDToken
+		return
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if !claims.VerifyIssuer(discovery.Issuer, true) || !audience(claims, oc.ClientId) || nonce != claims["nonce"] {
+		err = ErrOIDCIDToken
+		return
+	}
+
+	identity.Claims = claims
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	if "" == identity.Subject {
+		err = ErrOIDCIDToken
+	}
+
+	return
+}
+
+// audience 受众可能是字符串也可能是数组
+func audience(claims jwt.MapClaims, clientId string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == clientId
+	case []interface{}:
+		for _, item := range aud {
+			if clientId == item {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (oc *OIDCConfig) discover(ctx context.Context) (discovery *oidcDiscovery, err error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if nil != oc.discovery {
+		return oc.discovery, nil
+	}
+
+	discovery = new(oidcDiscovery)
+	if err = oc.get(ctx, strings.TrimSuffix(oc.Issuer, "/")+"/.well-known/openid-configuration", discovery); nil != err {
+		return
+	}
+	if "" == discovery.AuthorizationEndpoint || "" == discovery.TokenEndpoint || "" == discovery.JWKSURI {
+		err = errors.New("oidc: discovery document is incomplete")
+		return
+	}
+	oc.discovery = discovery
+
+	return
+}
+
+// key 签名公钥，kid未知时刷新JWKS
+func (oc *OIDCConfig) key(ctx context.Context, discovery *oidcDiscovery, kid string) (key *rsa.PublicKey, err error) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+
+	if key = oc.lookup(kid); nil != key || time.Since(oc.refreshed) < oidcJWKSMinRefresh {
+		if nil == key {
+			err = fmt.Errorf("oidc: unknown key id %s", kid)
+		}
+		return
+	}
+
+	jwks := struct {
+		Keys []oidcJWK `json:"keys"`
+	}{}
+	if err = oc.get(ctx, discovery.JWKSURI, &jwks); nil != err {
+		return
+	}
+	oc.refreshed = time.Now()
+	oc.keys = make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if public, parseErr := jwk.public(); nil == parseErr {
+			oc.keys[jwk.Kid] = public
+		}
+	}
+	if key = oc.lookup(kid); nil == key {
+		err = fmt.Errorf("oidc: unknown key id %s", kid)
+	}
+
+	return
+}
+
+func (oc *OIDCConfig) lookup(kid string) *rsa.PublicKey {
+	if key, ok := oc.keys[kid]; ok {
+		return key
+	}
+	// 只有一个公钥时允许不指定kid
+	if "" == kid && 1 == len(oc.keys) {
+		for _, key := range oc.keys {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (oc *OIDCConfig) get(ctx context.Context, address string, result interface{}) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if nil != err {
+		return
+	}
+	rsp, err := oc.Client.Do(req)
+	if nil != err {
+		return
+	}
+	defer rsp.Body.Close()
+
+	if http.StatusOK != rsp.StatusCode {
+		return fmt.Errorf("oidc: %s returns %s", address, rsp.Status)
+	}
+
+	return json.NewDecoder(rsp.Body).Decode(result)
+}
+
+func (jwk oidcJWK) public() (key *rsa.PublicKey, err error) {
+	if "RSA" != jwk.Kty {
+		err = errors.New("oidc: only rsa keys are supported")
+		return
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if nil != err {
+		return
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if nil != err {
+		return
+	}
+	key = &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+
+	return
+}
@@ -0,0 +1,163 @@
+package echox
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+type (
+	// Schema OpenAPI中的数据描述
+	Schema struct {
+		Type        string             `json:"type,omitempty"`
+		Format      string             `json:"format,omitempty"`
+		Description string             `json:"description,omitempty"`
+		Enum        []interface{}      `json:"enum,omitempty"`
+		Items       *Schema            `json:"items,omitempty"`
+		Properties  map[string]*Schema `json:"properties,omitempty"`
+		Required    []string           `json:"required,omitempty"`
+		Nullable    bool               `json:"nullable,omitempty"`
+		Example     interface{}        `json:"example,omitempty"`
+	}
+
+	// OpenAPISchemer 自定义类型在OpenAPI中的描述
+	// 比如Date类型，在Go中是结构体，在传输中是字符串
+	OpenAPISchemer interface {
+		OpenAPISchema() *Schema
+	}
+)
+
+var schemerType = reflect.TypeOf((*OpenAPISchemer)(nil)).Elem()
+
+// SchemaOf 生成类型对应的OpenAPI描述
+// 字段名使用json标签，带有validate:"required"的字段是必须字段
+func SchemaOf(t reflect.Type) *Schema {
+	return schemaOf(t, make(map[reflect.Type]bool))
+}
+
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) (schema *Schema) {
+	// 先去掉指针，值接收者的方法对指针也成立，零值的指针调用时会崩溃
+	if reflect.Ptr == t.Kind() {
+		schema = schemaOf(t.Elem(), visiting)
+		schema.Nullable = true
+
+		return
+	}
+	if t.Implements(schemerType) {
+		return reflect.Zero(t).Interface().(OpenAPISchemer).OpenAPISchema()
+	}
+	if reflect.PtrTo(t).Implements(schemerType) {
+		return reflect.New(t).Interface().(OpenAPISchemer).OpenAPISchema()
+	}
+	if reflect.String == t.Kind() && t.Implements(enumType) {
+		return enumSchema(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		schema = &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		schema = &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		schema = &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		schema = &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		schema = &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		schema = &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if reflect.Uint8 == t.Elem().Kind() {
+			schema = &Schema{Type: "string", Format: "byte"}
+		} else {
+			schema = &Schema{Type: "array", Items: schemaOf(t.Elem(), visiting)}
+		}
+	case reflect.Map:
+		schema = &Schema{Type: "object"}
+	case reflect.Struct:
+		if reflect.TypeOf(time.Time{}) == t {
+			schema = &Schema{Type: "string", Format: "date-time"}
+		} else {
+			schema = structSchema(t, visiting)
+		}
+	default:
+		schema = &Schema{}
+	}
+
+	return
+}
+
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool) (schema *Schema) {
+	schema = &Schema{Type: "object"}
+	// 递归类型只展开一层
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	schema.Properties = make(map[string]*Schema)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if "" != field.PkgPath {
+			continue
+		}
+
+		name, omit := jsonName(field)
+		if omit {
+			continue
+		}
+		// 匿名结构体的字段提升到上一层
+		if field.Anonymous && "" == field.Tag.Get("json") && reflect.Struct == indirectType(field.Type).Kind() {
+			embedded := schemaOf(indirectType(field.Type), visiting)
+			for key, property := range embedded.Properties {
+				schema.Properties[key] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		schema.Properties[name] = schemaOf(field.Type, visiting)
+		if hasRule(field.Tag.Get("validate"), "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return
+}
+
+// jsonName 字段在JSON中的名字
+func jsonName(field reflect.StructField) (name string, omit bool) {
+	tag := field.Tag.Get("json")
+	if "-" == tag {
+		return "", true
+	}
+
+	name = field.Name
+	if index := strings.Index(tag, ","); -1 != index {
+		tag = tag[:index]
+	}
+	if "" != tag {
+		name = tag
+	}
+
+	return
+}
+
+func hasRule(tag string, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if rule == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+
+	return t
+}
@@ -0,0 +1,31 @@
+package echox
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pprofLabelsMiddleware 给处理请求的协程加上pprof标签
+// 生产环境采集的CPU和内存剖析可以按接口、方法和租户拆分，处理器中启动的协程会继承标签
+func pprofLabelsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		route := c.Path()
+		if "" == route {
+			route = MetricsOther
+		}
+		pairs := []string{"route", route, "method", c.Request().Method}
+		if tenant := TenantOf(c); "" != tenant {
+			pairs = append(pairs, "tenant", tenant)
+		}
+
+		req := c.Request()
+		pprof.Do(req.Context(), pprof.Labels(pairs...), func(ctx context.Context) {
+			c.SetRequest(req.WithContext(ctx))
+			err = next(c)
+		})
+
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package echox
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/storezhang/gox"
+)
+
+const (
+	// PrincipalUser 登录的用户
+	PrincipalUser = "user"
+	// PrincipalService 服务账号，比如定时任务、服务间调用和数据迁移
+	PrincipalService = "service"
+
+	// SystemService 内置的系统服务账号，定时调用自己的接口时使用
+	SystemService = "system"
+
+	// servicePrefix 服务账号在Casbin和审计日志中的前缀，不会和用户编号冲突
+	servicePrefix = "service:"
+)
+
+// ErrNotUser 调用者是服务账号，没有用户信息，需要区分时使用Principal
+var ErrNotUser = errors.New("调用者是服务账号，不是用户")
+
+type (
+	// Principal 调用者，用户和服务账号使用同一种Token，由Token中的svc区分
+	Principal struct {
+		Type string `json:"type"`
+		// 用户是用户编号，服务账号是服务名
+		Id   string       `json:"id"`
+		User gox.BaseUser `json:"user"`
+	}
+)
+
+// ServiceToken 为服务账号签发Token，服务账号没有用户编号
+func (j *JWTConfig) ServiceToken(service string, ttl time.Duration) (string, error) {
+	return j.Token(&JWTClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			Subject:   servicePrefix + service,
+		},
+		BaseUser: gox.BaseUser{Username: service},
+		Service:  service,
+	})
+}
+
+// Principal 当前请求的调用者
+func (ec *EchoContext) Principal() (principal Principal, err error) {
+	var token string
+	if token, err = ec.JWT.Extractor(ec.Context); nil != err {
+		return
+	}
+
+	var claims jwt.Claims
+	if claims, _, err = ec.JWT.Parse(token); nil != err {
+		return
+	}
+	principal = principalOf(claims.(*JWTClaims))
+
+	return
+}
+
+// IsService 调用者是不是服务账号
+func (p Principal) IsService() bool {
+	return PrincipalService == p.Type
+}
+
+// Subject Casbin的主体，用户是用户编号，服务账号是service:服务名
+func (p Principal) Subject() string {
+	if p.IsService() {
+		return servicePrefix + p.Id
+	}
+
+	return p.Id
+}
+
+// token 为调用者重新签发Token，用户还是原来的用户，服务账号还是原来的服务账号
+func (p Principal) token(j *JWTConfig, ttl time.Duration) (string, error) {
+	if p.IsService() {
+		return j.ServiceToken(p.Id, ttl)
+	}
+
+	return j.Token(&JWTClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+		BaseUser: p.User,
+	})
+}
+
+func principalOf(claims *JWTClaims) Principal {
+	if "" != claims.Service {
+		return Principal{Type: PrincipalService, Id: claims.Service, User: claims.BaseUser}
+	}
+
+	return Principal{Type: PrincipalUser, Id: claims.BaseUser.IdString(), User: claims.BaseUser}
+}
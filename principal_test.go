@@ -0,0 +1,59 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+func TestUserRejectsServiceTokens(t *testing.T) {
+	ec := NewDefaultConfig()
+	ec.JWT = &JWTConfig{SigningKey: "secret"}
+	var (
+		user      gox.BaseUser
+		userErr   error
+		principal Principal
+	)
+	ec.Routes = []RouteFunc{Register(Route{Method: echo.GET, Path: "/me", Auth: AuthJWT, Handler: func(c echo.Context) (err error) {
+		user, userErr = c.(*EchoContext).User()
+		if principal, err = c.(*EchoContext).Principal(); nil != err {
+			return
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}})}
+	e := New(ec)
+	me := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	token, err := ec.JWT.ServiceToken("billing", time.Minute)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if code := me(token); http.StatusNoContent != code {
+		t.Fatalf("服务账号没有通过认证：%d", code)
+	}
+	if ErrNotUser != userErr || 0 != user.Id {
+		t.Fatalf("服务账号的User返回了%+v %v", user, userErr)
+	}
+	if !principal.IsService() || "service:billing" != principal.Subject() {
+		t.Fatalf("服务账号的调用者是%+v", principal)
+	}
+
+	if token, err = ec.JWT.UserToken(gox.BaseUser{Id: 7, Username: "alice"}); nil != err {
+		t.Fatal(err)
+	}
+	if code := me(token); http.StatusNoContent != code || nil != userErr || 7 != user.Id {
+		t.Fatalf("用户的User返回了%d %+v %v", code, user, userErr)
+	}
+}
@@ -0,0 +1,324 @@
+package echox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// profileExtends 配置文件中指定继承的配置，比如prod.yaml中的extends: staging
+const profileExtends = "extends"
+
+type (
+	// ProfileLoader 分层加载配置
+	// 加载顺序是base.yaml、继承的配置、当前环境的配置，最后是环境变量，后加载的覆盖先加载的
+	// 合并规则：
+	//  - 对象按键递归合并
+	//  - 列表和普通值整体替换
+	//  - 值为null时删除这个键
+	//  - 环境变量ECHOX_DB__MAX_LAG=2s对应db.max_lag，值按YAML解析
+	ProfileLoader struct {
+		// 配置文件目录
+		// 必须字段
+		Dir string
+
+		// 基础配置的文件名，不带扩展名
+		// 非必须 默认值是base
+		Base string
+
+		// 当前环境
+		// 非必须 默认读取环境变量ECHOX_PROFILE，为空时只加载基础配置
+		Profile string
+
+		// 环境变量前缀
+		// 非必须 默认值是ECHOX_
+		EnvPrefix string
+
+		// 是否忽略环境变量
+		DisableEnv bool
+	}
+
+	// ConfigDiff 两个配置的差异
+	ConfigDiff struct {
+		Path string      `json:"path"`
+		From interface{} `json:"from"`
+		To   interface{} `json:"to"`
+	}
+)
+
+var (
+	// ErrProfileCycle 配置循环继承
+	ErrProfileCycle = errors.New("配置循环继承")
+)
+
+// Load 加载配置到target，target是结构体指针，字段按yaml标签匹配
+func (pl ProfileLoader) Load(target interface{}) (err error) {
+	var merged map[string]interface{}
+	if merged, err = pl.Merged(); nil != err {
+		return
+	}
+
+	var data []byte
+	if data, err = yaml.Marshal(merged); nil != err {
+		return
+	}
+
+	return yaml.Unmarshal(data, target)
+}
+
+// Merged 合并后的配置
+func (pl ProfileLoader) Merged() (merged map[string]interface{}, err error) {
+	pl.defaults()
+	if merged, err = pl.file(pl.Base); nil != err {
+		return
+	}
+	delete(merged, profileExtends)
+
+	var layers []map[string]interface{}
+	visited := map[string]bool{pl.Base: true}
+	for profile := pl.Profile; "" != profile && pl.Base != profile; {
+		if visited[profile] {
+			return nil, ErrProfileCycle
+		}
+		visited[profile] = true
+
+		var layer map[string]interface{}
+		if layer, err = pl.file(profile); nil != err {
+			return
+		}
+		layers = append([]map[string]interface{}{layer}, layers...)
+		profile, _ = layer[profileExtends].(string)
+		delete(layer, profileExtends)
+	}
+	for _, layer := range layers {
+		merged = mergeConfig(merged, layer)
+	}
+	if !pl.DisableEnv {
+		merged = mergeConfig(merged, pl.env())
+	}
+
+	return
+}
+
+func (pl *ProfileLoader) defaults() {
+	if "" == pl.Dir {
+		panic("echo: profile loader requires a directory")
+	}
+	if "" == pl.Base {
+		pl.Base = "base"
+	}
+	if "" == pl.EnvPrefix {
+		pl.EnvPrefix = "ECHOX_"
+	}
+	if "" == pl.Profile {
+		pl.Profile = os.Getenv(pl.EnvPrefix + "PROFILE")
+	}
+}
+
+// file 读取配置文件，支持.yaml和.yml，基础配置不存在时为空
+func (pl *ProfileLoader) file(name string) (config map[string]interface{}, err error) {
+	var data []byte
+	for _, ext := range []string{".yaml", ".yml"} {
+		if data, err = ioutil.ReadFile(filepath.Join(pl.Dir, name+ext)); nil == err || !os.IsNotExist(err) {
+			break
+		}
+	}
+	if os.IsNotExist(err) {
+		if pl.Base == name {
+			return make(map[string]interface{}), nil
+		}
+
+		return nil, fmt.Errorf("配置%s不存在", name)
+	} else if nil != err {
+		return
+	}
+
+	var raw interface{}
+	if err = yaml.Unmarshal(data, &raw); nil != err {
+		return nil, fmt.Errorf("配置%s格式错误：%w", name, err)
+	}
+	if config, _ = normalizeConfig(raw).(map[string]interface{}); nil == config {
+		config = make(map[string]interface{})
+	}
+
+	return
+}
+
+// env 环境变量组成的配置，双下划线表示下一层
+func (pl *ProfileLoader) env() (config map[string]interface{}) {
+	config = make(map[string]interface{})
+	for _, pair := range os.Environ() {
+		kv := strings.SplitN(pair, "=", 2)
+		if 2 != len(kv) || !strings.HasPrefix(kv[0], pl.EnvPrefix) || pl.EnvPrefix+"PROFILE" == kv[0] {
+			continue
+		}
+
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(kv[0], pl.EnvPrefix)), "__")
+		// 空值不能当成null，否则会删除配置
+		var value interface{} = kv[1]
+		if "" != kv[1] {
+			if nil != yaml.Unmarshal([]byte(kv[1]), &value) {
+				value = kv[1]
+			}
+		}
+
+		node := config
+		for _, key := range path[:len(path)-1] {
+			child, ok := node[key].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[key] = child
+			}
+			node = child
+		}
+		node[path[len(path)-1]] = normalizeConfig(value)
+	}
+
+	return
+}
+
+// mergeConfig 把overlay合并到base上
+func mergeConfig(base map[string]interface{}, overlay map[string]interface{}) map[string]interface{} {
+	for key, value := range overlay {
+		if nil == value {
+			delete(base, key)
+			continue
+		}
+
+		baseMap, baseOk := base[key].(map[string]interface{})
+		overlayMap, overlayOk := value.(map[string]interface{})
+		if baseOk && overlayOk {
+			base[key] = mergeConfig(baseMap, overlayMap)
+		} else {
+			base[key] = value
+		}
+	}
+
+	return base
+}
+
+// normalizeConfig 把YAML解析出的map[interface{}]interface{}转换成map[string]interface{}
+func normalizeConfig(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized[fmt.Sprint(key)] = normalizeConfig(item)
+		}
+
+		return normalized
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeConfig(item)
+		}
+	}
+
+	return value
+}
+
+// DiffConfig 比较两个配置，按路径排序
+func DiffConfig(from map[string]interface{}, to map[string]interface{}) (diffs []ConfigDiff) {
+	diffConfig("", from, to, &diffs)
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+
+	return
+}
+
+func diffConfig(prefix string, from map[string]interface{}, to map[string]interface{}, diffs *[]ConfigDiff) {
+	keys := make(map[string]bool)
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		path := key
+		if "" != prefix {
+			path = prefix + "." + key
+		}
+
+		fromMap, fromOk := from[key].(map[string]interface{})
+		toMap, toOk := to[key].(map[string]interface{})
+		if fromOk && toOk {
+			diffConfig(path, fromMap, toMap, diffs)
+		} else if !reflect.DeepEqual(from[key], to[key]) {
+			*diffs = append(*diffs, ConfigDiff{Path: path, From: from[key], To: to[key]})
+		}
+	}
+}
+
+// ConfigCommand 处理配置命令，不是配置命令时handled为false
+//
+//	config diff <from> <to> 比较两个环境合并后的配置
+//	config show [profile]   输出合并后的配置
+//
+// 在main中使用：
+//
+//	if handled, err := loader.ConfigCommand(os.Args[1:], os.Stdout); handled {
+//		...
+//	}
+func (pl ProfileLoader) ConfigCommand(args []string, out io.Writer) (handled bool, err error) {
+	if 2 > len(args) || "config" != args[0] {
+		return
+	}
+	handled = true
+
+	switch args[1] {
+	case "diff":
+		if 4 != len(args) {
+			return handled, errors.New("用法：config diff <from> <to>")
+		}
+
+		var from, to map[string]interface{}
+		if from, err = pl.withProfile(args[2]).Merged(); nil != err {
+			return
+		}
+		if to, err = pl.withProfile(args[3]).Merged(); nil != err {
+			return
+		}
+		for _, diff := range DiffConfig(from, to) {
+			if _, err = fmt.Fprintf(out, "%s: %v -> %v\n", diff.Path, diff.From, diff.To); nil != err {
+				return
+			}
+		}
+	case "show":
+		loader := pl
+		if 3 <= len(args) {
+			loader = pl.withProfile(args[2])
+		}
+
+		var merged map[string]interface{}
+		if merged, err = loader.Merged(); nil != err {
+			return
+		}
+		var data []byte
+		if data, err = yaml.Marshal(merged); nil != err {
+			return
+		}
+		_, err = out.Write(data)
+	default:
+		err = fmt.Errorf("不支持的配置命令：%s", args[1])
+	}
+
+	return
+}
+
+// withProfile 比较时只看配置文件，不受当前环境变量影响
+func (pl ProfileLoader) withProfile(profile string) ProfileLoader {
+	pl.Profile = profile
+	pl.DisableEnv = true
+
+	return pl
+}
@@ -0,0 +1,140 @@
+package echox
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// ProfilingConfig 按请求统计资源消耗的配置（实验性）
+	// 被采样的请求在独立的线程上执行，用线程的CPU时间作为请求的CPU时间；
+	// 内存分配是采样期间整个进程的分配量，并发高时会偏大，只适合比较不同接口的相对大小
+	ProfilingConfig struct {
+		// 跳过统计
+		Skipper middleware.Skipper
+
+		// 采样比例
+		// 非必须 默认值是0.01
+		SampleRate float64
+	}
+
+	// EndpointUsage 接口的资源消耗
+	EndpointUsage struct {
+		Route      string        `json:"route"`
+		Samples    int64         `json:"samples"`
+		CPU        time.Duration `json:"cpu"`
+		AllocBytes uint64        `json:"allocBytes"`
+		Wall       time.Duration `json:"wall"`
+	}
+
+	// ResourceRecorder 可以记录资源消耗的指标记录器
+	ResourceRecorder interface {
+		ObserveResources(route string, cpu time.Duration, allocBytes uint64)
+	}
+)
+
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+var (
+	// DefaultProfilingConfig 默认配置
+	DefaultProfilingConfig = ProfilingConfig{
+		Skipper:    middleware.DefaultSkipper,
+		SampleRate: 0.01,
+	}
+
+	usageMutex sync.Mutex
+	usages     = make(map[string]*EndpointUsage)
+)
+
+// ResourceUsage 资源消耗最多的接口，按CPU时间排序
+func ResourceUsage(top int) (endpoints []EndpointUsage) {
+	usageMutex.Lock()
+	endpoints = make([]EndpointUsage, 0, len(usages))
+	for _, usage := range usages {
+		endpoints = append(endpoints, *usage)
+	}
+	usageMutex.Unlock()
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CPU > endpoints[j].CPU
+	})
+	if 0 < top && top < len(endpoints) {
+		endpoints = endpoints[:top]
+	}
+
+	return
+}
+
+// ProfilingWithConfig 按请求统计资源消耗的中间件
+func ProfilingWithConfig(config ProfilingConfig, recorder MetricsRecorder) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultProfilingConfig.Skipper
+	}
+	if 0 >= config.SampleRate {
+		config.SampleRate = DefaultProfilingConfig.SampleRate
+	}
+	resources, _ := recorder.(ResourceRecorder)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) || rand.Float64() >= config.SampleRate {
+				return next(c)
+			}
+
+			route := c.Path()
+			if "" == route {
+				route = MetricsOther
+			}
+			labels := pprof.Labels("route", route, "request_id", CorrelationOf(c).RequestId)
+
+			// 锁定线程后，线程的CPU时间就是这个请求的CPU时间
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			sample := []metrics.Sample{{Name: heapAllocsMetric}}
+			metrics.Read(sample)
+			allocsBefore := sample[0].Value.Uint64()
+			cpuBefore := threadCPU()
+			start := time.Now()
+
+			pprof.Do(c.Request().Context(), labels, func(ctx context.Context) {
+				trace.WithRegion(ctx, route, func() {
+					err = next(c)
+				})
+			})
+
+			wall := time.Since(start)
+			cpu := threadCPU() - cpuBefore
+			metrics.Read(sample)
+			alloc := sample[0].Value.Uint64() - allocsBefore
+
+			usageMutex.Lock()
+			usage, ok := usages[route]
+			if !ok {
+				usage = &EndpointUsage{Route: route}
+				usages[route] = usage
+			}
+			usage.Samples++
+			usage.CPU += cpu
+			usage.AllocBytes += alloc
+			usage.Wall += wall
+			usageMutex.Unlock()
+
+			if nil != resources {
+				resources.ObserveResources(route, cpu, alloc)
+			}
+
+			return
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package echox
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusageThread 只统计当前线程，和Linux的RUSAGE_THREAD一致
+const rusageThread = 1
+
+// threadCPU 当前线程消耗的CPU时间
+func threadCPU() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &usage); nil != err {
+		return 0
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
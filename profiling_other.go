@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package echox
+
+import (
+	"time"
+)
+
+// threadCPU 其它系统不支持按线程统计
+func threadCPU() time.Duration {
+	return 0
+}
@@ -0,0 +1,253 @@
+package echox
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	// LoadBalancingRoundRobin 轮询
+	LoadBalancingRoundRobin = "round-robin"
+	// LoadBalancingRandom 随机
+	LoadBalancingRandom = "random"
+)
+
+type (
+	// ProxyConfig 网关转发配置
+	ProxyConfig struct {
+		// 转发的路径前缀
+		// 必须
+		Prefix string
+
+		// 上游地址，比如http://payments:8080
+		// 必须
+		Upstreams []string
+
+		// 负载均衡方式
+		// 非必须 默认值是round-robin
+		LoadBalancing string
+
+		// 转发前去掉路径前缀
+		StripPrefix bool
+
+		// 路径重写规则，和echo的Rewrite规则一致
+		// 比如"/payments/v1/*": "/api/$1"
+		Rewrite map[string]string
+
+		// 上游超时时间
+		// 非必须 默认值是30秒
+		Timeout time.Duration
+
+		// 上游健康检查的路径，为空时不做健康检查
+		HealthPath string
+
+		// 健康检查的间隔
+		// 非必须 默认值是10秒
+		HealthInterval time.Duration
+	}
+
+	// upstream 上游
+	upstream struct {
+		target  *middleware.ProxyTarget
+		healthy bool
+	}
+
+	// upstreamBalancer 只在健康的上游中选择的负载均衡器
+	upstreamBalancer struct {
+		mutex     sync.RWMutex
+		upstreams []*upstream
+		random    bool
+		index     uint32
+	}
+)
+
+var (
+	// DefaultProxyConfig 默认配置
+	DefaultProxyConfig = ProxyConfig{
+		LoadBalancing:  LoadBalancingRoundRobin,
+		Timeout:        30 * time.Second,
+		HealthInterval: 10 * time.Second,
+	}
+
+	// ErrNoUpstream 没有可用的上游
+	ErrNoUpstream = echo.NewHTTPError(http.StatusBadGateway, "没有可用的上游服务")
+)
+
+func (pc ProxyConfig) mount(e *echo.Echo) {
+	if "" == pc.Prefix {
+		panic("echo: proxy requires a prefix")
+	}
+	if 0 == len(pc.Upstreams) {
+		panic("echo: proxy requires upstreams")
+	}
+	if "" == pc.LoadBalancing {
+		pc.LoadBalancing = DefaultProxyConfig.LoadBalancing
+	}
+	if 0 >= pc.Timeout {
+		pc.Timeout = DefaultProxyConfig.Timeout
+	}
+	if 0 >= pc.HealthInterval {
+		pc.HealthInterval = DefaultProxyConfig.HealthInterval
+	}
+	prefix := strings.TrimSuffix(pc.Prefix, "/")
+
+	balancer := &upstreamBalancer{random: LoadBalancingRandom == pc.LoadBalancing}
+	for _, address := range pc.Upstreams {
+		target, err := url.Parse(address)
+		if nil != err {
+			panic("echo: proxy upstream is invalid: " + address)
+		}
+		balancer.AddTarget(&middleware.ProxyTarget{Name: address, URL: target})
+	}
+
+	rewrite := make(map[string]string, len(pc.Rewrite)+1)
+	for from, to := range pc.Rewrite {
+		rewrite[from] = to
+	}
+	if pc.StripPrefix && 0 == len(pc.Rewrite) {
+		rewrite[prefix+"/*"] = "/$1"
+		rewrite[prefix] = "/"
+	}
+
+	proxy := middleware.ProxyWithConfig(middleware.ProxyConfig{
+		Balancer: balancer,
+		Rewrite:  rewrite,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: pc.Timeout, KeepAlive: 30 * time.Second}).DialContext,
+			ResponseHeaderTimeout: pc.Timeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   32,
+		},
+	})
+	available := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !balancer.available() {
+				return ErrNoUpstream
+			}
+
+			return next(c)
+		}
+	}
+
+	e.Any(prefix, echo.NotFoundHandler, available, proxy)
+	e.Any(prefix+"/*", echo.NotFoundHandler, available, proxy)
+
+	if "" != pc.HealthPath {
+		go balancer.check(pc.HealthPath, pc.HealthInterval, pc.Timeout)
+	}
+}
+
+func (ub *upstreamBalancer) AddTarget(target *middleware.ProxyTarget) bool {
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	for _, u := range ub.upstreams {
+		if u.target.Name == target.Name {
+			return false
+		}
+	}
+	ub.upstreams = append(ub.upstreams, &upstream{target: target, healthy: true})
+
+	return true
+}
+
+func (ub *upstreamBalancer) RemoveTarget(name string) bool {
+	ub.mutex.Lock()
+	defer ub.mutex.Unlock()
+
+	for i, u := range ub.upstreams {
+		if u.target.Name == name {
+			ub.upstreams = append(ub.upstreams[:i], ub.upstreams[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ub *upstreamBalancer) Next(_ echo.Context) *middleware.ProxyTarget {
+	ub.mutex.RLock()
+	defer ub.mutex.RUnlock()
+
+	healthy := make([]*middleware.ProxyTarget, 0, len(ub.upstreams))
+	for _, u := range ub.upstreams {
+		if u.healthy {
+			healthy = append(healthy, u.target)
+		}
+	}
+	if 0 == len(healthy) {
+		return nil
+	}
+
+	if ub.random {
+		return healthy[rand.Intn(len(healthy))]
+	}
+
+	return healthy[int(atomic.AddUint32(&ub.index, 1)-1)%len(healthy)]
+}
+
+func (ub *upstreamBalancer) available() bool {
+	ub.mutex.RLock()
+	defer ub.mutex.RUnlock()
+
+	for _, u := range ub.upstreams {
+		if u.healthy {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check 定时检查上游，不健康的上游不再分配请求，恢复后重新加入
+func (ub *upstreamBalancer) check(path string, interval time.Duration, timeout time.Duration) {
+	client := &http.Client{Timeout: timeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if LifecycleStopped == State() {
+			return
+		}
+
+		ub.mutex.RLock()
+		upstreams := make([]*upstream, len(ub.upstreams))
+		copy(upstreams, ub.upstreams)
+		ub.mutex.RUnlock()
+
+		for _, u := range upstreams {
+			healthy := ping(client, u.target.URL.String()+path, timeout)
+			ub.mutex.Lock()
+			u.healthy = healthy
+			ub.mutex.Unlock()
+		}
+	}
+}
+
+func ping(client *http.Client, address string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if nil != err {
+		return false
+	}
+	rsp, err := client.Do(req)
+	if nil != err {
+		return false
+	}
+	defer rsp.Body.Close()
+
+	return http.StatusOK <= rsp.StatusCode && http.StatusBadRequest > rsp.StatusCode
+}
@@ -0,0 +1,159 @@
+package echox
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// PubSub 跨实例的消息通道，*Redis和*NATS都实现了这个接口
+	PubSub interface {
+		// Publish 发布消息
+		Publish(ctx context.Context, channel string, data []byte) error
+		// Subscribe 订阅消息，阻塞到ctx取消或者连接出错
+		Subscribe(ctx context.Context, channel string, handler func(data []byte)) error
+	}
+
+	// PubSubConfig 跨实例广播的配置，配置后Hub和Broker的广播通过它发给所有实例上的连接
+	// Redis、NATS和PubSub只需要配置一个
+	PubSubConfig struct {
+		// Redis的发布订阅
+		Redis *RedisConfig
+
+		// NATS的发布订阅
+		NATS *NATSConfig
+
+		// 自定义的消息通道
+		PubSub PubSub
+
+		// 频道名，所有实例要一致
+		// 非必须 默认值是"echox:broadcast"
+		Channel string
+
+		// 订阅断开后重连的间隔
+		// 非必须 默认值是1秒
+		Retry time.Duration
+	}
+
+	// broadcastMessage 在实例之间传递的广播，Namespace区分不同的Hub和Broker
+	broadcastMessage struct {
+		Namespace string `json:"namespace"`
+		Key       string `json:"key"`
+		Binary    bool   `json:"binary,omitempty"`
+		Data      []byte `json:"data"`
+	}
+
+	broadcastBus struct {
+		mutex    sync.RWMutex
+		handlers map[string]func(key string, binary bool, data []byte)
+		remote   atomic.Value
+	}
+
+	remotePubSub struct {
+		pubsub  PubSub
+		channel string
+	}
+)
+
+var (
+	// DefaultPubSubConfig 默认配置
+	DefaultPubSubConfig = PubSubConfig{
+		Channel: "echox:broadcast",
+		Retry:   time.Second,
+	}
+
+	broadcasts = &broadcastBus{handlers: make(map[string]func(key string, binary bool, data []byte))}
+)
+
+// worker 订阅频道的后台任务，订阅成功前和没有配置时广播只发给本实例
+func (pc *PubSubConfig) worker(e *echo.Echo) Worker {
+	pubsub := pc.PubSub
+	switch {
+	case nil != pubsub:
+	case nil != pc.Redis:
+		pubsub = NewRedis(*pc.Redis)
+	case nil != pc.NATS:
+		pubsub = NewNATS(*pc.NATS)
+	default:
+		panic("echo: pubsub requires redis, nats or a custom pubsub")
+	}
+	remote := &remotePubSub{pubsub: pubsub, channel: pc.Channel}
+	if "" == remote.channel {
+		remote.channel = DefaultPubSubConfig.Channel
+	}
+	retry := pc.Retry
+	if 0 >= retry {
+		retry = DefaultPubSubConfig.Retry
+	}
+
+	return Worker{
+		Name:     "pubsub",
+		Interval: retry,
+		Run: func(ctx context.Context) error {
+			broadcasts.remote.Store(remote)
+
+			return pubsub.Subscribe(ctx, remote.channel, func(data []byte) {
+				var message broadcastMessage
+				if err := json.Unmarshal(data, &message); nil != err {
+					e.Logger.Warnf("pubsub message is invalid: %v", err)
+					return
+				}
+				broadcasts.deliver(message)
+			})
+		},
+	}
+}
+
+// handle 注册命名空间的本地处理器
+func (bb *broadcastBus) handle(namespace string, handler func(key string, binary bool, data []byte)) {
+	bb.mutex.Lock()
+	defer bb.mutex.Unlock()
+
+	if _, ok := bb.handlers[namespace]; ok {
+		panic("echo: broadcast namespace is duplicated: " + namespace)
+	}
+	bb.handlers[namespace] = handler
+}
+
+// publish 有跨实例的通道时发布到通道，由订阅统一投递给包括本实例在内的所有实例，否则直接投递
+func (bb *broadcastBus) publish(ctx context.Context, namespace string, key string, v interface{}) (err error) {
+	message := broadcastMessage{Namespace: namespace, Key: key}
+	switch value := v.(type) {
+	case string:
+		message.Data = []byte(value)
+	case []byte:
+		message.Binary = true
+		message.Data = value
+	default:
+		if message.Data, err = json.Marshal(value); nil != err {
+			return
+		}
+	}
+
+	remote, ok := bb.remote.Load().(*remotePubSub)
+	if !ok {
+		bb.deliver(message)
+
+		return
+	}
+	var data []byte
+	if data, err = json.Marshal(message); nil != err {
+		return
+	}
+
+	return remote.pubsub.Publish(ctx, remote.channel, data)
+}
+
+func (bb *broadcastBus) deliver(message broadcastMessage) {
+	bb.mutex.RLock()
+	handler, ok := bb.handlers[message.Namespace]
+	bb.mutex.RUnlock()
+	if ok {
+		handler(message.Key, message.Binary, message.Data)
+	}
+}
@@ -0,0 +1,167 @@
+package echox
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// QueryCountConfig 查询次数统计的配置，需要同时配置DB
+	// 通过DBOf执行的查询才会被统计
+	QueryCountConfig struct {
+		// 跳过统计
+		Skipper middleware.Skipper
+
+		// 单个请求最多的查询次数，超过时告警
+		// 非必须 默认值是20
+		Threshold int64
+
+		// 同一条语句在一个请求中执行的次数，超过时认为是N+1查询
+		// 非必须 默认值是5
+		Repeat int
+
+		// 告警，不配置时只打印日志
+		Alert func(QueryAlert)
+	}
+
+	// QueryAlert 查询告警
+	QueryAlert struct {
+		Method    string `json:"method"`
+		Route     string `json:"route"`
+		RequestId string `json:"requestId"`
+		// 请求中的查询次数
+		Count int64 `json:"count"`
+		// 重复执行的语句，没有N+1时为空
+		Statement string `json:"statement,omitempty"`
+		Repeats   int    `json:"repeats,omitempty"`
+	}
+
+	// QueryRecorder 可以记录查询次数的指标记录器
+	QueryRecorder interface {
+		ObserveQueries(route string, count int64)
+	}
+
+	// queryStats 一个请求中的查询统计
+	queryStats struct {
+		count      int64
+		mutex      sync.Mutex
+		statements map[string]int
+	}
+)
+
+var (
+	// DefaultQueryCountConfig 默认配置
+	DefaultQueryCountConfig = QueryCountConfig{
+		Skipper:   middleware.DefaultSkipper,
+		Threshold: 20,
+		Repeat:    5,
+	}
+
+	// sqlLiteral 语句中的字面量，归一化时替换成占位符
+	sqlLiteral = regexp.MustCompile(`'(?:[^']|'')*'|\b[0-9]+(?:\.[0-9]+)?\b`)
+)
+
+// QueryCountWithConfig 统计每个请求的查询次数，发现查询过多或者N+1查询时告警
+func QueryCountWithConfig(config QueryCountConfig, recorder MetricsRecorder) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultQueryCountConfig.Skipper
+	}
+	if 0 >= config.Threshold {
+		config.Threshold = DefaultQueryCountConfig.Threshold
+	}
+	if 0 >= config.Repeat {
+		config.Repeat = DefaultQueryCountConfig.Repeat
+	}
+	queries, _ := recorder.(QueryRecorder)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			// 开发模式已经开始统计时共用同一个统计
+			stats, ok := c.Get(dbQueriesKey).(*queryStats)
+			if !ok {
+				stats = newQueryStats()
+				c.Set(dbQueriesKey, stats)
+			}
+			err = next(c)
+
+			route := c.Path()
+			if "" == route {
+				route = MetricsOther
+			}
+			count := stats.total()
+			if nil != queries {
+				queries.ObserveQueries(route, count)
+			}
+
+			alert := QueryAlert{
+				Method:    c.Request().Method,
+				Route:     route,
+				RequestId: CorrelationOf(c).RequestId,
+				Count:     count,
+			}
+			alert.Statement, alert.Repeats = stats.mostRepeated()
+			if config.Repeat > alert.Repeats {
+				alert.Statement, alert.Repeats = "", 0
+			}
+			if config.Threshold >= count && "" == alert.Statement {
+				return
+			}
+
+			if "" != alert.Statement {
+				c.Logger().Warnf("N+1 query: %s %s executed %q %d times", alert.Method, route, alert.Statement, alert.Repeats)
+			} else {
+				c.Logger().Warnf("too many queries: %s %s executed %d queries", alert.Method, route, count)
+			}
+			if nil != config.Alert {
+				config.Alert(alert)
+			}
+
+			return
+		}
+	}
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{statements: make(map[string]int)}
+}
+
+func (qs *queryStats) observe(query string) {
+	atomic.AddInt64(&qs.count, 1)
+
+	statement := normalizeStatement(query)
+	qs.mutex.Lock()
+	qs.statements[statement]++
+	qs.mutex.Unlock()
+}
+
+func (qs *queryStats) total() int64 {
+	return atomic.LoadInt64(&qs.count)
+}
+
+// mostRepeated 执行次数最多的语句
+func (qs *queryStats) mostRepeated() (statement string, repeats int) {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	for s, n := range qs.statements {
+		if n > repeats || (n == repeats && s < statement) {
+			statement, repeats = s, n
+		}
+	}
+
+	return
+}
+
+// normalizeStatement 去掉字面量和多余的空白，只是参数不同的语句视为同一条
+func normalizeStatement(query string) string {
+	return sqlLiteral.ReplaceAllString(strings.Join(strings.Fields(query), " "), "?")
+}
@@ -0,0 +1,158 @@
+package echox
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// RateLimitConfig 限流中间件的配置
+	RateLimitConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 每秒生成的令牌数
+		// 必须字段
+		Rate float64
+
+		// 令牌桶的容量，即允许的突发请求数
+		// 非必须 默认值和Rate相同
+		Burst int
+
+		// 限流的维度
+		// 非必须 默认按客户端IP限流
+		KeyFunc func(echo.Context) string
+
+		// 令牌桶存储
+		// 非必须 默认存储在内存中
+		Store RateLimitStore
+	}
+
+	// RateLimitStore 令牌桶存储
+	RateLimitStore interface {
+		// Allow 从key对应的令牌桶中取一个令牌
+		Allow(key string, rate float64, burst int) (bool, error)
+	}
+
+	memoryRateLimitStore struct {
+		mutex     sync.Mutex
+		buckets   map[string]*tokenBucket
+		lastSweep time.Time
+	}
+
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+var (
+	// DefaultRateLimitConfig 默认配置
+	DefaultRateLimitConfig = RateLimitConfig{
+		Skipper: middleware.DefaultSkipper,
+		KeyFunc: func(c echo.Context) string {
+			return c.RealIP()
+		},
+	}
+
+	ErrRateLimited = echo.NewHTTPError(http.StatusTooManyRequests, "请求太频繁")
+)
+
+// NewMemoryRateLimitStore 创建内存令牌桶存储
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (mrls *memoryRateLimitStore) Allow(key string, rate float64, burst int) (allowed bool, err error) {
+	mrls.mutex.Lock()
+	defer mrls.mutex.Unlock()
+
+	now := time.Now()
+	mrls.sweep(now, rate, burst)
+
+	bucket, ok := mrls.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		mrls.buckets[key] = bucket
+	}
+	allowed = bucket.take(now, rate, burst)
+
+	return
+}
+
+// take 按流逝的时间补充令牌后取一个令牌
+func (tb *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	tb.tokens = math.Min(float64(burst), tb.tokens+now.Sub(tb.last).Seconds()*rate)
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+
+	return true
+}
+
+// sweep 每分钟清理一次已经装满的令牌桶，避免内存无限增长
+func (mrls *memoryRateLimitStore) sweep(now time.Time, rate float64, burst int) {
+	if now.Sub(mrls.lastSweep) < time.Minute {
+		return
+	}
+
+	for key, bucket := range mrls.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rate >= float64(burst) {
+			delete(mrls.buckets, key)
+		}
+	}
+	mrls.lastSweep = now
+}
+
+// RateLimit 限流中间件
+func RateLimit(rate float64) echo.MiddlewareFunc {
+	c := DefaultRateLimitConfig
+	c.Rate = rate
+
+	return RateLimitWithConfig(c)
+}
+
+// RateLimitWithConfig 限流中间件
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultRateLimitConfig.Skipper
+	}
+	if 0 >= config.Rate {
+		panic("echo: rate limit middleware requires rate")
+	}
+	if 0 >= config.Burst {
+		config.Burst = int(math.Ceil(config.Rate))
+	}
+	if nil == config.KeyFunc {
+		config.KeyFunc = DefaultRateLimitConfig.KeyFunc
+	}
+	if nil == config.Store {
+		config.Store = NewMemoryRateLimitStore()
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			if allowed, err := config.Store.Allow(config.KeyFunc(c), config.Rate, config.Burst); nil != err {
+				return err
+			} else if !allowed {
+				return ErrRateLimited
+			}
+
+			return next(c)
+		}
+	}
+}
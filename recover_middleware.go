@@ -0,0 +1,159 @@
+package echox
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// RecoverConfig 异常恢复中间件的配置
+	RecoverConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 堆栈的最大长度
+		// 非必须 默认值是4KB
+		StackSize int
+
+		// 是否采集所有协程的堆栈
+		// 非必须 默认只采集当前协程
+		StackAll bool
+
+		// 错误上报
+		// 非必须 不配置时只打印日志
+		Reporter ErrorReporter
+
+		// 用来解析上报中的用户
+		// 非必须 默认使用EchoConfig的JWT
+		JWT *JWTConfig
+	}
+
+	// ErrorReporter 错误上报，可以对接Sentry等平台
+	ErrorReporter interface {
+		// Report 上报异常，不能阻塞太久
+		Report(report *PanicReport)
+	}
+
+	// ErrorReporterFunc 函数形式的错误上报
+	ErrorReporterFunc func(report *PanicReport)
+
+	// PanicReport 异常信息
+	PanicReport struct {
+		// 异常
+		Err error
+		// 堆栈，只上报，不返回给客户端
+		Stack []byte
+		// 发生的时间
+		Time time.Time
+
+		// 请求信息
+		Method    string
+		Path      string
+		Route     string
+		RequestId string
+		UserId    string
+		Tenant    string
+		Ip        string
+		// 程序的版本
+		Version string
+	}
+)
+
+var (
+	// DefaultRecoverConfig 默认配置
+	DefaultRecoverConfig = RecoverConfig{
+		Skipper:   middleware.DefaultSkipper,
+		StackSize: 4 << 10,
+		StackAll:  false,
+	}
+
+	// ErrInternal 服务器内部错误，异常的细节不返回给客户端
+	ErrInternal = echo.NewHTTPError(http.StatusInternalServerError, "服务器内部错误")
+)
+
+func (erf ErrorReporterFunc) Report(report *PanicReport) {
+	erf(report)
+}
+
+// Recover 异常恢复中间件
+func Recover(reporter ErrorReporter) echo.MiddlewareFunc {
+	c := DefaultRecoverConfig
+	c.Reporter = reporter
+
+	return RecoverWithConfig(c)
+}
+
+// RecoverWithConfig 异常恢复中间件
+// 捕获处理器中的异常，记录堆栈并上报，客户端只收到统一的500错误
+func RecoverWithConfig(config RecoverConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultRecoverConfig.Skipper
+	}
+	if 0 >= config.StackSize {
+		config.StackSize = DefaultRecoverConfig.StackSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			defer func() {
+				r := recover()
+				if nil == r {
+					return
+				}
+				// 客户端断开时标准库用来中止处理，需要继续往上抛
+				if http.ErrAbortHandler == r {
+					panic(r)
+				}
+
+				report := config.report(c, r)
+				c.Logger().Errorf("[PANIC RECOVER] %v %s\n", report.Err, report.Stack)
+				if nil != config.Reporter {
+					config.Reporter.Report(report)
+				}
+				err = ErrInternal
+			}()
+			err = next(c)
+
+			return
+		}
+	}
+}
+
+func (rc *RecoverConfig) report(c echo.Context, r interface{}) (report *PanicReport) {
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+	stack := make([]byte, rc.StackSize)
+	stack = stack[:runtime.Stack(stack, rc.StackAll)]
+
+	report = &PanicReport{
+		Err:       err,
+		Stack:     stack,
+		Time:      time.Now(),
+		Method:    c.Request().Method,
+		Path:      c.Request().URL.Path,
+		Route:     c.Path(),
+		RequestId: CorrelationOf(c).RequestId,
+		Tenant:    TenantOf(c),
+		Ip:        c.RealIP(),
+		Version:   appVersion(),
+	}
+	if "" == report.RequestId {
+		report.RequestId = c.Response().Header().Get(echo.HeaderXRequestID)
+	}
+	if nil != rc.JWT {
+		report.UserId = userIdOf(&EchoContext{Context: c, JWT: rc.JWT})
+	}
+
+	return
+}
@@ -0,0 +1,162 @@
+package echox
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// RedirectRule 重定向规则，在路由之前执行
+	//
+	//	{From: "/old/users/:id", To: "/users/:id"}
+	//	{From: "/docs/*", To: "https://docs.example.com/*", Code: http.StatusFound}
+	RedirectRule struct {
+		// 匹配的路径，精确匹配；:name匹配一段路径，*匹配剩余的路径
+		// 必须
+		From string
+
+		// 目标地址，可以引用From中的:name和*，可以是完整的URL
+		// 必须
+		To string
+
+		// 状态码，301、302、303、307或者308
+		// 非必须 默认值是301
+		Code int
+
+		// 是否丢弃原来的查询参数，默认保留，目标地址带了查询参数时合并
+		DropQuery bool
+	}
+
+	// RewriteRule 重写规则，在路由之前修改请求路径，客户端看不到变化
+	RewriteRule struct {
+		// 匹配的路径，规则和RedirectRule.From一样
+		// 必须
+		From string
+
+		// 新的路径，可以引用From中的:name和*
+		// 必须
+		To string
+	}
+
+	pathRule struct {
+		pattern *regexp.Regexp
+		names   []string
+		order   []int
+		to      string
+	}
+)
+
+// redirectMiddleware 按顺序匹配重定向和重写规则，第一个匹配的规则生效
+func redirectMiddleware(redirects []RedirectRule, rewrites []RewriteRule) echo.MiddlewareFunc {
+	redirectRules := make([]pathRule, 0, len(redirects))
+	for _, redirect := range redirects {
+		switch redirect.Code {
+		case 0:
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			panic("echo: redirect code is invalid: " + redirect.From)
+		}
+		redirectRules = append(redirectRules, compilePathRule(redirect.From, redirect.To))
+	}
+	rewriteRules := make([]pathRule, 0, len(rewrites))
+	for _, rewrite := range rewrites {
+		if !strings.HasPrefix(rewrite.To, "/") {
+			panic("echo: rewrite target must be a path: " + rewrite.To)
+		}
+		rewriteRules = append(rewriteRules, compilePathRule(rewrite.From, rewrite.To))
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			for i, rule := range redirectRules {
+				to, ok := rule.apply(req.URL.Path)
+				if !ok {
+					continue
+				}
+				redirect := redirects[i]
+				if !redirect.DropQuery && "" != req.URL.RawQuery {
+					if strings.Contains(to, "?") {
+						to += "&" + req.URL.RawQuery
+					} else {
+						to += "?" + req.URL.RawQuery
+					}
+				}
+				code := redirect.Code
+				if 0 == code {
+					code = http.StatusMovedPermanently
+				}
+
+				return c.Redirect(code, to)
+			}
+			for _, rule := range rewriteRules {
+				if to, ok := rule.apply(req.URL.Path); ok {
+					req.URL.Path = to
+					req.URL.RawPath = ""
+					break
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// compilePathRule 把路径规则转换成正则表达式
+func compilePathRule(from string, to string) (rule pathRule) {
+	if !strings.HasPrefix(from, "/") || "" == to {
+		panic("echo: path rule requires from and to: " + from)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	segments := strings.Split(from, "/")
+	for i, segment := range segments {
+		if 0 != i {
+			sb.WriteString("/")
+		}
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			rule.names = append(rule.names, segment)
+			sb.WriteString("([^/]+)")
+		case "*" == segment && len(segments)-1 == i:
+			rule.names = append(rule.names, segment)
+			sb.WriteString("(.*)")
+		default:
+			sb.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+	sb.WriteString("$")
+	rule.pattern = regexp.MustCompile(sb.String())
+	rule.to = to
+	// 长的参数名先替换，避免:id替换了:idx的前缀
+	rule.order = make([]int, len(rule.names))
+	for i := range rule.order {
+		rule.order[i] = i
+	}
+	sort.SliceStable(rule.order, func(i, j int) bool {
+		return len(rule.names[rule.order[i]]) > len(rule.names[rule.order[j]])
+	})
+
+	return
+}
+
+// apply 匹配时返回替换了参数的目标
+func (pr pathRule) apply(path string) (to string, ok bool) {
+	matches := pr.pattern.FindStringSubmatch(path)
+	if nil == matches {
+		return
+	}
+
+	to = pr.to
+	for _, index := range pr.order {
+		to = strings.ReplaceAll(to, pr.names[index], matches[index+1])
+	}
+	ok = true
+
+	return
+}
@@ -0,0 +1,336 @@
+package echox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+type (
+	// RedisConfig Redis连接的配置
+	RedisConfig struct {
+		// 地址
+		// 非必须 默认值是"localhost:6379"
+		Address string
+
+		// 密码
+		Password string
+
+		// 数据库
+		DB int
+
+		// TLS的配置，为空时不加密，ServerName为空时使用地址中的主机名
+		TLS *tls.Config
+
+		// 最多保留的空闲连接数
+		// 非必须 默认值是10
+		PoolSize int
+
+		// 连接和单个命令的超时时间，上下文有截止时间时以上下文为准
+		// 非必须 默认值是5秒
+		Timeout time.Duration
+	}
+
+	// Redis 精简的Redis客户端，只实现RESP协议，不依赖第三方的库
+	// 只连接单个节点，哨兵和集群使用go-redis等客户端自己实现PubSub
+	Redis struct {
+		config RedisConfig
+		pool   chan *redisConn
+	}
+
+	// RedisError Redis返回的错误
+	RedisError string
+
+	redisConn struct {
+		conn   net.Conn
+		reader *bufio.Reader
+		writer *bufio.Writer
+	}
+)
+
+var (
+	// DefaultRedisConfig 默认配置
+	DefaultRedisConfig = RedisConfig{
+		Address:  "localhost:6379",
+		PoolSize: 10,
+		Timeout:  5 * time.Second,
+	}
+
+	errRedisProtocol = errors.New("redis: 协议错误")
+)
+
+// NewRedis 创建Redis客户端，连接在第一次使用时建立
+func NewRedis(config RedisConfig) *Redis {
+	if "" == config.Address {
+		config.Address = DefaultRedisConfig.Address
+	}
+	if 0 >= config.PoolSize {
+		config.PoolSize = DefaultRedisConfig.PoolSize
+	}
+	if 0 >= config.Timeout {
+		config.Timeout = DefaultRedisConfig.Timeout
+	}
+
+	return &Redis{config: config, pool: make(chan *redisConn, config.PoolSize)}
+}
+
+func (re RedisError) Error() string {
+	return "redis: " + string(re)
+}
+
+// Do 执行命令，返回值是string、int64、[]byte、[]interface{}或者nil
+func (r *Redis) Do(ctx context.Context, args ...interface{}) (reply interface{}, err error) {
+	var rc *redisConn
+	if rc, err = r.get(ctx); nil != err {
+		return
+	}
+
+	reply, err = rc.do(r.deadline(ctx), args...)
+	// 网络错误后连接的状态不确定，不能再放回连接池
+	var redisErr RedisError
+	if nil == err || errors.As(err, &redisErr) {
+		r.put(rc)
+	} else {
+		_ = rc.conn.Close()
+	}
+
+	return
+}
+
+// Close 关闭空闲的连接
+func (r *Redis) Close() error {
+	for {
+		select {
+		case rc := <-r.pool:
+			_ = rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (r *Redis) get(ctx context.Context) (rc *redisConn, err error) {
+	select {
+	case rc = <-r.pool:
+		return
+	default:
+	}
+
+	return r.dial(ctx)
+}
+
+func (r *Redis) put(rc *redisConn) {
+	select {
+	case r.pool <- rc:
+	default:
+		_ = rc.conn.Close()
+	}
+}
+
+// dial 建立连接，配置了密码和数据库时先认证和选择数据库
+func (r *Redis) dial(ctx context.Context) (rc *redisConn, err error) {
+	dialer := &net.Dialer{Timeout: r.config.Timeout}
+	var conn net.Conn
+	if nil != r.config.TLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: r.config.TLS}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", r.config.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", r.config.Address)
+	}
+	if nil != err {
+		return
+	}
+	rc = &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+
+	deadline := r.deadline(ctx)
+	if "" != r.config.Password {
+		if _, err = rc.do(deadline, "AUTH", r.config.Password); nil != err {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if 0 != r.config.DB {
+		if _, err = rc.do(deadline, "SELECT", r.config.DB); nil != err {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return
+}
+
+func (r *Redis) deadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+
+	return time.Now().Add(r.config.Timeout)
+}
+
+func (rc *redisConn) do(deadline time.Time, args ...interface{}) (reply interface{}, err error) {
+	if err = rc.conn.SetDeadline(deadline); nil != err {
+		return
+	}
+	if err = rc.write(args...); nil != err {
+		return
+	}
+
+	return rc.read()
+}
+
+// write 按RESP数组发送命令，每个参数都是批量字符串
+func (rc *redisConn) write(args ...interface{}) (err error) {
+	if _, err = fmt.Fprintf(rc.writer, "*%d\r\n", len(args)); nil != err {
+		return
+	}
+	for _, arg := range args {
+		var value string
+		switch v := arg.(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		default:
+			value = fmt.Sprint(v)
+		}
+		if _, err = fmt.Fprintf(rc.writer, "$%d\r\n%s\r\n", len(value), value); nil != err {
+			return
+		}
+	}
+
+	return rc.writer.Flush()
+}
+
+func (rc *redisConn) read() (reply interface{}, err error) {
+	var line string
+	if line, err = rc.reader.ReadString('\n'); nil != err {
+		return
+	}
+	if len(line) < 3 || '\r' != line[len(line)-2] {
+		return nil, errRedisProtocol
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		var size int
+		if size, err = strconv.Atoi(line[1:]); nil != err || 0 > size {
+			return
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(rc.reader, data); nil != err {
+			return
+		}
+
+		return data[:size], nil
+	case '*':
+		var size int
+		if size, err = strconv.Atoi(line[1:]); nil != err || 0 > size {
+			return
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			if items[i], err = rc.read(); nil != err {
+				var redisErr RedisError
+				// 事务中单个命令的错误放在数组里
+				if !errors.As(err, &redisErr) {
+					return
+				}
+				items[i], err = redisErr, nil
+			}
+		}
+
+		return items, nil
+	default:
+		return nil, errRedisProtocol
+	}
+}
+
+// redisString 把回复转换成字符串，nil转换成空字符串
+func redisString(reply interface{}) string {
+	switch value := reply.(type) {
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	default:
+		return ""
+	}
+}
+
+// redisStrings 把数组回复转换成字符串列表
+func redisStrings(reply interface{}) (values []string) {
+	items, _ := reply.([]interface{})
+	values = make([]string, 0, len(items))
+	for _, item := range items {
+		values = append(values, redisString(item))
+	}
+
+	return
+}
+
+// Publish 发布消息
+func (r *Redis) Publish(ctx context.Context, channel string, data []byte) (err error) {
+	_, err = r.Do(ctx, "PUBLISH", channel, data)
+
+	return
+}
+
+// Subscribe 订阅频道，使用单独的连接，阻塞到ctx取消或者连接出错
+func (r *Redis) Subscribe(ctx context.Context, channel string, handler func(data []byte)) (err error) {
+	var rc *redisConn
+	if rc, err = r.dial(ctx); nil != err {
+		return
+	}
+	defer rc.conn.Close()
+
+	if err = rc.conn.SetDeadline(r.deadline(ctx)); nil != err {
+		return
+	}
+	if err = rc.write("SUBSCRIBE", channel); nil != err {
+		return
+	}
+	// 订阅后一直等待消息，不能有读超时，ctx取消时关闭连接来结束读取
+	if err = rc.conn.SetDeadline(time.Time{}); nil != err {
+		return
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = rc.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		var reply interface{}
+		if reply, err = rc.read(); nil != err {
+			if nil != ctx.Err() {
+				err = nil
+			}
+
+			return
+		}
+		// 消息的格式是["message", channel, data]，订阅的确认忽略
+		if items, ok := reply.([]interface{}); ok && 3 == len(items) && "message" == redisString(items[0]) {
+			data, _ := items[2].([]byte)
+			handler(data)
+		}
+	}
+}
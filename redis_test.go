@@ -0,0 +1,142 @@
+package echox
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRedis 只支持测试用到的几个命令
+func fakeRedis(t *testing.T, listener net.Listener) {
+	values := make(map[string]string)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rc := &redisConn{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+				for {
+					reply, err := rc.read()
+					if nil != err {
+						return
+					}
+					args := redisStrings(reply)
+					switch strings.ToUpper(args[0]) {
+					case "AUTH":
+						if "secret" != args[1] {
+							fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+						} else {
+							fmt.Fprint(conn, "+OK\r\n")
+						}
+					case "SET":
+						values[args[1]] = args[2]
+						fmt.Fprint(conn, "+OK\r\n")
+					case "GET":
+						fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(values[args[1]]), values[args[1]])
+					case "SUBSCRIBE":
+						fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+						fmt.Fprintf(conn, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$5\r\nhello\r\n", len(args[1]), args[1])
+					default:
+						fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+					}
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { _ = listener.Close() })
+}
+
+func localListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return listener
+}
+
+// testTLS 借用httptest的证书，证书对127.0.0.1有效
+func testTLS(t *testing.T) (server *tls.Config, client *tls.Config) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	server = &tls.Config{Certificates: srv.TLS.Certificates}
+	client = srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+
+	return
+}
+
+func TestRedisDo(t *testing.T) {
+	listener := localListener(t)
+	fakeRedis(t, listener)
+	redis := NewRedis(RedisConfig{Address: listener.Addr().String(), Password: "secret"})
+	defer redis.Close()
+
+	ctx := context.Background()
+	if _, err := redis.Do(ctx, "SET", "name", []byte("echox")); nil != err {
+		t.Fatal(err)
+	}
+	reply, err := redis.Do(ctx, "GET", "name")
+	if nil != err || "echox" != redisString(reply) {
+		t.Fatalf("读到了%v，错误是%v", reply, err)
+	}
+
+	var redisErr RedisError
+	if _, err = redis.Do(ctx, "NOPE"); !errors.As(err, &redisErr) {
+		t.Fatalf("Redis的错误应该是RedisError：%v", err)
+	}
+	// 命令的错误不影响连接，还能继续使用
+	if _, err = redis.Do(ctx, "GET", "name"); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisAuthFailed(t *testing.T) {
+	listener := localListener(t)
+	fakeRedis(t, listener)
+	redis := NewRedis(RedisConfig{Address: listener.Addr().String(), Password: "wrong"})
+
+	var redisErr RedisError
+	if _, err := redis.Do(context.Background(), "GET", "name"); !errors.As(err, &redisErr) {
+		t.Fatalf("密码错误时应该返回RedisError：%v", err)
+	}
+}
+
+func TestRedisSubscribeOverTLS(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	listener := tls.NewListener(localListener(t), serverTLS)
+	fakeRedis(t, listener)
+	redis := NewRedis(RedisConfig{Address: listener.Addr().String(), TLS: clientTLS})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- redis.Subscribe(ctx, "events", func(data []byte) { received <- string(data) })
+	}()
+
+	select {
+	case data := <-received:
+		if "hello" != data {
+			t.Fatalf("收到了%q", data)
+		}
+	case err := <-done:
+		t.Fatalf("订阅提前结束：%v", err)
+	}
+	cancel()
+	if err := <-done; nil != err {
+		t.Fatalf("取消订阅不应该返回错误：%v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	// HeaderXRegion 区域提示
+	HeaderXRegion = "X-Region"
+	// HeaderXRegionForwarded 已经被转发到目标区域，防止循环转发
+	HeaderXRegionForwarded = "X-Region-Forwarded"
+
+	// RegionRedirect 重定向到目标区域
+	RegionRedirect = "redirect"
+	// RegionProxy 代理到目标区域
+	RegionProxy = "proxy"
+	// RegionLocal 只识别区域，都在本地处理
+	RegionLocal = "local"
+
+	regionKey = "echox.region"
+)
+
+type (
+	// RegionConfig 多区域路由配置
+	RegionConfig struct {
+		// 跳过路由
+		Skipper middleware.Skipper
+
+		// 当前部署所在的区域
+		// 必须
+		Local string
+
+		// 读取区域提示的请求头
+		// 非必须 默认值是"X-Region"
+		Header string
+
+		// 从请求中推断区域，比如从用户信息中读取，返回空时使用请求头
+		// 非必须
+		Resolver func(c echo.Context) string
+
+		// 区域和部署地址的映射，比如"eu": "https://eu.example.com"
+		Regions map[string]string
+
+		// 请求不属于当前区域时的处理方式
+		// 非必须 默认值是redirect
+		Mode string
+	}
+)
+
+// RegionOf 当前请求所属的区域
+func RegionOf(c echo.Context) string {
+	if region, ok := c.Get(regionKey).(string); ok {
+		return region
+	}
+
+	return ""
+}
+
+func (ec *EchoContext) Region() string {
+	return RegionOf(ec.Context)
+}
+
+// RegionWithConfig 多区域路由中间件
+func RegionWithConfig(config RegionConfig) echo.MiddlewareFunc {
+	if "" == config.Local {
+		panic("echo: region requires the local region")
+	}
+	if nil == config.Skipper {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if "" == config.Header {
+		config.Header = HeaderXRegion
+	}
+	if "" == config.Mode {
+		config.Mode = RegionRedirect
+	}
+
+	targets := make(map[string]*url.URL, len(config.Regions))
+	proxies := make(map[string]*httputil.ReverseProxy, len(config.Regions))
+	for region, address := range config.Regions {
+		target, err := url.Parse(address)
+		if nil != err {
+			panic("echo: region address is invalid: " + address)
+		}
+		targets[strings.ToLower(region)] = target
+		proxies[strings.ToLower(region)] = httputil.NewSingleHostReverseProxy(target)
+	}
+	local := strings.ToLower(config.Local)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			region := ""
+			if nil != config.Resolver {
+				region = config.Resolver(c)
+			}
+			if "" == region {
+				region = req.Header.Get(config.Header)
+			}
+			region = strings.ToLower(strings.TrimSpace(region))
+			// 未知的区域在本地处理，也避免日志和指标中出现任意的取值
+			if _, ok := targets[region]; !ok {
+				region = local
+			}
+			c.Set(regionKey, region)
+			req.Header.Set(HeaderXRegion, region)
+
+			if local == region || RegionLocal == config.Mode || "" != req.Header.Get(HeaderXRegionForwarded) {
+				return next(c)
+			}
+
+			switch config.Mode {
+			case RegionProxy:
+				req.Header.Set(HeaderXRegionForwarded, config.Local)
+				proxies[region].ServeHTTP(c.Response(), req)
+
+				return nil
+			default:
+				location := *targets[region]
+				location.Path = strings.TrimSuffix(location.Path, "/") + req.URL.Path
+				location.RawQuery = req.URL.RawQuery
+
+				return c.Redirect(http.StatusTemporaryRedirect, location.String())
+			}
+		}
+	}
+}
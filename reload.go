@@ -0,0 +1,97 @@
+package echox
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// reloadable 可以在运行时替换的配置
+	reloadable struct {
+		cors      echo.MiddlewareFunc
+		rateLimit echo.MiddlewareFunc
+		features  map[string]bool
+	}
+)
+
+var (
+	reloadMutex sync.Mutex
+	running     *echo.Echo
+	runningJWT  *JWTConfig
+	applied     *EchoConfig
+	current     atomic.Value
+	// rateLimitStore 没有配置存储时使用的内存存储，重新加载时保留，不然令牌桶会重置
+	rateLimitStore RateLimitStore
+)
+
+// Reload 在运行时重新加载配置
+// 只有日志级别、限流、跨域、功能开关和JWT密钥支持热加载，其它配置需要重启才能生效
+// 所有配置一起替换，请求不会看到只生效了一半的配置
+func Reload(ec *EchoConfig) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if nil == running {
+		return
+	}
+	if !ec.MutableConfig {
+		watchDrift(ec)
+		ec = ec.Clone()
+	}
+	apply(running, ec)
+}
+
+func apply(e *echo.Echo, ec *EchoConfig) {
+	r := &reloadable{features: ec.Features}
+	if nil != ec.CORS {
+		r.cors = middleware.CORSWithConfig(*ec.CORS)
+	}
+	if nil != ec.RateLimit {
+		config := *ec.RateLimit
+		if nil == config.Store {
+			if nil == rateLimitStore {
+				rateLimitStore = NewMemoryRateLimitStore()
+			}
+			config.Store = rateLimitStore
+		}
+		r.rateLimit = RateLimitWithConfig(config)
+	}
+	current.Store(r)
+	applied = ec
+
+	if 0 != ec.LogLevel {
+		e.Logger.SetLevel(ec.LogLevel)
+	}
+	if nil != runningJWT && nil != ec.JWT && nil != ec.JWT.SigningKey {
+		runningJWT.SetSigningKey(ec.JWT.SigningKey)
+	}
+}
+
+// Feature 功能开关是否打开
+func Feature(name string) (enabled bool) {
+	if r, ok := current.Load().(*reloadable); ok {
+		enabled = r.features[name]
+	}
+
+	return
+}
+
+// reloadableMiddleware 每次请求都使用最新加载的配置
+func reloadableMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h := next
+		if r, ok := current.Load().(*reloadable); ok {
+			if nil != r.rateLimit {
+				h = r.rateLimit(h)
+			}
+			if nil != r.cors {
+				h = r.cors(h)
+			}
+		}
+
+		return h(c)
+	}
+}
@@ -0,0 +1,85 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+func TestReloadKeepsRateLimitBuckets(t *testing.T) {
+	ec := NewDefaultConfig()
+	ec.RateLimit = &RateLimitConfig{Rate: 0.001, Burst: 1}
+	ec.Routes = []RouteFunc{Register(Route{Method: echo.GET, Path: "/ping", Handler: func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}})}
+	e := New(ec)
+
+	ping := func() int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+		return rec.Code
+	}
+	if http.StatusNoContent != ping() || http.StatusTooManyRequests != ping() {
+		t.Fatal("第二个请求应该被限流")
+	}
+
+	Reload(ec.Clone())
+	if code := ping(); http.StatusTooManyRequests != code {
+		t.Fatalf("重新加载后令牌桶被重置了，返回了%d", code)
+	}
+}
+
+func TestReloadSigningKeyGrace(t *testing.T) {
+	tests := map[string]struct {
+		grace    time.Duration
+		expected int
+	}{
+		"宽限期内旧Token有效":  {grace: 0, expected: http.StatusNoContent},
+		"没有宽限期旧Token失效": {grace: -1, expected: http.StatusUnauthorized},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ec := NewDefaultConfig()
+			ec.JWT = &JWTConfig{SigningKey: "old", SigningKeyGrace: test.grace}
+			ec.Routes = []RouteFunc{Register(Route{Method: echo.GET, Path: "/me", Auth: AuthJWT, Handler: func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			}})}
+			e := New(ec)
+			me := func(token string) int {
+				req := httptest.NewRequest(http.MethodGet, "/me", nil)
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+
+				return rec.Code
+			}
+
+			user := gox.BaseUser{Id: 7, Username: "alice"}
+			old, err := ec.JWT.UserToken(user)
+			if nil != err {
+				t.Fatal(err)
+			}
+			reloaded := ec.Clone()
+			reloaded.JWT = &JWTConfig{SigningKey: "new"}
+			Reload(reloaded)
+			// 相同的密钥再加载一次不影响宽限期
+			Reload(reloaded)
+
+			current, err := ec.JWT.UserToken(user)
+			if nil != err {
+				t.Fatal(err)
+			}
+			if old == current || http.StatusNoContent != me(current) {
+				t.Fatal("新签发的Token应该使用新密钥")
+			}
+			if code := me(old); test.expected != code {
+				t.Fatalf("旧Token返回了%d，应该是%d", code, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package echox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ConfigProvider 配置中心
+	ConfigProvider interface {
+		// Get 读取配置，不存在时返回ErrConfigNotFound
+		Get(ctx context.Context) ([]byte, error)
+		// Watch 监听配置变化，每次变化调用onChange，ctx取消时返回
+		Watch(ctx context.Context, onChange func(data []byte)) error
+	}
+
+	// RemoteConfig 从配置中心加载配置的配置
+	// 配置变化后通过Reload热加载，和Reload一样只有部分配置支持热加载
+	RemoteConfig struct {
+		// 配置中心
+		// 必须字段
+		Provider ConfigProvider
+
+		// 把配置中心的内容转换成新的配置，一般是在当前配置的基础上修改后返回
+		// 必须字段
+		Apply func(data []byte) (*EchoConfig, error)
+
+		// 监听失败后重试的间隔
+		// 非必须 默认值是5秒
+		Retry time.Duration
+	}
+)
+
+var (
+	// ErrConfigNotFound 配置中心没有这个配置
+	ErrConfigNotFound = errors.New("配置不存在")
+)
+
+// LoadRemote 启动前从配置中心读取配置
+func LoadRemote(ctx context.Context, provider ConfigProvider, apply func(data []byte) (*EchoConfig, error)) (ec *EchoConfig, err error) {
+	var data []byte
+	if data, err = provider.Get(ctx); nil != err {
+		return
+	}
+
+	return apply(data)
+}
+
+// worker 监听配置变化的后台任务，出错后按间隔重试
+func (rc *RemoteConfig) worker(e *echo.Echo) Worker {
+	if nil == rc.Provider {
+		panic("echo: remote config requires a provider")
+	}
+	if nil == rc.Apply {
+		panic("echo: remote config requires an apply function")
+	}
+	retry := rc.Retry
+	if 0 >= retry {
+		retry = 5 * time.Second
+	}
+
+	var last []byte
+	return Worker{
+		Name:     "remote-config",
+		Interval: retry,
+		Run: func(ctx context.Context) (err error) {
+			// 重连后先读取一次，避免错过断开期间的变化
+			var data []byte
+			if data, err = rc.Provider.Get(ctx); nil != err && ErrConfigNotFound != err {
+				return
+			}
+			onChange := func(data []byte) {
+				if nil != last && bytes.Equal(last, data) {
+					return
+				}
+				ec, err := rc.Apply(data)
+				if nil != err {
+					// 错误的配置不生效，继续使用当前配置
+					e.Logger.Errorf("remote config rejected: %v", err)
+					return
+				}
+				last = data
+				Reload(ec)
+				e.Logger.Infof("remote config reloaded")
+			}
+			if nil == err {
+				onChange(data)
+			}
+
+			return rc.Provider.Watch(ctx, onChange)
+		},
+	}
+}
+
+// remoteRequest 发送请求并读取响应
+func remoteRequest(ctx context.Context, client *http.Client, method string, url string, body io.Reader, header http.Header) (rsp *http.Response, data []byte, err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, method, url, body); nil != err {
+		return
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if rsp, err = client.Do(req); nil != err {
+		return
+	}
+	defer rsp.Body.Close()
+	data, err = ioutil.ReadAll(rsp.Body)
+
+	return
+}
@@ -0,0 +1,277 @@
+package echox
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/xml"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// Encoder 把数据编码成某种格式
+	Encoder func(w io.Writer, data interface{}) error
+
+	renderEncoding struct {
+		mimeType    string
+		contentType string
+		encoder     Encoder
+	}
+
+	accepted struct {
+		mimeType string
+		q        float64
+	}
+
+	// negotiation 一个Accept请求头协商的结果，nil表示使用JSON
+	negotiation struct {
+		// 普通的数据按客户端能接受的格式中优先级最高的
+		preferred *renderEncoding
+		// 错误保持JSON，只有客户端最优先的格式是注册的格式时才换
+		strict *renderEncoding
+	}
+
+	// negotiationCache 协商结果的LRU缓存，随意构造的Accept请求头只会挤掉最久没有使用的结果
+	negotiationCache struct {
+		mutex      sync.Mutex
+		limit      int
+		generation uint64
+		entries    map[string]*list.Element
+		order      *list.List
+	}
+
+	negotiationEntry struct {
+		accept      string
+		negotiation negotiation
+	}
+)
+
+var (
+	encodingMutex sync.RWMutex
+	encodings     = []*renderEncoding{
+		{mimeType: echo.MIMEApplicationXML, contentType: echo.MIMEApplicationXMLCharsetUTF8, encoder: encodeXML},
+		{mimeType: echo.MIMETextXML, contentType: echo.MIMETextXMLCharsetUTF8, encoder: encodeXML},
+		{mimeType: echo.MIMEApplicationMsgpack, contentType: echo.MIMEApplicationMsgpack, encoder: encodeMsgpack},
+	}
+
+	// negotiated 协商的结果，客户端的Accept种类有限，缓存后不用每次解析，注册编码器时清空
+	negotiated = newNegotiationCache(negotiatedLimit)
+
+	renderBuffers = sync.Pool{
+		New: func() interface{} {
+			return new(bytes.Buffer)
+		},
+	}
+)
+
+const (
+	// negotiatedLimit 缓存的Accept的数量，超出后淘汰最久没有使用的
+	negotiatedLimit = 256
+	// renderBufferLimit 超过这个大小的缓冲不放回池中
+	renderBufferLimit = 64 << 10
+)
+
+// RegisterEncoder 注册编码器，已经存在的类型会被覆盖
+// JSON总是使用上下文的JSON方法，不能覆盖
+func RegisterEncoder(mimeType string, contentType string, encoder Encoder) {
+	encodingMutex.Lock()
+	defer encodingMutex.Unlock()
+
+	negotiated.reset()
+	for _, e := range encodings {
+		if e.mimeType == mimeType {
+			e.contentType = contentType
+			e.encoder = encoder
+
+			return
+		}
+	}
+	encodings = append(encodings, &renderEncoding{mimeType: mimeType, contentType: contentType, encoder: encoder})
+}
+
+// Render 根据Accept请求头选择格式返回数据
+// 客户端没有要求或者要求的格式都不支持时使用JSON
+// 配置了Fields中间件时按客户端选择的字段裁剪
+func Render(c echo.Context, code int, data interface{}) error {
+	return render(c, code, data, negotiate(c.Request().Header.Get(echo.HeaderAccept)).preferred)
+}
+
+// renderError 输出错误，浏览器的Accept中有application/xml，但是错误仍然使用JSON
+func renderError(c echo.Context, code int, data interface{}) error {
+	return render(c, code, data, negotiate(c.Request().Header.Get(echo.HeaderAccept)).strict)
+}
+
+func render(c echo.Context, code int, data interface{}, e *renderEncoding) (err error) {
+	if data, err = maskResponse(c, code, data); nil != err {
+		return
+	}
+
+	if nil == e {
+		return c.JSON(code, data)
+	}
+
+	buffer := renderBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if renderBufferLimit >= buffer.Cap() {
+			buffer.Reset()
+			renderBuffers.Put(buffer)
+		}
+	}()
+	if err = e.encoder(buffer, data); nil != err {
+		return
+	}
+
+	return c.Blob(code, e.contentType, buffer.Bytes())
+}
+
+// negotiate 按Accept请求头中的优先级选择编码器
+func negotiate(accept string) (n negotiation) {
+	if "" == accept {
+		return
+	}
+
+	n, generation, ok := negotiated.get(accept)
+	if ok {
+		return
+	}
+
+	// 解析时不持有缓存的锁，只读取编码器
+	encodingMutex.RLock()
+	n = selectEncoding(accept)
+	encodingMutex.RUnlock()
+	negotiated.put(accept, n, generation)
+
+	return
+}
+
+func newNegotiationCache(limit int) *negotiationCache {
+	return &negotiationCache{
+		limit:   limit,
+		entries: make(map[string]*list.Element, limit),
+		order:   list.New(),
+	}
+}
+
+// get 读取缓存的结果，没有命中时返回当前的版本，写入时用来判断期间有没有注册编码器
+func (nc *negotiationCache) get(accept string) (n negotiation, generation uint64, ok bool) {
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	var element *list.Element
+	if element, ok = nc.entries[accept]; ok {
+		// 常用的Accept一般已经在最前面
+		if nc.order.Front() != element {
+			nc.order.MoveToFront(element)
+		}
+		n = element.Value.(*negotiationEntry).negotiation
+	}
+	generation = nc.generation
+
+	return
+}
+
+// put 写入解析的结果，解析期间注册了编码器时结果可能已经过时，不写入
+func (nc *negotiationCache) put(accept string, n negotiation, generation uint64) {
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	if generation != nc.generation {
+		return
+	}
+	if element, ok := nc.entries[accept]; ok {
+		element.Value.(*negotiationEntry).negotiation = n
+		nc.order.MoveToFront(element)
+
+		return
+	}
+	if nc.limit <= nc.order.Len() {
+		oldest := nc.order.Back()
+		nc.order.Remove(oldest)
+		delete(nc.entries, oldest.Value.(*negotiationEntry).accept)
+	}
+	nc.entries[accept] = nc.order.PushFront(&negotiationEntry{accept: accept, negotiation: n})
+}
+
+func (nc *negotiationCache) reset() {
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	nc.generation++
+	nc.entries = make(map[string]*list.Element, nc.limit)
+	nc.order.Init()
+}
+
+// selectEncoding 解析Accept请求头，调用时需要持有encodingMutex的读锁
+func selectEncoding(accept string) (n negotiation) {
+	accepts := make([]accepted, 0)
+	eachHeaderValue(accept, func(part string) bool {
+		mimeType, params, err := mime.ParseMediaType(part)
+		if nil != err {
+			return true
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); nil != err {
+				return true
+			}
+		}
+		if 0 < q {
+			accepts = append(accepts, accepted{mimeType: mimeType, q: q})
+		}
+
+		return true
+	})
+	sort.SliceStable(accepts, func(i, j int) bool {
+		return accepts[i].q > accepts[j].q
+	})
+
+	for index, a := range accepts {
+		if echo.MIMEApplicationJSON == a.mimeType || "*/*" == a.mimeType || "application/*" == a.mimeType {
+			return
+		}
+		if e := encodingOf(a.mimeType); nil != e {
+			n.preferred = e
+			if 0 == index {
+				n.strict = e
+			}
+
+			return
+		}
+	}
+
+	return
+}
+
+func encodingOf(mimeType string) *renderEncoding {
+	for _, e := range encodings {
+		if e.mimeType == mimeType {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func encodeXML(w io.Writer, data interface{}) (err error) {
+	if _, err = w.Write([]byte(xml.Header)); nil != err {
+		return
+	}
+
+	return xml.NewEncoder(w).Encode(data)
+}
+
+func encodeMsgpack(w io.Writer, data interface{}) (err error) {
+	var b []byte
+	if b, err = MarshalMsgpack(data); nil != err {
+		return
+	}
+	_, err = w.Write(b)
+
+	return
+}
@@ -0,0 +1,40 @@
+package echox
+
+import (
+	"strconv"
+	"testing"
+)
+
+func BenchmarkNegotiate(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		accept := "text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8"
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			negotiate(accept)
+		}
+	})
+	// 每次都是新的Accept，缓存不会命中
+	b.Run("random", func(b *testing.B) {
+		accepts := make([]string, 4096)
+		for i := range accepts {
+			accepts[i] = "application/xml;q=0.9, application/x-" + strconv.Itoa(i)
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			negotiate(accepts[i%len(accepts)])
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		accept := "application/xml, application/json;q=0.9"
+
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				negotiate(accept)
+			}
+		})
+	})
+}
@@ -0,0 +1,170 @@
+package echox
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// envListenFD 继承的监听的文件描述符
+	envListenFD = "ECHOX_LISTEN_FD"
+	// envParentPID 新进程准备好后通知旧进程退出
+	envParentPID = "ECHOX_PARENT_PID"
+)
+
+type (
+	// RestartConfig 不中断连接的重启
+	// 收到信号后启动新进程并把监听交给它，新进程准备好后旧进程按优雅退出的流程处理完请求再退出
+	// 只继承HTTP的监听，gRPC和HTTP/3使用单独的端口时不会继承
+	RestartConfig struct {
+		// 触发重启的信号
+		// 非必须 默认值是SIGUSR2，Windows不支持
+		Signal os.Signal
+
+		// 使用SO_REUSEPORT监听，新进程自己监听同一个端口，适合由部署工具启动新进程再停止旧进程
+		// 非必须 默认不开启，只支持Linux和BSD
+		ReusePort bool
+	}
+
+	filer interface {
+		File() (*os.File, error)
+	}
+)
+
+var (
+	// ErrRestartUnsupported 系统不支持重启
+	ErrRestartUnsupported = errors.New("系统不支持不中断连接的重启")
+
+	restarting int32
+)
+
+// listen 优先使用继承的监听，其次按配置监听
+func listen(ec *EchoConfig) (listener net.Listener, err error) {
+	if value := os.Getenv(envListenFD); "" != value {
+		var fd int
+		if fd, err = strconv.Atoi(value); nil != err {
+			return
+		}
+		file := os.NewFile(uintptr(fd), "listener")
+		defer file.Close()
+		// 再重启时重新设置
+		_ = os.Unsetenv(envListenFD)
+
+		return net.FileListener(file)
+	}
+
+	if nil != ec.Restart && ec.Restart.ReusePort {
+		return reusePortListen(ec.Address())
+	}
+
+	return net.Listen("tcp", ec.Address())
+}
+
+// takeOver 新进程准备好了，通知旧进程退出
+func takeOver(e *echo.Echo) {
+	value := os.Getenv(envParentPID)
+	if "" == value {
+		return
+	}
+	_ = os.Unsetenv(envParentPID)
+
+	pid, err := strconv.Atoi(value)
+	if nil != err {
+		return
+	}
+	if parent, findErr := os.FindProcess(pid); nil == findErr {
+		if err = parent.Signal(syscall.SIGTERM); nil != err {
+			e.Logger.Errorf("通知旧进程%d退出出错：%v", pid, err)
+		}
+	}
+}
+
+// watch 等待重启的信号
+func (rc *RestartConfig) watch(e *echo.Echo, listener net.Listener) {
+	sig := rc.Signal
+	if nil == sig {
+		sig = defaultRestartSignal
+	}
+	if nil == sig {
+		e.Logger.Warn(ErrRestartUnsupported)
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+	go func() {
+		for range signals {
+			if err := rc.restart(listener); nil != err {
+				e.Logger.Errorf("重启出错：%v", err)
+			}
+		}
+	}()
+}
+
+// restart 启动新进程，新进程准备好之前旧进程继续处理请求，新进程启动失败时旧进程不受影响
+func (rc *RestartConfig) restart(listener net.Listener) (err error) {
+	if !atomic.CompareAndSwapInt32(&restarting, 0, 1) {
+		return errors.New("正在重启")
+	}
+
+	var executable string
+	if executable, err = os.Executable(); nil != err {
+		atomic.StoreInt32(&restarting, 0)
+		return
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = restartEnv()
+
+	if !rc.ReusePort {
+		f, ok := listener.(filer)
+		if !ok {
+			atomic.StoreInt32(&restarting, 0)
+			return ErrRestartUnsupported
+		}
+		var file *os.File
+		if file, err = f.File(); nil != err {
+			atomic.StoreInt32(&restarting, 0)
+			return
+		}
+		defer file.Close()
+		// ExtraFiles从3开始编号
+		cmd.ExtraFiles = []*os.File{file}
+		cmd.Env = append(cmd.Env, envListenFD+"=3")
+	}
+
+	if err = cmd.Start(); nil != err {
+		atomic.StoreInt32(&restarting, 0)
+		return
+	}
+	// 新进程没有接管就退出时允许再次重启
+	go func() {
+		_ = cmd.Wait()
+		atomic.StoreInt32(&restarting, 0)
+	}()
+
+	return
+}
+
+// restartEnv 去掉上一次重启留下的环境变量
+func restartEnv() (env []string) {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envListenFD+"=") || strings.HasPrefix(kv, envParentPID+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	return append(env, envParentPID+"="+strconv.Itoa(os.Getpid()))
+}
@@ -0,0 +1,10 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+// +build darwin freebsd netbsd openbsd dragonfly
+
+package echox
+
+import (
+	"syscall"
+)
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,4 @@
+package echox
+
+// soReusePort syscall包中没有Linux的SO_REUSEPORT
+const soReusePort = 0xf
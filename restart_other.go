@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package echox
+
+import (
+	"net"
+	"os"
+)
+
+// defaultRestartSignal 其它系统没有SIGUSR2
+var defaultRestartSignal os.Signal
+
+func reusePortListen(_ string) (net.Listener, error) {
+	return nil, ErrRestartUnsupported
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package echox
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+)
+
+var defaultRestartSignal os.Signal = syscall.SIGUSR2
+
+// reusePortListen 使用SO_REUSEPORT监听，多个进程可以同时监听同一个端口
+func reusePortListen(address string) (net.Listener, error) {
+	config := net.ListenConfig{
+		Control: func(_ string, _ string, conn syscall.RawConn) (err error) {
+			controlErr := conn.Control(func(fd uintptr) {
+				err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			if nil == err {
+				err = controlErr
+			}
+
+			return
+		},
+	}
+
+	return config.Listen(context.Background(), "tcp", address)
+}
@@ -0,0 +1,399 @@
+package echox
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/random"
+)
+
+const (
+	HeaderUploadOffset   = "Upload-Offset"
+	HeaderUploadLength   = "Upload-Length"
+	HeaderUploadChecksum = "Upload-Checksum"
+	HeaderUploadExpires  = "Upload-Expires"
+
+	// StatusChecksumMismatch 分片校验失败，和tus协议一致
+	StatusChecksumMismatch = 460
+)
+
+type (
+	// ResumableConfig 断点续传配置
+	//
+	//	POST   /uploads              创建上传，返回编号
+	//	HEAD   /uploads/:id          查询已经上传的偏移量
+	//	PATCH  /uploads/:id          从Upload-Offset开始上传分片，Upload-Checksum是可选的分片校验和
+	//	POST   /uploads/:id/complete 校验整个文件的SHA-256并写入存储
+	//	DELETE /uploads/:id          放弃上传
+	ResumableConfig struct {
+		// 路径前缀
+		// 非必须 默认值是"/uploads"
+		Prefix string
+
+		// 保存未完成分片的本地目录
+		// 必须
+		Dir string
+
+		// 完成后写入的存储
+		// 必须
+		Storage Storage
+
+		// 文件的最大字节数
+		// 非必须 默认值是4G
+		MaxSize int64
+
+		// 未完成的上传保留的时间
+		// 非必须 默认值是24小时
+		TTL time.Duration
+
+		// 生成保存的文件名
+		// 非必须 默认是上传编号加扩展名
+		Key func(upload ResumableUpload) string
+	}
+
+	// ResumableUpload 上传的状态
+	ResumableUpload struct {
+		Id          string `json:"id"`
+		Filename    string `json:"filename" validate:"required"`
+		ContentType string `json:"contentType"`
+		Length      int64  `json:"length" validate:"required,min=1"`
+		Offset      int64  `json:"offset"`
+		// 整个文件的SHA-256，十六进制
+		SHA256  string    `json:"sha256"`
+		Expires time.Time `json:"expires"`
+	}
+
+	resumableUploads struct {
+		config ResumableConfig
+		locks  sync.Map
+	}
+)
+
+var (
+	// DefaultResumableConfig 默认配置
+	DefaultResumableConfig = ResumableConfig{
+		Prefix:  "/uploads",
+		MaxSize: 4 << 30,
+		TTL:     24 * time.Hour,
+	}
+
+	ErrUploadNotFound       = echo.NewHTTPError(http.StatusNotFound, "上传不存在或者已经过期")
+	ErrUploadOffset         = echo.NewHTTPError(http.StatusConflict, "上传的偏移量不正确")
+	ErrUploadChecksum       = echo.NewHTTPError(StatusChecksumMismatch, "分片校验失败")
+	ErrUploadIncomplete     = echo.NewHTTPError(http.StatusConflict, "文件还没有上传完")
+	ErrUploadHashMismatch   = echo.NewHTTPError(http.StatusUnprocessableEntity, "文件校验失败")
+	ErrUploadChecksumFormat = echo.NewHTTPError(http.StatusBadRequest, "Upload-Checksum的格式应该是sha256 <base64>")
+)
+
+// Resumable 断点续传路由
+func Resumable(config ResumableConfig) RouteFunc {
+	if "" == config.Dir {
+		panic("echo: resumable upload requires a directory")
+	}
+	if nil == config.Storage {
+		panic("echo: resumable upload requires a storage")
+	}
+	if "" == config.Prefix {
+		config.Prefix = DefaultResumableConfig.Prefix
+	}
+	if 0 >= config.MaxSize {
+		config.MaxSize = DefaultResumableConfig.MaxSize
+	}
+	if 0 >= config.TTL {
+		config.TTL = DefaultResumableConfig.TTL
+	}
+	if err := os.MkdirAll(config.Dir, 0755); nil != err {
+		panic(err)
+	}
+	uploads := &resumableUploads{config: config}
+
+	return func(g *echo.Group) {
+		g.POST(config.Prefix, uploads.create)
+		g.HEAD(config.Prefix+"/:id", uploads.head)
+		g.PATCH(config.Prefix+"/:id", uploads.patch)
+		g.POST(config.Prefix+"/:id/complete", uploads.complete)
+		g.DELETE(config.Prefix+"/:id", uploads.remove)
+	}
+}
+
+func (ru *resumableUploads) create(c echo.Context) (err error) {
+	upload := ResumableUpload{}
+	if err = c.Bind(&upload); nil != err {
+		return
+	}
+	if nil != c.Echo().Validator {
+		if err = c.Validate(&upload); nil != err {
+			return
+		}
+	}
+	if upload.Length > ru.config.MaxSize {
+		return ErrUploadTooLarge
+	}
+	ru.clean()
+
+	upload.Id = random.String(32, random.Lowercase+random.Numeric)
+	upload.Filename = path.Base(upload.Filename)
+	upload.SHA256 = strings.ToLower(upload.SHA256)
+	upload.Offset = 0
+	upload.Expires = time.Now().Add(ru.config.TTL)
+	if err = ioutil.WriteFile(ru.data(upload.Id), nil, 0644); nil != err {
+		return
+	}
+	if err = ru.save(upload); nil != err {
+		return
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, c.Request().URL.Path+"/"+upload.Id)
+	return c.JSON(http.StatusCreated, upload)
+}
+
+func (ru *resumableUploads) head(c echo.Context) (err error) {
+	upload, err := ru.load(c.Param("id"))
+	if nil != err {
+		return
+	}
+	ru.headers(c, upload)
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (ru *resumableUploads) patch(c echo.Context) (err error) {
+	id := c.Param("id")
+	unlock, err := ru.lock(id)
+	if nil != err {
+		return
+	}
+	defer unlock()
+
+	upload, err := ru.load(id)
+	if nil != err {
+		return
+	}
+	offset, parseErr := strconv.ParseInt(c.Request().Header.Get(HeaderUploadOffset), 10, 64)
+	if nil != parseErr || offset != upload.Offset {
+		ru.headers(c, upload)
+		return ErrUploadOffset
+	}
+
+	var expected []byte
+	if checksum := c.Request().Header.Get(HeaderUploadChecksum); "" != checksum {
+		fields := strings.Fields(checksum)
+		if 2 != len(fields) || "sha256" != strings.ToLower(fields[0]) {
+			return ErrUploadChecksumFormat
+		}
+		if expected, err = base64.StdEncoding.DecodeString(fields[1]); nil != err {
+			return ErrUploadChecksumFormat
+		}
+	}
+
+	file, err := os.OpenFile(ru.data(id), os.O_WRONLY, 0644)
+	if nil != err {
+		return
+	}
+	defer file.Close()
+	if _, err = file.Seek(upload.Offset, io.SeekStart); nil != err {
+		return
+	}
+
+	hash := sha256.New()
+	body := &sizeLimitReader{reader: c.Request().Body, remain: upload.Length - upload.Offset}
+	written, err := io.Copy(io.MultiWriter(file, hash), body)
+	if nil == err && nil != expected && 1 != subtle.ConstantTimeCompare(expected, hash.Sum(nil)) {
+		err = ErrUploadChecksum
+	}
+	if nil != err {
+		// 丢弃不完整或者校验失败的分片
+		_ = file.Truncate(upload.Offset)
+		if ErrUploadTooLarge == err {
+			err = ErrUploadOffset
+		}
+		return
+	}
+	if err = file.Sync(); nil != err {
+		return
+	}
+
+	upload.Offset += written
+	upload.Expires = time.Now().Add(ru.config.TTL)
+	if err = ru.save(upload); nil != err {
+		return
+	}
+	ru.headers(c, upload)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ru *resumableUploads) complete(c echo.Context) (err error) {
+	id := c.Param("id")
+	unlock, err := ru.lock(id)
+	if nil != err {
+		return
+	}
+	defer unlock()
+
+	upload, err := ru.load(id)
+	if nil != err {
+		return
+	}
+	if upload.Offset != upload.Length {
+		ru.headers(c, upload)
+		return ErrUploadIncomplete
+	}
+
+	file, err := os.Open(ru.data(id))
+	if nil != err {
+		return
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); nil != err {
+		return
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if "" != upload.SHA256 && sum != upload.SHA256 {
+		ru.delete(id)
+		return ErrUploadHashMismatch
+	}
+	if _, err = file.Seek(0, io.SeekStart); nil != err {
+		return
+	}
+
+	key := upload.Id + strings.ToLower(path.Ext(upload.Filename))
+	if nil != ru.config.Key {
+		key = ru.config.Key(upload)
+	}
+	object, err := ru.config.Storage.Put(c.Request().Context(), key, file, upload.Length, upload.ContentType)
+	if nil != err {
+		return
+	}
+	object.Filename = upload.Filename
+	ru.delete(id)
+
+	return c.JSON(http.StatusOK, object)
+}
+
+func (ru *resumableUploads) remove(c echo.Context) (err error) {
+	id := c.Param("id")
+	unlock, err := ru.lock(id)
+	if nil != err {
+		return
+	}
+	defer unlock()
+
+	if _, err = ru.load(id); nil != err {
+		return
+	}
+	ru.delete(id)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ru *resumableUploads) headers(c echo.Context, upload ResumableUpload) {
+	header := c.Response().Header()
+	header.Set(HeaderUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	header.Set(HeaderUploadLength, strconv.FormatInt(upload.Length, 10))
+	header.Set(HeaderUploadExpires, upload.Expires.UTC().Format(http.TimeFormat))
+	header.Set(HeaderCacheControl, "no-store")
+}
+
+// lock 锁住一个上传，上传不存在时不创建锁，随意的编号不会占用内存
+func (ru *resumableUploads) lock(id string) (unlock func(), err error) {
+	if !validUploadId(id) {
+		err = ErrUploadNotFound
+		return
+	}
+	if _, statErr := os.Stat(ru.meta(id)); nil != statErr {
+		err = ErrUploadNotFound
+		return
+	}
+
+	mutex, _ := ru.locks.LoadOrStore(id, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+	unlock = mutex.(*sync.Mutex).Unlock
+
+	return
+}
+
+// validUploadId 编号只包含字母和数字，防止路径穿越
+func validUploadId(id string) bool {
+	return "" != id && !strings.ContainsAny(id, `./\`)
+}
+
+func (ru *resumableUploads) meta(id string) string {
+	return filepath.Join(ru.config.Dir, id+".json")
+}
+
+func (ru *resumableUploads) data(id string) string {
+	return filepath.Join(ru.config.Dir, id+".part")
+}
+
+func (ru *resumableUploads) load(id string) (upload ResumableUpload, err error) {
+	if !validUploadId(id) {
+		err = ErrUploadNotFound
+		return
+	}
+
+	data, readErr := ioutil.ReadFile(ru.meta(id))
+	if nil != readErr {
+		// 加锁之后上传被删除了，锁也不再需要
+		ru.locks.Delete(id)
+		err = ErrUploadNotFound
+		return
+	}
+	if err = json.Unmarshal(data, &upload); nil != err {
+		return
+	}
+	if time.Now().After(upload.Expires) {
+		ru.delete(id)
+		err = ErrUploadNotFound
+	}
+
+	return
+}
+
+func (ru *resumableUploads) save(upload ResumableUpload) (err error) {
+	data, err := json.Marshal(upload)
+	if nil != err {
+		return
+	}
+
+	// 先写临时文件再改名，崩溃时不会留下损坏的状态
+	temp := ru.meta(upload.Id) + ".tmp"
+	if err = ioutil.WriteFile(temp, data, 0644); nil != err {
+		return
+	}
+
+	return os.Rename(temp, ru.meta(upload.Id))
+}
+
+func (ru *resumableUploads) delete(id string) {
+	_ = os.Remove(ru.meta(id))
+	_ = os.Remove(ru.data(id))
+	ru.locks.Delete(id)
+}
+
+// clean 清理过期的上传
+func (ru *resumableUploads) clean() {
+	matches, _ := filepath.Glob(filepath.Join(ru.config.Dir, "*.json"))
+	for _, match := range matches {
+		id := strings.TrimSuffix(filepath.Base(match), ".json")
+		if _, err := ru.load(id); ErrUploadNotFound == err {
+			ru.delete(id)
+		}
+	}
+}
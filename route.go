@@ -0,0 +1,316 @@
+package echox
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+// AuthJWT 需要JWT认证
+const AuthJWT = "jwt"
+
+type (
+	// Route 带元数据的路由，横切的策略和路由声明在一起，由echox统一执行
+	//
+	//	echox.Register(echox.Route{
+	//		Method: http.MethodDelete, Path: "/users/:id", Handler: deleteUser,
+	//		Auth: echox.AuthJWT, Roles: []string{"admin"}, RateLimit: "10/s", Timeout: 5 * time.Second,
+	//	})
+	Route struct {
+		Method  string
+		Path    string
+		Handler echo.HandlerFunc
+		// 路由名称
+		Name string
+
+		// 认证方式，目前支持jwt
+		Auth string
+		// 允许访问的角色，任意一个满足即可，需要设置UserRoles
+		Roles []string
+		// 令牌需要的权限，需要全部满足，需要设置TokenScopes
+		Scopes []string
+		// 不需要认证的修改类路由要声明公开，否则权限覆盖检查会报告
+		Public bool
+		// 限流，格式是"次数/单位"，单位是s、m或者h，比如"10/s"，按客户端IP限流
+		RateLimit string
+		// 超时时间，超时后请求的上下文被取消
+		Timeout time.Duration
+		// 降级处理，超时和熔断也会降级
+		Fallback *Fallback
+		// 其它中间件
+		Middlewares []echo.MiddlewareFunc
+		// 响应使用规范的JSON，用于需要签名或者按内容缓存的接口
+		CanonicalJSON bool
+		// 承诺的服务水平
+		SLA *SLA
+		// 请求先持久化再处理，崩溃后重启时重放，需要配置EchoConfig.Journal
+		// 在认证之后记录，重放时使用原来的调用者
+		Journaled bool
+
+		// 请求和响应的类型，比如CreateUserReq{}，用来生成接口快照和检查兼容性
+		Request  interface{}
+		Response interface{}
+		// 响应的示例，用来生成OpenAPI文档和模拟响应
+		Examples []Example
+
+		// 调用Register的位置，报告冲突时使用
+		source string
+	}
+)
+
+var (
+	// UserRoles 读取用户的角色，路由声明了Roles时必须设置
+	UserRoles func(c echo.Context, user gox.BaseUser) ([]string, error)
+
+	// ErrRouteTimeout 请求超时
+	ErrRouteTimeout = echo.NewHTTPError(http.StatusServiceUnavailable, "请求超时")
+
+	routeMutex    sync.RWMutex
+	routeMetadata = make(map[string]Route)
+	// routeJournal 声明了Journaled的路由使用的请求日志中间件，New时按EchoConfig.Journal创建
+	routeJournal echo.MiddlewareFunc
+)
+
+// Register 注册带元数据的路由，可以直接放到EchoConfig.Routes中
+func Register(routes ...Route) RouteFunc {
+	source := callerSource(2)
+
+	return func(g *echo.Group) {
+		for _, route := range routes {
+			route.source = source
+			route.register(g)
+		}
+	}
+}
+
+// RouteOf 读取路由的元数据，path是注册时的完整路径
+// 每次New都会清空，读到的是最后一次New创建的服务的路由
+func RouteOf(method string, path string) (route Route, ok bool) {
+	routeMutex.RLock()
+	defer routeMutex.RUnlock()
+
+	route, ok = routeMetadata[routeKey(method, path)]
+
+	return
+}
+
+// RegisteredRoutes 所有带元数据的路由
+func RegisteredRoutes() (registered []Route) {
+	routeMutex.RLock()
+	defer routeMutex.RUnlock()
+
+	registered = make([]Route, 0, len(routeMetadata))
+	for _, route := range routeMetadata {
+		registered = append(registered, route)
+	}
+	sort.Slice(registered, func(i, j int) bool {
+		return routeKey(registered[i].Method, registered[i].Path) < routeKey(registered[j].Method, registered[j].Path)
+	})
+
+	return
+}
+
+// resetRoutes 清空路由的元数据和注册时发现的问题
+func resetRoutes() {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	routeMetadata = make(map[string]Route)
+	duplicateRoutes = nil
+}
+
+func (r Route) register(g *echo.Group) {
+	if "" == r.Method {
+		panic("echo: route requires method: " + r.source)
+	}
+	// 和其它冲突一起报告，不在第一个错误时就退出
+	if nil == r.Handler {
+		recordRouteProblem(RouteConflict{
+			Kind:    RouteConflictNilHandler,
+			Method:  r.Method,
+			Routes:  []string{r.Path},
+			Message: "处理器为空",
+			Sources: []string{r.source},
+			Fatal:   true,
+		})
+
+		return
+	}
+
+	middlewares := make([]echo.MiddlewareFunc, 0, 4+len(r.Middlewares))
+	switch r.Auth {
+	case "":
+	case AuthJWT:
+		middlewares = append(middlewares, r.authenticate)
+	default:
+		panic("echo: route auth is unsupported: " + r.Auth)
+	}
+	if 0 != len(r.Roles) {
+		if nil == UserRoles {
+			panic("echo: route roles requires echox.UserRoles")
+		}
+		if AuthJWT != r.Auth {
+			panic("echo: route roles requires jwt auth")
+		}
+		middlewares = append(middlewares, r.authorize)
+	}
+	if 0 != len(r.Scopes) {
+		if nil == TokenScopes {
+			panic("echo: route scopes requires echox.TokenScopes")
+		}
+		if AuthJWT != r.Auth {
+			panic("echo: route scopes requires jwt auth")
+		}
+		middlewares = append(middlewares, r.scope)
+	}
+	if "" != r.RateLimit {
+		rate, burst := parseRate(r.RateLimit)
+		config := DefaultRateLimitConfig
+		config.Rate = rate
+		config.Burst = burst
+		middlewares = append(middlewares, RateLimitWithConfig(config))
+	}
+	if r.Journaled {
+		if nil == routeJournal {
+			panic("echo: route journal requires EchoConfig.Journal")
+		}
+		middlewares = append(middlewares, routeJournal)
+	}
+	if nil != r.Fallback {
+		middlewares = append(middlewares, r.Fallback.middlewares()...)
+	}
+	if 0 < r.Timeout {
+		middlewares = append(middlewares, r.timeout)
+	}
+	if r.CanonicalJSON {
+		middlewares = append(middlewares, canonicalJSONMiddleware)
+	}
+	middlewares = append(middlewares, r.Middlewares...)
+	r.checkExamples()
+	if nil != r.SLA {
+		r.SLA.validate(r.Path)
+	}
+
+	added := g.Add(r.Method, r.Path, r.Handler, middlewares...)
+	if "" != r.Name {
+		added.Name = r.Name
+	}
+
+	// 保存完整路径，分组的前缀也包含在内
+	r.Path = added.Path
+	previous, duplicated := RouteOf(r.Method, r.Path)
+	if duplicated {
+		recordRouteProblem(RouteConflict{
+			Kind:    RouteConflictDuplicate,
+			Method:  r.Method,
+			Routes:  []string{r.Path},
+			Message: "重复注册，后注册的处理器覆盖了先注册的",
+			Sources: []string{previous.source, r.source},
+			Fatal:   true,
+		})
+	}
+	routeMutex.Lock()
+	routeMetadata[routeKey(r.Method, r.Path)] = r
+	routeMutex.Unlock()
+}
+
+func (r Route) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ec, ok := c.(*EchoContext)
+		if !ok || nil == ec.JWT {
+			panic("echo: route jwt auth requires EchoConfig.JWT")
+		}
+		// 用户和服务账号都可以通过认证
+		if _, err := ec.Principal(); nil != err {
+			return echo.NewHTTPError(http.StatusUnauthorized, "无效的Token").SetInternal(err)
+		}
+
+		return next(c)
+	}
+}
+
+func (r Route) authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, err := c.(*EchoContext).Principal()
+		if nil != err {
+			return echo.ErrUnauthorized
+		}
+		// 角色是用户的，服务账号通过Scopes或者Casbin授权
+		if principal.IsService() {
+			return echo.ErrForbidden
+		}
+		roles, err := UserRoles(c, principal.User)
+		if nil != err {
+			return err
+		}
+		for _, role := range roles {
+			if found, _ := gox.IsInArray(role, r.Roles); found {
+				return next(c)
+			}
+		}
+
+		return echo.ErrForbidden
+	}
+}
+
+// timeout 取消请求的上下文，处理器需要使用请求的上下文才能及时结束
+func (r Route) timeout(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		req := c.Request()
+		ctx, cancel := context.WithTimeout(req.Context(), r.Timeout)
+		defer cancel()
+
+		c.SetRequest(req.WithContext(ctx))
+		err = next(c)
+		if context.DeadlineExceeded == ctx.Err() && !c.Response().Committed {
+			err = ErrRouteTimeout
+		}
+
+		return
+	}
+}
+
+// canonicalJSONMiddleware 没有通过New创建时没有echox的上下文，这里补上
+func canonicalJSONMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(canonicalJSONKey, true)
+		if _, ok := c.(*EchoContext); !ok {
+			c = &EchoContext{Context: c}
+		}
+
+		return next(c)
+	}
+}
+
+// parseRate 解析"10/s"格式的限流
+func parseRate(limit string) (rate float64, burst int) {
+	parts := strings.SplitN(strings.TrimSpace(limit), "/", 2)
+	count, err := strconv.Atoi(parts[0])
+	if nil != err || 0 >= count {
+		panic("echo: route rate limit is invalid: " + limit)
+	}
+
+	unit := time.Second
+	if 2 == len(parts) {
+		switch parts[1] {
+		case "s":
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		default:
+			panic("echo: route rate limit is invalid: " + limit)
+		}
+	}
+	rate = float64(count) / unit.Seconds()
+	burst = count
+
+	return
+}
@@ -0,0 +1,201 @@
+package echox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+const (
+	// RouteConflictDuplicate 同一个请求方法和路径注册了多次，后注册的会覆盖先注册的
+	RouteConflictDuplicate = "duplicate"
+	// RouteConflictName 路由名字重复
+	RouteConflictName = "name"
+	// RouteConflictParam 相同位置的路径参数名字不同，参数会取错
+	RouteConflictParam = "param"
+	// RouteConflictShadow 静态路径优先于参数，比如/users/new会遮住/users/:id
+	RouteConflictShadow = "shadow"
+	// RouteConflictWildcard 参数或者静态路径会遮住通配符的一部分
+	RouteConflictWildcard = "wildcard"
+	// RouteConflictNilHandler 处理器为空，请求时会崩溃
+	RouteConflictNilHandler = "nil"
+)
+
+type (
+	// RouteCheckConfig 启动时检查路由冲突的配置
+	RouteCheckConfig struct {
+		// 遮挡也作为错误，默认只打印警告
+		Strict bool
+
+		// 忽略的冲突类型
+		Ignore []string
+	}
+
+	// RouteConflict 路由冲突
+	RouteConflict struct {
+		Kind    string   `json:"kind"`
+		Method  string   `json:"method"`
+		Routes  []string `json:"routes"`
+		Message string   `json:"message"`
+		// 注册的位置，文件名和行号
+		Sources []string `json:"sources,omitempty"`
+		// 是否是错误，错误会导致启动失败
+		Fatal bool `json:"fatal"`
+	}
+)
+
+var duplicateRoutes []RouteConflict
+
+// CheckRoutes 检查路由的冲突和遮挡
+func CheckRoutes(e *echo.Echo) (conflicts []RouteConflict) {
+	routeMutex.RLock()
+	conflicts = append(conflicts, duplicateRoutes...)
+	names := make(map[string]string)
+	for _, route := range routeMetadata {
+		if "" == route.Name {
+			continue
+		}
+		key := routeKey(route.Method, route.Path)
+		if other, ok := names[route.Name]; ok {
+			conflicts = append(conflicts, RouteConflict{
+				Kind:    RouteConflictName,
+				Routes:  sortedStrings(other, key),
+				Message: fmt.Sprintf("路由名字%s重复", route.Name),
+				Fatal:   true,
+			})
+		} else {
+			names[route.Name] = key
+		}
+	}
+	routeMutex.RUnlock()
+
+	// 分组的中间件和网关转发会注册NotFoundHandler的通配符路由，不参与检查
+	notFound := handlerName(echo.NotFoundHandler)
+	byMethod := make(map[string][]string)
+	for _, route := range e.Routes() {
+		if notFound == route.Name {
+			continue
+		}
+		byMethod[route.Method] = append(byMethod[route.Method], route.Path)
+	}
+	for method, paths := range byMethod {
+		sort.Strings(paths)
+		for i := 0; i < len(paths); i++ {
+			for j := i + 1; j < len(paths); j++ {
+				if conflict, ok := compareRoutes(paths[i], paths[j]); ok {
+					conflict.Method = method
+					conflicts = append(conflicts, conflict)
+				}
+			}
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Fatal != conflicts[j].Fatal {
+			return conflicts[i].Fatal
+		}
+
+		return strings.Join(conflicts[i].Routes, ",")+conflicts[i].Method < strings.Join(conflicts[j].Routes, ",")+conflicts[j].Method
+	})
+
+	return
+}
+
+// check 启动时检查，有错误时列出所有冲突后退出
+func (rcc *RouteCheckConfig) check(e *echo.Echo) {
+	var report []string
+	for _, conflict := range CheckRoutes(e) {
+		if found, _ := gox.IsInArray(conflict.Kind, rcc.Ignore); found {
+			continue
+		}
+		line := fmt.Sprintf("[%s] %s %s: %s", conflict.Kind, conflict.Method, strings.Join(conflict.Routes, " <> "), conflict.Message)
+		if 0 != len(conflict.Sources) {
+			line += "（" + strings.Join(conflict.Sources, "，") + "）"
+		}
+		if conflict.Fatal || rcc.Strict {
+			report = append(report, line)
+		} else {
+			e.Logger.Warn(line)
+		}
+	}
+	if 0 != len(report) {
+		panic("echo: route conflicts:\n  " + strings.Join(report, "\n  "))
+	}
+}
+
+// compareRoutes 比较两个路由是不是会匹配到相同的请求
+func compareRoutes(a string, b string) (conflict RouteConflict, ok bool) {
+	as := strings.Split(strings.Trim(a, "/"), "/")
+	bs := strings.Split(strings.Trim(b, "/"), "/")
+	conflict.Routes = []string{a, b}
+
+	shadow := false
+	mismatch := ""
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		sa, sb := as[i], bs[i]
+		wa, wb := strings.HasSuffix(sa, "*"), strings.HasSuffix(sb, "*")
+		if wa || wb {
+			if wa && wb {
+				return
+			}
+			wildcard, other, rest := sa, sb, bs[i:]
+			if wb {
+				wildcard, other, rest = sb, sa, as[i:]
+			}
+			// 通配符下的静态路径很常见，只有参数路由会遮住通配符
+			if strings.HasPrefix(other, strings.TrimSuffix(wildcard, "*")) && (shadow || hasParam(rest)) {
+				conflict.Kind = RouteConflictWildcard
+				conflict.Message = "参数路由会优先匹配，通配符路由只能匹配剩下的请求"
+				ok = true
+			}
+
+			return
+		}
+
+		pa, pb := strings.HasPrefix(sa, ":"), strings.HasPrefix(sb, ":")
+		switch {
+		case pa && pb:
+			if sa != sb && "" == mismatch {
+				mismatch = fmt.Sprintf("相同位置的参数名不同：%s和%s", sa, sb)
+			}
+		case pa || pb:
+			shadow = true
+		case sa != sb:
+			return
+		}
+	}
+	if len(as) != len(bs) {
+		return
+	}
+
+	if "" != mismatch {
+		conflict.Kind = RouteConflictParam
+		conflict.Message = mismatch
+		conflict.Fatal = true
+		ok = true
+	} else if shadow {
+		conflict.Kind = RouteConflictShadow
+		conflict.Message = "静态路径优先于参数，参数路由匹配不到静态路径的请求"
+		ok = true
+	}
+
+	return
+}
+
+func hasParam(segments []string) bool {
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedStrings(values ...string) []string {
+	sort.Strings(values)
+
+	return values
+}
@@ -0,0 +1,82 @@
+package echox
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultDisabledMessage = "服务暂时不可用"
+)
+
+type (
+	// DisabledRoute 被停用的路由
+	DisabledRoute struct {
+		// 请求方法，*表示所有方法
+		Method string `json:"method" validate:"required"`
+		// 注册路由时的路径，比如/users/:id
+		Path string `json:"path" validate:"required"`
+		// 返回给客户端的消息
+		Message string    `json:"message"`
+		Since   time.Time `json:"since"`
+	}
+)
+
+var disabledRoutes sync.Map
+
+// DisableRoute 停用路由，停用后请求直接返回503
+func DisableRoute(method, path, message string) {
+	if "" == message {
+		message = defaultDisabledMessage
+	}
+
+	disabledRoutes.Store(routeKey(method, path), &DisabledRoute{
+		Method:  method,
+		Path:    path,
+		Message: message,
+		Since:   time.Now(),
+	})
+}
+
+// EnableRoute 重新启用路由
+func EnableRoute(method, path string) {
+	disabledRoutes.Delete(routeKey(method, path))
+}
+
+// DisabledRoutes 所有被停用的路由
+func DisabledRoutes() (routes []DisabledRoute) {
+	routes = make([]DisabledRoute, 0)
+	disabledRoutes.Range(func(_, value interface{}) bool {
+		routes = append(routes, *value.(*DisabledRoute))
+
+		return true
+	})
+	sort.Slice(routes, func(i, j int) bool {
+		return routeKey(routes[i].Method, routes[i].Path) < routeKey(routes[j].Method, routes[j].Path)
+	})
+
+	return
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// routeSwitchMiddleware 拦截被停用的路由
+func routeSwitchMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		route, ok := disabledRoutes.Load(routeKey(c.Request().Method, c.Path()))
+		if !ok {
+			route, ok = disabledRoutes.Load(routeKey("*", c.Path()))
+		}
+		if ok {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, route.(*DisabledRoute).Message)
+		}
+
+		return next(c)
+	}
+}
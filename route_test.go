@@ -0,0 +1,23 @@
+package echox
+
+import (
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNewTwiceKeepsRoutesSeparate(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		ec := NewDefaultConfig()
+		ec.Routes = []RouteFunc{Register(Route{
+			Method:  echo.GET,
+			Path:    "/ping",
+			Handler: func(c echo.Context) error { return nil },
+		})}
+		New(ec)
+
+		if _, ok := RouteOf(echo.GET, "/ping"); !ok {
+			t.Fatalf("第%d次New之后没有路由的元数据", i+1)
+		}
+	}
+}
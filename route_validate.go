@@ -0,0 +1,122 @@
+package echox
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+
+	"github.com/labstack/echo/v4"
+)
+
+// mountRoutes 依次执行RouteFunc，比较每次执行前后的路由，找出空的处理器和不同RouteFunc之间的重复注册
+// 问题都记录下来，由路由检查一起报告
+func mountRoutes(e *echo.Echo, g *echo.Group, routes []RouteFunc) {
+	owners := make(map[string]string)
+	for index, route := range routes {
+		if nil == route {
+			recordRouteProblem(RouteConflict{
+				Kind:    RouteConflictNilHandler,
+				Message: fmt.Sprintf("第%d个RouteFunc为空", index+1),
+				Fatal:   true,
+			})
+
+			continue
+		}
+
+		before := routesByKey(e)
+		route(g)
+		source := funcSource(route)
+		for key, added := range routesByKey(e) {
+			previous, existed := before[key]
+			if existed && previous == added {
+				continue
+			}
+
+			// Register创建的RouteFunc使用调用Register的位置
+			current := source
+			if meta, ok := RouteOf(added.Method, added.Path); ok && "" != meta.source {
+				current = meta.source
+			}
+			if "" == added.Name {
+				recordRouteProblem(RouteConflict{
+					Kind:    RouteConflictNilHandler,
+					Method:  added.Method,
+					Routes:  []string{added.Path},
+					Message: "处理器为空",
+					Sources: []string{current},
+					Fatal:   true,
+				})
+			}
+			if owner, ok := owners[key]; ok && existed {
+				recordRouteProblem(RouteConflict{
+					Kind:    RouteConflictDuplicate,
+					Method:  added.Method,
+					Routes:  []string{added.Path},
+					Message: "重复注册，后注册的处理器覆盖了先注册的",
+					Sources: []string{owner, current},
+					Fatal:   true,
+				})
+			}
+			owners[key] = current
+		}
+	}
+}
+
+// recordRouteProblem 记录注册时发现的问题，同一个路由的同一种问题合并注册的位置
+func recordRouteProblem(problem RouteConflict) {
+	sources := make([]string, 0, len(problem.Sources))
+	for _, source := range problem.Sources {
+		if "" != source {
+			sources = append(sources, source)
+		}
+	}
+	problem.Sources = sources
+
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+
+	for index, recorded := range duplicateRoutes {
+		if recorded.Kind != problem.Kind || recorded.Method != problem.Method || fmt.Sprint(recorded.Routes) != fmt.Sprint(problem.Routes) {
+			continue
+		}
+		for _, source := range problem.Sources {
+			if !containsString(duplicateRoutes[index].Sources, source) {
+				duplicateRoutes[index].Sources = append(duplicateRoutes[index].Sources, source)
+			}
+		}
+
+		return
+	}
+	duplicateRoutes = append(duplicateRoutes, problem)
+}
+
+func routesByKey(e *echo.Echo) map[string]*echo.Route {
+	routes := make(map[string]*echo.Route)
+	for _, route := range e.Routes() {
+		routes[routeKey(route.Method, route.Path)] = route
+	}
+
+	return routes
+}
+
+// funcSource 函数定义的位置
+func funcSource(fn interface{}) string {
+	pc := reflect.ValueOf(fn).Pointer()
+	if f := runtime.FuncForPC(pc); nil != f {
+		file, line := f.FileLine(pc)
+
+		return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	return ""
+}
+
+// callerSource 调用者的位置，skip和runtime.Caller相同
+func callerSource(skip int) string {
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	return ""
+}
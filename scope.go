@@ -0,0 +1,193 @@
+package echox
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/storezhang/gox"
+)
+
+type (
+	// Scope 注册的令牌权限
+	Scope struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	// ScopeCoverageConfig 权限覆盖检查的配置
+	ScopeCoverageConfig struct {
+		// 不检查的路径前缀，比如使用分组中间件认证的管理接口
+		Ignore []string
+	}
+
+	// ScopeGap 有问题的路由
+	ScopeGap struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Scope  string `json:"scope,omitempty"`
+	}
+
+	// ScopeReport 路由和权限的交叉检查结果
+	ScopeReport struct {
+		// 没有认证也没有声明公开的修改类路由
+		Unprotected []ScopeGap `json:"unprotected"`
+		// 有认证但是没有权限和角色的修改类路由，只在注册了权限时检查
+		Unscoped []ScopeGap `json:"unscoped"`
+		// 路由使用了没有注册的权限，一般是拼写错误
+		Undeclared []ScopeGap `json:"undeclared"`
+		// 注册了但是没有路由使用的权限
+		Unused []string `json:"unused"`
+	}
+)
+
+var (
+	// TokenScopes 读取令牌的权限，路由声明了Scopes时必须设置
+	TokenScopes func(c echo.Context) ([]string, error)
+
+	scopeMutex sync.RWMutex
+	scopes     = make(map[string]Scope)
+
+	mutationMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+)
+
+// RegisterScope 注册令牌权限
+func RegisterScope(name string, description string) {
+	scopeMutex.Lock()
+	defer scopeMutex.Unlock()
+
+	scopes[name] = Scope{Name: name, Description: description}
+}
+
+// Scopes 所有注册的权限，按名字排序
+func Scopes() (registered []Scope) {
+	scopeMutex.RLock()
+	registered = make([]Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		registered = append(registered, scope)
+	}
+	scopeMutex.RUnlock()
+
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].Name < registered[j].Name
+	})
+
+	return
+}
+
+// ScopeCoverage 交叉检查路由的认证声明和注册的权限，发布前发现授权漏洞
+//
+//	echox.RegisterSmokeCheck("scopes", func(ctx context.Context, e *echo.Echo) error {
+//		return echox.ScopeCoverage(e, echox.ScopeCoverageConfig{Ignore: []string{"/admin"}}).Err()
+//	})
+func ScopeCoverage(e *echo.Echo, config ScopeCoverageConfig) (report ScopeReport) {
+	registered := Scopes()
+	used := make(map[string]bool)
+	notFound := handlerName(echo.NotFoundHandler)
+	for _, r := range e.Routes() {
+		if notFound == r.Name || ignoredPath(r.Path, config.Ignore) {
+			continue
+		}
+
+		gap := ScopeGap{Method: r.Method, Path: r.Path}
+		route, ok := RouteOf(r.Method, r.Path)
+		for _, scope := range route.Scopes {
+			used[scope] = true
+			if !scopeRegistered(registered, scope) {
+				report.Undeclared = append(report.Undeclared, ScopeGap{Method: r.Method, Path: r.Path, Scope: scope})
+			}
+		}
+		if mutation, _ := gox.IsInArray(r.Method, mutationMethods); !mutation || (ok && route.Public) {
+			continue
+		}
+		switch {
+		case !ok || "" == route.Auth:
+			report.Unprotected = append(report.Unprotected, gap)
+		case 0 != len(registered) && 0 == len(route.Scopes) && 0 == len(route.Roles):
+			report.Unscoped = append(report.Unscoped, gap)
+		}
+	}
+	for _, scope := range registered {
+		if !used[scope.Name] {
+			report.Unused = append(report.Unused, scope.Name)
+		}
+	}
+
+	sortGaps(report.Unprotected)
+	sortGaps(report.Unscoped)
+	sortGaps(report.Undeclared)
+
+	return
+}
+
+// Err 有问题时返回错误，列出所有问题
+func (sr ScopeReport) Err() error {
+	var problems []string
+	for _, gap := range sr.Unprotected {
+		problems = append(problems, fmt.Sprintf("unprotected %s %s", gap.Method, gap.Path))
+	}
+	for _, gap := range sr.Unscoped {
+		problems = append(problems, fmt.Sprintf("unscoped %s %s", gap.Method, gap.Path))
+	}
+	for _, gap := range sr.Undeclared {
+		problems = append(problems, fmt.Sprintf("undeclared scope %s on %s %s", gap.Scope, gap.Method, gap.Path))
+	}
+	for _, scope := range sr.Unused {
+		problems = append(problems, fmt.Sprintf("unused scope %s", scope))
+	}
+	if 0 == len(problems) {
+		return nil
+	}
+
+	return fmt.Errorf("scope coverage: %s", strings.Join(problems, "; "))
+}
+
+// scope 令牌需要有路由声明的所有权限
+func (r Route) scope(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		granted, err := TokenScopes(c)
+		if nil != err {
+			return err
+		}
+		for _, scope := range r.Scopes {
+			if found, _ := gox.IsInArray(scope, granted); !found {
+				return echo.ErrForbidden
+			}
+		}
+
+		return next(c)
+	}
+}
+
+func scopeRegistered(registered []Scope, name string) bool {
+	for _, scope := range registered {
+		if scope.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ignoredPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortGaps(gaps []ScopeGap) {
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].Path != gaps[j].Path {
+			return gaps[i].Path < gaps[j].Path
+		}
+
+		return gaps[i].Method < gaps[j].Method
+	})
+}
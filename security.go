@@ -0,0 +1,169 @@
+package echox
+
+import (
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type (
+	// SecurityConfig 安全相关的配置
+	SecurityConfig struct {
+		// 安全响应头，为空时使用echo的默认配置
+		Secure *middleware.SecureConfig
+
+		// 内容安全策略，设置后覆盖Secure中的ContentSecurityPolicy
+		CSP *CSP
+
+		// CSRF保护，为空时不启用
+		CSRF *CSRFConfig
+	}
+
+	// CSRFConfig CSRF配置
+	CSRFConfig struct {
+		// 读取令牌的位置，格式和echo一致，比如"header:X-CSRF-Token"或者"form:csrf"
+		// 非必须 默认值是"header:X-CSRF-Token"
+		TokenLookup string
+
+		// 令牌的Cookie
+		// 非必须 默认值是"_csrf"
+		CookieName     string
+		CookieDomain   string
+		CookiePath     string
+		CookieMaxAge   int
+		CookieSecure   bool
+		CookieHTTPOnly bool
+
+		// 不需要CSRF保护的路径，支持path.Match的通配符，以/*结尾时匹配前缀
+		// 比如"/api/*"、"/webhooks/*/callback"
+		Exempt []string
+	}
+
+	// CSP 内容安全策略的构建器
+	//
+	//	csp := echox.NewCSP().DefaultSrc(echox.CSPSelf).ScriptSrc(echox.CSPSelf, "https://cdn.example.com")
+	CSP struct {
+		names      []string
+		directives map[string][]string
+	}
+)
+
+const (
+	CSPSelf          = "'self'"
+	CSPNone          = "'none'"
+	CSPUnsafeInline  = "'unsafe-inline'"
+	CSPUnsafeEval    = "'unsafe-eval'"
+	CSPStrictDynamic = "'strict-dynamic'"
+)
+
+// NewCSP 创建内容安全策略
+func NewCSP() *CSP {
+	return &CSP{directives: make(map[string][]string)}
+}
+
+// Add 增加指令，同名的指令合并来源
+func (csp *CSP) Add(directive string, sources ...string) *CSP {
+	if _, ok := csp.directives[directive]; !ok {
+		csp.names = append(csp.names, directive)
+	}
+	csp.directives[directive] = append(csp.directives[directive], sources...)
+
+	return csp
+}
+
+func (csp *CSP) DefaultSrc(sources ...string) *CSP {
+	return csp.Add("default-src", sources...)
+}
+
+func (csp *CSP) ScriptSrc(sources ...string) *CSP {
+	return csp.Add("script-src", sources...)
+}
+
+func (csp *CSP) StyleSrc(sources ...string) *CSP {
+	return csp.Add("style-src", sources...)
+}
+
+func (csp *CSP) ImgSrc(sources ...string) *CSP {
+	return csp.Add("img-src", sources...)
+}
+
+func (csp *CSP) ConnectSrc(sources ...string) *CSP {
+	return csp.Add("connect-src", sources...)
+}
+
+func (csp *CSP) FontSrc(sources ...string) *CSP {
+	return csp.Add("font-src", sources...)
+}
+
+func (csp *CSP) FrameAncestors(sources ...string) *CSP {
+	return csp.Add("frame-ancestors", sources...)
+}
+
+func (csp *CSP) ReportURI(uri string) *CSP {
+	return csp.Add("report-uri", uri)
+}
+
+// String 生成Content-Security-Policy响应头的值
+func (csp *CSP) String() string {
+	directives := make([]string, 0, len(csp.names))
+	for _, name := range csp.names {
+		directives = append(directives, strings.TrimSpace(name+" "+strings.Join(csp.directives[name], " ")))
+	}
+
+	return strings.Join(directives, "; ")
+}
+
+func (sc *SecurityConfig) mount(e *echo.Echo) {
+	secure := middleware.DefaultSecureConfig
+	if nil != sc.Secure {
+		secure = *sc.Secure
+	}
+	if nil != sc.CSP {
+		secure.ContentSecurityPolicy = sc.CSP.String()
+	}
+	e.Use(middleware.SecureWithConfig(secure))
+
+	if nil != sc.CSRF {
+		e.Use(sc.CSRF.middleware())
+	}
+}
+
+func (cc *CSRFConfig) middleware() echo.MiddlewareFunc {
+	config := middleware.DefaultCSRFConfig
+	if "" != cc.TokenLookup {
+		config.TokenLookup = cc.TokenLookup
+	}
+	if "" != cc.CookieName {
+		config.CookieName = cc.CookieName
+	}
+	config.CookieDomain = cc.CookieDomain
+	config.CookiePath = cc.CookiePath
+	if 0 != cc.CookieMaxAge {
+		config.CookieMaxAge = cc.CookieMaxAge
+	}
+	config.CookieSecure = cc.CookieSecure
+	config.CookieHTTPOnly = cc.CookieHTTPOnly
+	config.Skipper = func(c echo.Context) bool {
+		return exempted(c.Request().URL.Path, cc.Exempt)
+	}
+
+	return middleware.CSRFWithConfig(config)
+}
+
+func exempted(requestPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/*") {
+			prefix := strings.TrimSuffix(pattern, "*")
+			if strings.HasPrefix(requestPath, prefix) || strings.TrimSuffix(prefix, "/") == requestPath {
+				return true
+			}
+		}
+		if matched, _ := path.Match(pattern, requestPath); matched {
+			return true
+		}
+	}
+
+	return false
+}
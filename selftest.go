@@ -0,0 +1,188 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SelfTestFlag 启动参数中有这个参数时只做自检，不启动服务
+const SelfTestFlag = "--selftest"
+
+type (
+	// SmokeCheck 自检时执行的检查，e是按配置创建好但是没有启动的服务
+	SmokeCheck func(ctx context.Context, e *echo.Echo) error
+
+	// SelfTestResult 单项检查的结果
+	SelfTestResult struct {
+		Name     string        `json:"name"`
+		Passed   bool          `json:"passed"`
+		Duration time.Duration `json:"duration"`
+		Error    string        `json:"error,omitempty"`
+	}
+
+	// SelfTestReport 自检报告
+	SelfTestReport struct {
+		Passed  bool             `json:"passed"`
+		Results []SelfTestResult `json:"results"`
+	}
+)
+
+var (
+	smokeMutex  sync.RWMutex
+	smokeChecks = make(map[string]SmokeCheck)
+)
+
+// RegisterSmokeCheck 注册自检时执行的检查
+func RegisterSmokeCheck(name string, check SmokeCheck) {
+	smokeMutex.Lock()
+	defer smokeMutex.Unlock()
+
+	smokeChecks[name] = check
+}
+
+// SelfTest 创建完整的服务并执行所有检查
+// 依次检查配置（创建服务没有崩溃）、所有健康检查、一个经过完整中间件的请求和注册的自检
+func SelfTest(ctx context.Context, ec *EchoConfig) (report SelfTestReport) {
+	report.Passed = true
+	run := func(name string, check func() error) {
+		start := time.Now()
+		err := safeCheck(check)
+		result := SelfTestResult{Name: name, Passed: nil == err, Duration: time.Since(start)}
+		if nil != err {
+			result.Error = err.Error()
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	var e *echo.Echo
+	run("config", func() error {
+		e = New(ec)
+
+		return nil
+	})
+	if nil == e {
+		return
+	}
+
+	healthMutex.RLock()
+	names := make([]string, 0, len(healthChecks))
+	for name := range healthChecks {
+		names = append(names, name)
+	}
+	healthMutex.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		healthMutex.RLock()
+		check := healthChecks[name]
+		healthMutex.RUnlock()
+		run("health:"+name, func() error {
+			return check(ctx)
+		})
+	}
+
+	run("request", func() error {
+		return syntheticRequest(e, ec)
+	})
+
+	smokeMutex.RLock()
+	names = names[:0]
+	for name := range smokeChecks {
+		names = append(names, name)
+	}
+	smokeMutex.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		smokeMutex.RLock()
+		check := smokeChecks[name]
+		smokeMutex.RUnlock()
+		run(name, func() error {
+			return check(ctx, e)
+		})
+	}
+
+	return
+}
+
+// Print 输出自检报告
+func (sr SelfTestReport) Print(out io.Writer) {
+	for _, result := range sr.Results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(out, "%s %-24s %s", status, result.Name, result.Duration.Round(time.Millisecond))
+		if "" != result.Error {
+			fmt.Fprintf(out, " %s", result.Error)
+		}
+		fmt.Fprintln(out)
+	}
+	if sr.Passed {
+		fmt.Fprintln(out, "selftest passed")
+	} else {
+		fmt.Fprintln(out, "selftest failed")
+	}
+}
+
+// isSelfTest 启动参数中是否要求自检
+func isSelfTest(args []string) bool {
+	for _, arg := range args {
+		if SelfTestFlag == arg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selfTest 自检后退出，失败时退出码不为0
+func selfTest(ec *EchoConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	report := SelfTest(ctx, ec)
+	cancel()
+
+	report.Print(os.Stdout)
+	if !report.Passed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// syntheticRequest 发送一个经过所有中间件的请求，只要没有服务器错误就算通过
+// 配置了Kubernetes时请求存活检查，否则请求根路径，404也是正常的
+func syntheticRequest(e *echo.Echo, ec *EchoConfig) error {
+	path := "/"
+	if nil != ec.Kubernetes && "" != ec.Kubernetes.LivenessPath {
+		path = ec.Kubernetes.LivenessPath
+	}
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(echo.HeaderXRequestID, "selftest")
+	rsp := httptest.NewRecorder()
+	e.ServeHTTP(rsp, req)
+	if http.StatusInternalServerError <= rsp.Code {
+		return fmt.Errorf("GET %s returned %d", path, rsp.Code)
+	}
+
+	return nil
+}
+
+// safeCheck 检查崩溃时当作失败，配置错误一般会在创建服务时崩溃
+func safeCheck(check func() error) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return check()
+}
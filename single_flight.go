@@ -0,0 +1,168 @@
+package echox
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const HeaderXSingleFlight = "X-Single-Flight"
+
+type (
+	// SingleFlightConfig 合并相同请求的配置
+	SingleFlightConfig struct {
+		// 确定是不是要走中间件
+		Skipper middleware.Skipper
+
+		// 相同请求的键
+		// 非必须 默认值是请求地址和当前用户
+		KeyFunc CacheKeyFunc
+	}
+
+	// flight 正在处理的请求
+	flight struct {
+		done     chan struct{}
+		leaving  sync.Once
+		response *CachedResponse
+		err      error
+		// 处理器刷新了响应，比如SSE，等待的请求自己执行处理器
+		streaming bool
+	}
+
+	flightGroup struct {
+		mutex   sync.Mutex
+		flights map[string]*flight
+	}
+)
+
+var (
+	// DefaultSingleFlightConfig 默认配置
+	DefaultSingleFlightConfig = SingleFlightConfig{
+		Skipper: middleware.DefaultSkipper,
+		KeyFunc: DefaultCacheKey,
+	}
+)
+
+// SingleFlight 合并相同请求的中间件
+func SingleFlight() echo.MiddlewareFunc {
+	return SingleFlightWithConfig(DefaultSingleFlightConfig)
+}
+
+// SingleFlightWithConfig 合并相同请求的中间件
+// 同时到达的相同GET请求只执行一次处理器，所有请求共享同一个响应，用来保护开销大的读接口
+func SingleFlightWithConfig(config SingleFlightConfig) echo.MiddlewareFunc {
+	if nil == config.Skipper {
+		config.Skipper = DefaultSingleFlightConfig.Skipper
+	}
+	if nil == config.KeyFunc {
+		config.KeyFunc = DefaultSingleFlightConfig.KeyFunc
+	}
+	group := &flightGroup{flights: make(map[string]*flight)}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) || http.MethodGet != c.Request().Method {
+				return next(c)
+			}
+
+			key := config.KeyFunc(c)
+			f, leader := group.join(key)
+			if !leader {
+				select {
+				case <-f.done:
+				case <-c.Request().Context().Done():
+					return c.Request().Context().Err()
+				}
+				if f.streaming {
+					return next(c)
+				}
+				if nil != f.err {
+					return f.err
+				}
+				c.Response().Header().Set(HeaderXSingleFlight, "shared")
+
+				return writeShared(c, f.response)
+			}
+
+			writer := &bufferedWriter{ResponseWriter: c.Response().Writer, status: http.StatusOK}
+			// 刷新以后响应已经写出了一部分，不再合并，马上放开等待的请求
+			writer.onStream = func() {
+				f.streaming = true
+				group.leave(key, f)
+			}
+			c.Response().Writer = writer
+			defer func() {
+				c.Response().Writer = writer.ResponseWriter
+				// 崩溃时等待的请求也返回错误
+				if r := recover(); nil != r {
+					f.err = ErrInternal
+					group.leave(key, f)
+					panic(r)
+				}
+			}()
+
+			err = next(c)
+			if writer.streaming {
+				return
+			}
+			if f.err = err; nil == f.err {
+				f.response = &CachedResponse{
+					Status: writer.status,
+					Header: c.Response().Header().Clone(),
+					Body:   writer.body.Bytes(),
+				}
+			}
+			group.leave(key, f)
+			if err = f.err; nil != err {
+				return
+			}
+
+			writer.ResponseWriter.WriteHeader(f.response.Status)
+			_, err = writer.ResponseWriter.Write(f.response.Body)
+
+			return
+		}
+	}
+}
+
+// join 加入正在处理的请求，没有时成为处理请求的一方
+func (fg *flightGroup) join(key string) (f *flight, leader bool) {
+	fg.mutex.Lock()
+	defer fg.mutex.Unlock()
+
+	if f, ok := fg.flights[key]; ok {
+		return f, false
+	}
+	f = &flight{done: make(chan struct{})}
+	fg.flights[key] = f
+
+	return f, true
+}
+
+// leave 处理完成，唤醒等待的请求，可以重复调用
+func (fg *flightGroup) leave(key string, f *flight) {
+	f.leaving.Do(func() {
+		fg.mutex.Lock()
+		delete(fg.flights, key)
+		fg.mutex.Unlock()
+
+		close(f.done)
+	})
+}
+
+func writeShared(c echo.Context, rsp *CachedResponse) (err error) {
+	header := c.Response().Header()
+	for key, values := range rsp.Header {
+		// 保存的请求头是规范的写法，请求编号使用这次请求的
+		if requestIdHeader == key || HeaderXSingleFlight == key {
+			continue
+		}
+		header[key] = values
+	}
+	c.Response().WriteHeader(rsp.Status)
+	_, err = c.Response().Write(rsp.Body)
+
+	return
+}
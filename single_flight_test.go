@@ -0,0 +1,96 @@
+package echox
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// sharedFlight 第二个请求加入以后第一个请求的处理器才继续，handler的参数是第几次执行
+func sharedFlight(t *testing.T, handler func(c echo.Context, call int32, joined <-chan struct{}) error) (leader *httptest.ResponseRecorder, follower *httptest.ResponseRecorder, calls int32) {
+	joined := make(chan struct{})
+	var joining sync.Once
+	var requests int32
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(SingleFlightWithConfig(SingleFlightConfig{KeyFunc: func(c echo.Context) string {
+		if 2 == atomic.AddInt32(&requests, 1) {
+			// 留出加入等待的时间
+			time.AfterFunc(20*time.Millisecond, func() { joining.Do(func() { close(joined) }) })
+		}
+
+		return DefaultCacheKey(c)
+	}}))
+	e.GET("/report", func(c echo.Context) error {
+		return handler(c, atomic.AddInt32(&calls, 1), joined)
+	})
+
+	leader, follower = httptest.NewRecorder(), httptest.NewRecorder()
+	started := make(chan struct{})
+	wait := sync.WaitGroup{}
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		close(started)
+		e.ServeHTTP(leader, httptest.NewRequest(http.MethodGet, "/report", nil))
+	}()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	e.ServeHTTP(follower, httptest.NewRequest(http.MethodGet, "/report", nil))
+	wait.Wait()
+
+	return
+}
+
+func TestSingleFlightSharedKeepsRequestId(t *testing.T) {
+	leader, follower, calls := sharedFlight(t, func(c echo.Context, call int32, joined <-chan struct{}) error {
+		<-joined
+
+		return c.String(http.StatusOK, "report")
+	})
+
+	if 1 != calls {
+		t.Fatalf("处理器执行了%d次", calls)
+	}
+	if "shared" != follower.Header().Get(HeaderXSingleFlight) || "report" != follower.Body.String() {
+		t.Fatalf("第二个请求没有共享响应：%q", follower.Body.String())
+	}
+	if leader.Header().Get(echo.HeaderXRequestID) == follower.Header().Get(echo.HeaderXRequestID) {
+		t.Fatal("共享的响应使用了第一个请求的编号")
+	}
+}
+
+func TestSingleFlightBypassedWhenLeaderStreams(t *testing.T) {
+	leader, follower, calls := sharedFlight(t, func(c echo.Context, call int32, joined <-chan struct{}) (err error) {
+		if 1 == call {
+			<-joined
+		}
+		c.Response().WriteHeader(http.StatusOK)
+		if _, err = c.Response().Write([]byte("a")); nil != err {
+			return
+		}
+		c.Response().Flush()
+		_, err = c.Response().Write([]byte("b"))
+
+		return
+	})
+
+	if 2 != calls {
+		t.Fatalf("刷新以后第二个请求没有自己执行处理器，处理器执行了%d次", calls)
+	}
+	for name, rec := range map[string]*httptest.ResponseRecorder{"第一个": leader, "第二个": follower} {
+		if http.StatusOK != rec.Code || "ab" != rec.Body.String() {
+			t.Fatalf("%s请求的响应是%d %q", name, rec.Code, rec.Body.String())
+		}
+	}
+	if "shared" == follower.Header().Get(HeaderXSingleFlight) {
+		t.Fatal("流式的响应被共享了")
+	}
+}
@@ -0,0 +1,256 @@
+package echox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	// sitemapMaxURLs 协议规定单个文件最多的地址数
+	sitemapMaxURLs = 50000
+)
+
+type (
+	// SitemapURL 站点地图中的一个地址
+	SitemapURL struct {
+		// 完整的地址
+		Loc string
+		// 最后修改的时间
+		LastMod time.Time
+		// 变化频率，always、hourly、daily、weekly、monthly、yearly或者never
+		ChangeFreq string
+		// 优先级，0到1之间，为0时不输出
+		Priority float64
+	}
+
+	// SitemapProvider 提供站点地图的地址，按分页读取，数据量大时不需要一次加载
+	SitemapProvider interface {
+		// Count 地址的总数
+		Count(ctx context.Context) (int, error)
+		// URLs 读取一页地址
+		URLs(ctx context.Context, offset int, limit int) ([]SitemapURL, error)
+	}
+
+	// SitemapConfig 站点地图和robots.txt的配置
+	SitemapConfig struct {
+		// 地址的来源
+		// 必须
+		Provider SitemapProvider
+
+		// 站点的地址，比如https://www.example.com，用来生成分页的地址
+		// 必须
+		BaseURL string
+
+		// 每页的地址数
+		// 非必须 默认值是50000，也是协议允许的最大值
+		PageSize int
+
+		// 分页使用gzip压缩，地址以.xml.gz结尾
+		Gzip bool
+
+		// 缓存头
+		// 非必须 默认值是"public, max-age=3600"
+		CacheControl string
+
+		// robots.txt，为空时不提供
+		Robots *RobotsConfig
+	}
+
+	// RobotsConfig robots.txt的配置
+	RobotsConfig struct {
+		// 规则，按顺序输出
+		// 非必须 默认允许所有的爬虫
+		Rules []RobotsRule
+
+		// 其它内容，原样加在最后
+		Extra []string
+	}
+
+	// RobotsRule 一组爬虫的规则
+	RobotsRule struct {
+		// 非必须 默认值是"*"
+		UserAgent  string
+		Allow      []string
+		Disallow   []string
+		CrawlDelay time.Duration
+	}
+
+	sitemapIndex struct {
+		XMLName  xml.Name       `xml:"sitemapindex"`
+		Xmlns    string         `xml:"xmlns,attr"`
+		Sitemaps []sitemapEntry `xml:"sitemap"`
+	}
+
+	sitemapEntry struct {
+		Loc string `xml:"loc"`
+	}
+
+	sitemapURLSet struct {
+		XMLName xml.Name     `xml:"urlset"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+
+	sitemapURL struct {
+		Loc        string `xml:"loc"`
+		LastMod    string `xml:"lastmod,omitempty"`
+		ChangeFreq string `xml:"changefreq,omitempty"`
+		Priority   string `xml:"priority,omitempty"`
+	}
+)
+
+var (
+	// DefaultSitemapConfig 默认配置
+	DefaultSitemapConfig = SitemapConfig{
+		PageSize:     sitemapMaxURLs,
+		CacheControl: "public, max-age=3600",
+	}
+)
+
+// mount 挂载/sitemap.xml、/sitemaps/:page和/robots.txt
+// /sitemap.xml是索引，分页在/sitemaps/1.xml（或者1.xml.gz）
+func (sc *SitemapConfig) mount(e *echo.Echo) {
+	if nil == sc.Provider {
+		panic("echo: sitemap requires a provider")
+	}
+	if "" == sc.BaseURL {
+		panic("echo: sitemap requires a base url")
+	}
+	sc.BaseURL = strings.TrimRight(sc.BaseURL, "/")
+	if 0 >= sc.PageSize || sitemapMaxURLs < sc.PageSize {
+		sc.PageSize = DefaultSitemapConfig.PageSize
+	}
+	if "" == sc.CacheControl {
+		sc.CacheControl = DefaultSitemapConfig.CacheControl
+	}
+
+	e.GET("/sitemap.xml", sc.index)
+	e.GET("/sitemaps/:page", sc.page)
+	if nil != sc.Robots {
+		e.GET("/robots.txt", sc.robots)
+	}
+}
+
+func (sc *SitemapConfig) index(c echo.Context) (err error) {
+	var count int
+	if count, err = sc.Provider.Count(c.Request().Context()); nil != err {
+		return
+	}
+
+	index := sitemapIndex{Xmlns: sitemapNamespace}
+	for page := 1; page <= (count+sc.PageSize-1)/sc.PageSize; page++ {
+		index.Sitemaps = append(index.Sitemaps, sitemapEntry{Loc: fmt.Sprintf("%s/sitemaps/%d%s", sc.BaseURL, page, sc.ext())})
+	}
+
+	return sc.writeXML(c, index, false)
+}
+
+func (sc *SitemapConfig) page(c echo.Context) (err error) {
+	name := c.Param("page")
+	if !strings.HasSuffix(name, sc.ext()) {
+		return echo.ErrNotFound
+	}
+	page, parseErr := strconv.Atoi(strings.TrimSuffix(name, sc.ext()))
+	if nil != parseErr || 1 > page {
+		return echo.ErrNotFound
+	}
+
+	var urls []SitemapURL
+	if urls, err = sc.Provider.URLs(c.Request().Context(), (page-1)*sc.PageSize, sc.PageSize); nil != err {
+		return
+	}
+	if 0 == len(urls) {
+		return echo.ErrNotFound
+	}
+	set := sitemapURLSet{Xmlns: sitemapNamespace, URLs: make([]sitemapURL, 0, len(urls))}
+	for _, url := range urls {
+		item := sitemapURL{Loc: url.Loc, ChangeFreq: url.ChangeFreq}
+		if !url.LastMod.IsZero() {
+			item.LastMod = url.LastMod.UTC().Format(time.RFC3339)
+		}
+		if 0 < url.Priority {
+			item.Priority = strconv.FormatFloat(url.Priority, 'f', 1, 64)
+		}
+		set.URLs = append(set.URLs, item)
+	}
+
+	return sc.writeXML(c, set, sc.Gzip)
+}
+
+func (sc *SitemapConfig) ext() string {
+	if sc.Gzip {
+		return ".xml.gz"
+	}
+
+	return ".xml"
+}
+
+func (sc *SitemapConfig) writeXML(c echo.Context, v interface{}, compressed bool) (err error) {
+	var data []byte
+	if data, err = xml.Marshal(v); nil != err {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+
+	c.Response().Header().Set(HeaderCacheControl, sc.CacheControl)
+	if !compressed {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationXMLCharsetUTF8, data)
+	}
+
+	// .xml.gz是压缩后的文件，不是传输编码
+	buffer := new(bytes.Buffer)
+	gw := gzip.NewWriter(buffer)
+	if _, err = gw.Write(data); nil != err {
+		return
+	}
+	if err = gw.Close(); nil != err {
+		return
+	}
+
+	return c.Blob(http.StatusOK, "application/gzip", buffer.Bytes())
+}
+
+func (sc *SitemapConfig) robots(c echo.Context) error {
+	rules := sc.Robots.Rules
+	if 0 == len(rules) {
+		rules = []RobotsRule{{Disallow: []string{""}}}
+	}
+
+	var sb strings.Builder
+	for i, rule := range rules {
+		if 0 != i {
+			sb.WriteString("\n")
+		}
+		agent := rule.UserAgent
+		if "" == agent {
+			agent = "*"
+		}
+		sb.WriteString("User-agent: " + agent + "\n")
+		for _, path := range rule.Allow {
+			sb.WriteString("Allow: " + path + "\n")
+		}
+		for _, path := range rule.Disallow {
+			sb.WriteString("Disallow: " + path + "\n")
+		}
+		if 0 < rule.CrawlDelay {
+			sb.WriteString("Crawl-delay: " + strconv.Itoa(int(rule.CrawlDelay.Seconds())) + "\n")
+		}
+	}
+	sb.WriteString("\nSitemap: " + sc.BaseURL + "/sitemap.xml\n")
+	for _, line := range sc.Robots.Extra {
+		sb.WriteString(line + "\n")
+	}
+	c.Response().Header().Set(HeaderCacheControl, sc.CacheControl)
+
+	return c.String(http.StatusOK, sb.String())
+}
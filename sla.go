@@ -0,0 +1,136 @@
+package echox
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type (
+	// SLA 路由承诺的服务水平，导出到OpenAPI文档、错误预算和监控的定义中
+	SLA struct {
+		// 延迟的目标，比如200毫秒
+		Latency time.Duration
+
+		// 延迟目标对应的分位数
+		// 非必须 默认值是0.99
+		Percentile float64
+
+		// 可用性的目标，比如0.999，5xx算作不可用
+		Availability float64
+	}
+
+	// SLOMonitor 机器可读的监控定义，可以用来生成Grafana面板和告警规则
+	SLOMonitor struct {
+		Name         string  `json:"name"`
+		Method       string  `json:"method"`
+		Route        string  `json:"route"`
+		Availability float64 `json:"availability,omitempty"`
+		Latency      string  `json:"latency,omitempty"`
+		Percentile   float64 `json:"percentile,omitempty"`
+		// PromQL，基于echox导出的Prometheus指标
+		ErrorRatio   string `json:"errorRatio,omitempty"`
+		LatencyQuery string `json:"latencyQuery,omitempty"`
+		// 告警规则，错误预算按BurnRate倍速消耗或者延迟超过目标时触发
+		Alerts []SLOAlert `json:"alerts"`
+	}
+
+	// SLOAlert 告警规则
+	SLOAlert struct {
+		Name string `json:"name"`
+		Expr string `json:"expr"`
+		For  string `json:"for"`
+	}
+
+	// OpenAPISLA 文档中的x-sla扩展
+	OpenAPISLA struct {
+		Latency      string  `json:"latency,omitempty"`
+		Percentile   float64 `json:"percentile,omitempty"`
+		Availability float64 `json:"availability,omitempty"`
+	}
+)
+
+// sloBurnRate 一小时内消耗掉一个月2%的错误预算的速度，和Google SRE的快速告警一致
+const sloBurnRate = 14.4
+
+// SLOMonitors 声明了SLA的路由的监控定义
+func SLOMonitors() (monitors []SLOMonitor) {
+	monitors = make([]SLOMonitor, 0)
+	for _, route := range RegisteredRoutes() {
+		if nil == route.SLA {
+			continue
+		}
+
+		sla := route.SLA.normalize()
+		name := route.Name
+		if "" == name {
+			name = routeKey(route.Method, route.Path)
+		}
+		monitor := SLOMonitor{Name: name, Method: route.Method, Route: route.Path, Alerts: make([]SLOAlert, 0, 2)}
+		selector := fmt.Sprintf(`method="%s",route="%s"`, escapeLabel(route.Method), escapeLabel(route.Path))
+		if 0 < sla.Availability {
+			monitor.Availability = sla.Availability
+			monitor.ErrorRatio = fmt.Sprintf(`sum(rate(http_requests_total{%s,status=~"5.."}[5m])) / sum(rate(http_requests_total{%s}[5m]))`, selector, selector)
+			monitor.Alerts = append(monitor.Alerts, SLOAlert{
+				Name: name + " error budget burn",
+				Expr: monitor.ErrorRatio + " > " + formatFloat(sla.maxErrorRate(sloBurnRate)),
+				For:  "5m",
+			})
+		}
+		if 0 < sla.Latency {
+			monitor.Latency = sla.Latency.String()
+			monitor.Percentile = sla.Percentile
+			monitor.LatencyQuery = fmt.Sprintf(`histogram_quantile(%s, sum(rate(http_request_duration_seconds_bucket{%s}[5m])) by (le))`, formatFloat(sla.Percentile), selector)
+			monitor.Alerts = append(monitor.Alerts, SLOAlert{
+				Name: name + " latency",
+				Expr: monitor.LatencyQuery + " > " + formatFloat(sla.Latency.Seconds()),
+				For:  "10m",
+			})
+		}
+		monitors = append(monitors, monitor)
+	}
+
+	return
+}
+
+func (s SLA) normalize() SLA {
+	if 0 >= s.Percentile {
+		s.Percentile = 0.99
+	}
+
+	return s
+}
+
+// maxErrorRate 按burnRate倍速消耗错误预算时的错误率
+func (s SLA) maxErrorRate(burnRate float64) float64 {
+	rate := (1 - s.Availability) * burnRate
+	if 1 < rate {
+		rate = 1
+	}
+
+	return rate
+}
+
+func (s SLA) openAPI() *OpenAPISLA {
+	s = s.normalize()
+	doc := &OpenAPISLA{Availability: s.Availability}
+	if 0 < s.Latency {
+		doc.Latency = s.Latency.String()
+		doc.Percentile = s.Percentile
+	}
+
+	return doc
+}
+
+func (s SLA) validate(path string) {
+	if 0 > s.Availability || 1 <= s.Availability {
+		panic("echo: route sla availability must be less than 1: " + path)
+	}
+	if 1 < s.Percentile || 0 > s.Latency {
+		panic("echo: route sla is invalid: " + path)
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
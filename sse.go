@@ -0,0 +1,129 @@
+package echox
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// Event SSE事件
+	Event struct {
+		Id    string
+		Event string
+		// 字符串和[]byte原样发送，其它按JSON发送
+		Data interface{}
+		// 建议客户端重连的间隔
+		Retry time.Duration
+	}
+
+	// EventStream SSE连接，写入是并发安全的
+	EventStream struct {
+		c       echo.Context
+		mutex   sync.Mutex
+		closing chan struct{}
+		done    chan struct{}
+	}
+
+	// EventStreamHandler 处理SSE连接，返回时结束响应
+	EventStreamHandler func(c echo.Context, stream *EventStream) error
+)
+
+// SSE 创建SSE处理器
+// 服务退出时发送最后一个事件，处理器应该在Done()后尽快返回
+func SSE(handler EventStreamHandler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		es := &EventStream{c: c, closing: make(chan struct{}), done: make(chan struct{})}
+		// 请求结束时上下文一定会取消，协程不会泄漏
+		done := c.Request().Context().Done()
+		go func() {
+			select {
+			case <-done:
+			case <-es.closing:
+			}
+			close(es.done)
+		}()
+		s := &stream{
+			notify: func(config StreamConfig) {
+				if err := es.Send(Event{Event: config.Event, Data: config.Reason, Retry: config.Retry}); nil != err {
+					c.Logger().Debug(err)
+				}
+				close(es.closing)
+			},
+			// SSE是普通的请求，处理器不返回时由HTTP服务的退出超时兜底
+			close: func() {},
+		}
+		if !streams.add(s) {
+			return ErrStreamClosing
+		}
+		defer streams.remove(s)
+
+		header := c.Response().Header()
+		header.Set(echo.HeaderContentType, MIMETextEventStream)
+		header.Set("Cache-Control", "no-cache")
+		header.Set(HeaderConnection, "keep-alive")
+		// 禁止Nginx缓冲
+		header.Set("X-Accel-Buffering", "no")
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Flush()
+
+		return handler(c, es)
+	}
+}
+
+// Send 发送事件
+func (es *EventStream) Send(event Event) (err error) {
+	var sb strings.Builder
+	if "" != event.Id {
+		sb.WriteString("id: " + event.Id + "\n")
+	}
+	if "" != event.Event {
+		sb.WriteString("event: " + event.Event + "\n")
+	}
+	if 0 < event.Retry {
+		sb.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	var data string
+	switch value := event.Data.(type) {
+	case nil:
+	case string:
+		data = value
+	case []byte:
+		data = string(value)
+	default:
+		var encoded []byte
+		if encoded, err = json.Marshal(value); nil != err {
+			return
+		}
+		data = string(encoded)
+	}
+	// 多行数据每行一个data字段
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	if _, err = es.c.Response().Write([]byte(sb.String())); nil == err {
+		es.c.Response().Flush()
+	}
+
+	return
+}
+
+// Done 客户端断开或者服务退出时关闭
+func (es *EventStream) Done() <-chan struct{} {
+	return es.done
+}
+
+// Closing 服务退出时关闭
+func (es *EventStream) Closing() <-chan struct{} {
+	return es.closing
+}
@@ -0,0 +1,119 @@
+package echox
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// Broker 按主题把SSE事件发给订阅的连接
+	// 配置了EchoConfig.PubSub时发布的事件会发给所有实例上的连接
+	Broker struct {
+		name        string
+		mutex       sync.RWMutex
+		subscribers map[string]map[*EventStream]struct{}
+	}
+
+	// brokerEvent 在实例之间传递的事件，数据保持JSON原样
+	brokerEvent struct {
+		Id    string          `json:"id,omitempty"`
+		Event string          `json:"event,omitempty"`
+		Data  json.RawMessage `json:"data,omitempty"`
+		Text  *string         `json:"text,omitempty"`
+		Retry time.Duration   `json:"retry,omitempty"`
+	}
+)
+
+// NewBroker 创建Broker，同一个名称只能创建一个
+func NewBroker(name string) *Broker {
+	if "" == name {
+		name = "default"
+	}
+	broker := &Broker{name: name, subscribers: make(map[string]map[*EventStream]struct{})}
+	broadcasts.handle("sse:"+name, broker.deliver)
+
+	return broker
+}
+
+// Subscribe 连接订阅主题，返回取消订阅的函数
+func (b *Broker) Subscribe(topic string, stream *EventStream) (unsubscribe func()) {
+	b.mutex.Lock()
+	streams, ok := b.subscribers[topic]
+	if !ok {
+		streams = make(map[*EventStream]struct{})
+		b.subscribers[topic] = streams
+	}
+	streams[stream] = struct{}{}
+	b.mutex.Unlock()
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		delete(b.subscribers[topic], stream)
+		if 0 == len(b.subscribers[topic]) {
+			delete(b.subscribers, topic)
+		}
+	}
+}
+
+// Publish 发布事件给订阅了主题的所有连接
+func (b *Broker) Publish(ctx context.Context, topic string, event Event) (err error) {
+	be := brokerEvent{Id: event.Id, Event: event.Event, Retry: event.Retry}
+	switch value := event.Data.(type) {
+	case nil:
+	case string:
+		be.Text = &value
+	case []byte:
+		text := string(value)
+		be.Text = &text
+	default:
+		if be.Data, err = json.Marshal(value); nil != err {
+			return
+		}
+	}
+
+	return broadcasts.publish(ctx, "sse:"+b.name, topic, be)
+}
+
+// Handler 订阅topics返回的主题，直到客户端断开或者服务退出
+func (b *Broker) Handler(topics func(c echo.Context) []string) echo.HandlerFunc {
+	return SSE(func(c echo.Context, stream *EventStream) error {
+		for _, topic := range topics(c) {
+			defer b.Subscribe(topic, stream)()
+		}
+		<-stream.Done()
+
+		return nil
+	})
+}
+
+func (b *Broker) deliver(topic string, _ bool, data []byte) {
+	var be brokerEvent
+	if err := json.Unmarshal(data, &be); nil != err {
+		return
+	}
+	event := Event{Id: be.Id, Event: be.Event, Retry: be.Retry}
+	switch {
+	case nil != be.Text:
+		event.Data = *be.Text
+	case 0 != len(be.Data):
+		// 已经是JSON，原样发送
+		event.Data = []byte(be.Data)
+	}
+
+	b.mutex.RLock()
+	streams := make([]*EventStream, 0, len(b.subscribers[topic]))
+	for stream := range b.subscribers[topic] {
+		streams = append(streams, stream)
+	}
+	b.mutex.RUnlock()
+
+	for _, stream := range streams {
+		_ = stream.Send(event)
+	}
+}
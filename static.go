@@ -0,0 +1,184 @@
+package echox
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderCacheControl = "Cache-Control"
+
+	defaultIndexFile = "index.html"
+)
+
+type (
+	// StaticMount 静态文件挂载配置
+	StaticMount struct {
+		// 访问前缀
+		// 非必须 默认挂载在根路径
+		Prefix string
+
+		// 本地目录
+		// 和FS二选一
+		Root string
+
+		// 文件系统，一般是embed.FS
+		// 优先于Root
+		FS fs.FS
+
+		// 文件不存在时返回index.html
+		// 适用于使用History API的单页应用
+		SPAFallback bool
+
+		// 静态资源的缓存头
+		// 非必须 index.html始终不缓存，避免发布后前端不更新
+		CacheControl string
+	}
+
+	// StaticResponse 配置的固定响应，比如robots.txt和security.txt，不需要写处理器
+	StaticResponse struct {
+		// 路径
+		// 必须
+		Path string
+
+		// 请求方法，GET同时响应HEAD
+		// 非必须 默认值是GET
+		Method string
+
+		// 状态码
+		// 非必须 默认值是200
+		Status int
+
+		// 响应头
+		Headers map[string]string
+
+		// 内容类型
+		// 非必须 默认按文件的扩展名判断，没有文件时是纯文本
+		ContentType string
+
+		// 响应内容
+		// 和File二选一
+		Body string
+
+		// 本地文件，启动时读取，不存在时启动失败
+		File string
+	}
+)
+
+func (sm *StaticMount) mount(e *echo.Echo) {
+	prefix := strings.TrimRight(sm.Prefix, "/")
+	handler := sm.handler()
+
+	if "" != prefix {
+		e.GET(prefix, handler)
+		e.HEAD(prefix, handler)
+	}
+	e.GET(prefix+"/*", handler)
+	e.HEAD(prefix+"/*", handler)
+}
+
+func (sm *StaticMount) handler() echo.HandlerFunc {
+	var fileSystem http.FileSystem
+	if nil != sm.FS {
+		fileSystem = http.FS(sm.FS)
+	} else {
+		fileSystem = http.Dir(sm.Root)
+	}
+
+	return func(c echo.Context) (err error) {
+		name := c.Param("*")
+		if unescaped, unescapeErr := url.PathUnescape(name); nil == unescapeErr {
+			name = unescaped
+		}
+		name = path.Clean("/" + name)
+
+		var file http.File
+		if file, err = sm.open(fileSystem, name); nil != err {
+			if !os.IsNotExist(err) || !sm.SPAFallback {
+				return echo.ErrNotFound
+			}
+			if file, err = fileSystem.Open("/" + defaultIndexFile); nil != err {
+				return echo.ErrNotFound
+			}
+			name = "/" + defaultIndexFile
+		}
+
+		if defaultIndexFile == path.Base(name) {
+			c.Response().Header().Set(HeaderCacheControl, "no-cache")
+		} else if "" != sm.CacheControl {
+			c.Response().Header().Set(HeaderCacheControl, sm.CacheControl)
+		}
+		ec := EchoContext{Context: c}
+
+		return ec.HttpFile(file)
+	}
+}
+
+func (sr *StaticResponse) mount(e *echo.Echo) {
+	if "" == sr.Path {
+		panic("echo: static response requires a path")
+	}
+	method := sr.Method
+	if "" == method {
+		method = http.MethodGet
+	}
+	status := sr.Status
+	if 0 == status {
+		status = http.StatusOK
+	}
+
+	body := []byte(sr.Body)
+	contentType := sr.ContentType
+	if "" != sr.File {
+		var err error
+		if body, err = os.ReadFile(sr.File); nil != err {
+			panic("echo: static response file is unreadable: " + err.Error())
+		}
+		if "" == contentType {
+			contentType = mime.TypeByExtension(filepath.Ext(sr.File))
+		}
+	}
+	if "" == contentType {
+		contentType = echo.MIMETextPlainCharsetUTF8
+	}
+
+	headers := sr.Headers
+	handler := func(c echo.Context) error {
+		for key, value := range headers {
+			c.Response().Header().Set(key, value)
+		}
+
+		return c.Blob(status, contentType, body)
+	}
+	e.Add(method, sr.Path, handler)
+	if http.MethodGet == method {
+		e.HEAD(sr.Path, handler)
+	}
+}
+
+// open 打开文件，目录则打开目录下的index.html
+func (sm *StaticMount) open(fileSystem http.FileSystem, name string) (file http.File, err error) {
+	if file, err = fileSystem.Open(name); nil != err {
+		return
+	}
+
+	var fi os.FileInfo
+	if fi, err = file.Stat(); nil != err {
+		file.Close()
+		return
+	}
+	if fi.IsDir() {
+		file.Close()
+		file, err = fileSystem.Open(path.Join(name, defaultIndexFile))
+	}
+
+	return
+}
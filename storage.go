@@ -0,0 +1,315 @@
+package echox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type (
+	// Storage 文件存储
+	Storage interface {
+		// Put 保存文件，size小于0表示长度未知
+		// 失败时不能覆盖同名的已有文件，也不能留下写了一半的文件
+		Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (StoredObject, error)
+		// Open 读取文件
+		Open(ctx context.Context, key string) (io.ReadCloser, error)
+		// Delete 删除文件
+		Delete(ctx context.Context, key string) error
+	}
+
+	// StoredObject 保存后的文件信息
+	StoredObject struct {
+		Key         string `json:"key"`
+		Size        int64  `json:"size"`
+		ContentType string `json:"contentType"`
+		Filename    string `json:"filename,omitempty"`
+		Width       int    `json:"width,omitempty"`
+		Height      int    `json:"height,omitempty"`
+	}
+
+	// localStorage 本地目录存储
+	localStorage struct {
+		dir string
+	}
+
+	// S3Config 兼容S3协议的对象存储配置
+	S3Config struct {
+		// 服务地址，比如https://s3.amazonaws.com或者http://minio:9000
+		Endpoint  string
+		Region    string
+		Bucket    string
+		AccessKey string
+		SecretKey string
+		// 使用路径风格的地址，MinIO等需要设置
+		PathStyle bool
+		Client    *http.Client
+	}
+
+	s3Storage struct {
+		config S3Config
+	}
+)
+
+var (
+	// ErrObjectNotFound 文件不存在
+	ErrObjectNotFound = errors.New("文件不存在")
+	// ErrInvalidKey 文件名不合法
+	ErrInvalidKey = errors.New("文件名不合法")
+)
+
+// NewLocalStorage 创建本地目录存储
+func NewLocalStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); nil != err {
+		return nil, err
+	}
+
+	return &localStorage{dir: dir}, nil
+}
+
+func (ls *localStorage) path(key string) (path string, err error) {
+	clean := filepath.Clean("/" + key)
+	if "/" == clean {
+		err = ErrInvalidKey
+		return
+	}
+	path = filepath.Join(ls.dir, filepath.FromSlash(clean))
+
+	return
+}
+
+func (ls *localStorage) Put(_ context.Context, key string, reader io.Reader, _ int64, contentType string) (object StoredObject, err error) {
+	var path string
+	if path, err = ls.path(key); nil != err {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); nil != err {
+		return
+	}
+
+	// 先写临时文件，完整写入后再改名，避免留下半个文件
+	var file *os.File
+	if file, err = ioutil.TempFile(filepath.Dir(path), ".upload-*"); nil != err {
+		return
+	}
+	defer func() {
+		if nil != err {
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	var size int64
+	size, err = io.Copy(file, reader)
+	if closeErr := file.Close(); nil == err {
+		err = closeErr
+	}
+	if nil != err {
+		return
+	}
+	if err = os.Rename(file.Name(), path); nil != err {
+		return
+	}
+
+	object = StoredObject{Key: key, Size: size, ContentType: contentType}
+
+	return
+}
+
+func (ls *localStorage) Open(_ context.Context, key string) (reader io.ReadCloser, err error) {
+	var path string
+	if path, err = ls.path(key); nil != err {
+		return
+	}
+	if reader, err = os.Open(path); os.IsNotExist(err) {
+		err = ErrObjectNotFound
+	}
+
+	return
+}
+
+func (ls *localStorage) Delete(_ context.Context, key string) (err error) {
+	var path string
+	if path, err = ls.path(key); nil != err {
+		return
+	}
+	if err = os.Remove(path); os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+// NewS3Storage 创建兼容S3协议的对象存储
+func NewS3Storage(config S3Config) Storage {
+	if "" == config.Endpoint {
+		panic("echo: s3 storage requires an endpoint")
+	}
+	if "" == config.Bucket {
+		panic("echo: s3 storage requires a bucket")
+	}
+	if "" == config.Region {
+		config.Region = "us-east-1"
+	}
+	if nil == config.Client {
+		config.Client = http.DefaultClient
+	}
+
+	return &s3Storage{config: config}
+}
+
+func (ss *s3Storage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (object StoredObject, err error) {
+	// S3需要知道长度，长度未知时先写到临时文件
+	if 0 > size {
+		var file *os.File
+		if file, err = ioutil.TempFile("", "echox-s3-*"); nil != err {
+			return
+		}
+		defer func() {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}()
+		if size, err = io.Copy(file, reader); nil != err {
+			return
+		}
+		if _, err = file.Seek(0, io.SeekStart); nil != err {
+			return
+		}
+		reader = file
+	}
+
+	var req *http.Request
+	if req, err = ss.request(ctx, http.MethodPut, key, reader); nil != err {
+		return
+	}
+	req.ContentLength = size
+	if "" != contentType {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if _, err = ss.do(req); nil != err {
+		return
+	}
+
+	object = StoredObject{Key: key, Size: size, ContentType: contentType}
+
+	return
+}
+
+func (ss *s3Storage) Open(ctx context.Context, key string) (reader io.ReadCloser, err error) {
+	var req *http.Request
+	if req, err = ss.request(ctx, http.MethodGet, key, nil); nil != err {
+		return
+	}
+
+	var rsp *http.Response
+	if rsp, err = ss.do(req); nil != err {
+		return
+	}
+	reader = rsp.Body
+
+	return
+}
+
+func (ss *s3Storage) Delete(ctx context.Context, key string) (err error) {
+	var req *http.Request
+	if req, err = ss.request(ctx, http.MethodDelete, key, nil); nil != err {
+		return
+	}
+
+	var rsp *http.Response
+	if rsp, err = ss.do(req); nil == err {
+		_ = rsp.Body.Close()
+	} else if ErrObjectNotFound == err {
+		err = nil
+	}
+
+	return
+}
+
+func (ss *s3Storage) request(ctx context.Context, method string, key string, body io.Reader) (req *http.Request, err error) {
+	var endpoint *url.URL
+	if endpoint, err = url.Parse(ss.config.Endpoint); nil != err {
+		return
+	}
+
+	escaped := (&url.URL{Path: "/" + strings.TrimPrefix(key, "/")}).EscapedPath()
+	if ss.config.PathStyle {
+		endpoint.Path = "/" + ss.config.Bucket + escaped
+	} else {
+		endpoint.Host = ss.config.Bucket + "." + endpoint.Host
+		endpoint.Path = escaped
+	}
+	endpoint.RawPath = endpoint.Path
+	if req, err = http.NewRequestWithContext(ctx, method, endpoint.String(), body); nil != err {
+		return
+	}
+	ss.sign(req, time.Now().UTC())
+
+	return
+}
+
+func (ss *s3Storage) do(req *http.Request) (rsp *http.Response, err error) {
+	if rsp, err = ss.config.Client.Do(req); nil != err {
+		return
+	}
+	if http.StatusNotFound == rsp.StatusCode {
+		_ = rsp.Body.Close()
+		err = ErrObjectNotFound
+	} else if http.StatusMultipleChoices <= rsp.StatusCode {
+		message, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 1024))
+		_ = rsp.Body.Close()
+		err = fmt.Errorf("s3: %s %s", rsp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return
+}
+
+// sign AWS Signature Version 4签名，不对内容签名以支持流式上传
+func (ss *s3Storage) sign(req *http.Request, now time.Time) {
+	const payload = "UNSIGNED-PAYLOAD"
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", timestamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payload + "\nx-amz-date:" + timestamp + "\n",
+		signed,
+		payload,
+	}, "\n")
+	scope := date + "/" + ss.config.Region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+ss.config.SecretKey), date)
+	key = hmacSHA256(key, ss.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		ss.config.AccessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
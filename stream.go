@@ -0,0 +1,149 @@
+package echox
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// StreamConfig 长连接（WebSocket和SSE）优雅退出的配置
+	StreamConfig struct {
+		// 通知客户端后等待客户端断开的时间，超时后直接关闭
+		// 非必须 默认值是10秒
+		Deadline time.Duration
+
+		// 通知客户端的原因，WebSocket放在关闭帧中，SSE放在最后一个事件的数据中
+		// 非必须 默认值是"server shutting down"
+		Reason string
+
+		// SSE最后一个事件的名字
+		// 非必须 默认值是"shutdown"
+		Event string
+
+		// 建议SSE客户端重连的间隔
+		// 非必须 默认值是1秒
+		Retry time.Duration
+	}
+
+	// stream 登记的长连接
+	stream struct {
+		// 通知客户端服务要退出了
+		notify func(config StreamConfig)
+		// 超时后强制关闭
+		close func()
+		done  chan struct{}
+	}
+
+	streamRegistry struct {
+		mutex   sync.Mutex
+		closing bool
+		streams map[*stream]struct{}
+	}
+)
+
+var (
+	// DefaultStreamConfig 默认配置
+	DefaultStreamConfig = StreamConfig{
+		Deadline: 10 * time.Second,
+		Reason:   "server shutting down",
+		Event:    "shutdown",
+		Retry:    time.Second,
+	}
+
+	// ErrStreamClosing 服务正在退出，不再接受长连接
+	ErrStreamClosing = echo.NewHTTPError(http.StatusServiceUnavailable, "服务正在退出")
+
+	streams = &streamRegistry{streams: make(map[*stream]struct{})}
+)
+
+// Streams 当前的长连接数
+func Streams() int {
+	streams.mutex.Lock()
+	defer streams.mutex.Unlock()
+
+	return len(streams.streams)
+}
+
+// stopped 服务是否已经开始退出
+func (sr *streamRegistry) stopped() bool {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	return sr.closing
+}
+
+// add 登记长连接，服务退出时返回false
+func (sr *streamRegistry) add(s *stream) bool {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	if sr.closing {
+		return false
+	}
+	s.done = make(chan struct{})
+	sr.streams[s] = struct{}{}
+
+	return true
+}
+
+func (sr *streamRegistry) remove(s *stream) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	if _, ok := sr.streams[s]; ok {
+		delete(sr.streams, s)
+		close(s.done)
+	}
+}
+
+// shutdown 通知所有长连接并等待断开，超时后强制关闭
+func (sr *streamRegistry) shutdown(config StreamConfig) {
+	sr.mutex.Lock()
+	sr.closing = true
+	active := make([]*stream, 0, len(sr.streams))
+	for s := range sr.streams {
+		active = append(active, s)
+	}
+	sr.mutex.Unlock()
+
+	for _, s := range active {
+		s.notify(config)
+	}
+	deadline := time.After(config.Deadline)
+	for _, s := range active {
+		select {
+		case <-s.done:
+		case <-deadline:
+			for _, remaining := range active {
+				select {
+				case <-remaining.done:
+				default:
+					remaining.close()
+				}
+			}
+
+			return
+		}
+	}
+}
+
+func (sc *StreamConfig) defaults() StreamConfig {
+	config := *sc
+	if 0 >= config.Deadline {
+		config.Deadline = DefaultStreamConfig.Deadline
+	}
+	if "" == config.Reason {
+		config.Reason = DefaultStreamConfig.Reason
+	}
+	if "" == config.Event {
+		config.Event = DefaultStreamConfig.Event
+	}
+	if 0 >= config.Retry {
+		config.Retry = DefaultStreamConfig.Retry
+	}
+
+	return config
+}
@@ -0,0 +1,222 @@
+package echox
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// ChangeUpsert 新增或者修改
+	ChangeUpsert = "upsert"
+	// ChangeDelete 删除
+	ChangeDelete = "delete"
+)
+
+type (
+	// Change 一条变化
+	Change struct {
+		Id   string      `json:"id"`
+		Op   string      `json:"op"`
+		Data interface{} `json:"data,omitempty"`
+	}
+
+	// ChangeFeed 变化来源
+	ChangeFeed interface {
+		// Changes 返回游标之后的变化，游标为空表示从头开始
+		// 返回新的游标，以及是否还有更多的变化
+		Changes(ctx context.Context, scope string, cursor string, limit int) (changes []Change, next string, more bool, err error)
+	}
+
+	// SyncConfig 增量同步配置
+	SyncConfig struct {
+		// 签名令牌的密钥
+		// 必须
+		Secret []byte
+
+		// 变化来源
+		// 必须
+		Feed ChangeFeed
+
+		// 令牌的有效期，过期后客户端需要全量同步
+		// 非必须 默认值是30天
+		TTL time.Duration
+
+		// 每次最多返回的变化数
+		// 非必须 默认值是500
+		Limit int
+
+		// 令牌所属的范围，令牌不能跨范围使用
+		// 非必须 默认是当前用户
+		Scope func(c echo.Context) string
+
+		// 传递令牌的查询参数
+		// 非必须 默认值是"token"
+		TokenParam string
+	}
+
+	// SyncResponse 增量同步的返回
+	SyncResponse struct {
+		Changes []Change `json:"changes"`
+		Token   string   `json:"token"`
+		More    bool     `json:"more"`
+	}
+
+	syncToken struct {
+		Cursor string `json:"c"`
+		Scope  string `json:"s"`
+		Expiry int64  `json:"e"`
+	}
+
+	// MemoryChangeFeed 内存中的变化来源，适合测试和单实例
+	MemoryChangeFeed struct {
+		mutex   sync.RWMutex
+		changes map[string][]Change
+	}
+)
+
+var (
+	// DefaultSyncConfig 默认配置
+	DefaultSyncConfig = SyncConfig{
+		TTL:        30 * 24 * time.Hour,
+		Limit:      500,
+		Scope:      userIdOf,
+		TokenParam: "token",
+	}
+
+	// ErrSyncTokenInvalid 令牌不合法或者已经过期，需要全量同步
+	ErrSyncTokenInvalid = echo.NewHTTPError(http.StatusGone, "同步令牌已经失效，请重新全量同步")
+)
+
+// Sync 增量同步处理器
+// 客户端第一次不带令牌，之后每次带上返回的令牌，只取得之后的变化
+func Sync(config SyncConfig) echo.HandlerFunc {
+	if 0 == len(config.Secret) {
+		panic("echo: sync requires a secret")
+	}
+	if nil == config.Feed {
+		panic("echo: sync requires a change feed")
+	}
+	if 0 >= config.TTL {
+		config.TTL = DefaultSyncConfig.TTL
+	}
+	if 0 >= config.Limit {
+		config.Limit = DefaultSyncConfig.Limit
+	}
+	if nil == config.Scope {
+		config.Scope = DefaultSyncConfig.Scope
+	}
+	if "" == config.TokenParam {
+		config.TokenParam = DefaultSyncConfig.TokenParam
+	}
+
+	return func(c echo.Context) (err error) {
+		scope := config.Scope(c)
+		cursor := ""
+		if raw := c.QueryParam(config.TokenParam); "" != raw {
+			var token syncToken
+			if token, err = config.parse(raw); nil != err || token.Scope != scope {
+				return ErrSyncTokenInvalid
+			}
+			cursor = token.Cursor
+		}
+
+		changes, next, more, err := config.Feed.Changes(c.Request().Context(), scope, cursor, config.Limit)
+		if nil != err {
+			return
+		}
+		if nil == changes {
+			changes = make([]Change, 0)
+		}
+
+		return Render(c, http.StatusOK, SyncResponse{
+			Changes: changes,
+			Token:   config.sign(syncToken{Cursor: next, Scope: scope, Expiry: time.Now().Add(config.TTL).Unix()}),
+			More:    more,
+		})
+	}
+}
+
+func (sc *SyncConfig) sign(token syncToken) string {
+	data, _ := json.Marshal(token)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + sc.signature(payload)
+}
+
+func (sc *SyncConfig) signature(payload string) string {
+	mac := hmac.New(sha256.New, sc.Secret)
+	_, _ = mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (sc *SyncConfig) parse(raw string) (token syncToken, err error) {
+	index := strings.LastIndex(raw, ".")
+	if -1 == index || !hmac.Equal([]byte(raw[index+1:]), []byte(sc.signature(raw[:index]))) {
+		err = ErrSyncTokenInvalid
+		return
+	}
+
+	var data []byte
+	if data, err = base64.RawURLEncoding.DecodeString(raw[:index]); nil != err {
+		return
+	}
+	if err = json.Unmarshal(data, &token); nil != err {
+		return
+	}
+	if time.Now().Unix() > token.Expiry {
+		err = ErrSyncTokenInvalid
+	}
+
+	return
+}
+
+// NewMemoryChangeFeed 创建内存中的变化来源
+func NewMemoryChangeFeed() *MemoryChangeFeed {
+	return &MemoryChangeFeed{changes: make(map[string][]Change)}
+}
+
+// Append 记录一条变化
+func (mcf *MemoryChangeFeed) Append(scope string, change Change) {
+	mcf.mutex.Lock()
+	defer mcf.mutex.Unlock()
+
+	mcf.changes[scope] = append(mcf.changes[scope], change)
+}
+
+func (mcf *MemoryChangeFeed) Changes(_ context.Context, scope string, cursor string, limit int) (changes []Change, next string, more bool, err error) {
+	mcf.mutex.RLock()
+	defer mcf.mutex.RUnlock()
+
+	// 游标是已经同步的变化数
+	offset := 0
+	if "" != cursor {
+		if offset, err = strconv.Atoi(cursor); nil != err {
+			return
+		}
+	}
+	all := mcf.changes[scope]
+	if offset > len(all) {
+		offset = len(all)
+	}
+	end := offset + limit
+	if end > len(all) {
+		end = len(all)
+	}
+
+	changes = append(changes, all[offset:end]...)
+	next = strconv.Itoa(end)
+	more = end < len(all)
+
+	return
+}
@@ -0,0 +1,191 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	// HeaderXTenantID 租户编号
+	HeaderXTenantID = "X-Tenant-ID"
+
+	tenantKey = "echox.tenant"
+)
+
+type (
+	// TenantResolver 从请求中解析租户，解析不出时返回空
+	TenantResolver func(c echo.Context) (tenant string, err error)
+
+	// TenantConfig 多租户配置
+	TenantConfig struct {
+		// 跳过解析
+		Skipper middleware.Skipper
+
+		// 依次尝试的解析方式，第一个解析出租户的生效
+		// 必须
+		Resolvers []TenantResolver
+
+		// 是否拒绝解析不出租户的请求
+		Required bool
+	}
+
+	tenantContextKey struct{}
+)
+
+var (
+	// ErrTenantRequired 无法确定租户
+	ErrTenantRequired = echo.NewHTTPError(http.StatusBadRequest, "无法确定租户")
+)
+
+// TenantOf 当前请求的租户
+func TenantOf(c echo.Context) string {
+	if tenant, ok := c.Get(tenantKey).(string); ok {
+		return tenant
+	}
+
+	return ""
+}
+
+// TenantFrom 从上下文中读取租户，用于下游的调用
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+
+	return tenant
+}
+
+func (ec *EchoContext) Tenant() string {
+	return TenantOf(ec.Context)
+}
+
+// TenantKey 按租户限流时作为RateLimitConfig.KeyFunc
+func TenantKey(c echo.Context) string {
+	if tenant := TenantOf(c); "" != tenant {
+		return "tenant:" + tenant
+	}
+
+	return c.RealIP()
+}
+
+// SubdomainTenant 从子域名解析租户，比如acme.example.com解析出acme
+func SubdomainTenant(domain string) TenantResolver {
+	suffix := "." + strings.TrimPrefix(strings.ToLower(domain), ".")
+
+	return func(c echo.Context) (tenant string, err error) {
+		host := strings.ToLower(c.Request().Host)
+		if index := strings.LastIndex(host, ":"); -1 != index && !strings.Contains(host[index:], "]") {
+			host = host[:index]
+		}
+		if strings.HasSuffix(host, suffix) {
+			tenant = strings.TrimSuffix(host, suffix)
+			// 只取最近一级
+			if index := strings.LastIndex(tenant, "."); -1 != index {
+				tenant = tenant[index+1:]
+			}
+		}
+
+		return
+	}
+}
+
+// HeaderTenant 从请求头解析租户
+func HeaderTenant(header string) TenantResolver {
+	if "" == header {
+		header = HeaderXTenantID
+	}
+
+	return func(c echo.Context) (string, error) {
+		return strings.TrimSpace(c.Request().Header.Get(header)), nil
+	}
+}
+
+// PathTenant 从路径解析租户，比如前缀是/tenants时，/tenants/acme/orders解析出acme
+func PathTenant(prefix string) TenantResolver {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	return func(c echo.Context) (tenant string, err error) {
+		path := c.Request().URL.Path
+		if strings.HasPrefix(path, prefix) {
+			tenant = strings.SplitN(strings.TrimPrefix(path, prefix), "/", 2)[0]
+		}
+
+		return
+	}
+}
+
+// ClaimTenant 从JWT的声明中解析租户
+func ClaimTenant(config *JWTConfig, claim string) TenantResolver {
+	if nil == config {
+		panic("echo: claim tenant requires a jwt config")
+	}
+
+	var once sync.Once
+
+	return func(c echo.Context) (tenant string, err error) {
+		once.Do(config.init)
+
+		token, extractErr := config.Extractor(c)
+		if nil != extractErr {
+			return
+		}
+		parsed, err := config.parse(token, jwt.MapClaims{})
+		if nil != err || !parsed.Valid {
+			return "", echo.ErrUnauthorized
+		}
+		if value, ok := parsed.Claims.(jwt.MapClaims)[claim]; ok && nil != value {
+			tenant = fmt.Sprint(value)
+		}
+
+		return
+	}
+}
+
+// TenantWithConfig 多租户中间件
+func TenantWithConfig(config TenantConfig) echo.MiddlewareFunc {
+	if 0 == len(config.Resolvers) {
+		panic("echo: tenant requires resolvers")
+	}
+	if nil == config.Skipper {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			tenant := ""
+			for _, resolver := range config.Resolvers {
+				if tenant, err = resolver(c); nil != err {
+					return
+				}
+				if "" != tenant {
+					break
+				}
+			}
+			if "" == tenant {
+				// 日志中不能出现客户端伪造的租户
+				c.Request().Header.Del(HeaderXTenantID)
+				if config.Required {
+					return ErrTenantRequired
+				}
+				return next(c)
+			}
+
+			c.Set(tenantKey, tenant)
+			req := c.Request()
+			// 请求日志通过请求头读取租户
+			req.Header.Set(HeaderXTenantID, tenant)
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), tenantContextKey{}, tenant)))
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package echox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// TypeScriptConfig 生成TypeScript类型的配置
+	TypeScriptConfig struct {
+		// 输出目录
+		// 必须字段
+		Dir string
+
+		// NPM包名，比如@example/api-types
+		// 非必须 为空时不生成package.json
+		Package string
+
+		// NPM包的版本
+		// 非必须 默认值是0.0.0
+		Version string
+
+		// 请求和响应的类型，传入值或者指针，比如UserReq{}、&UserRsp{}
+		// 引用到的其它结构体会一起生成
+		Types []interface{}
+
+		// 是否生成错误码枚举
+		// 非必须 默认生成，设置为true时不生成
+		DisableErrorCodes bool
+	}
+
+	// typeScriptGenerator 按类型生成接口定义，同名类型加上包名区分
+	typeScriptGenerator struct {
+		names      map[reflect.Type]string
+		used       map[string]reflect.Type
+		order      []reflect.Type
+		interfaces map[reflect.Type]string
+	}
+)
+
+// GenerateTypeScript 生成请求和响应的TypeScript类型以及错误码枚举
+// 输出types.ts、errors.ts和index.ts，配置了包名时加上package.json，前端项目可以直接引用
+func GenerateTypeScript(config TypeScriptConfig) (err error) {
+	if "" == config.Dir {
+		panic("echo: typescript generator requires a directory")
+	}
+	if "" == config.Version {
+		config.Version = "0.0.0"
+	}
+	if err = os.MkdirAll(config.Dir, 0755); nil != err {
+		return
+	}
+
+	files := map[string]string{
+		"types.ts": TypeScriptTypes(config.Types...),
+	}
+	index := "export * from './types';\n"
+	if !config.DisableErrorCodes {
+		files["errors.ts"] = TypeScriptErrorCodes(ErrorCodes())
+		index += "export * from './errors';\n"
+	}
+	files["index.ts"] = index
+	if "" != config.Package {
+		var manifest []byte
+		if manifest, err = json.MarshalIndent(map[string]interface{}{
+			"name":    config.Package,
+			"version": config.Version,
+			"main":    "index.ts",
+			"types":   "index.ts",
+			"files":   []string{"*.ts"},
+		}, "", defaultIndent); nil != err {
+			return
+		}
+		files["package.json"] = string(manifest) + "\n"
+	}
+
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(config.Dir, name), []byte(content), 0644); nil != err {
+			return
+		}
+	}
+
+	return
+}
+
+// TypeScriptTypes 生成类型的TypeScript接口定义
+func TypeScriptTypes(types ...interface{}) string {
+	generator := &typeScriptGenerator{
+		names:      make(map[reflect.Type]string),
+		used:       make(map[string]reflect.Type),
+		interfaces: make(map[reflect.Type]string),
+	}
+	for _, value := range types {
+		generator.typeOf(reflect.TypeOf(value))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("// 自动生成，不要修改\n")
+	for _, t := range generator.order {
+		sb.WriteString("\n")
+		sb.WriteString(generator.interfaces[t])
+	}
+
+	return sb.String()
+}
+
+// TypeScriptErrorCodes 生成错误码枚举
+func TypeScriptErrorCodes(codes []ErrorCode) string {
+	var sb strings.Builder
+	sb.WriteString("// 自动生成，不要修改\n\n")
+	sb.WriteString("export enum ErrorCode {\n")
+	for _, code := range codes {
+		if "" != code.Message {
+			sb.WriteString(fmt.Sprintf("  /** %s */\n", code.Message))
+		}
+		sb.WriteString(fmt.Sprintf("  %s = %d,\n", pascalCase(code.Name), code.Code))
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func (tsg *typeScriptGenerator) typeOf(t reflect.Type) string {
+	if t.Implements(schemerType) || reflect.PtrTo(t).Implements(schemerType) {
+		return schemaTypeScript(SchemaOf(t))
+	}
+	if reflect.String == t.Kind() && t.Implements(enumType) {
+		return schemaTypeScript(enumSchema(t))
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return tsg.typeOf(t.Elem()) + " | null"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if reflect.Uint8 == t.Elem().Kind() {
+			return "string"
+		}
+		element := tsg.typeOf(t.Elem())
+		if strings.Contains(element, " ") {
+			element = "(" + element + ")"
+		}
+
+		return element + "[]"
+	case reflect.Map:
+		return "Record<string, " + tsg.typeOf(t.Elem()) + ">"
+	case reflect.Struct:
+		if reflect.TypeOf(time.Time{}) == t {
+			return "string"
+		}
+		if "" == t.Name() {
+			return tsg.fields(t, "")
+		}
+
+		return tsg.named(t)
+	default:
+		return "unknown"
+	}
+}
+
+// named 命名的结构体生成单独的接口
+func (tsg *typeScriptGenerator) named(t reflect.Type) string {
+	if name, ok := tsg.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if other, ok := tsg.used[name]; ok && other != t {
+		name = pascalCase(filepath.Base(t.PkgPath())) + name
+	}
+	tsg.names[t] = name
+	tsg.used[name] = t
+	// 先占位，递归引用时直接使用名字
+	tsg.order = append(tsg.order, t)
+	tsg.interfaces[t] = "export interface " + name + " " + tsg.fields(t, "") + "\n"
+
+	return name
+}
+
+func (tsg *typeScriptGenerator) fields(t reflect.Type, indent string) string {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	tsg.writeFields(&sb, t, indent+"  ")
+	sb.WriteString(indent + "}")
+
+	return sb.String()
+}
+
+func (tsg *typeScriptGenerator) writeFields(sb *strings.Builder, t reflect.Type, indent string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if "" != field.PkgPath {
+			continue
+		}
+		name, omit := jsonName(field)
+		if omit {
+			continue
+		}
+		// 匿名结构体的字段提升到上一层
+		if field.Anonymous && "" == field.Tag.Get("json") && reflect.Struct == indirectType(field.Type).Kind() {
+			tsg.writeFields(sb, indirectType(field.Type), indent)
+			continue
+		}
+
+		optional := "?"
+		if hasRule(field.Tag.Get("validate"), "required") {
+			optional = ""
+		}
+		if !validIdentifier(name) {
+			name = strconv.Quote(name)
+		}
+		sb.WriteString(fmt.Sprintf("%s%s%s: %s;\n", indent, name, optional, tsg.typeOf(field.Type)))
+	}
+}
+
+// schemaTypeScript 自定义类型按OpenAPI描述转换
+func schemaTypeScript(schema *Schema) (ts string) {
+	switch {
+	case 0 != len(schema.Enum):
+		values := make([]string, 0, len(schema.Enum))
+		for _, value := range schema.Enum {
+			encoded, _ := json.Marshal(value)
+			values = append(values, string(encoded))
+		}
+		sort.Strings(values)
+		ts = strings.Join(values, " | ")
+	case "integer" == schema.Type || "number" == schema.Type:
+		ts = "number"
+	case "boolean" == schema.Type:
+		ts = "boolean"
+	case "string" == schema.Type:
+		ts = "string"
+	case "array" == schema.Type && nil != schema.Items:
+		ts = schemaTypeScript(schema.Items) + "[]"
+	default:
+		ts = "unknown"
+	}
+	if schema.Nullable {
+		ts += " | null"
+	}
+
+	return
+}
+
+func validIdentifier(name string) bool {
+	for i, r := range name {
+		if !('_' == r || '$' == r || ('a' <= r && 'z' >= r) || ('A' <= r && 'Z' >= r) || (0 < i && '0' <= r && '9' >= r)) {
+			return false
+		}
+	}
+
+	return "" != name
+}
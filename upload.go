@@ -0,0 +1,202 @@
+package echox
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	// 注册图片格式，用于读取图片尺寸
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/random"
+)
+
+type (
+	// UploadSpec 上传文件的要求
+	UploadSpec struct {
+		// 表单字段
+		// 非必须 默认值是"file"
+		Field string
+
+		// 最大字节数
+		// 非必须 默认值是10M
+		MaxSize int64
+
+		// 允许的类型，按内容识别而不是扩展名，支持"image/*"这样的写法
+		// 非必须 为空时不限制
+		Types []string
+
+		// 图片尺寸限制，为0时不限制
+		MinWidth  int
+		MinHeight int
+		MaxWidth  int
+		MaxHeight int
+
+		// 文件存储
+		// 必须
+		Storage Storage
+
+		// 生成保存的文件名，可能和已有的文件相同，写入失败时不会删除
+		// 非必须 默认是随机字符串加扩展名
+		Key func(filename string, contentType string) string
+	}
+
+	// sizeLimitReader 超过大小时返回错误
+	sizeLimitReader struct {
+		reader io.Reader
+		remain int64
+	}
+)
+
+const (
+	defaultUploadField   = "file"
+	defaultUploadMaxSize = 10 << 20
+	// 读取图片尺寸时最多预读的字节数
+	imageHeaderSize = 64 << 10
+)
+
+var (
+	ErrUploadMissing   = echo.NewHTTPError(http.StatusBadRequest, "没有上传文件")
+	ErrUploadTooLarge  = echo.NewHTTPError(http.StatusRequestEntityTooLarge, "上传的文件太大")
+	ErrUploadType      = echo.NewHTTPError(http.StatusUnsupportedMediaType, "不支持的文件类型")
+	ErrUploadDimension = echo.NewHTTPError(http.StatusUnprocessableEntity, "图片尺寸不符合要求")
+)
+
+// BindUpload 读取上传的文件并直接写入存储，不会把整个文件读到内存中
+func BindUpload(c echo.Context, spec *UploadSpec) (object StoredObject, err error) {
+	if nil == spec.Storage {
+		panic("echo: upload requires a storage")
+	}
+	field := spec.Field
+	if "" == field {
+		field = defaultUploadField
+	}
+	maxSize := spec.MaxSize
+	if 0 >= maxSize {
+		maxSize = defaultUploadMaxSize
+	}
+
+	reader, err := c.Request().MultipartReader()
+	if nil != err {
+		err = ErrUploadMissing
+		return
+	}
+
+	for {
+		part, nextErr := reader.NextPart()
+		if io.EOF == nextErr {
+			err = ErrUploadMissing
+			return
+		}
+		if nil != nextErr {
+			err = echo.NewHTTPError(http.StatusBadRequest, nextErr.Error())
+			return
+		}
+		if field != part.FormName() || "" == part.FileName() {
+			_ = part.Close()
+			continue
+		}
+
+		object, err = store(c, spec, part.FileName(), part, maxSize)
+		_ = part.Close()
+
+		return
+	}
+}
+
+func store(c echo.Context, spec *UploadSpec, filename string, part io.Reader, maxSize int64) (object StoredObject, err error) {
+	buffered := bufio.NewReaderSize(&sizeLimitReader{reader: part, remain: maxSize}, imageHeaderSize)
+	head, peekErr := buffered.Peek(512)
+	if nil != peekErr && io.EOF != peekErr && bufio.ErrBufferFull != peekErr {
+		err = peekErr
+		return
+	}
+
+	contentType := http.DetectContentType(head)
+	if mediaType, _, parseErr := mime.ParseMediaType(contentType); nil == parseErr {
+		contentType = mediaType
+	}
+	if !allowedType(contentType, spec.Types) {
+		err = ErrUploadType
+		return
+	}
+
+	width, height := 0, 0
+	if strings.HasPrefix(contentType, "image/") && (0 < spec.MinWidth || 0 < spec.MinHeight || 0 < spec.MaxWidth || 0 < spec.MaxHeight) {
+		header, _ := buffered.Peek(imageHeaderSize)
+		config, _, decodeErr := image.DecodeConfig(bytes.NewReader(header))
+		if nil != decodeErr {
+			err = ErrUploadDimension
+			return
+		}
+		width, height = config.Width, config.Height
+		if width < spec.MinWidth || height < spec.MinHeight ||
+			(0 < spec.MaxWidth && width > spec.MaxWidth) || (0 < spec.MaxHeight && height > spec.MaxHeight) {
+			err = ErrUploadDimension
+			return
+		}
+	}
+
+	var key string
+	generated := nil == spec.Key
+	if generated {
+		key = random.String(32, random.Lowercase+random.Numeric) + strings.ToLower(path.Ext(filename))
+	} else {
+		key = spec.Key(filename, contentType)
+	}
+
+	if object, err = spec.Storage.Put(c.Request().Context(), key, buffered, -1, contentType); nil != err {
+		// 随机的文件名只可能是这次写入的，可以清理写了一半的文件
+		// 自定义的文件名可能是已有的文件，不能删除，由存储保证失败时不覆盖
+		if generated {
+			_ = spec.Storage.Delete(c.Request().Context(), key)
+		}
+		return
+	}
+	object.Filename = filename
+	object.Width = width
+	object.Height = height
+
+	return
+}
+
+func allowedType(contentType string, types []string) bool {
+	if 0 == len(types) {
+		return true
+	}
+
+	for _, allowed := range types {
+		if allowed == contentType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (slr *sizeLimitReader) Read(p []byte) (n int, err error) {
+	if 0 > slr.remain {
+		return 0, ErrUploadTooLarge
+	}
+	// 多读一个字节用于判断是否超过大小
+	if int64(len(p)) > slr.remain+1 {
+		p = p[:slr.remain+1]
+	}
+	n, err = slr.reader.Read(p)
+	slr.remain -= int64(n)
+	if 0 > slr.remain {
+		err = ErrUploadTooLarge
+	}
+
+	return
+}
@@ -0,0 +1,67 @@
+package echox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/labstack/echo/v4"
+)
+
+// failingStorage 读完内容后写入失败，记录删除了哪些文件
+type failingStorage struct {
+	deleted []string
+}
+
+func (fs *failingStorage) Put(_ context.Context, _ string, reader io.Reader, _ int64, _ string) (StoredObject, error) {
+	if _, err := io.Copy(ioutil.Discard, reader); nil != err {
+		return StoredObject{}, err
+	}
+
+	return StoredObject{}, errors.New("storage is unavailable")
+}
+
+func (fs *failingStorage) Open(_ context.Context, _ string) (io.ReadCloser, error) {
+	return nil, errors.New("not found")
+}
+
+func (fs *failingStorage) Delete(_ context.Context, key string) error {
+	fs.deleted = append(fs.deleted, key)
+
+	return nil
+}
+
+func TestUploadFailureOnlyCleansUpGeneratedKeys(t *testing.T) {
+	tests := map[string]struct {
+		key     func(string, string) string
+		content string
+		deleted bool
+	}{
+		"自定义的文件名不删除":      {key: func(string, string) string { return "avatars/7.txt" }, content: "hello", deleted: false},
+		"自定义的文件名超过大小也不删除": {key: func(string, string) string { return "avatars/7.txt" }, content: strings.Repeat("a", 1024), deleted: false},
+		"随机的文件名清理写了一半的文件": {content: "hello", deleted: true},
+		"随机的文件名超过大小也清理":   {content: strings.Repeat("a", 1024), deleted: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			storage := new(failingStorage)
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/upload", nil), httptest.NewRecorder())
+
+			spec := &UploadSpec{Storage: storage, Key: test.key}
+			// 逐字节读取，超过大小的错误发生在写入存储的时候
+			part := iotest.OneByteReader(strings.NewReader(test.content))
+			if _, err := store(c, spec, "7.txt", part, 600); nil == err {
+				t.Fatal("写入失败时应该返回错误")
+			}
+			if test.deleted != (1 == len(storage.deleted)) {
+				t.Fatalf("删除了%v", storage.deleted)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package echox
 
 import (
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/go-playground/locales/en"
@@ -11,32 +13,147 @@ import (
 	zhLang "github.com/go-playground/validator/v10/translations/zh"
 )
 
+// CodeValidation 验证错误的错误码，具体的规则使用ValidationCodes中的错误码
+const CodeValidation = 9901
+
 var (
 	v          *validator.Validate
 	translator *ut.UniversalTranslator
+
+	// ValidationCodes 验证规则对应的错误码，前端可以按错误码处理，不用解析翻译后的消息
+	// 没有配置的规则使用CodeValidation
+	ValidationCodes = map[string]int{
+		"type":     9902,
+		"required": 9903,
+		"min":      9904,
+		"max":      9905,
+		"len":      9906,
+		"email":    9907,
+		"url":      9908,
+		"oneof":    9909,
+		enumTag:    9910,
+		"gt":       9911,
+		"gte":      9912,
+		"lt":       9913,
+		"lte":      9914,
+	}
 )
 
-type customValidator struct {
-	validator *validator.Validate
-}
+type (
+	customValidator struct {
+		validator *validator.Validate
+	}
+
+	// FieldError 字段的验证错误
+	FieldError struct {
+		// 字段的路径，使用json标签，比如items[0].name
+		Field string `json:"field" xml:"field"`
+		// 验证规则，绑定失败时是type
+		Rule string `json:"rule" xml:"rule"`
+		// 规则的参数，比如min=3中的3
+		Param string `json:"param,omitempty" xml:"param,omitempty"`
+		// 翻译后的消息
+		Message string `json:"message" xml:"message"`
+		// 规则的错误码
+		Code int `json:"code" xml:"code"`
+	}
+)
+
+func (cv *customValidator) Validate(i interface{}) (err error) {
+	err = cv.validator.Struct(i)
+	if trace, ok := bindTraces.Load(i); ok {
+		trace.(*BindTrace).validated(i, err)
+	}
 
-func (cv *customValidator) Validate(i interface{}) error {
-	return cv.validator.Struct(i)
+	return
 }
 
 func initValidate() {
 	v = validator.New()
+	v.RegisterCustomTypeFunc(timeValue, Date{}, DateTime{}, Duration{})
+	v.RegisterValidation(enumTag, validateEnum)
+	v.RegisterTagNameFunc(fieldName)
 
 	translator = ut.New(en.New(), en.New(), zh.New())
 	if en, success := translator.GetTranslator("en"); success {
 		enLang.RegisterDefaultTranslations(v, en)
+		registerEnumTranslation(en, "{0} must be one of [{1}]")
 	}
 	if zh, success := translator.GetTranslator("zh"); success {
 		zhLang.RegisterDefaultTranslations(v, zh)
+		registerEnumTranslation(zh, "{0}必须是[{1}]中的一个")
+	}
+}
+
+// fieldName 错误中的字段名使用json标签
+func fieldName(field reflect.StructField) string {
+	name, _ := jsonName(field)
+
+	return name
+}
+
+// fieldErrors 把验证错误转换成稳定的字段错误列表
+func fieldErrors(lang string, errs validator.ValidationErrors) (fields []FieldError) {
+	t := translatorOf(lang)
+	fields = make([]FieldError, 0, len(errs))
+	for _, fe := range errs {
+		field := FieldError{
+			Field: fieldPath(fe.Namespace()),
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+			Code:  validationCode(fe.Tag()),
+		}
+		// v10.3.0的FieldError接口没有Error方法，具体的类型实现了error
+		if nil != t {
+			field.Message = fe.Translate(t)
+		} else if err, ok := fe.(error); ok {
+			field.Message = err.Error()
+		} else {
+			field.Message = fe.Tag()
+		}
+		fields = append(fields, field)
+	}
+
+	return
+}
+
+// bindFieldErrors 把绑定错误转换成和验证错误相同的格式
+func bindFieldErrors(errs BindErrors) (fields []FieldError) {
+	fields = make([]FieldError, 0, len(errs))
+	for field, message := range errs {
+		fields = append(fields, FieldError{
+			Field:   field,
+			Rule:    "type",
+			Message: message,
+			Code:    validationCode("type"),
+		})
 	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Field < fields[j].Field
+	})
+
+	return
 }
 
-func i18n(lang string, errs validator.ValidationErrors) (i18n validator.ValidationErrorsTranslations) {
+// fieldPath 去掉命名空间中最外层的结构体名
+func fieldPath(namespace string) string {
+	if index := strings.Index(namespace, "."); -1 != index {
+		return namespace[index+1:]
+	}
+
+	return namespace
+}
+
+func validationCode(rule string) int {
+	if code, ok := ValidationCodes[rule]; ok {
+		return code
+	}
+
+	return CodeValidation
+}
+
+// translatorOf 按语言查找翻译，找不到时使用中文
+func translatorOf(lang string) ut.Translator {
 	sep := "_"
 	if strings.Contains(lang, "-") {
 		sep = "-"
@@ -45,21 +162,17 @@ func i18n(lang string, errs validator.ValidationErrors) (i18n validator.Validati
 	splits := strings.Split(lang, sep)
 	for i := 0; i < len(splits); i++ {
 		if t, s := translator.FindTranslator(lang); s {
-			i18n = errs.Translate(t)
+			return t
+		}
+		if index := strings.LastIndex(lang, sep); -1 == index {
 			break
 		} else {
-			if index := strings.LastIndex(lang, sep); -1 == index {
-				break
-			} else {
-				lang = lang[0:index]
-			}
+			lang = lang[0:index]
 		}
 	}
-	if nil == i18n {
-		if t, s := translator.GetTranslator("zh"); s {
-			i18n = errs.Translate(t)
-		}
+	if t, s := translator.GetTranslator("zh"); s {
+		return t
 	}
 
-	return
+	return nil
 }
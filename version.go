@@ -0,0 +1,163 @@
+package echox
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderXAPIVersion = "X-API-Version"
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+
+	// VersionStrategyPath 版本在路径中，比如/v1/users
+	VersionStrategyPath = "path"
+	// VersionStrategyHeader 版本在请求头中，比如X-API-Version: v1
+	VersionStrategyHeader = "header"
+	// VersionStrategyAccept 版本在Accept请求头中，比如application/vnd.example.v1+json
+	VersionStrategyAccept = "accept"
+)
+
+type (
+	// VersionConfig 接口版本的配置
+	VersionConfig struct {
+		// 选择版本的方式
+		// 非必须 默认值是VersionStrategyPath
+		// 使用请求头时，也可以直接通过路径访问
+		Strategy string
+
+		// 版本请求头
+		// 非必须 默认值是"X-API-Version"
+		Header string
+
+		// Accept中的厂商名，比如application/vnd.example.v1+json中的example
+		Vendor string
+
+		// 客户端没有指定版本时使用的版本
+		Default string
+
+		// 已经废弃的版本
+		Deprecated map[string]Deprecation
+	}
+
+	// Deprecation 废弃版本的信息
+	Deprecation struct {
+		// 废弃的时间
+		// 非必须 为空时Deprecation响应头为true
+		Since time.Time
+
+		// 停止服务的时间
+		Sunset time.Time
+
+		// 迁移文档的地址
+		Link string
+	}
+)
+
+var (
+	// DefaultVersionConfig 默认配置
+	DefaultVersionConfig = VersionConfig{
+		Strategy: VersionStrategyPath,
+		Header:   HeaderXAPIVersion,
+	}
+)
+
+// mountVersions 把每个版本的路由挂载到自己的路径下
+func mountVersions(e *echo.Echo, ec *EchoConfig) {
+	config := DefaultVersionConfig
+	if nil != ec.Versioning {
+		config = *ec.Versioning
+	}
+	if "" == config.Strategy {
+		config.Strategy = DefaultVersionConfig.Strategy
+	}
+	if "" == config.Header {
+		config.Header = DefaultVersionConfig.Header
+	}
+
+	for version, routes := range ec.Versions {
+		var middlewares []echo.MiddlewareFunc
+		if deprecation, ok := config.Deprecated[version]; ok {
+			middlewares = append(middlewares, deprecation.middleware)
+		}
+
+		mountRoutes(e, e.Group(ec.BasePath+"/"+version, middlewares...), routes)
+	}
+
+	if VersionStrategyPath != config.Strategy {
+		e.Pre(config.rewrite(ec.BasePath, ec.Versions))
+	}
+}
+
+// rewrite 把请求头中的版本改写到路径中，这样所有策略都使用同一套路由
+func (vc *VersionConfig) rewrite(basePath string, versions map[string][]RouteFunc) echo.MiddlewareFunc {
+	accept := regexp.MustCompile(`application/vnd\.` + regexp.QuoteMeta(vc.Vendor) + `\.([^+;,\s]+)`)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !strings.HasPrefix(req.URL.Path, basePath) {
+				return next(c)
+			}
+			rest := strings.TrimPrefix(req.URL.Path, basePath)
+			for version := range versions {
+				if rest == "/"+version || strings.HasPrefix(rest, "/"+version+"/") {
+					return next(c)
+				}
+			}
+
+			version := ""
+			switch vc.Strategy {
+			case VersionStrategyHeader:
+				version = req.Header.Get(vc.Header)
+			case VersionStrategyAccept:
+				if matches := accept.FindStringSubmatch(req.Header.Get(echo.HeaderAccept)); nil != matches {
+					version = matches[1]
+				}
+			}
+			if "" == version {
+				version = vc.Default
+			}
+			if _, ok := versions[version]; !ok {
+				if "" == version {
+					return next(c)
+				}
+
+				return echo.NewHTTPError(http.StatusNotAcceptable, "不支持的接口版本："+version)
+			}
+
+			req.URL.Path = basePath + "/" + version + rest
+			if "" != req.URL.RawPath {
+				req.URL.RawPath = basePath + "/" + version + strings.TrimPrefix(req.URL.RawPath, basePath)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// middleware 在废弃版本的响应中加上Deprecation和Sunset响应头
+func (d Deprecation) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	deprecation := "true"
+	if !d.Since.IsZero() {
+		deprecation = d.Since.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c echo.Context) error {
+		header := c.Response().Header()
+		header.Set(HeaderDeprecation, deprecation)
+		if !d.Sunset.IsZero() {
+			header.Set(HeaderSunset, d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if "" != d.Link {
+			header.Add(HeaderLink, "<"+d.Link+`>; rel="deprecation"`)
+		}
+
+		return next(c)
+	}
+}
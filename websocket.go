@@ -0,0 +1,340 @@
+package echox
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// WSCloseGoingAway 服务退出时的关闭码
+	WSCloseGoingAway = 1001
+	// WSClosePolicyViolation 消息太频繁时的关闭码
+	WSClosePolicyViolation = 1008
+	// WSCloseMessageTooBig 消息太大时的关闭码
+	WSCloseMessageTooBig = 1009
+
+	// WebSocket指标的事件
+	WSEventConnected   = "connected"
+	WSEventClosed      = "closed"
+	WSEventRejected    = "rejected"
+	WSEventRateLimited = "rate_limited"
+	WSEventTooLarge    = "too_large"
+
+	// maxCloseReason 关闭帧的内容最多125字节，去掉2字节的关闭码
+	maxCloseReason = 123
+)
+
+type (
+	// WebSocketConfig WebSocket的配置
+	WebSocketConfig struct {
+		// 检查Origin，防止跨站的WebSocket劫持
+		// 非必须 默认允许没有Origin或者和Host相同的请求
+		CheckOrigin func(req *http.Request) bool
+
+		// 单个消息的最大字节数，超过时以1009关闭连接
+		// 非必须 默认值是1MB
+		MaxMessageSize int
+
+		// 每个连接每秒允许接收的消息数，超过时以1008关闭连接
+		// 非必须 默认不限制
+		MessageRate float64
+
+		// 允许突发的消息数
+		// 非必须 默认值和MessageRate相同
+		MessageBurst int
+
+		// 每个用户最多同时建立的连接数，所有WebSocket处理器一起计数，超过时拒绝握手
+		// 非必须 默认不限制
+		MaxConnections int
+
+		// 连接数限制的维度
+		// 非必须 默认是登录的用户，没有登录时是客户端IP
+		PrincipalFunc func(c echo.Context) string
+
+		// 连接和限制的指标
+		// 非必须 默认使用服务端的指标记录器
+		Recorder WebSocketRecorder
+	}
+
+	// WebSocketRecorder 记录WebSocket的指标，event是WSEventXxx
+	WebSocketRecorder interface {
+		ObserveWebSocket(route string, event string)
+	}
+
+	// WSConn WebSocket连接，写入是并发安全的，接收不是
+	WSConn struct {
+		id      string
+		ws      *websocket.Conn
+		mutex   sync.Mutex
+		closed  bool
+		closing chan struct{}
+
+		route    string
+		rate     float64
+		burst    int
+		bucket   *tokenBucket
+		recorder WebSocketRecorder
+	}
+
+	// wsPrincipalCounter 每个用户的连接数
+	wsPrincipalCounter struct {
+		mutex  sync.Mutex
+		counts map[string]int
+	}
+
+	// WebSocketHandler 处理WebSocket连接，返回时关闭连接
+	WebSocketHandler func(c echo.Context, conn *WSConn) error
+)
+
+var (
+	// DefaultWebSocketConfig 默认配置
+	DefaultWebSocketConfig = WebSocketConfig{
+		CheckOrigin:    sameOrigin,
+		MaxMessageSize: 1 << 20,
+		PrincipalFunc: func(c echo.Context) string {
+			if id := userIdOf(c); "" != id {
+				return id
+			}
+
+			return c.RealIP()
+		},
+	}
+
+	// ErrForbiddenOrigin 不允许的Origin
+	ErrForbiddenOrigin = echo.NewHTTPError(http.StatusForbidden, "不允许的来源")
+	// ErrTooManyConnections 用户的连接数超过限制
+	ErrTooManyConnections = echo.NewHTTPError(http.StatusTooManyRequests, "连接数太多")
+	// ErrWSRateLimited 消息太频繁，连接已经关闭
+	ErrWSRateLimited = errors.New("消息太频繁")
+
+	wsPrincipals = &wsPrincipalCounter{counts: make(map[string]int)}
+)
+
+// WebSocket 创建WebSocket处理器
+// 服务退出时向客户端发送1001关闭帧，处理器应该在Closing()后尽快返回
+func WebSocket(handler WebSocketHandler) echo.HandlerFunc {
+	return WebSocketWithConfig(DefaultWebSocketConfig, handler)
+}
+
+// WebSocketWithConfig 创建WebSocket处理器
+func WebSocketWithConfig(config WebSocketConfig, handler WebSocketHandler) echo.HandlerFunc {
+	if nil == config.CheckOrigin {
+		config.CheckOrigin = DefaultWebSocketConfig.CheckOrigin
+	}
+	if 0 >= config.MaxMessageSize {
+		config.MaxMessageSize = DefaultWebSocketConfig.MaxMessageSize
+	}
+	if 0 < config.MessageRate && 0 >= config.MessageBurst {
+		config.MessageBurst = int(math.Ceil(config.MessageRate))
+	}
+	if nil == config.PrincipalFunc {
+		config.PrincipalFunc = DefaultWebSocketConfig.PrincipalFunc
+	}
+
+	return func(c echo.Context) (err error) {
+		recorder := config.Recorder
+		if nil == recorder {
+			recorder, _ = metricsRecorder.(WebSocketRecorder)
+		}
+		observe := func(event string) {
+			if nil != recorder {
+				recorder.ObserveWebSocket(c.Path(), event)
+			}
+		}
+
+		if !config.CheckOrigin(c.Request()) {
+			return ErrForbiddenOrigin
+		}
+
+		if streams.stopped() {
+			return ErrStreamClosing
+		}
+
+		if 0 < config.MaxConnections {
+			principal := config.PrincipalFunc(c)
+			if !wsPrincipals.acquire(principal, config.MaxConnections) {
+				observe(WSEventRejected)
+
+				return ErrTooManyConnections
+			}
+			defer wsPrincipals.release(principal)
+		}
+
+		server := websocket.Server{
+			// Origin已经检查过了
+			Handshake: func(*websocket.Config, *http.Request) error {
+				return nil
+			},
+			Handler: func(ws *websocket.Conn) {
+				ws.MaxPayloadBytes = config.MaxMessageSize
+				conn := &WSConn{
+					id:       randomHex(8),
+					ws:       ws,
+					closing:  make(chan struct{}),
+					route:    c.Path(),
+					rate:     config.MessageRate,
+					burst:    config.MessageBurst,
+					recorder: recorder,
+				}
+				if 0 < conn.rate {
+					conn.bucket = &tokenBucket{tokens: float64(conn.burst), last: time.Now()}
+				}
+				s := &stream{
+					notify: func(config StreamConfig) {
+						close(conn.closing)
+						if closeErr := conn.CloseWith(WSCloseGoingAway, config.Reason); nil != closeErr {
+							c.Logger().Debug(closeErr)
+						}
+					},
+					close: func() {
+						_ = ws.Close()
+					},
+				}
+				// 握手期间开始退出
+				if !streams.add(s) {
+					_ = conn.CloseWith(WSCloseGoingAway, DefaultStreamConfig.Reason)
+					return
+				}
+				defer streams.remove(s)
+				observe(WSEventConnected)
+				defer observe(WSEventClosed)
+
+				err = handler(c, conn)
+			},
+		}
+		server.ServeHTTP(c.Response(), c.Request())
+
+		return
+	}
+}
+
+// Send 发送消息，字符串按文本帧发送，[]byte按二进制帧发送，其它按JSON发送
+func (wc *WSConn) Send(v interface{}) error {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+
+	switch v.(type) {
+	case string, []byte:
+		return websocket.Message.Send(wc.ws, v)
+	default:
+		return websocket.JSON.Send(wc.ws, v)
+	}
+}
+
+// Receive 接收消息，v是*string或者*[]byte时接收原始消息，其它按JSON解析
+// 消息太大或者太频繁时关闭连接并返回错误
+func (wc *WSConn) Receive(v interface{}) (err error) {
+	switch v.(type) {
+	case *string, *[]byte:
+		err = websocket.Message.Receive(wc.ws, v)
+	default:
+		err = websocket.JSON.Receive(wc.ws, v)
+	}
+
+	switch {
+	case errors.Is(err, websocket.ErrFrameTooLarge):
+		wc.observe(WSEventTooLarge)
+		_ = wc.CloseWith(WSCloseMessageTooBig, "message too big")
+	case nil == err && nil != wc.bucket && !wc.bucket.take(time.Now(), wc.rate, wc.burst):
+		wc.observe(WSEventRateLimited)
+		_ = wc.CloseWith(WSClosePolicyViolation, "rate limited")
+		err = ErrWSRateLimited
+	}
+
+	return
+}
+
+// CloseWith 发送带关闭码和原因的关闭帧，客户端收到后会断开连接
+func (wc *WSConn) CloseWith(code int, reason string) (err error) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+
+	if wc.closed {
+		return
+	}
+	wc.closed = true
+
+	if len(reason) > maxCloseReason {
+		reason = reason[:maxCloseReason]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	writer, err := wc.ws.NewFrameWriter(websocket.CloseFrame)
+	if nil != err {
+		return
+	}
+	if _, err = writer.Write(payload); nil != err {
+		return
+	}
+
+	return writer.Close()
+}
+
+// Closing 服务退出时关闭
+func (wc *WSConn) Closing() <-chan struct{} {
+	return wc.closing
+}
+
+// Id 连接的编号
+func (wc *WSConn) Id() string {
+	return wc.id
+}
+
+// Request 建立连接的请求
+func (wc *WSConn) Request() *http.Request {
+	return wc.ws.Request()
+}
+
+// Conn 原始的连接，直接写入时不能和Send并发
+func (wc *WSConn) Conn() *websocket.Conn {
+	return wc.ws
+}
+
+func (wc *WSConn) observe(event string) {
+	if nil != wc.recorder {
+		wc.recorder.ObserveWebSocket(wc.route, event)
+	}
+}
+
+// acquire 占用一个连接，超过限制时返回false
+func (wpc *wsPrincipalCounter) acquire(principal string, max int) bool {
+	wpc.mutex.Lock()
+	defer wpc.mutex.Unlock()
+
+	if wpc.counts[principal] >= max {
+		return false
+	}
+	wpc.counts[principal]++
+
+	return true
+}
+
+func (wpc *wsPrincipalCounter) release(principal string) {
+	wpc.mutex.Lock()
+	defer wpc.mutex.Unlock()
+
+	if wpc.counts[principal]--; 0 >= wpc.counts[principal] {
+		delete(wpc.counts, principal)
+	}
+}
+
+// sameOrigin 没有Origin（非浏览器客户端）或者Origin和Host相同
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get(echo.HeaderOrigin)
+	if "" == origin {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+
+	return nil == err && parsed.Host == req.Host
+}
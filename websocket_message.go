@@ -0,0 +1,280 @@
+package echox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// WSCloseUnsupportedData 收到不认识的消息时的关闭码
+	WSCloseUnsupportedData = 1003
+
+	// wsEnvelopeHeader 信封头是2字节大端序的消息类型
+	wsEnvelopeHeader = 2
+)
+
+type (
+	// WSCodec 消息体的编码方式
+	WSCodec interface {
+		Name() string
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+
+	// WSMessageHandler 处理收到的消息，返回错误时关闭连接
+	WSMessageHandler[T any] func(c echo.Context, conn *WSConn, message *T) error
+
+	// WSRegistry 二进制WebSocket协议的消息注册表
+	// 每个消息是一个二进制帧：2字节大端序的消息类型加上编码后的消息体
+	WSRegistry struct {
+		codec WSCodec
+		mutex sync.RWMutex
+		ids   map[uint16]*wsMessageType
+		types map[reflect.Type]*wsMessageType
+	}
+
+	// WSSchema 给客户端的消息定义
+	WSSchema struct {
+		Codec    string            `json:"codec"`
+		Envelope string            `json:"envelope"`
+		Messages []WSMessageSchema `json:"messages"`
+	}
+
+	// WSMessageSchema 单个消息的定义
+	WSMessageSchema struct {
+		Id      uint16  `json:"id"`
+		Name    string  `json:"name"`
+		Inbound bool    `json:"inbound"`
+		Schema  *Schema `json:"schema"`
+	}
+
+	wsMessageType struct {
+		id      uint16
+		name    string
+		typ     reflect.Type
+		handler func(c echo.Context, conn *WSConn, message interface{}) error
+	}
+
+	msgpackCodec struct{}
+
+	protobufCodec struct{}
+
+	// protoMessage gogo和其它生成Marshal、Unmarshal方法的protobuf消息
+	protoMessage interface {
+		Marshal() ([]byte, error)
+		Unmarshal(data []byte) error
+	}
+)
+
+var (
+	// MsgpackCodec 按MessagePack编码，字段名和JSON一致
+	MsgpackCodec WSCodec = msgpackCodec{}
+
+	// ProtobufCodec 按protobuf编码，消息需要实现Marshal() ([]byte, error)和Unmarshal([]byte) error
+	ProtobufCodec WSCodec = protobufCodec{}
+
+	// ErrWSUnknownMessage 收到没有注册的消息类型
+	ErrWSUnknownMessage = errors.New("不认识的消息类型")
+)
+
+// NewWSRegistry 创建消息注册表
+func NewWSRegistry(codec WSCodec) *WSRegistry {
+	if nil == codec {
+		panic("echo: websocket registry requires a codec")
+	}
+
+	return &WSRegistry{
+		codec: codec,
+		ids:   make(map[uint16]*wsMessageType),
+		types: make(map[reflect.Type]*wsMessageType),
+	}
+}
+
+// RegisterWSMessage 注册消息类型，handler为空表示只由服务端发送
+func RegisterWSMessage[T any](registry *WSRegistry, id uint16, name string, handler WSMessageHandler[T]) {
+	if !validIdentifier(name) {
+		panic("echo: websocket message name must be an identifier: " + name)
+	}
+	mt := &wsMessageType{id: id, name: name, typ: reflect.TypeOf((*T)(nil)).Elem()}
+	if nil != handler {
+		mt.handler = func(c echo.Context, conn *WSConn, message interface{}) error {
+			return handler(c, conn, message.(*T))
+		}
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, ok := registry.ids[id]; ok {
+		panic(fmt.Sprintf("echo: websocket message id is duplicated: %d", id))
+	}
+	if _, ok := registry.types[mt.typ]; ok {
+		panic("echo: websocket message type is duplicated: " + mt.typ.String())
+	}
+	registry.ids[id] = mt
+	registry.types[mt.typ] = mt
+}
+
+// Handler 接收消息并分发到注册的处理器，可以直接传给WebSocket
+func (wr *WSRegistry) Handler() WebSocketHandler {
+	return func(c echo.Context, conn *WSConn) error {
+		for {
+			message, mt, err := wr.receive(conn)
+			if nil != err {
+				return err
+			}
+			if nil == mt.handler {
+				_ = conn.CloseWith(WSCloseUnsupportedData, "unexpected message "+mt.name)
+
+				return fmt.Errorf("%w：%s", ErrWSUnknownMessage, mt.name)
+			}
+			if err = mt.handler(c, conn, message); nil != err {
+				return err
+			}
+		}
+	}
+}
+
+// Send 按注册的类型发送消息，message是注册的类型或者它的指针
+func (wr *WSRegistry) Send(conn *WSConn, message interface{}) (err error) {
+	typ := reflect.TypeOf(message)
+	if nil != typ && reflect.Ptr == typ.Kind() {
+		typ = typ.Elem()
+	}
+	wr.mutex.RLock()
+	mt, ok := wr.types[typ]
+	wr.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w：%v", ErrWSUnknownMessage, typ)
+	}
+
+	var body []byte
+	if body, err = wr.codec.Marshal(message); nil != err {
+		return
+	}
+	frame := make([]byte, wsEnvelopeHeader, wsEnvelopeHeader+len(body))
+	binary.BigEndian.PutUint16(frame, mt.id)
+
+	return conn.Send(append(frame, body...))
+}
+
+// Receive 接收一个消息并按类型解码，返回注册类型的指针，不认识的类型以1003关闭连接
+func (wr *WSRegistry) Receive(conn *WSConn) (message interface{}, err error) {
+	message, _, err = wr.receive(conn)
+
+	return
+}
+
+func (wr *WSRegistry) receive(conn *WSConn) (message interface{}, mt *wsMessageType, err error) {
+	var frame []byte
+	if err = conn.Receive(&frame); nil != err {
+		return
+	}
+	if len(frame) < wsEnvelopeHeader {
+		_ = conn.CloseWith(WSCloseUnsupportedData, "invalid envelope")
+		err = ErrWSUnknownMessage
+
+		return
+	}
+
+	id := binary.BigEndian.Uint16(frame)
+	wr.mutex.RLock()
+	mt, ok := wr.ids[id]
+	wr.mutex.RUnlock()
+	if !ok {
+		_ = conn.CloseWith(WSCloseUnsupportedData, fmt.Sprintf("unknown message %d", id))
+		err = fmt.Errorf("%w：%d", ErrWSUnknownMessage, id)
+
+		return
+	}
+
+	message = reflect.New(mt.typ).Interface()
+	err = wr.codec.Unmarshal(frame[wsEnvelopeHeader:], message)
+
+	return
+}
+
+// Schema 导出消息定义，客户端按它生成代码
+func (wr *WSRegistry) Schema() (schema WSSchema) {
+	wr.mutex.RLock()
+	defer wr.mutex.RUnlock()
+
+	schema.Codec = wr.codec.Name()
+	schema.Envelope = "uint16 big-endian message id + body"
+	for _, mt := range wr.ids {
+		schema.Messages = append(schema.Messages, WSMessageSchema{
+			Id:      mt.id,
+			Name:    mt.name,
+			Inbound: nil != mt.handler,
+			Schema:  SchemaOf(mt.typ),
+		})
+	}
+	sort.Slice(schema.Messages, func(i, j int) bool {
+		return schema.Messages[i].Id < schema.Messages[j].Id
+	})
+
+	return
+}
+
+// TypeScript 导出消息的TypeScript类型和消息类型的枚举
+func (wr *WSRegistry) TypeScript() string {
+	schema := wr.Schema()
+
+	wr.mutex.RLock()
+	types := make([]interface{}, 0, len(schema.Messages))
+	for _, message := range schema.Messages {
+		types = append(types, reflect.Zero(wr.ids[message.Id].typ).Interface())
+	}
+	wr.mutex.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString(TypeScriptTypes(types...))
+	sb.WriteString("\nexport enum MessageType {\n")
+	for _, message := range schema.Messages {
+		sb.WriteString(fmt.Sprintf("  %s = %d,\n", message.Name, message.Id))
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func (mc msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (mc msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return MarshalMsgpack(v)
+}
+
+func (mc msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalMsgpack(data, v)
+}
+
+func (pc protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (pc protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(protoMessage)
+	if !ok {
+		return nil, fmt.Errorf("不是protobuf消息：%T", v)
+	}
+
+	return message.Marshal()
+}
+
+func (pc protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(protoMessage)
+	if !ok {
+		return fmt.Errorf("不是protobuf消息：%T", v)
+	}
+
+	return message.Unmarshal(data)
+}
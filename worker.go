@@ -0,0 +1,159 @@
+package echox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// Worker 后台任务，和服务一起启动，优雅退出时取消
+	Worker struct {
+		// 名称
+		// 必须
+		Name string
+
+		// 执行任务，ctx被取消时应该尽快返回
+		// 必须
+		Run func(ctx context.Context) error
+
+		// 执行间隔，为0时只执行一次（适合常驻的任务）
+		Interval time.Duration
+	}
+
+	// WorkerStatus 后台任务的状态
+	WorkerStatus struct {
+		Name      string    `json:"name"`
+		Running   bool      `json:"running"`
+		Runs      int64     `json:"runs"`
+		Failures  int64     `json:"failures"`
+		LastRun   time.Time `json:"lastRun,omitempty"`
+		LastError string    `json:"lastError,omitempty"`
+	}
+
+	workerGroup struct {
+		cancel context.CancelFunc
+		wait   sync.WaitGroup
+	}
+)
+
+var (
+	workerMutex    sync.RWMutex
+	workerStatuses = make(map[string]*WorkerStatus)
+)
+
+// Workers 所有后台任务的状态
+func Workers() (statuses []WorkerStatus) {
+	workerMutex.RLock()
+	defer workerMutex.RUnlock()
+
+	statuses = make([]WorkerStatus, 0, len(workerStatuses))
+	for _, status := range workerStatuses {
+		statuses = append(statuses, *status)
+	}
+
+	return
+}
+
+// startWorkers 启动所有后台任务
+func startWorkers(e *echo.Echo, workers []Worker) *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	group := &workerGroup{cancel: cancel}
+
+	for _, worker := range workers {
+		if "" == worker.Name {
+			panic("echo: worker requires a name")
+		}
+		if nil == worker.Run {
+			panic("echo: worker requires a run function")
+		}
+
+		workerMutex.Lock()
+		workerStatuses[worker.Name] = &WorkerStatus{Name: worker.Name}
+		workerMutex.Unlock()
+
+		group.wait.Add(1)
+		go func(worker Worker) {
+			defer group.wait.Done()
+			worker.loop(ctx, e)
+		}(worker)
+	}
+
+	return group
+}
+
+// stop 取消后台任务并等待退出，超时后不再等待
+func (wg *workerGroup) stop(timeout time.Duration) {
+	wg.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.wait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (w Worker) loop(ctx context.Context, e *echo.Echo) {
+	if 0 >= w.Interval {
+		w.execute(ctx, e)
+		return
+	}
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		w.execute(ctx, e)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w Worker) execute(ctx context.Context, e *echo.Echo) {
+	update := func(fn func(status *WorkerStatus)) {
+		workerMutex.Lock()
+		defer workerMutex.Unlock()
+
+		fn(workerStatuses[w.Name])
+	}
+	update(func(status *WorkerStatus) {
+		status.Running = true
+		status.LastRun = time.Now()
+	})
+
+	err := w.safeRun(ctx)
+	update(func(status *WorkerStatus) {
+		status.Running = false
+		status.Runs++
+		status.LastError = ""
+		if nil != err {
+			status.Failures++
+			status.LastError = err.Error()
+		}
+	})
+	if nil != err && nil == ctx.Err() {
+		e.Logger.Errorf("后台任务%s执行出错：%v", w.Name, err)
+	}
+}
+
+// safeRun 任务崩溃时不影响服务
+func (w Worker) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("崩溃：%v", r)
+		}
+	}()
+
+	return w.Run(ctx)
+}